@@ -4,7 +4,12 @@
 // Implementing a backend requires implementing both the BooleanQuery interface and the Compiler interface.
 package backend
 
-import "github.com/hscells/transmute/ir"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hscells/transmute/ir"
+)
 
 // BooleanQuery is an interface for handling the queries in a query language. The most important method is String(),
 // which will output an appropriate query suitable for a search engine.
@@ -20,3 +25,17 @@ type Compiler interface {
 	// is the reason both the backend and query interfaces must be implemented for this package.
 	Compile(ir ir.BooleanQuery) (BooleanQuery, error)
 }
+
+// adjacencyOperator is the operator of a group with the distance of the group (ir.DistanceOption) in place of the
+// distance of the operator, e.g. `adj3` for an `adj` group with a distance of 3. The distance of 1 is the bare `adj`.
+// The operator of any other group is returned as is.
+func adjacencyOperator(q ir.BooleanQuery) string {
+	distance, ok := q.Options[ir.DistanceOption].(int)
+	if !ok || distance < 1 || !strings.HasPrefix(strings.ToLower(q.Operator), "adj") {
+		return q.Operator
+	}
+	if distance == 1 {
+		return "adj"
+	}
+	return fmt.Sprintf("adj%d", distance)
+}
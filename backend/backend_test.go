@@ -0,0 +1,203 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/hscells/transmute/fields"
+	"github.com/hscells/transmute/ir"
+)
+
+func TestCompile_PushNegationDown(t *testing.T) {
+	title := func(s string) ir.Keyword {
+		return ir.Keyword{QueryString: s, Fields: []string{fields.Title}}
+	}
+	child := ir.BooleanQuery{Operator: "and", Keywords: []ir.Keyword{title("child"), title("infant")}}
+
+	// asthma NOT (child OR infant) = asthma NOT child NOT infant
+	excluded := ir.BooleanQuery{
+		Operator: "not",
+		Children: []ir.BooleanQuery{{Keywords: []ir.Keyword{title("asthma")}}, {Operator: "or", Keywords: child.Keywords}},
+	}.PushNegationDown()
+	// asthma OR NOT (child AND infant) = asthma OR NOT child OR NOT infant
+	negated := ir.BooleanQuery{
+		Operator: "or",
+		Children: []ir.BooleanQuery{{Operator: "not", Children: []ir.BooleanQuery{child}}},
+		Keywords: []ir.Keyword{title("asthma")},
+	}.PushNegationDown()
+
+	for _, q := range []ir.BooleanQuery{excluded, negated} {
+		if problems := q.Validate(); len(problems) != 0 {
+			t.Fatalf("Expected no problems with %v, got %v", q, problems)
+		}
+	}
+
+	for _, c := range []struct {
+		compiler Compiler
+		query    ir.BooleanQuery
+		expected string
+	}{
+		{NewPubmedBackend(), excluded, "(asthma[Title] NOT child[Title] NOT infant[Title])"},
+		{NewMedlineBackend(), excluded, "1. asthma.ti.\n2. child.ti.\n3. infant.ti.\n4. 1 not 2 not 3\n"},
+		{NewProQuestBackend(), excluded, "TI(asthma) NOT TI(child) NOT TI(infant)"},
+		{NewWebSearchBackend(), excluded, "intitle:asthma -intitle:child -intitle:infant"},
+		{NewPubmedBackend(), negated, "((all[sb] NOT child[Title]) OR (all[sb] NOT infant[Title]) OR asthma[Title])"},
+		{NewProQuestBackend(), negated, "(NOT TI(child)) OR (NOT TI(infant)) OR TI(asthma)"},
+		{NewWebSearchBackend(), negated, "-intitle:child OR -intitle:infant OR intitle:asthma"},
+		{
+			NewElasticsearchCompiler(), negated,
+			`{"query":{"constant_score":{"filter":{"bool":{"disable_coord":true,"should":[{"match":{"title":"asthma"}},{"bool":{"disable_coord":true,"must_not":[{"match":{"title":"child"}}]}},{"bool":{"disable_coord":true,"must_not":[{"match":{"title":"infant"}}]}}]}}}}}`,
+		},
+	} {
+		b, err := c.compiler.Compile(c.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := b.String()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.expected {
+			t.Fatalf("Expected %v, got %v", c.expected, got)
+		}
+	}
+
+	// A Medline line cannot be negated without a line to exclude it from.
+	if _, err := NewMedlineBackend().Compile(negated); err == nil {
+		t.Fatalf("Expected an error compiling %v", negated)
+	}
+
+	// The negated operands are not flattened away by CQR.
+	c, err := CommonQueryRepresentationBackend{FlattenSingle: true}.Compile(negated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.String()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"operator":"or","children":[{"operator":"not","children":[{"query":"child","fields":["title"],"options":{"exploded":false,"truncated":false}}],"options":{}},{"operator":"not","children":[{"query":"infant","fields":["title"],"options":{"exploded":false,"truncated":false}}],"options":{}},{"query":"asthma","fields":["title"],"options":{"exploded":false,"truncated":false}}],"options":{}}`; got != expected {
+		t.Fatalf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestCompile_Exists(t *testing.T) {
+	exists := func(field string) ir.Keyword {
+		return ir.Keyword{Fields: []string{field}, Options: map[string]interface{}{ir.ExistsOption: true}}
+	}
+	asthma := ir.Keyword{QueryString: "asthma", Fields: []string{fields.Title}}
+	abstract := ir.BooleanQuery{Operator: "and", Keywords: []ir.Keyword{asthma, exists(fields.Abstract)}}
+	journal := ir.BooleanQuery{Operator: "and", Keywords: []ir.Keyword{asthma, exists(fields.Journal)}}
+
+	for _, c := range []struct {
+		compiler Compiler
+		expected string
+	}{
+		{NewPubmedBackend(), "(asthma[Title] AND hasabstract)"},
+		{NewPubMedHistoryBackend(), `[{"number":1,"query":"asthma[Title]","translation":"asthma[Title]"},{"number":2,"query":"hasabstract","translation":"hasabstract"},{"number":3,"query":"#1 AND #2","translation":"(asthma[Title] AND hasabstract)"}]`},
+	} {
+		b, err := c.compiler.Compile(abstract)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := b.String()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.expected {
+			t.Fatalf("Expected %v, got %v", c.expected, got)
+		}
+	}
+
+	// The presence of a field is never searched in place of a keyword, so a field which cannot be searched is an error.
+	for _, c := range []struct {
+		compiler Compiler
+		query    ir.BooleanQuery
+	}{
+		{NewPubmedBackend(), journal},
+		{NewPubMedHistoryBackend(), journal},
+		{NewMedlineBackend(), abstract},
+		{NewProQuestBackend(), abstract},
+	} {
+		if _, err := c.compiler.Compile(c.query); err == nil {
+			t.Fatalf("Expected an error compiling %v with %T", c.query, c.compiler)
+		}
+	}
+}
+
+func TestCompile_Distance(t *testing.T) {
+	// The distance of a bare `adj` is given by the options of the group.
+	q := ir.BooleanQuery{
+		Operator: "adj",
+		Keywords: []ir.Keyword{{QueryString: "asthma", Fields: []string{fields.Title}}, {QueryString: "wheeze", Fields: []string{fields.Title}}},
+		Options:  map[string]interface{}{ir.DistanceOption: 5},
+	}
+
+	for _, c := range []struct {
+		compiler Compiler
+		expected string
+	}{
+		{NewMedlineBackend(), "1. asthma.ti.\n2. wheeze.ti.\n3. 1 adj5 2\n"},
+		{NewProQuestBackend(), "TI(asthma) NEAR/4 TI(wheeze)"},
+		{NewElasticsearchCompiler(), `{"query":{"constant_score":{"filter":{"bool":{"should":[{"span_near":{"clauses":[{"span_multi":{"match":{"prefix":{"title":"asthma"}}}},{"span_multi":{"match":{"prefix":{"title":"wheeze"}}}}],"in_order":false,"slop":5}}]}}}}}`},
+	} {
+		b, err := c.compiler.Compile(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := b.String()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.expected {
+			t.Fatalf("Expected %v, got %v", c.expected, got)
+		}
+	}
+
+	// PubMed has no adjacency, so the distance is lost.
+	warnings := Validate(NewPubmedBackend(), q)
+	if expected := "adjacency is not supported, so `adj5` is searched with `and`"; len(warnings) != 1 || warnings[0].String() != expected {
+		t.Fatalf("Expected %v, got %v", expected, warnings)
+	}
+}
+
+func TestCompile_PubMedWildcards(t *testing.T) {
+	title := func(s string) ir.Keyword {
+		return ir.Keyword{QueryString: s, Fields: []string{fields.Title}, Truncated: true}
+	}
+
+	// PubMed only truncates the end of a term, so an optional wildcard searches the spelling without the character, or
+	// the known spellings of the keyword.
+	for _, c := range []struct {
+		compiler Compiler
+		keyword  ir.Keyword
+		expected string
+	}{
+		{NewPubmedBackend(), title("colo?r"), "(color[Title])"},
+		{NewPubmedBackend(), title("p?ediatric*"), "(pediatric*[Title])"},
+		{NewPubmedBackend(), title("apnea$"), "(apnea*[Title])"},
+		{PubmedBackend{Variants: map[string][]string{"colo?r": {"color", "colour"}}}, title("colo?r"), "(color[Title] OR colour[Title])"},
+	} {
+		b, err := c.compiler.Compile(ir.BooleanQuery{Operator: "or", Keywords: []ir.Keyword{c.keyword}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := b.String()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.expected {
+			t.Fatalf("Expected %v, got %v", c.expected, got)
+		}
+	}
+
+	// A wildcard inside a term cannot be searched without truncating the rest of the term.
+	internal := ir.BooleanQuery{Operator: "or", Keywords: []ir.Keyword{title("colo*r")}}
+	for _, compiler := range []Compiler{NewPubmedBackend(), NewPubMedHistoryBackend()} {
+		if _, err := compiler.Compile(internal); err == nil {
+			t.Fatalf("Expected an error compiling %v with %T", internal, compiler)
+		}
+	}
+	if _, err := RenderKeyword(title("colo*r"), PubMedTarget); err == nil {
+		t.Fatal("Expected an error rendering colo*r")
+	}
+}
@@ -0,0 +1,97 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hscells/transmute/ir"
+)
+
+// BlockTerm is a single term of a concept block.
+type BlockTerm struct {
+	Query     string   `json:"query"`
+	Fields    []string `json:"fields"`
+	Exploded  bool     `json:"exploded"`
+	Truncated bool     `json:"truncated"`
+}
+
+// Block is a concept block of a search strategy, e.g. the population or the intervention.
+type Block struct {
+	// Name is the comment of the block, if it has one, e.g. `population`.
+	Name string `json:"name,omitempty"`
+	// Operator combines the terms of the block, e.g. "or".
+	Operator string `json:"operator"`
+	// Terms are all the keywords in the block.
+	Terms []BlockTerm `json:"terms"`
+	// Query is the block in full, for blocks which contain nested groups, e.g. `(a OR b) AND c`.
+	Query string `json:"query"`
+}
+
+// BlocksQuery is a search strategy split into concept blocks which are combined with "and", the structure imported by
+// systematic review management tools.
+type BlocksQuery struct {
+	Operator string  `json:"operator"`
+	Blocks   []Block `json:"blocks"`
+}
+
+// BlocksBackend compiles queries into concept blocks, using ir.BooleanQuery.Blocks.
+type BlocksBackend struct{}
+
+// Representation returns the blocks.
+func (q BlocksQuery) Representation() (interface{}, error) {
+	return q, nil
+}
+
+// String returns a JSON-encoded representation of the blocks.
+func (q BlocksQuery) String() (string, error) {
+	b, err := json.Marshal(q)
+	return string(b), err
+}
+
+// StringPretty returns a pretty-printed JSON-encoded representation of the blocks.
+func (q BlocksQuery) StringPretty() (string, error) {
+	b, err := json.MarshalIndent(q, "", "    ")
+	return string(b), err
+}
+
+// compileBlock transforms a block of a query into its terms. Groups without an operator that only wrap another group
+// are unwrapped, so the operator of the block is the operator of the group it wraps.
+func compileBlock(q ir.BooleanQuery) Block {
+	var b Block
+	for {
+		if comment, ok := q.Options[ir.CommentOption]; ok {
+			b.Name = fmt.Sprint(comment)
+		}
+		if len(q.Operator) > 0 || len(q.Keywords) > 0 || len(q.Children) != 1 {
+			break
+		}
+		q = q.Children[0]
+	}
+	b.Operator = strings.ToLower(q.Operator)
+	b.Query = q.String()
+	b.Terms = []BlockTerm{}
+	for _, leaf := range q.Leaves() {
+		b.Terms = append(b.Terms, BlockTerm{
+			Query:     leaf.Keyword.QueryString,
+			Fields:    leaf.Keyword.Fields,
+			Exploded:  leaf.Keyword.Exploded,
+			Truncated: leaf.Keyword.Truncated,
+		})
+	}
+	return b
+}
+
+// Compile transforms the ir into concept blocks. A query which is not an "and" of concepts is a single block.
+func (b BlocksBackend) Compile(q ir.BooleanQuery) (BooleanQuery, error) {
+	bq := BlocksQuery{Operator: "and", Blocks: []Block{}}
+	for _, block := range q.Blocks() {
+		bq.Blocks = append(bq.Blocks, compileBlock(block))
+	}
+	return bq, nil
+}
+
+// NewBlocksBackend returns a new concept blocks backend.
+func NewBlocksBackend() BlocksBackend {
+	return BlocksBackend{}
+}
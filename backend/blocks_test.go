@@ -0,0 +1,50 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/hscells/transmute/fields"
+	"github.com/hscells/transmute/ir"
+)
+
+func TestBlocksBackend_Compile(t *testing.T) {
+	ti := func(s string) ir.Keyword {
+		return ir.Keyword{QueryString: s, Fields: []string{fields.Title}}
+	}
+	q := ir.BooleanQuery{
+		Operator: "and",
+		Keywords: []ir.Keyword{ti("randomized")},
+		Children: []ir.BooleanQuery{
+			{Operator: "or", Keywords: []ir.Keyword{ti("asthma"), ti("wheeze")}, Options: map[string]interface{}{ir.CommentOption: "population"}},
+			{Children: []ir.BooleanQuery{{Operator: "or", Keywords: []ir.Keyword{ti("steroid*")}, Children: []ir.BooleanQuery{
+				{Operator: "adj2", Keywords: []ir.Keyword{ti("inhaled"), ti("corticosteroid*")}},
+			}}}},
+		},
+	}
+
+	c, err := NewBlocksBackend().Compile(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := c.Representation()
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks := r.(BlocksQuery).Blocks
+	if len(blocks) != 3 {
+		t.Fatalf("Expected %v blocks, got %v", 3, len(blocks))
+	}
+	if blocks[0].Name != "population" || blocks[0].Operator != "or" || len(blocks[0].Terms) != 2 {
+		t.Fatalf("Expected the population block of two terms, got %v", blocks[0])
+	}
+	if blocks[1].Operator != "or" || len(blocks[1].Terms) != 3 || blocks[1].Query != "(inhaled[title] ADJ2 corticosteroid*[title]) OR steroid*[title]" {
+		t.Fatalf("Expected the intervention block of three terms, got %v", blocks[1])
+	}
+	if blocks[2].Operator != "" || len(blocks[2].Terms) != 1 || blocks[2].Terms[0].Query != "randomized" {
+		t.Fatalf("Expected a block of the single keyword, got %v", blocks[2])
+	}
+
+	if _, err := c.String(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"github.com/hscells/cqr"
 	"github.com/hscells/transmute/ir"
+	"strings"
 )
 
 // CommonQueryRepresentationQuery is the transmute wrapper for CQR.
@@ -12,7 +13,15 @@ type CommonQueryRepresentationQuery struct {
 }
 
 // CommonQueryRepresentationBackend is the backend for compiling transmute ir into CQR.
-type CommonQueryRepresentationBackend struct{}
+type CommonQueryRepresentationBackend struct {
+	// FlattenSingle emits the only child of a Boolean query in place of the Boolean query, e.g. a single keyword is
+	// compiled to a CQR keyword rather than a Boolean query containing the keyword. Boolean queries with options are
+	// never flattened, so that the options are not lost.
+	FlattenSingle bool
+	// OmitDefaults does not set the exploded and truncated options of keywords which are not exploded or truncated,
+	// since a missing option is read as false.
+	OmitDefaults bool
+}
 
 // Representation returns the CQR.
 func (q CommonQueryRepresentationQuery) Representation() (interface{}, error) {
@@ -31,19 +40,41 @@ func (q CommonQueryRepresentationQuery) StringPretty() (string, error) {
 	return string(b), err
 }
 
+// compileCQRKeyword transforms a transmute keyword into a CQR keyword, carrying over any options of the keyword.
+func (b CommonQueryRepresentationBackend) compileCQRKeyword(keyword ir.Keyword) cqr.Keyword {
+	k := cqr.NewKeyword(keyword.QueryString, keyword.Fields...)
+	k.Options = make(map[string]interface{})
+	for key, value := range keyword.Options {
+		k.Options[key] = value
+	}
+	if keyword.Exploded || !b.OmitDefaults {
+		k.SetOption(cqr.ExplodedString, keyword.Exploded)
+	}
+	if keyword.Truncated || !b.OmitDefaults {
+		k.SetOption(cqr.TruncatedString, keyword.Truncated)
+	}
+	return k
+}
+
+// cqrOperator maps an operator of the ir to the operator constants of CQR (e.g. `AND` to cqr.AND), so that the operators
+// are the same however they were cased in the query that was parsed. Other operators, such as adjacency, are lower
+// cased.
+func cqrOperator(operator string) string {
+	switch strings.ToLower(operator) {
+	case cqr.AND:
+		return cqr.AND
+	case cqr.OR:
+		return cqr.OR
+	case cqr.NOT:
+		return cqr.NOT
+	}
+	return strings.ToLower(operator)
+}
+
 // Compile transforms the transmute ir into CQR. The CQR is slightly different to the transmute ir, in that the
 // depth of the children is different. Take note of how the children of a transmute ir differs from the children of CQR.
 func (b CommonQueryRepresentationBackend) Compile(q ir.BooleanQuery) (BooleanQuery, error) {
 	var children []cqr.CommonQueryRepresentation
-	for _, keyword := range q.Keywords {
-		k := cqr.NewKeyword(keyword.QueryString, keyword.Fields...)
-		k.Options = keyword.Options
-		if k.Options == nil {
-			k.Options = make(map[string]interface{})
-		}
-		k = k.SetOption(cqr.ExplodedString, keyword.Exploded).SetOption(cqr.TruncatedString, keyword.Truncated).(cqr.Keyword)
-		children = append(children, k)
-	}
 	for _, child := range q.Children {
 		var subChildren []cqr.CommonQueryRepresentation
 		for _, subChild := range child.Children {
@@ -55,36 +86,26 @@ func (b CommonQueryRepresentationBackend) Compile(q ir.BooleanQuery) (BooleanQue
 			subChildren = append(subChildren, cqrSub)
 		}
 		for _, keyword := range child.Keywords {
-			k := cqr.NewKeyword(keyword.QueryString, keyword.Fields...).
-				SetOption(cqr.ExplodedString, keyword.Exploded).
-				SetOption(cqr.TruncatedString, keyword.Truncated).(cqr.Keyword)
-			//if !keyword.Exploded {
-			//	delete(k.Options, cqr.ExplodedString)
-			//}
-			//if !keyword.Truncated {
-			//	delete(k.Options, cqr.TruncatedString)
-			//}
-			subChildren = append(subChildren, k)
+			subChildren = append(subChildren, b.compileCQRKeyword(keyword))
 		}
 
 		if len(child.Operator) == 0 {
 			children = append(children, subChildren...)
 		} else {
-			bq := cqr.NewBooleanQuery(child.Operator, subChildren)
+			bq := cqr.NewBooleanQuery(cqrOperator(child.Operator), subChildren)
 			for k, v := range child.Options {
 				bq.SetOption(k, v)
 			}
 			children = append(children, bq)
 		}
 	}
+	for _, keyword := range q.Keywords {
+		children = append(children, b.compileCQRKeyword(keyword))
+	}
 
 	var repr cqr.CommonQueryRepresentation
 	if len(q.Operator) == 0 && len(q.Children) == 1 {
 		var keywords []cqr.CommonQueryRepresentation
-		for _, kw := range q.Children[0].Keywords {
-			keywords = append(keywords, cqr.NewKeyword(kw.QueryString, kw.Fields...).SetOption(cqr.ExplodedString, kw.Exploded).SetOption(cqr.TruncatedString, kw.Truncated))
-		}
-
 		for _, child := range q.Children[0].Children {
 			keyword, err := b.Compile(child)
 			if err != nil {
@@ -92,18 +113,43 @@ func (b CommonQueryRepresentationBackend) Compile(q ir.BooleanQuery) (BooleanQue
 			}
 			keywords = append(keywords, keyword.(CommonQueryRepresentationQuery).repr)
 		}
-		repr = cqr.NewBooleanQuery(q.Children[0].Operator, keywords)
+
+		for _, kw := range q.Children[0].Keywords {
+			keywords = append(keywords, b.compileCQRKeyword(kw))
+		}
+		repr = cqr.NewBooleanQuery(cqrOperator(q.Children[0].Operator), keywords)
 	} else {
-		repr = cqr.NewBooleanQuery(q.Operator, children)
+		repr = cqr.NewBooleanQuery(cqrOperator(q.Operator), children)
 	}
 
 	for k, v := range q.Options {
 		repr.SetOption(k, v)
 	}
 
+	if b.FlattenSingle {
+		repr = flattenCQR(repr)
+	}
 	return CommonQueryRepresentationQuery{repr: repr}, nil
 }
 
+// flattenCQR replaces every Boolean query with a single child and no options by its child, except a "NOT" query of a
+// single child, which negates the child.
+func flattenCQR(q cqr.CommonQueryRepresentation) cqr.CommonQueryRepresentation {
+	bq, ok := q.(cqr.BooleanQuery)
+	if !ok {
+		return q
+	}
+	children := make([]cqr.CommonQueryRepresentation, len(bq.Children))
+	for i, child := range bq.Children {
+		children[i] = flattenCQR(child)
+	}
+	if len(children) == 1 && len(bq.Options) == 0 && bq.Operator != cqr.NOT {
+		return children[0]
+	}
+	bq.Children = children
+	return bq
+}
+
 // NewCQRBackend returns a new CQR backend.
 func NewCQRBackend() CommonQueryRepresentationBackend {
 	return CommonQueryRepresentationBackend{}
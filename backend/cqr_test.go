@@ -0,0 +1,124 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/hscells/cqr"
+	"github.com/hscells/transmute/fields"
+	"github.com/hscells/transmute/ir"
+)
+
+func TestCommonQueryRepresentationBackend_FlattenSingle(t *testing.T) {
+	q := ir.BooleanQuery{
+		Operator: "and",
+		Keywords: []ir.Keyword{{QueryString: "a", Fields: []string{fields.Title}}},
+		Children: []ir.BooleanQuery{
+			{Operator: "or", Children: []ir.BooleanQuery{{Operator: "or", Keywords: []ir.Keyword{{QueryString: "b", Fields: []string{fields.Title}}}}}},
+		},
+	}
+
+	c, err := CommonQueryRepresentationBackend{FlattenSingle: true}.Compile(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repr, _ := c.Representation()
+	bq, ok := repr.(cqr.BooleanQuery)
+	if !ok || len(bq.Children) != 2 {
+		t.Fatalf("Expected an and query with %v children, got %v", 2, repr)
+	}
+	for _, child := range bq.Children {
+		if !isCQRKeyword(child) {
+			t.Fatalf("Expected the children to be flattened to keywords, got %v", child)
+		}
+	}
+
+	single := ir.BooleanQuery{Keywords: []ir.Keyword{{QueryString: "a"}}}
+	c, err = CommonQueryRepresentationBackend{FlattenSingle: true}.Compile(single)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repr, _ := c.Representation(); !isCQRKeyword(repr) {
+		t.Fatalf("Expected a single keyword, got %v", repr)
+	}
+
+	c, err = NewCQRBackend().Compile(single)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repr, _ := c.Representation(); isCQRKeyword(repr) {
+		t.Fatalf("Expected a Boolean query when not flattening, got %v", repr)
+	}
+}
+
+func TestCommonQueryRepresentationBackend_OmitDefaults(t *testing.T) {
+	q := ir.BooleanQuery{
+		Operator: "or",
+		Keywords: []ir.Keyword{
+			{QueryString: "a", Fields: []string{fields.Title}},
+			{QueryString: "b*", Fields: []string{fields.Title}, Truncated: true},
+		},
+	}
+
+	c, err := CommonQueryRepresentationBackend{OmitDefaults: true}.Compile(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repr, _ := c.Representation()
+	children := repr.(cqr.BooleanQuery).Children
+	if len(children[0].(cqr.Keyword).Options) != 0 {
+		t.Fatalf("Expected no options, got %v", children[0])
+	}
+	if o := children[1].(cqr.Keyword).Options; len(o) != 1 || o[cqr.TruncatedString] != true {
+		t.Fatalf("Expected only the truncated option, got %v", children[1])
+	}
+
+	c, err = NewCQRBackend().Compile(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repr, _ = c.Representation()
+	if o := repr.(cqr.BooleanQuery).Children[0].(cqr.Keyword).Options; len(o) != 2 {
+		t.Fatalf("Expected the exploded and truncated options, got %v", o)
+	}
+}
+
+func TestCommonQueryRepresentationBackend_Operators(t *testing.T) {
+	q := ir.BooleanQuery{
+		Operator: "AND",
+		Keywords: []ir.Keyword{{QueryString: "a", Fields: []string{fields.Title}}},
+		Children: []ir.BooleanQuery{
+			{Operator: "Or", Keywords: []ir.Keyword{{QueryString: "b", Fields: []string{fields.Title}}, {QueryString: "c", Fields: []string{fields.Title}}}},
+			{Operator: "NOT", Keywords: []ir.Keyword{{QueryString: "d", Fields: []string{fields.Title}}, {QueryString: "e", Fields: []string{fields.Title}}}},
+			{Operator: "ADJ3", Keywords: []ir.Keyword{{QueryString: "f", Fields: []string{fields.Title}}, {QueryString: "g", Fields: []string{fields.Title}}}},
+		},
+	}
+	c, err := NewCQRBackend().Compile(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repr, _ := c.Representation()
+	bq := repr.(cqr.BooleanQuery)
+	if bq.Operator != cqr.AND {
+		t.Fatalf("Expected %v, got %v", cqr.AND, bq.Operator)
+	}
+	var operators []string
+	for _, child := range bq.Children {
+		if b, ok := child.(cqr.BooleanQuery); ok {
+			operators = append(operators, b.Operator)
+		}
+	}
+	expected := []string{cqr.OR, cqr.NOT, "adj3"}
+	if len(operators) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, operators)
+	}
+	for i := range expected {
+		if operators[i] != expected[i] {
+			t.Fatalf("Expected %v, got %v", expected, operators)
+		}
+	}
+}
+
+func isCQRKeyword(repr interface{}) bool {
+	_, ok := repr.(cqr.Keyword)
+	return ok
+}
@@ -0,0 +1,101 @@
+package backend
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hscells/transmute/ir"
+)
+
+// DotQuery is a Graphviz DOT graph of the structure of a query.
+type DotQuery struct {
+	repr string
+}
+
+// DotBackend is the compiler for visualising the ir as a Graphviz DOT graph.
+type DotBackend struct{}
+
+// Representation returns the DOT source as a string.
+func (q DotQuery) Representation() (interface{}, error) {
+	return q.repr, nil
+}
+
+// String returns the DOT source of the graph.
+func (q DotQuery) String() (string, error) {
+	return q.repr, nil
+}
+
+// StringPretty returns the DOT source of the graph; it is already indented.
+func (q DotQuery) StringPretty() (string, error) {
+	return q.repr, nil
+}
+
+// dotGraph accumulates the nodes and edges of a graph.
+type dotGraph struct {
+	lines []string
+	nodes int
+}
+
+// node adds a node to the graph, returning the identifier of the node.
+func (g *dotGraph) node(label, shape string) string {
+	id := fmt.Sprintf("n%d", g.nodes)
+	g.nodes++
+	g.lines = append(g.lines, fmt.Sprintf("    %s [label=%s, shape=%s];", id, strconv.Quote(label), shape))
+	return id
+}
+
+// edge adds an edge between two nodes.
+func (g *dotGraph) edge(from, to string) {
+	if len(from) > 0 {
+		g.lines = append(g.lines, fmt.Sprintf("    %s -> %s;", from, to))
+	}
+}
+
+// dotKeyword labels a keyword with its query string, fields, and whether it is exploded or truncated.
+func dotKeyword(keyword ir.Keyword) string {
+	label := keyword.QueryString
+	if len(keyword.Fields) > 0 {
+		label += "\n[" + strings.Join(keyword.Fields, ", ") + "]"
+	}
+	var flags []string
+	if keyword.Exploded {
+		flags = append(flags, "exploded")
+	}
+	if keyword.Truncated {
+		flags = append(flags, "truncated")
+	}
+	if len(flags) > 0 {
+		label += "\n(" + strings.Join(flags, ", ") + ")"
+	}
+	return label
+}
+
+// add adds a query and all of its keywords and children to the graph, below the parent node. Groups without an
+// operator do not have a node of their own; their operands are added directly below the parent.
+func (g *dotGraph) add(q ir.BooleanQuery, parent string) {
+	if len(q.Operator) > 0 {
+		id := g.node(strings.ToUpper(q.Operator), "ellipse")
+		g.edge(parent, id)
+		parent = id
+	}
+	for _, child := range q.Children {
+		g.add(child, parent)
+	}
+	for _, keyword := range q.Keywords {
+		g.edge(parent, g.node(dotKeyword(keyword), "box"))
+	}
+}
+
+// Compile transforms the ir into a Graphviz DOT graph. Operators are drawn as ellipses, and keywords as boxes labelled
+// with the query string and fields of the keyword.
+func (b DotBackend) Compile(q ir.BooleanQuery) (BooleanQuery, error) {
+	g := &dotGraph{}
+	g.add(q, "")
+	return DotQuery{repr: "digraph query {\n" + strings.Join(append(g.lines, "}"), "\n")}, nil
+}
+
+// NewDotBackend returns a new Graphviz DOT backend.
+func NewDotBackend() DotBackend {
+	return DotBackend{}
+}
@@ -0,0 +1,53 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/hscells/transmute/fields"
+	"github.com/hscells/transmute/ir"
+)
+
+func TestDotBackend_Compile(t *testing.T) {
+	title := func(s string) ir.Keyword {
+		return ir.Keyword{QueryString: s, Fields: []string{fields.Title}}
+	}
+	queries := []struct {
+		query    ir.BooleanQuery
+		expected string
+	}{
+		{
+			ir.BooleanQuery{
+				Operator: "and",
+				Children: []ir.BooleanQuery{{Operator: "or", Keywords: []ir.Keyword{title("asthma"), title("wheez*")}}},
+				Keywords: []ir.Keyword{{QueryString: "Asthma", Fields: []string{fields.MeshHeadings}, Exploded: true}},
+			},
+			`digraph query {
+    n0 [label="AND", shape=ellipse];
+    n1 [label="OR", shape=ellipse];
+    n0 -> n1;
+    n2 [label="asthma\n[title]", shape=box];
+    n1 -> n2;
+    n3 [label="wheez*\n[title]", shape=box];
+    n1 -> n3;
+    n4 [label="Asthma\n[mesh_headings]\n(exploded)", shape=box];
+    n0 -> n4;
+}`,
+		},
+		{
+			// A keyword without a group has no edges.
+			ir.BooleanQuery{Keywords: []ir.Keyword{title("asthma")}},
+			`digraph query {
+    n0 [label="asthma\n[title]", shape=box];
+}`,
+		},
+	}
+	for _, q := range queries {
+		d, err := NewDotBackend().Compile(q.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s, _ := d.String(); s != q.expected {
+			t.Fatalf("Expected\n%v\ngot\n%v", q.expected, s)
+		}
+	}
+}
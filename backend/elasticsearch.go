@@ -19,6 +19,7 @@ import (
 type ElasticsearchQuery struct {
 	queryString string
 	fields      []string
+	options     map[string]interface{}
 }
 
 // ElasticsearchBooleanQuery is the transmute representation of an Elasticsearch query.
@@ -26,9 +27,21 @@ type ElasticsearchBooleanQuery struct {
 	queries  []ElasticsearchQuery
 	grouping string
 	children []BooleanQuery
+	inOrder  bool
 }
 
-// ElasticsearchCompiler is a compiler for Elasticsearch queries.
+// ElasticsearchCompiler is a compiler for Elasticsearch queries. The options of a query which are understood by the
+// compiler are:
+//
+//   - ir.ProximityOption on a keyword, which sets the slop of the phrase (an error is returned when the keyword also
+//     has ir.FuzzinessOption);
+//   - ir.FuzzinessOption on a keyword, which sets the fuzziness of the match;
+//   - ir.BoostOption on a keyword, which sets the boost of the match, or of the query string of a truncated keyword;
+//   - ir.InOrderOption on an adjacency group, which requires the spans of the group to be in order;
+//   - ir.DistanceOption on an adjacency group, which sets the slop of the spans in place of the distance of the
+//     operator.
+//
+// Elasticsearch has no equivalent of ir.FrequencyOption, so it is ignored.
 type ElasticsearchCompiler struct {
 	tree *meshexp.MeSHTree
 }
@@ -49,13 +62,20 @@ func NewElasticsearchCompiler() ElasticsearchCompiler {
 }
 
 // Compile transforms an immediate representation of a query into an Elasticsearch query.
-func (b ElasticsearchCompiler) Compile(ir ir.BooleanQuery) (BooleanQuery, error) {
+func (b ElasticsearchCompiler) Compile(q ir.BooleanQuery) (BooleanQuery, error) {
 	elasticSearchBooleanQuery := ElasticsearchBooleanQuery{}
 
 	var queries []ElasticsearchQuery
 
+	// The `?` of Elasticsearch matches exactly one character, so a keyword with an optional wildcard is searched
+	// without the character, or with a wildcard for exactly one character in its place.
+	q, err := q.ExpandOptional(maxSpellings)
+	if err != nil {
+		return nil, err
+	}
+
 	// This is really the only thing that differs from the IR; Elasticsearch has funny boolean operators.
-	switch ir.Operator {
+	switch q.Operator {
 	case "or", "OR":
 		elasticSearchBooleanQuery.grouping = "should"
 	case "not", "NOT":
@@ -63,13 +83,17 @@ func (b ElasticsearchCompiler) Compile(ir ir.BooleanQuery) (BooleanQuery, error)
 	case "and", "AND":
 		elasticSearchBooleanQuery.grouping = "filter"
 	default:
-		elasticSearchBooleanQuery.grouping = ir.Operator
+		elasticSearchBooleanQuery.grouping = adjacencyOperator(q)
+		elasticSearchBooleanQuery.inOrder, _ = q.Options[ir.InOrderOption].(bool)
 	}
 
-	for _, keyword := range ir.Keywords {
+	// The number of queries for the first keyword, which is more than one when the keyword is exploded.
+	first := 0
+	for i, keyword := range q.Keywords {
 		query := ElasticsearchQuery{}
 		query.queryString = keyword.QueryString
 		query.fields = keyword.Fields
+		query.options = keyword.Options
 		queries = append(queries, query)
 
 		if keyword.Exploded {
@@ -81,7 +105,9 @@ func (b ElasticsearchCompiler) Compile(ir ir.BooleanQuery) (BooleanQuery, error)
 				})
 			}
 		}
-
+		if i == 0 {
+			first = len(queries)
+		}
 	}
 
 	if elasticSearchBooleanQuery.grouping == "must_not" {
@@ -93,7 +119,7 @@ func (b ElasticsearchCompiler) Compile(ir ir.BooleanQuery) (BooleanQuery, error)
 		}
 
 		var children []BooleanQuery
-		for _, child := range ir.Children {
+		for _, child := range q.Children {
 			c, err := b.Compile(child)
 			if err != nil {
 				return nil, err
@@ -101,17 +127,22 @@ func (b ElasticsearchCompiler) Compile(ir ir.BooleanQuery) (BooleanQuery, error)
 			children = append(children, c)
 		}
 
-		if len(children) > 1 && len(queries) == 0 {
+		// The operands are in the same order as in the ir (children, then keywords); the first is searched, and the
+		// others are excluded from it.
+		if len(children) > 0 && len(children)+len(q.Keywords) > 1 {
 			rhsQuery.children = []BooleanQuery{children[0]}
 			lhsQuery.children = children[1:]
-		} else if len(queries) > 1 && len(children) == 0 {
-			rhsQuery.queries = []ElasticsearchQuery{queries[0]}
-			lhsQuery.queries = queries[1:]
-		} else if len(queries) == 1 && len(children) > 0 {
-			rhsQuery.queries = queries
+			lhsQuery.queries = queries
+		} else if len(children) == 0 && len(q.Keywords) > 1 {
+			rhsQuery.queries = queries[:first]
+			lhsQuery.queries = queries[first:]
+		} else if len(children)+len(q.Keywords) == 1 {
+			// A "not" group of a single operand only excludes the operand.
 			lhsQuery.children = children
+			lhsQuery.queries = queries
+			return lhsQuery, nil
 		} else {
-			return nil, errors.New(fmt.Sprintf("a not query cannot have less than two children:\n%v\n%v", queries, children))
+			return nil, errors.New(fmt.Sprintf("a not query must have an operand:\n%v\n%v", queries, children))
 		}
 
 		elasticSearchBooleanQuery.children = []BooleanQuery{rhsQuery, lhsQuery}
@@ -121,14 +152,14 @@ func (b ElasticsearchCompiler) Compile(ir ir.BooleanQuery) (BooleanQuery, error)
 		elasticSearchBooleanQuery.queries = queries
 
 		//fmt.Println(len(ir.Keywords), len(ir.Children))
-		if (len(ir.Keywords) == 0 || ir.Keywords == nil) && len(ir.Children) == 1 {
-			c, err := b.Compile(ir.Children[0])
+		if (len(q.Keywords) == 0 || q.Keywords == nil) && len(q.Children) == 1 {
+			c, err := b.Compile(q.Children[0])
 			if err != nil {
 				return nil, err
 			}
 			elasticSearchBooleanQuery = c.(ElasticsearchBooleanQuery)
 		} else {
-			for _, child := range ir.Children {
+			for _, child := range q.Children {
 				c, err := b.Compile(child)
 				if err != nil {
 					return nil, err
@@ -211,7 +242,7 @@ func (q ElasticsearchBooleanQuery) traverseGroup(node m) (m, error) {
 						"span_near": m{
 							"clauses":  append(adjClauses[field], query.createAdjacentClause(field)),
 							"slop":     slopSize,
-							"in_order": false,
+							"in_order": q.inOrder,
 						},
 					}
 					clauses = append(clauses, c)
@@ -223,12 +254,12 @@ func (q ElasticsearchBooleanQuery) traverseGroup(node m) (m, error) {
 		var query map[string]interface{}
 		if len(clauses) == 0 { // There were no "nested" clauses, only terms.
 			var ac []interface{}
-			for _, q := range adjClauses {
+			for _, c := range adjClauses {
 				ac = append(ac, m{
 					"span_near": m{
-						"clauses":  q,
+						"clauses":  c,
 						"slop":     slopSize,
-						"in_order": false,
+						"in_order": q.inOrder,
 					},
 				})
 			}
@@ -239,12 +270,12 @@ func (q ElasticsearchBooleanQuery) traverseGroup(node m) (m, error) {
 			}
 		} else if len(clauses) > 0 && len(adjClauses) == 0 { // only "nested" clauses, no terms.
 			var ac []interface{}
-			for _, q := range nesClauses {
+			for _, c := range nesClauses {
 				ac = append(ac, m{
 					"span_near": m{
-						"clauses":  q,
+						"clauses":  c,
 						"slop":     slopSize,
-						"in_order": false,
+						"in_order": q.inOrder,
 					},
 				})
 			}
@@ -306,15 +337,55 @@ func (q ElasticsearchBooleanQuery) traverseGroup(node m) (m, error) {
 
 			queryString := q.queries[i].queryString
 
+			// A keyword without a query string may only require its fields to be present in a document.
+			if exists, _ := q.queries[i].options[ir.ExistsOption].(bool); exists && len(queryString) == 0 {
+				var queries []interface{}
+				for _, field := range fields {
+					queries = append(queries, m{"exists": m{"field": field}})
+				}
+				query = m{
+					"bool": m{
+						"should": queries,
+					},
+				}
+				groups[subQuery] = query
+				subQuery++
+				continue
+			}
+
 			matchType := "match"
 			if strings.ContainsRune(queryString, ' ') {
 				matchType = "match_phrase"
 			}
 
+			// A proximity on the keyword is the slop of the phrase.
+			var matchQuery interface{} = queryString
+			params := m{}
+			// The slop of a phrase cannot be combined with the fuzziness of its terms.
+			_, proximity := q.queries[i].options[ir.ProximityOption]
+			if _, fuzzy := q.queries[i].options[ir.FuzzinessOption]; proximity && fuzzy {
+				return nil, fmt.Errorf("the keyword `%v` cannot have both a proximity and a fuzziness", queryString)
+			}
+			if slop, ok := q.queries[i].options[ir.ProximityOption]; ok {
+				matchType = "match_phrase"
+				params["slop"] = slop
+			} else if fuzziness, ok := q.queries[i].options[ir.FuzzinessOption]; ok {
+				// A fuzzy term matches the terms within an edit distance of it.
+				params["fuzziness"] = fuzziness
+			}
+			// A boosted keyword is weighted when the documents are ranked.
+			if boost, ok := q.queries[i].options[ir.BoostOption]; ok {
+				params["boost"] = boost
+			}
+			if len(params) > 0 {
+				params["query"] = queryString
+				matchQuery = params
+			}
+
 			// Now, we can have a general way of constructing the query.
 			if len(fields) > 1 {
 				// Multiple fields, with a wildcard query string.
-				if strings.ContainsAny(queryString, "*?~") {
+				if strings.ContainsAny(queryString, "*?#$~") {
 					var queries []interface{}
 					/*
 										{
@@ -326,13 +397,7 @@ func (q ElasticsearchBooleanQuery) traverseGroup(node m) (m, error) {
 										}
 					*/
 					for _, field := range fields {
-						queries = append(queries, m{
-							"query_string": m{
-								"query":               fmt.Sprintf("%v:%v", field, queryString),
-								"analyze_wildcard":    true,
-								"split_on_whitespace": false,
-							},
-						})
+						queries = append(queries, queryStringClause(field, queryString, q.queries[i].options))
 					}
 
 					query = map[string]interface{}{
@@ -344,19 +409,13 @@ func (q ElasticsearchBooleanQuery) traverseGroup(node m) (m, error) {
 					var queries []interface{}
 					// Multiple fields, with a regular query string.
 					for _, field := range fields {
-						if strings.ContainsAny(queryString, "*?~") {
-							queries = append(queries, m{
-								"query_string": m{
-									"query":               fmt.Sprintf("%v:%v", field, queryString),
-									"analyze_wildcard":    true,
-									"split_on_whitespace": false,
-								},
-							})
+						if strings.ContainsAny(queryString, "*?#$~") {
+							queries = append(queries, queryStringClause(field, queryString, q.queries[i].options))
 						} else {
 							// Otherwise we just use a regular match query.
 							queries = append(queries, m{
 								matchType: m{
-									field: queryString,
+									field: matchQuery,
 								},
 							})
 						}
@@ -369,19 +428,13 @@ func (q ElasticsearchBooleanQuery) traverseGroup(node m) (m, error) {
 				}
 			} else if len(fields) == 1 {
 				// Check to see if we first need to create a wildcard query.
-				if strings.ContainsAny(queryString, "*?") {
-					query = m{
-						"query_string": m{
-							"query":               fmt.Sprintf("%v:%v", fields[0], queryString),
-							"analyze_wildcard":    true,
-							"split_on_whitespace": false,
-						},
-					}
+				if strings.ContainsAny(queryString, "*?#$") {
+					query = queryStringClause(fields[0], queryString, q.queries[i].options)
 				} else {
 					// Otherwise we just use a regular match query.
 					query = m{
 						matchType: m{
-							fields[0]: queryString,
+							fields[0]: matchQuery,
 						},
 					}
 				}
@@ -413,6 +466,20 @@ func (q ElasticsearchBooleanQuery) traverseGroup(node m) (m, error) {
 	return node, nil
 }
 
+// queryStringClause is a `query_string` query which searches a query string with wildcards in a field. A boosted
+// keyword (ir.BoostOption) is weighted in the same way as a `match` query.
+func queryStringClause(field, queryString string, options map[string]interface{}) m {
+	clause := m{
+		"query":               fmt.Sprintf("%v:%v", field, escapeLucene(queryString, true)),
+		"analyze_wildcard":    true,
+		"split_on_whitespace": false,
+	}
+	if boost, ok := options[ir.BoostOption]; ok {
+		clause["boost"] = boost
+	}
+	return m{"query_string": clause}
+}
+
 // createAdjacentClause attempts to create an Elasticsearch version of the `adj` operator in Pubmed/Medline (slop).
 func (q ElasticsearchQuery) createAdjacentClause(field string) map[string]interface{} {
 	innerClauses := make(map[string]interface{})
@@ -0,0 +1,78 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/hscells/transmute/fields"
+	"github.com/hscells/transmute/ir"
+)
+
+func TestElasticsearchCompiler_Adjacency(t *testing.T) {
+	title := func(s string) ir.Keyword {
+		return ir.Keyword{QueryString: s, Fields: []string{fields.Title}}
+	}
+	adjacent := ir.BooleanQuery{Operator: "adj3", Keywords: []ir.Keyword{title("asthma"), title("wheeze")}}
+	ordered := adjacent
+	ordered.Options = map[string]interface{}{ir.InOrderOption: true}
+	phrase := ir.BooleanQuery{Operator: "or", Keywords: []ir.Keyword{{
+		QueryString: "asthma wheeze",
+		Fields:      []string{fields.Title},
+		Options:     map[string]interface{}{ir.ProximityOption: 2},
+	}}}
+
+	// The distance of an adjacency group is the slop of its spans, and ir.InOrderOption requires them to be in order. The
+	// proximity of a phrase is the slop of the phrase.
+	for _, c := range []struct {
+		query    ir.BooleanQuery
+		expected string
+	}{
+		{adjacent, `{"query":{"constant_score":{"filter":{"bool":{"should":[{"span_near":{"clauses":[{"span_multi":{"match":{"prefix":{"title":"asthma"}}}},{"span_multi":{"match":{"prefix":{"title":"wheeze"}}}}],"in_order":false,"slop":3}}]}}}}}`},
+		{ordered, `{"query":{"constant_score":{"filter":{"bool":{"should":[{"span_near":{"clauses":[{"span_multi":{"match":{"prefix":{"title":"asthma"}}}},{"span_multi":{"match":{"prefix":{"title":"wheeze"}}}}],"in_order":true,"slop":3}}]}}}}}`},
+		{phrase, `{"query":{"constant_score":{"filter":{"bool":{"disable_coord":true,"should":[{"match_phrase":{"title":{"query":"asthma wheeze","slop":2}}}]}}}}}`},
+	} {
+		b, err := NewElasticsearchCompiler().Compile(c.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := b.String()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.expected {
+			t.Fatalf("Expected %v, got %v", c.expected, got)
+		}
+	}
+}
+
+func TestElasticsearchCompiler_Boost(t *testing.T) {
+	// A truncated keyword is searched with a query string, which is boosted in the same way as a match.
+	q := ir.BooleanQuery{Operator: "or", Keywords: []ir.Keyword{{
+		QueryString: "asthm*",
+		Fields:      []string{fields.Title},
+		Truncated:   true,
+		Options:     map[string]interface{}{ir.BoostOption: 2.0},
+	}}}
+	b, err := NewElasticsearchCompiler().Compile(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := b.String()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"query":{"constant_score":{"filter":{"bool":{"disable_coord":true,"should":[{"query_string":{"analyze_wildcard":true,"boost":2,"query":"title:asthm*","split_on_whitespace":false}}]}}}}}`; got != expected {
+		t.Fatalf("Expected %v, got %v", expected, got)
+	}
+
+	// The slop of a phrase cannot be combined with a fuzziness.
+	q.Keywords[0] = ir.Keyword{
+		QueryString: "heart attack",
+		Fields:      []string{fields.Title},
+		Options:     map[string]interface{}{ir.ProximityOption: 2, ir.FuzzinessOption: 1},
+	}
+	if b, err := NewElasticsearchCompiler().Compile(q); err == nil {
+		if _, err := b.String(); err == nil {
+			t.Fatalf("Expected an error compiling %v", q)
+		}
+	}
+}
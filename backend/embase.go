@@ -0,0 +1,63 @@
+package backend
+
+import (
+	"github.com/hscells/transmute/fields"
+	"github.com/hscells/transmute/ir"
+)
+
+// embaseFields maps Embase (Ovid) field codes to fields in the ir.
+var embaseFields = map[string][]string{
+	"ab":       {fields.Abstract},
+	"af":       {fields.AllFields},
+	"au":       {fields.Authors},
+	"hw":       {fields.HeadingWord},
+	"jn":       {fields.Journal},
+	"kw":       {fields.Keywords},
+	"lg":       {fields.Language},
+	"pt":       {fields.PublicationType},
+	"ti":       {fields.Title},
+	"ti,ab":    {fields.TitleAbstract},
+	"ti,ab,kw": {fields.TitleAbstract, fields.Keywords},
+	"yr":       {fields.PublicationDate},
+}
+
+// embasePreferredFields are the field codes used for fields which more than one field code maps to. The text word
+// field of the ir is the title and abstract (as `.tw.` searches in Medline), whereas `.tw.` searches more fields of
+// Embase, so it is searched with `.ti,ab.` instead.
+var embasePreferredFields = map[string]string{
+	fields.AllFields: "af",
+	fields.TextWord:  "ti,ab",
+}
+
+// embaseFieldCodes are the field codes of Embase.
+var embaseFieldCodes = fieldCodes{codes: embaseFields, preferred: embasePreferredFields}
+
+// EmbaseBackend compiles queries into Embase search strategies for Ovid. The lines are the same as those of the
+// Medline backend (Emtree headings are written in the same way as MeSH headings, e.g. `exp asthma/`), except that the
+// fields of keywords are mapped to the field codes of Embase.
+type EmbaseBackend struct {
+	MedlineBackend
+}
+
+// medline returns the Medline backend which writes the lines of the strategy, using the field codes of Embase.
+func (b EmbaseBackend) medline() MedlineBackend {
+	m := b.MedlineBackend
+	m.fieldCodes = &embaseFieldCodes
+	return m
+}
+
+// Compile transforms the ir into an Embase search strategy.
+func (b EmbaseBackend) Compile(q ir.BooleanQuery) (BooleanQuery, error) {
+	return b.medline().Compile(q)
+}
+
+// Validate reports the keywords whose fields have no Embase field code, and the options of keywords which Embase does
+// not support.
+func (b EmbaseBackend) Validate(q ir.BooleanQuery) []ir.Warning {
+	return b.medline().Validate(q)
+}
+
+// NewEmbaseBackend creates a new backend for compiling Embase search strategies for Ovid.
+func NewEmbaseBackend() EmbaseBackend {
+	return EmbaseBackend{}
+}
@@ -0,0 +1,49 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/hscells/transmute/fields"
+	"github.com/hscells/transmute/ir"
+)
+
+func TestEmbaseBackend_Compile(t *testing.T) {
+	q := ir.BooleanQuery{
+		Operator: "or",
+		Keywords: []ir.Keyword{
+			{QueryString: "asthma", Fields: []string{fields.MeshHeadings}, Exploded: true},
+			{QueryString: "wheez*", Fields: []string{fields.TextWord}, Truncated: true},
+			{QueryString: "inhaler", Fields: []string{fields.TitleAbstract}},
+		},
+	}
+
+	// The text word field is searched with `.tw.` in Medline, and `.ti,ab.` in Embase.
+	for _, c := range []struct {
+		compiler Compiler
+		expected string
+	}{
+		{NewMedlineBackend(), "1. exp asthma/\n2. wheez*.tw.\n3. inhaler.ti,ab.\n4. or/1-3\n"},
+		{NewEmbaseBackend(), "1. exp asthma/\n2. wheez*.ti,ab.\n3. inhaler.ti,ab.\n4. or/1-3\n"},
+	} {
+		b, err := c.compiler.Compile(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := b.String()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.expected {
+			t.Fatalf("Expected %v, got %v", c.expected, got)
+		}
+	}
+
+	// Embase has a field code for the language, but Medline does not.
+	q = ir.BooleanQuery{Keywords: []ir.Keyword{{QueryString: "english", Fields: []string{fields.Language}}}}
+	if warnings := NewEmbaseBackend().Validate(q); len(warnings) != 0 {
+		t.Fatalf("Expected no warnings, got %v", warnings)
+	}
+	if warnings := NewMedlineBackend().Validate(q); len(warnings) != 1 {
+		t.Fatalf("Expected a warning for the language field, got %v", warnings)
+	}
+}
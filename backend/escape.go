@@ -0,0 +1,55 @@
+package backend
+
+import "strings"
+
+// luceneSpecialCharacters are the characters with a meaning in the Lucene query syntax (which is also the syntax of the
+// Elasticsearch query_string query), including the `<`, `>`, and `=` of ranges. They must be escaped with a backslash to
+// be searched, e.g. `c\+\+`, `5\-HT`, or `p\<0.05`.
+const luceneSpecialCharacters = `+-&|!(){}[]^"~*?:\/<>=`
+
+// luceneWildcards translates the wildcards of the ir into those of Lucene; `#` (exactly one character) is `?`, and `$`
+// is `*`.
+var luceneWildcards = strings.NewReplacer("#", "?", "$", "*")
+
+// escapeLucene escapes the special characters of a query string for Lucene. Only a quote or a backslash needs to be
+// escaped inside a phrase, so the quotes around a phrase are kept. When wildcards is set, the wildcards of a truncated
+// keyword are kept (as Lucene wildcards) rather than escaped.
+func escapeLucene(qs string, wildcards bool) string {
+	if len(qs) >= 2 && strings.HasPrefix(qs, `"`) && strings.HasSuffix(qs, `"`) {
+		phrase := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(qs[1 : len(qs)-1])
+		return `"` + phrase + `"`
+	}
+	if wildcards {
+		qs = luceneWildcards.Replace(qs)
+	}
+	var b strings.Builder
+	for _, c := range qs {
+		if wildcards && (c == '*' || c == '?') {
+			b.WriteRune(c)
+			continue
+		}
+		if strings.ContainsRune(luceneSpecialCharacters, c) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// pubmedEscaper escapes the characters which qualify a term with its fields in PubMed, e.g. `asthma[tiab]`, with a
+// backslash, so `TNF-[alpha]` is written `TNF-\[alpha\]`.
+var pubmedEscaper = strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`)
+
+// escapePubMed escapes the special characters of a query string for PubMed.
+func escapePubMed(qs string) string {
+	return pubmedEscaper.Replace(qs)
+}
+
+// escapeMedline quotes a query string which contains characters with a meaning in an Ovid search strategy, e.g. the
+// parenthesis that group terms, or the slash after a subject heading, so that `and/or` is searched as `"and/or"`.
+func escapeMedline(qs string) string {
+	if strings.HasPrefix(qs, `"`) || !strings.ContainsAny(qs, "()[]/") {
+		return qs
+	}
+	return `"` + qs + `"`
+}
@@ -0,0 +1,40 @@
+package backend
+
+import "testing"
+
+func TestEscapeLucene(t *testing.T) {
+	queries := []struct {
+		qs        string
+		wildcards bool
+		expected  string
+	}{
+		{"c++", false, `c\+\+`},
+		{"5-HT", false, `5\-HT`},
+		{"hiv/aids (adult)", false, `hiv\/aids \(adult\)`},
+		{"p<0.05!", false, `p\<0.05\!`},
+		{"BMI>=30", false, `BMI\>\=30`},
+		{"wheez*", false, `wheez\*`},
+		{"wheez*", true, "wheez*"},
+		{"child$ wom#n", true, "child* wom?n"},
+		{`"heart attack: acute"`, false, `"heart attack: acute"`},
+		{`"10" ruler"`, false, `"10\" ruler"`},
+	}
+	for _, q := range queries {
+		if got := escapeLucene(q.qs, q.wildcards); got != q.expected {
+			t.Fatalf("Expected %v, got %v", q.expected, got)
+		}
+	}
+}
+
+func TestEscapePubMed(t *testing.T) {
+	for qs, expected := range map[string]string{
+		"asthma":        "asthma",
+		"TNF-[alpha]":   `TNF-\[alpha\]`,
+		`"IL-1 [beta]"`: `"IL-1 \[beta\]"`,
+		`back\slash`:    `back\\slash`,
+	} {
+		if got := escapePubMed(qs); got != expected {
+			t.Fatalf("Expected %v, got %v", expected, got)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hscells/transmute/ir"
+)
+
+// LuceneQuery is a query string in the Lucene query syntax, e.g. `title:asthma AND (abstract:wheez* OR abstract:dry)`.
+type LuceneQuery struct {
+	repr string
+}
+
+// LuceneBackend is the compiler for queries in the Lucene query syntax, which is also the syntax of the query_string
+// query of Elasticsearch. Each keyword is searched in each of its fields in the same way as RenderKeyword with
+// LuceneTarget: special characters are escaped, phrases with ir.ProximityOption and fuzzy terms (ir.FuzzinessOption)
+// are searched with `~`, boosted keywords (ir.BoostOption) are weighted with `^`, and keywords with optional wildcards
+// are searched as their spellings.
+//
+// "and", "or", and "not" groups use `AND`, `OR`, and `NOT`, and a "not" group of a single operand excludes it from
+// every document, e.g. `(*:* NOT title:asthma)`. Lucene only has proximity within a phrase, so an adjacency group of
+// keywords without wildcards searched in the same fields is a phrase with a slop, e.g. `title:"asthma wheeze"~2` for
+// `adj3`. The slop of Lucene counts the words between the terms, whereas `adj` in the ir counts the distance between
+// the terms. Any other adjacency group is an error.
+//
+// Validate reports the keywords which are not faithfully represented.
+type LuceneBackend struct{}
+
+// Representation returns the query string.
+func (q LuceneQuery) Representation() (interface{}, error) {
+	return q.repr, nil
+}
+
+// String returns the query string.
+func (q LuceneQuery) String() (string, error) {
+	return q.repr, nil
+}
+
+// StringPretty returns the query string.
+func (q LuceneQuery) StringPretty() (string, error) {
+	return q.repr, nil
+}
+
+// lucenePhrase compiles an adjacency group of keywords into a phrase with a slop, searched in each of the fields of
+// the keywords, e.g. `title:"asthma wheeze"~2`.
+func lucenePhrase(q ir.BooleanQuery) (string, error) {
+	if len(q.Children) > 0 || len(q.Keywords) == 0 {
+		return "", errors.New("the adjacency of groups cannot be searched in lucene")
+	}
+	var terms []string
+	phraseFields := strings.Join(sortedFields(q.Keywords[0].Fields), ",")
+	for _, keyword := range q.Keywords {
+		if keyword.Truncated || strings.Join(sortedFields(keyword.Fields), ",") != phraseFields {
+			return "", fmt.Errorf("the adjacency of `%v` cannot be searched in lucene, since only the terms of a "+
+				"phrase in the same fields can be", keyword.QueryString)
+		}
+		terms = append(terms, strings.Trim(keyword.QueryString, `"`))
+	}
+	distance, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(adjacencyOperator(q)), "adj"))
+	if err != nil {
+		distance = 1
+	}
+	phrase := fmt.Sprintf("%v~%d", escapeLucene(`"`+strings.Join(terms, " ")+`"`, false), distance-1)
+	var s []string
+	for _, field := range q.Keywords[0].Fields {
+		s = append(s, field+":"+phrase)
+	}
+	if len(s) == 1 {
+		return s[0], nil
+	}
+	return "(" + strings.Join(s, " OR ") + ")", nil
+}
+
+// compileLucene compiles a query into a Lucene query string. Nested groups are parenthesised when they combine more
+// than one operand. The first operand of a "not" group is searched, and the others are excluded from it.
+func compileLucene(q ir.BooleanQuery, nested bool) (string, error) {
+	operator := strings.ToLower(adjacencyOperator(q))
+	if strings.HasPrefix(operator, "adj") {
+		return lucenePhrase(q)
+	}
+
+	var operands []string
+	for _, child := range q.Children {
+		s, err := compileLucene(child, true)
+		if err != nil {
+			return "", err
+		}
+		if len(s) > 0 {
+			operands = append(operands, s)
+		}
+	}
+	for _, keyword := range q.Keywords {
+		_, proximity := keyword.Options[ir.ProximityOption]
+		if _, fuzzy := keyword.Options[ir.FuzzinessOption]; proximity && fuzzy {
+			return "", fmt.Errorf("the keyword `%v` cannot have both a proximity and a fuzziness", keyword.QueryString)
+		}
+		s, err := renderSpellings(keyword, luceneKeyword)
+		if err != nil {
+			return "", err
+		}
+		operands = append(operands, s)
+	}
+
+	var s string
+	switch {
+	case len(operands) == 1 && operator == "not":
+		// A "not" group of a single operand excludes it from every document.
+		s = "*:* NOT " + operands[0]
+	case len(operands) <= 1:
+		return strings.Join(operands, ""), nil
+	case operator == "or" || operator == "not":
+		s = strings.Join(operands, " "+strings.ToUpper(operator)+" ")
+	default:
+		s = strings.Join(operands, " AND ")
+	}
+	if nested {
+		return "(" + s + ")", nil
+	}
+	return s, nil
+}
+
+// Compile transforms the ir into a Lucene query string.
+func (b LuceneBackend) Compile(q ir.BooleanQuery) (BooleanQuery, error) {
+	s, err := compileLucene(q, false)
+	if err != nil {
+		return nil, err
+	}
+	return LuceneQuery{repr: s}, nil
+}
+
+// Validate reports the keywords with a minimum frequency, since Lucene cannot search the number of times a keyword
+// appears in a document.
+func (b LuceneBackend) Validate(q ir.BooleanQuery) []ir.Warning {
+	return unsupportedOptions(q, ir.FrequencyOption)
+}
+
+// NewLuceneBackend returns a new Lucene query syntax backend.
+func NewLuceneBackend() LuceneBackend {
+	return LuceneBackend{}
+}
@@ -0,0 +1,65 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/hscells/transmute/fields"
+	"github.com/hscells/transmute/ir"
+)
+
+func TestLuceneBackend_Compile(t *testing.T) {
+	title := func(s string) ir.Keyword {
+		return ir.Keyword{QueryString: s, Fields: []string{fields.Title}}
+	}
+	fuzzy := title("tumour")
+	fuzzy.Options = map[string]interface{}{ir.FuzzinessOption: 2}
+	boosted := ir.Keyword{QueryString: "asthm*", Fields: []string{fields.Title, fields.Abstract}, Truncated: true,
+		Options: map[string]interface{}{ir.BoostOption: 2}}
+	optional := ir.Keyword{QueryString: "colo" + string(ir.OptionalWildcard) + "r", Fields: []string{fields.Title},
+		Truncated: true}
+	truncated := ir.Keyword{QueryString: "attack*", Fields: []string{fields.Title}, Truncated: true}
+	abstract := ir.Keyword{QueryString: "attack", Fields: []string{fields.Abstract}}
+
+	for _, c := range []struct {
+		query    ir.BooleanQuery
+		expected string
+	}{
+		{ir.BooleanQuery{Operator: "and", Keywords: []ir.Keyword{title("p<0.05"), fuzzy}},
+			`title:p\<0.05 AND title:tumour~2`},
+		{ir.BooleanQuery{Operator: "or", Keywords: []ir.Keyword{boosted, optional}},
+			`(title:asthm*^2 OR text:asthm*^2) OR (title:color OR title:colo?r)`},
+		{ir.BooleanQuery{Operator: "not", Keywords: []ir.Keyword{title("asthma"), title("child")}},
+			`title:asthma NOT title:child`},
+		{ir.BooleanQuery{Operator: "or", Keywords: []ir.Keyword{title("adult")},
+			Children: []ir.BooleanQuery{{Operator: "not", Keywords: []ir.Keyword{title("child")}}}},
+			`(*:* NOT title:child) OR title:adult`},
+		{ir.BooleanQuery{Operator: "and", Keywords: []ir.Keyword{title("asthma")},
+			Children: []ir.BooleanQuery{{Operator: "adj3", Keywords: []ir.Keyword{title("heart"), title("attack")}}}},
+			`title:"heart attack"~2 AND title:asthma`},
+	} {
+		b, err := NewLuceneBackend().Compile(c.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := b.String()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.expected {
+			t.Fatalf("Expected %v, got %v", c.expected, got)
+		}
+	}
+
+	// Only the terms of a phrase can be adjacent, and a phrase cannot also be fuzzy.
+	phrase := title("heart attack")
+	phrase.Options = map[string]interface{}{ir.ProximityOption: 3, ir.FuzzinessOption: 1}
+	for _, q := range []ir.BooleanQuery{
+		{Operator: "adj3", Keywords: []ir.Keyword{title("heart"), truncated}},
+		{Operator: "adj3", Keywords: []ir.Keyword{title("heart"), abstract}},
+		{Operator: "or", Keywords: []ir.Keyword{phrase}},
+	} {
+		if _, err := NewLuceneBackend().Compile(q); err == nil {
+			t.Fatalf("Expected an error compiling %v", q)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package backend
 
 import (
+	"errors"
 	"fmt"
 	"github.com/hscells/transmute/fields"
 	"github.com/hscells/transmute/ir"
@@ -11,7 +12,41 @@ import (
 	"strings"
 )
 
+// MedlineBackend compiles queries into Medline (Ovid) search strategies. The options of a keyword which are understood
+// by the backend are:
+//
+//   - ir.ProximityOption, which searches the terms of a phrase with `adj`, e.g. `(heart adj3 attack).ti,ab.`;
+//   - ir.FrequencyOption, which is added to the line of the keyword, e.g. `asthma.ab./freq=3`;
+//   - ir.CommentOption, which is written as a comment line above the line of the keyword (or of a group).
+//
+// The distance of an adjacency group (ir.DistanceOption) is used in place of the distance of its operator. Ovid has no
+// in order adjacency, so ir.InOrderOption is ignored.
 type MedlineBackend struct {
+	// ForceExplode emits every MeSH heading as exploded (`exp`), regardless of the explosion of the keyword.
+	ForceExplode bool
+	// ForceNoExplode emits every MeSH heading as not exploded, regardless of the explosion of the keyword.
+	ForceNoExplode bool
+	// StartLine is the number of the first line of the search strategy, so that a compiled query can be added to the
+	// end of an existing strategy. Numbering starts at 1 when StartLine is not set.
+	StartLine int
+	// DisableShorthand always combines lines in the long form (e.g. `1 or 2 or 3`), even when the lines could be
+	// combined in the short hand form (e.g. `or/1-3`), for importers that do not understand the short hand form.
+	DisableShorthand bool
+	// AlwaysFinalCombine always combines the lines of the top level of the query in a single final line in the long
+	// form (e.g. `7. 2 and 4 and 6`), even when the lines could be combined in the short hand form, for review tools
+	// which count the final result set from the last combining line.
+	AlwaysFinalCombine bool
+	// ExistingLines are the lines of an existing search strategy which the compiled query is added to, keyed by their
+	// text without the line number (e.g. `exp Asthma/` or `1 or 2`). A line of the compiled query which is the same as
+	// an existing line is not repeated; the existing line is referenced instead. It is used with StartLine.
+	ExistingLines map[string]int
+	// ExplicitFields writes the field codes of each field of a keyword (e.g. `.ti,ab.`), rather than a field code which
+	// abbreviates them (e.g. `.tw.`), for strategies which are published and must be clear about what they search.
+	ExplicitFields bool
+
+	// fieldCodes are the field codes of the database the strategy searches. The Medline field codes are used when it
+	// is not set.
+	fieldCodes *fieldCodes
 }
 
 type MedlineQuery struct {
@@ -30,90 +65,331 @@ func (m MedlineQuery) StringPretty() (string, error) {
 	return m.repr, nil
 }
 
-func compileMedline(q ir.BooleanQuery, level int) (l int, query MedlineQuery) {
+// medlineFields maps Medline field codes to fields in the ir.
+var medlineFields = map[string][]string{
+	"ti,ab,sh": {fields.AllFields},
+	"ti,ab":    {fields.TitleAbstract},
+	"ti,ab,kw": {fields.TitleAbstract, fields.Keywords},
+	"kw":       {fields.Keywords},
+	"ab":       {fields.Abstract},
+	"af":       {fields.AllFields},
+	"ai":       {fields.AuthorFull},
+	"as":       {fields.PublicationDate},
+	"au":       {fields.Authors},
+	"ax":       {fields.AuthorLast},
+	"ba":       {fields.Authors},
+	"bd":       {fields.PublicationDate},
+	"be":       {fields.Editor},
+	"bf":       {fields.Authors},
+	"em":       {fields.PublicationDate},
+	"ed":       {fields.PublicationDate},
+	"fa":       {fields.AuthorFull},
+	"fe":       {fields.Editor},
+	"fs":       {fields.FloatingMeshHeadings},
+	"hw":       {fields.HeadingWord},
+	"ot":       {fields.Title},
+	"mh":       {fields.MeshHeadings},
+	"px":       {fields.MeshHeadings},
+	"pt":       {fields.PublicationType},
+	"rs":       {fields.AllFields},
+	"rn":       {fields.AllFields},
+	"sb":       {fields.PublicationType},
+	"sh":       {fields.MeSHSubheading},
+	"tw":       {fields.TextWord},
+	"ti":       {fields.Title},
+	"ui":       {fields.PMID},
+	"ja":       {fields.Journal},
+	"jn":       {fields.Journal},
+	"jw":       {fields.Journal},
+}
+
+// medlinePreferredFields are the field codes used for fields which more than one field code maps to, e.g. all fields
+// are searched with `.af.` rather than `.rn.`, and the title with `.ti.` rather than `.ot.`.
+var medlinePreferredFields = map[string]string{
+	fields.AllFields:       "af",
+	fields.Title:           "ti",
+	fields.Authors:         "au",
+	fields.Journal:         "jn",
+	fields.PublicationType: "pt",
+}
+
+// sameFields determines if two slices contain the same fields, regardless of the order of the fields.
+func sameFields(a, b []string) bool {
+	a = set.Strings(sortedFields(a))
+	b = set.Strings(sortedFields(b))
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// sortedFields returns a sorted copy of fields, so the fields of a keyword (which may be shared with the field mapping
+// of a parser) are not modified.
+func sortedFields(f []string) []string {
+	s := append([]string{}, f...)
+	sort.Strings(s)
+	return s
+}
+
+// fieldCodes are the field codes of a database searched through Ovid. Each database has its own field codes, and
+// the same code may search different fields of different databases (e.g. `.tw.` searches more fields of Embase than
+// of Medline), so each backend maps the fields of the ir to the field codes of its own database.
+type fieldCodes struct {
+	// codes maps field codes to fields in the ir.
+	codes map[string][]string
+	// preferred are the field codes used for fields which more than one field code maps to.
+	preferred map[string]string
+}
+
+// medlineFieldCodes are the field codes of Medline.
+var medlineFieldCodes = fieldCodes{codes: medlineFields, preferred: medlinePreferredFields}
+
+// code finds the field code for the fields of a keyword. The order of the fields does not matter, so the title and
+// abstract fields map to `ti,ab` however they are ordered. An empty string is returned when there is no field code for
+// the fields.
+func (c fieldCodes) code(keywordFields []string) string {
+	keywordFields = set.Strings(sortedFields(keywordFields))
+	if len(keywordFields) == 1 {
+		if f, ok := c.preferred[keywordFields[0]]; ok {
+			return f
+		}
+	}
+
+	// The field codes are checked in order, so the same field code is always found for the same fields.
+	codes := make([]string, 0, len(c.codes))
+	for f := range c.codes {
+		codes = append(codes, f)
+	}
+	sort.Strings(codes)
+
+	for _, f := range codes {
+		if sameFields(c.codes[f], keywordFields) {
+			return f
+		}
+	}
+
+	// Otherwise, the fields may be those of each part of a combined field code, e.g. the title and abstract fields are
+	// the fields of `ti` and `ab`.
+	for _, f := range codes {
+		if !strings.Contains(f, ",") {
+			continue
+		}
+		var partFields []string
+		for _, part := range strings.Split(f, ",") {
+			partFields = append(partFields, c.codes[part]...)
+		}
+		if sameFields(partFields, keywordFields) {
+			return f
+		}
+	}
+	return ""
+}
+
+// explicitFieldParts are the fields of the ir which are searched as more than one field, so that they are written as
+// the field codes of each part when field codes are explicit.
+var explicitFieldParts = map[string][]string{
+	fields.TitleAbstract: {fields.Title, fields.Abstract},
+	fields.TextWord:      {fields.Title, fields.Abstract},
+}
+
+// explicit finds the field codes of each field of a keyword, in the order of the fields, e.g. `ti,ab,sh`, rather than
+// a field code which abbreviates them. An empty string is returned when a field has no field code.
+func (c fieldCodes) explicit(keywordFields []string) string {
+	var codes []string
+	seen := make(map[string]bool)
+	for _, field := range keywordFields {
+		parts, ok := explicitFieldParts[field]
+		if !ok {
+			parts = []string{field}
+		}
+		for _, part := range parts {
+			code := c.code([]string{part})
+			if len(code) == 0 {
+				return ""
+			}
+			if !seen[code] {
+				seen[code] = true
+				codes = append(codes, code)
+			}
+		}
+	}
+	return strings.Join(codes, ",")
+}
+
+// field finds the field code for the fields of a keyword in the database the strategy searches. An empty string is
+// returned when the fields have no field code.
+func (b MedlineBackend) field(keywordFields []string) string {
+	c := medlineFieldCodes
+	if b.fieldCodes != nil {
+		c = *b.fieldCodes
+	}
+	if b.ExplicitFields {
+		return c.explicit(keywordFields)
+	}
+	if code := c.code(keywordFields); len(code) > 0 {
+		return code
+	}
+	// Fields which no single field code searches, e.g. the title, abstract, and MeSH headings, are written explicitly.
+	return c.explicit(keywordFields)
+}
+
+// mapped determines if the fields of a keyword have a field code, or are the MeSH headings, which have none.
+func (b MedlineBackend) mapped(keyword ir.Keyword) bool {
+	if len(keyword.Fields) == 1 && keyword.Fields[0] == fields.MeshHeadings {
+		return true
+	}
+	return len(b.field(append([]string{}, keyword.Fields...))) > 0
+}
+
+// unmappedKeyword finds the first keyword in a query whose fields have no field code, which cannot be written as a
+// line of a strategy.
+func (b MedlineBackend) unmappedKeyword(q ir.BooleanQuery) (keyword *ir.Keyword) {
+	ir.Walk(&q, ir.VisitorFuncs{Keyword: func(k *ir.Keyword) bool {
+		if !b.mapped(*k) {
+			keyword = k
+		}
+		return keyword == nil
+	}})
+	return
+}
+
+// medlineProximity searches the terms of a phrase within a distance of each other, e.g. `"heart attack"` within two
+// words becomes `(heart adj3 attack)`. The distance of the ir counts the words between the terms, whereas `adj` counts
+// the distance between the terms.
+func medlineProximity(qs string, distance interface{}) string {
+	terms := strings.Fields(strings.Trim(qs, `"`))
+	n, err := strconv.Atoi(fmt.Sprint(distance))
+	if err != nil || len(terms) < 2 {
+		return qs
+	}
+	return "(" + strings.Join(terms, fmt.Sprintf(" adj%d ", n+1)) + ")"
+}
+
+// medlineComment writes the comment in the options of a keyword or group as a comment line, e.g. `# population`, to
+// go above the line of the keyword or group.
+func medlineComment(options map[string]interface{}) string {
+	if comment, ok := options[ir.CommentOption]; ok {
+		return fmt.Sprintf("# %v\n", comment)
+	}
+	return ""
+}
+
+// medlineLimits creates the limit lines, e.g. `4. limit 3 to humans`, for the limits in the options of a keyword or
+// group, starting at the line level. The first limit line limits the line ref, and each limit line after it limits the
+// line before it. The returned level is the next free line, and the returned reference is the line of the last limit
+// line (or ref when there are no limits), which is the line to be referenced.
+func medlineLimits(options map[string]interface{}, ref, level int) (string, int, int) {
+	var limits []string
+	switch v := options[ir.LimitOption].(type) {
+	case []string:
+		limits = v
+	case []interface{}:
+		for _, limit := range v {
+			limits = append(limits, fmt.Sprintf("%v", limit))
+		}
+	}
+	repr := ""
+	for _, limit := range limits {
+		repr += fmt.Sprintf("%v. limit %v to %v\n", level, ref, limit)
+		ref = level
+		level++
+	}
+	return repr, level, ref
+}
+
+// medlineKeyword compiles a keyword into the text of a line of a Medline search strategy, e.g. `exp Asthma/` or
+// `wheez*.ti,ab.`.
+func (b MedlineBackend) medlineKeyword(keyword ir.Keyword) string {
+	qs := keyword.QueryString
+	if len(keyword.Fields) == 1 && keyword.Fields[0] == fields.MeshHeadings {
+		// A heading containing a slash is quoted, so the slash is not mistaken for the end of the heading.
+		if strings.Contains(qs, "/") && !strings.HasPrefix(qs, `"`) {
+			qs = `"` + qs + `"`
+		}
+		if (keyword.Exploded || b.ForceExplode) && !b.ForceNoExplode {
+			qs = "exp " + qs
+		}
+		// A heading qualified by a subheading, e.g. `Asthma/drug therapy`, is not followed by a slash.
+		if subheading, ok := keyword.Options[ir.SubheadingOption]; ok {
+			return fmt.Sprintf("%v/%v", qs, subheading)
+		}
+		return qs + "/"
+	}
+	mf := b.field(keyword.Fields)
+	if len(mf) == 0 {
+		log.Println("WARNING: could not map fields: ", keyword)
+	} else if mf == "sh" && keyword.Exploded {
+		mf = "xs"
+	}
+	if distance, ok := keyword.Options[ir.ProximityOption]; ok {
+		qs = medlineProximity(qs, distance)
+	} else {
+		qs = escapeMedline(qs)
+	}
+	qs = fmt.Sprintf("%v.%v.", qs, mf)
+	if frequency, ok := keyword.Options[ir.FrequencyOption]; ok {
+		qs = fmt.Sprintf("%v/freq=%v", qs, frequency)
+	}
+	return qs
+}
+
+// compileMedline compiles a query into the lines of a Medline search strategy, starting at the line level. The lines
+// of a final query (i.e. the top level of the query) are combined in the last line of the strategy. The returned level
+// is the next free line, and the returned reference is the line which the query is referenced by, which is one of the
+// ExistingLines when the query is already in the strategy being added to.
+func (b MedlineBackend) compileMedline(q ir.BooleanQuery, level int, final bool) (l int, ref int, query MedlineQuery) {
 	repr := ""
 	var op []int
-	if q.Keywords == nil && len(q.Operator) == 0 {
+	ref = level - 1
+	// The only operand of a final query is also final, as its lines end the strategy.
+	finalChild := final && len(q.Keywords)+len(q.Children) == 1
+	if len(q.Keywords) == 0 && len(q.Operator) == 0 {
 		for _, child := range q.Children {
 			var comp MedlineQuery
-			level, comp = compileMedline(child, level)
+			level, ref, comp = b.compileMedline(child, level, finalChild)
 			repr += comp.repr
 		}
-		return level, MedlineQuery{repr: repr}
+		lim, level, ref := medlineLimits(q.Options, ref, level)
+		return level, ref, MedlineQuery{repr: repr + lim}
 	}
 	for _, child := range q.Children {
-		l, comp := compileMedline(child, level)
+		l, r, comp := b.compileMedline(child, level, finalChild)
 		repr += comp.repr
 		level = l
-		op = append(op, l-1)
+		op = append(op, r)
 	}
 	for _, keyword := range q.Keywords {
-		var mf string
-		qs := keyword.QueryString
-		if len(keyword.Fields) == 1 && keyword.Fields[0] == fields.MeshHeadings {
-			if keyword.Exploded {
-				qs = "exp " + qs
-			}
-			qs += "/"
-		} else {
-			m := map[string][]string{
-				"ti,ab,sh": {fields.AllFields},
-				"ti,ab":    {fields.TitleAbstract},
-				"ab":       {fields.Abstract},
-				"ai":       {fields.AuthorFull},
-				"as":       {fields.PublicationDate},
-				"au":       {fields.Authors},
-				"ax":       {fields.AuthorLast},
-				"ba":       {fields.Authors},
-				"bd":       {fields.PublicationDate},
-				"be":       {fields.Editor},
-				"bf":       {fields.Authors},
-				"em":       {fields.PublicationDate},
-				"ed":       {fields.PublicationDate},
-				"fa":       {fields.AuthorFull},
-				"fe":       {fields.Editor},
-				"fs":       {fields.FloatingMeshHeadings},
-				"fx":       {fields.FloatingMeshHeadings},
-				"ot":       {fields.Title},
-				"mh":       {fields.MeshHeadings},
-				"px":       {fields.MeshHeadings},
-				"pt":       {fields.PublicationType},
-				"rs":       {fields.AllFields},
-				"rn":       {fields.AllFields},
-				"sb":       {fields.PublicationType},
-				"sh":       {fields.MeSHSubheading},
-				"tw":       {fields.TextWord},
-				"ti":       {fields.Title},
-				"ja":       {fields.Journal},
-				"jn":       {fields.Journal},
-				"jw":       {fields.Journal},
-			}
-			sort.Strings(keyword.Fields)
-			keyword.Fields = set.Strings(keyword.Fields)
-			for f, mappingFields := range m {
-				if len(mappingFields) != len(keyword.Fields) {
-					continue
-				}
-				for _, field := range keyword.Fields {
-					for _, f2 := range mappingFields {
-						if field == f2 || field == f {
-							mf = f
-							break
-						}
-					}
-				}
-			}
-			if len(mf) == 0 {
-				log.Println("WARNING: could not map fields: ", keyword)
-			}
-			qs = fmt.Sprintf("%v.%v.", qs, mf)
+		line := b.medlineKeyword(keyword)
+		if existing, ok := b.ExistingLines[line]; ok {
+			// The keyword is already a line of the strategy, so only its limits are added.
+			lim, l, r := medlineLimits(keyword.Options, existing, level)
+			repr += lim
+			op = append(op, r)
+			level = l
+			continue
 		}
-		repr += fmt.Sprintf("%v. %v\n", level, qs)
-		op = append(op, level)
-		level += 1
+		repr += medlineComment(keyword.Options)
+		repr += fmt.Sprintf("%v. %v\n", level, line)
+		lim, l, r := medlineLimits(keyword.Options, level, level+1)
+		repr += lim
+		op = append(op, r)
+		level = l
 	}
+	if len(op) == 1 {
+		// A group of a single operand does not need a line to combine it; the line of the operand is referenced instead.
+		lim, level, ref := medlineLimits(q.Options, op[0], level)
+		return level, ref, MedlineQuery{repr: repr + lim}
+	}
+	ref = level
 	if len(op) > 0 {
-		// This block of code determines if we can use the short hand version of grouping for medline e.g. or/1-9
+		var line string
+		// This block of code determines if we can use the short hand version of grouping for medline e.g. or/1-9. Only
+		// "and" and "or" have a short hand version.
 		o := op[0]
 		asc := true
 		for i := 1; i < len(op); i++ {
@@ -123,24 +399,60 @@ func compileMedline(q ir.BooleanQuery, level int) (l int, query MedlineQuery) {
 			}
 			o = op[i]
 		}
-		if asc && len(op) > 2 {
-			repr += fmt.Sprintf("%d. %s/%d-%d\n", level, q.Operator, op[0], op[len(op)-1])
+		shorthand := strings.ToLower(q.Operator) == "and" || strings.ToLower(q.Operator) == "or"
+		if asc && shorthand && len(op) > 2 && !b.DisableShorthand && !(final && b.AlwaysFinalCombine) {
+			line = fmt.Sprintf("%s/%d-%d", q.Operator, op[0], op[len(op)-1])
 		} else {
 			// Otherwise we need to use the long form version.
 			ops := make([]string, len(op))
 			for i, o := range op {
 				ops[i] = strconv.Itoa(o)
 			}
-			repr += fmt.Sprintf("%v. %v\n", level, strings.Join(ops, fmt.Sprintf(" %v ", q.Operator)))
+			line = strings.Join(ops, fmt.Sprintf(" %v ", adjacencyOperator(q)))
+		}
+		if existing, ok := b.ExistingLines[line]; ok {
+			ref = existing
+		} else {
+			repr += medlineComment(q.Options)
+			repr += fmt.Sprintf("%v. %v\n", level, line)
+			level++
 		}
+	} else {
+		level++
+	}
+	lim, level, ref := medlineLimits(q.Options, ref, level)
+	return level, ref, MedlineQuery{repr: repr + lim}
+}
+
+func (b MedlineBackend) Compile(q ir.BooleanQuery) (BooleanQuery, error) {
+	if b.ForceExplode && b.ForceNoExplode {
+		return nil, errors.New("a medline backend cannot both force and prevent the explosion of MeSH headings")
+	}
+	if unaryNot(q) {
+		return nil, errors.New("a medline search strategy cannot negate a line without a line to exclude it from")
+	}
+	if err := checkExists(q, existsUnsupported("medline")); err != nil {
+		return nil, err
+	}
+	if k := b.unmappedKeyword(q); k != nil {
+		return nil, fmt.Errorf("the fields %v of the keyword %v have no medline field code", k.Fields, k.QueryString)
+	}
+	start := 1
+	if b.StartLine > 0 {
+		start = b.StartLine
 	}
-	level += 1
-	return level, MedlineQuery{repr: repr}
+	_, _, m := b.compileMedline(q, start, true)
+	return m, nil
 }
 
-func (b MedlineBackend) Compile(ir ir.BooleanQuery) (BooleanQuery, error) {
-	_, q := compileMedline(ir, 1)
-	return q, nil
+// unaryNot determines if a query contains a "not" group of a single operand, which negates the operand rather than
+// excluding it from another operand.
+func unaryNot(q ir.BooleanQuery) (found bool) {
+	ir.Walk(&q, ir.VisitorFuncs{Query: func(g *ir.BooleanQuery) bool {
+		found = found || strings.ToLower(g.Operator) == "not" && len(g.Keywords)+len(g.Children) == 1
+		return !found
+	}})
+	return
 }
 
 func NewMedlineBackend() MedlineBackend {
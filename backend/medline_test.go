@@ -0,0 +1,329 @@
+package backend
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hscells/transmute/fields"
+	"github.com/hscells/transmute/ir"
+)
+
+func medlineKeyword(s string) ir.Keyword {
+	return ir.Keyword{QueryString: s, Fields: []string{fields.TitleAbstract}}
+}
+
+func TestMedlineBackend_Compile(t *testing.T) {
+	queries := []struct {
+		query    ir.BooleanQuery
+		expected string
+	}{
+		{
+			// A group of two keywords.
+			ir.BooleanQuery{Operator: "or", Keywords: []ir.Keyword{medlineKeyword("a"), medlineKeyword("b")}},
+			"1. a.ti,ab.\n2. b.ti,ab.\n3. 1 or 2\n",
+		},
+		{
+			// A group of a keyword and a subgroup.
+			ir.BooleanQuery{
+				Operator: "and",
+				Keywords: []ir.Keyword{medlineKeyword("a")},
+				Children: []ir.BooleanQuery{{Operator: "or", Keywords: []ir.Keyword{medlineKeyword("b"), medlineKeyword("c")}}},
+			},
+			"1. b.ti,ab.\n2. c.ti,ab.\n3. 1 or 2\n4. a.ti,ab.\n5. 3 and 4\n",
+		},
+		{
+			// A group of a keyword and a subgroup wrapped in a group without an operator.
+			ir.BooleanQuery{
+				Operator: "and",
+				Keywords: []ir.Keyword{medlineKeyword("a")},
+				Children: []ir.BooleanQuery{{Keywords: []ir.Keyword{}, Children: []ir.BooleanQuery{{Operator: "or", Keywords: []ir.Keyword{medlineKeyword("b"), medlineKeyword("c")}}}}},
+			},
+			"1. b.ti,ab.\n2. c.ti,ab.\n3. 1 or 2\n4. a.ti,ab.\n5. 3 and 4\n",
+		},
+		{
+			// A group of a keyword and a subgroup containing a single keyword.
+			ir.BooleanQuery{
+				Operator: "and",
+				Keywords: []ir.Keyword{medlineKeyword("a")},
+				Children: []ir.BooleanQuery{{Keywords: []ir.Keyword{medlineKeyword("b")}}},
+			},
+			"1. b.ti,ab.\n2. a.ti,ab.\n3. 1 and 2\n",
+		},
+		{
+			// A single keyword.
+			ir.BooleanQuery{Keywords: []ir.Keyword{medlineKeyword("a")}},
+			"1. a.ti,ab.\n",
+		},
+		{
+			// A phrase with proximity and frequency options.
+			ir.BooleanQuery{Keywords: []ir.Keyword{{
+				QueryString: `"heart attack"`,
+				Fields:      []string{fields.TitleAbstract},
+				Options:     map[string]interface{}{ir.ProximityOption: 2, ir.FrequencyOption: 3},
+			}}},
+			"1. (heart adj3 attack).ti,ab./freq=3\n",
+		},
+		{
+			// An exploded subheading.
+			ir.BooleanQuery{Keywords: []ir.Keyword{{QueryString: "drug therapy", Fields: []string{fields.MeSHSubheading}, Exploded: true}}},
+			"1. drug therapy.xs.\n",
+		},
+	}
+
+	for _, q := range queries {
+		c, err := NewMedlineBackend().Compile(q.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := c.String()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != q.expected {
+			t.Fatalf("Expected\n%v\ngot\n%v", q.expected, s)
+		}
+	}
+}
+
+func TestMedlineBackend_DisableShorthand(t *testing.T) {
+	q := ir.BooleanQuery{Operator: "or", Keywords: []ir.Keyword{medlineKeyword("a"), medlineKeyword("b"), medlineKeyword("c")}}
+	for _, shorthand := range []struct {
+		disable  bool
+		expected string
+	}{
+		{false, "1. a.ti,ab.\n2. b.ti,ab.\n3. c.ti,ab.\n4. or/1-3\n"},
+		{true, "1. a.ti,ab.\n2. b.ti,ab.\n3. c.ti,ab.\n4. 1 or 2 or 3\n"},
+	} {
+		c, err := MedlineBackend{DisableShorthand: shorthand.disable}.Compile(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := c.String()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != shorthand.expected {
+			t.Fatalf("Expected\n%v\ngot\n%v", shorthand.expected, s)
+		}
+	}
+}
+
+func TestMedlineBackend_AlwaysFinalCombine(t *testing.T) {
+	q := ir.BooleanQuery{
+		Operator: "and",
+		Children: []ir.BooleanQuery{{Operator: "or", Keywords: []ir.Keyword{medlineKeyword("a"), medlineKeyword("b"), medlineKeyword("c")}}},
+		Keywords: []ir.Keyword{medlineKeyword("d"), medlineKeyword("e")},
+	}
+	queries := []struct {
+		query    ir.BooleanQuery
+		always   bool
+		expected string
+	}{
+		{q, false, "1. a.ti,ab.\n2. b.ti,ab.\n3. c.ti,ab.\n4. or/1-3\n5. d.ti,ab.\n6. e.ti,ab.\n7. and/4-6\n"},
+		// Only the final line is combined in the long form.
+		{q, true, "1. a.ti,ab.\n2. b.ti,ab.\n3. c.ti,ab.\n4. or/1-3\n5. d.ti,ab.\n6. e.ti,ab.\n7. 4 and 5 and 6\n"},
+		// The final line of a query wrapping a single group is the line of the group.
+		{ir.BooleanQuery{Children: q.Children}, true, "1. a.ti,ab.\n2. b.ti,ab.\n3. c.ti,ab.\n4. 1 or 2 or 3\n"},
+	}
+	for _, query := range queries {
+		c, err := MedlineBackend{AlwaysFinalCombine: query.always}.Compile(query.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := c.String()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != query.expected {
+			t.Fatalf("Expected\n%v\ngot\n%v", query.expected, s)
+		}
+	}
+}
+
+func TestMedlineBackend_ForceExplode(t *testing.T) {
+	q := ir.BooleanQuery{Operator: "or", Keywords: []ir.Keyword{
+		{QueryString: "Asthma", Fields: []string{fields.MeshHeadings}, Exploded: true},
+		{QueryString: "Lung", Fields: []string{fields.MeshHeadings}},
+		{QueryString: "wheez*", Fields: []string{fields.TitleAbstract}},
+	}}
+	for _, c := range []struct {
+		backend  MedlineBackend
+		expected string
+	}{
+		{MedlineBackend{}, "1. exp Asthma/\n2. Lung/\n3. wheez*.ti,ab.\n4. or/1-3\n"},
+		{MedlineBackend{ForceExplode: true}, "1. exp Asthma/\n2. exp Lung/\n3. wheez*.ti,ab.\n4. or/1-3\n"},
+		{MedlineBackend{ForceNoExplode: true}, "1. Asthma/\n2. Lung/\n3. wheez*.ti,ab.\n4. or/1-3\n"},
+	} {
+		m, err := c.backend.Compile(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s, _ := m.String(); s != c.expected {
+			t.Fatalf("Expected\n%v\ngot\n%v", c.expected, s)
+		}
+	}
+
+	// MeSH headings cannot be both forced and prevented from exploding.
+	if _, err := (MedlineBackend{ForceExplode: true, ForceNoExplode: true}).Compile(q); err == nil {
+		t.Fatal("Expected an error")
+	}
+}
+
+func TestMedlineBackend_StartLine(t *testing.T) {
+	q := ir.BooleanQuery{
+		Operator: "and",
+		Children: []ir.BooleanQuery{{Operator: "or", Keywords: []ir.Keyword{medlineKeyword("a"), medlineKeyword("b"), medlineKeyword("c")}}},
+		Keywords: []ir.Keyword{medlineKeyword("d")},
+	}
+	for _, c := range []struct {
+		start    int
+		expected string
+	}{
+		{0, "1. a.ti,ab.\n2. b.ti,ab.\n3. c.ti,ab.\n4. or/1-3\n5. d.ti,ab.\n6. 4 and 5\n"},
+		{1, "1. a.ti,ab.\n2. b.ti,ab.\n3. c.ti,ab.\n4. or/1-3\n5. d.ti,ab.\n6. 4 and 5\n"},
+		// The lines are numbered from the start line, and so are the lines they combine.
+		{10, "10. a.ti,ab.\n11. b.ti,ab.\n12. c.ti,ab.\n13. or/10-12\n14. d.ti,ab.\n15. 13 and 14\n"},
+	} {
+		m, err := MedlineBackend{StartLine: c.start}.Compile(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s, _ := m.String(); s != c.expected {
+			t.Fatalf("Expected\n%v\ngot\n%v", c.expected, s)
+		}
+	}
+}
+
+func TestMedlineBackend_ExistingLines(t *testing.T) {
+	b := MedlineBackend{
+		StartLine:     4,
+		ExistingLines: map[string]int{"exp Asthma/": 1, "wheez*.ti,ab.": 2, "1 or 2": 3},
+	}
+	asthma := ir.Keyword{QueryString: "Asthma", Fields: []string{fields.MeshHeadings}, Exploded: true}
+	queries := []struct {
+		query    ir.BooleanQuery
+		expected string
+	}{
+		{
+			// The whole population block is already in the strategy.
+			ir.BooleanQuery{
+				Operator: "and",
+				Children: []ir.BooleanQuery{{Operator: "or", Keywords: []ir.Keyword{asthma, medlineKeyword("wheez*")}}},
+				Keywords: []ir.Keyword{medlineKeyword("child*")},
+			},
+			"4. child*.ti,ab.\n5. 3 and 4\n",
+		},
+		{
+			ir.BooleanQuery{Operator: "or", Keywords: []ir.Keyword{asthma, medlineKeyword("cough*")}},
+			"4. cough*.ti,ab.\n5. 1 or 4\n",
+		},
+		{
+			ir.BooleanQuery{Operator: "or", Keywords: []ir.Keyword{asthma, {
+				QueryString: "wheez*",
+				Fields:      []string{fields.TitleAbstract},
+				Options:     map[string]interface{}{ir.LimitOption: []string{"humans"}},
+			}}},
+			"4. limit 2 to humans\n5. 1 or 4\n",
+		},
+	}
+	for _, query := range queries {
+		c, err := b.Compile(query.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := c.String()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != query.expected {
+			t.Fatalf("Expected\n%v\ngot\n%v", query.expected, s)
+		}
+	}
+}
+
+func TestMedlineBackend_FieldOrder(t *testing.T) {
+	for _, f := range [][]string{
+		{fields.Title, fields.Abstract},
+		{fields.Abstract, fields.Title},
+		{fields.TitleAbstract},
+	} {
+		keywordFields := append([]string{}, f...)
+		c, err := NewMedlineBackend().Compile(ir.BooleanQuery{Keywords: []ir.Keyword{{QueryString: "asthma", Fields: keywordFields}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := c.String()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := "1. asthma.ti,ab.\n"; s != expected {
+			t.Fatalf("Expected %v for %v, got %v", expected, f, s)
+		}
+		if !reflect.DeepEqual(keywordFields, f) {
+			t.Fatalf("Expected the fields %v not to be modified, got %v", f, keywordFields)
+		}
+	}
+}
+
+func TestMedlineBackend_ExplicitFields(t *testing.T) {
+	q := ir.BooleanQuery{Operator: "or", Keywords: []ir.Keyword{
+		{QueryString: "asthma", Fields: []string{fields.TextWord}},
+		{QueryString: "wheez*", Fields: []string{fields.Title, fields.Abstract, fields.MeshHeadings}},
+		{QueryString: "inhaler", Fields: []string{fields.TitleAbstract, fields.MeSHSubheading}},
+	}}
+	// Fields which no single field code searches are written explicitly either way.
+	for _, c := range []struct {
+		explicit bool
+		expected string
+	}{
+		{false, "1. asthma.tw.\n2. wheez*.ti,ab,mh.\n3. inhaler.ti,ab,sh.\n4. or/1-3\n"},
+		{true, "1. asthma.ti,ab.\n2. wheez*.ti,ab,mh.\n3. inhaler.ti,ab,sh.\n4. or/1-3\n"},
+	} {
+		b := NewMedlineBackend()
+		b.ExplicitFields = c.explicit
+		if warnings := b.Validate(q); len(warnings) != 0 {
+			t.Fatalf("Expected no warnings, got %v", warnings)
+		}
+		m, err := b.Compile(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s, _ := m.String(); s != c.expected {
+			t.Fatalf("Expected\n%v\ngot\n%v", c.expected, s)
+		}
+	}
+
+	// A keyword whose fields have no field code cannot be written as a line.
+	q.Keywords = append(q.Keywords, ir.Keyword{QueryString: "english", Fields: []string{fields.Language}})
+	if _, err := NewMedlineBackend().Compile(q); err == nil {
+		t.Fatalf("Expected an error for a keyword without a field code")
+	}
+}
+
+func TestNormalizeNot(t *testing.T) {
+	// a NOT b NOT c = (a NOT b) NOT c
+	q := ir.BooleanQuery{
+		Operator: "not",
+		Keywords: []ir.Keyword{medlineKeyword("a"), medlineKeyword("b"), medlineKeyword("c")},
+	}.NormalizeNot()
+
+	for _, c := range []struct {
+		compiler Compiler
+		expected string
+	}{
+		{NewPubmedBackend(), "((a[Title/Abstract] NOT b[Title/Abstract]) NOT c[Title/Abstract])"},
+		{NewMedlineBackend(), "1. a.ti,ab.\n2. b.ti,ab.\n3. 1 not 2\n4. c.ti,ab.\n5. 3 not 4\n"},
+	} {
+		b, err := c.compiler.Compile(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := b.String()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.expected {
+			t.Fatalf("Expected %v, got %v", c.expected, got)
+		}
+	}
+}
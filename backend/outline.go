@@ -0,0 +1,89 @@
+package backend
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hscells/transmute/ir"
+)
+
+// OutlineQuery is a plain-text outline of a query, suitable for including in the methods section of a paper.
+type OutlineQuery struct {
+	repr string
+}
+
+// OutlineBackend is the compiler for rendering the ir as an indented outline.
+type OutlineBackend struct{}
+
+// Representation returns the outline as a string.
+func (q OutlineQuery) Representation() (interface{}, error) {
+	return q.repr, nil
+}
+
+// String returns the outline.
+func (q OutlineQuery) String() (string, error) {
+	return q.repr, nil
+}
+
+// StringPretty returns the outline; it is already indented.
+func (q OutlineQuery) StringPretty() (string, error) {
+	return q.repr, nil
+}
+
+// outlineKeyword renders a keyword as a line of the outline, e.g. `- asthma [title, abstract] (truncated)`.
+func outlineKeyword(keyword ir.Keyword) string {
+	line := "- " + keyword.QueryString
+	if len(keyword.Fields) > 0 {
+		line += " [" + strings.Join(keyword.Fields, ", ") + "]"
+	}
+	var flags []string
+	if keyword.Exploded {
+		flags = append(flags, "exploded")
+	}
+	if keyword.Truncated {
+		flags = append(flags, "truncated")
+	}
+	if distance, ok := keyword.Options[ir.ProximityOption]; ok {
+		flags = append(flags, fmt.Sprintf("within %v words", distance))
+	}
+	if len(flags) > 0 {
+		line += " (" + strings.Join(flags, ", ") + ")"
+	}
+	return line
+}
+
+// outline renders a query and all of its keywords and children, indented to the depth of the query. Groups without an
+// operator (e.g. the group wrapping a single nested query) are not rendered themselves; their operands are rendered
+// in their place.
+func outline(q ir.BooleanQuery, depth int, lines []string) []string {
+	if len(q.Operator) > 0 {
+		line := strings.Repeat("  ", depth) + strings.ToUpper(q.Operator)
+		if inOrder, ok := q.Options[ir.InOrderOption].(bool); ok && inOrder {
+			line += " (in order)"
+		}
+		lines = append(lines, line)
+		depth++
+	}
+	for _, child := range q.Children {
+		lines = outline(child, depth, lines)
+	}
+	for _, keyword := range q.Keywords {
+		lines = append(lines, strings.Repeat("  ", depth)+outlineKeyword(keyword))
+	}
+	return lines
+}
+
+// Compile renders the ir as an outline. Each group is shown with its operator, and each keyword is shown with its
+// fields and whether it is exploded or truncated, e.g.:
+//
+//	OR
+//	  - asthma [title, text] (truncated)
+//	  - Asthma [mesh_headings] (exploded)
+func (b OutlineBackend) Compile(q ir.BooleanQuery) (BooleanQuery, error) {
+	return OutlineQuery{repr: strings.Join(outline(q, 0, nil), "\n")}, nil
+}
+
+// NewOutlineBackend returns a new outline backend.
+func NewOutlineBackend() OutlineBackend {
+	return OutlineBackend{}
+}
@@ -0,0 +1,57 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/hscells/transmute/fields"
+	"github.com/hscells/transmute/ir"
+)
+
+func TestOutlineBackend_Compile(t *testing.T) {
+	title := func(s string) ir.Keyword {
+		return ir.Keyword{QueryString: s, Fields: []string{fields.Title}}
+	}
+	queries := []struct {
+		query    ir.BooleanQuery
+		expected string
+	}{
+		{
+			ir.BooleanQuery{
+				Operator: "and",
+				Children: []ir.BooleanQuery{{Operator: "or", Keywords: []ir.Keyword{
+					{QueryString: "wheez*", Fields: []string{fields.TitleAbstract}, Truncated: true},
+					{QueryString: `"heart attack"`, Fields: []string{fields.Title}, Options: map[string]interface{}{ir.ProximityOption: 2}},
+				}}},
+				Keywords: []ir.Keyword{{QueryString: "Asthma", Fields: []string{fields.MeshHeadings}, Exploded: true}},
+			},
+			"AND\n  OR\n    - wheez* [title_abstract] (truncated)\n    - \"heart attack\" [title] (within 2 words)\n  - Asthma [mesh_headings] (exploded)",
+		},
+		{
+			// The operand a "not" group excludes from comes first.
+			ir.BooleanQuery{
+				Operator: "not",
+				Children: []ir.BooleanQuery{{Operator: "or", Keywords: []ir.Keyword{title("asthma"), title("wheeze")}}},
+				Keywords: []ir.Keyword{title("animals")},
+			},
+			"NOT\n  OR\n    - asthma [title]\n    - wheeze [title]\n  - animals [title]",
+		},
+		{
+			// A group without an operator is rendered as its operands.
+			ir.BooleanQuery{Children: []ir.BooleanQuery{{
+				Operator: "adj3",
+				Keywords: []ir.Keyword{title("heart"), title("attack")},
+				Options:  map[string]interface{}{ir.InOrderOption: true},
+			}}},
+			"ADJ3 (in order)\n  - heart [title]\n  - attack [title]",
+		},
+	}
+	for _, q := range queries {
+		o, err := NewOutlineBackend().Compile(q.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s, _ := o.String(); s != q.expected {
+			t.Fatalf("Expected\n%v\ngot\n%v", q.expected, s)
+		}
+	}
+}
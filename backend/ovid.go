@@ -0,0 +1,71 @@
+package backend
+
+import (
+	"bufio"
+	"regexp"
+	"strings"
+
+	"github.com/hscells/transmute/ir"
+)
+
+var ovidLineRegexp, _ = regexp.Compile(`^([0-9]+)\. `)
+
+// OvidBackend compiles queries into search strategies that can be pasted directly into Ovid SP. The lines are the
+// same as those of the Medline backend, with the following differences:
+//
+//   - lines are numbered `1` rather than `1.`, as in the search history exported by Ovid SP;
+//   - comments are not written, since Ovid SP would run a comment line as a search;
+//   - whitespace in query strings is collapsed, so that headings are written as `exp Heading/` with no space before
+//     the `/`.
+type OvidBackend struct {
+	MedlineBackend
+}
+
+// OvidQuery is a search strategy for Ovid SP.
+type OvidQuery struct {
+	repr string
+}
+
+func (o OvidQuery) Representation() (interface{}, error) {
+	return o.repr, nil
+}
+
+func (o OvidQuery) String() (string, error) {
+	return o.repr, nil
+}
+
+func (o OvidQuery) StringPretty() (string, error) {
+	return o.repr, nil
+}
+
+// Compile transforms the ir into an Ovid SP search strategy.
+func (b OvidBackend) Compile(q ir.BooleanQuery) (BooleanQuery, error) {
+	m, err := b.MedlineBackend.Compile(q.NormalizeTerms(func(s string) string {
+		return strings.Join(strings.Fields(s), " ")
+	}))
+	if err != nil {
+		return nil, err
+	}
+	s, err := m.String()
+	if err != nil {
+		return nil, err
+	}
+
+	var repr strings.Builder
+	scanner := bufio.NewScanner(strings.NewReader(s))
+	for scanner.Scan() {
+		line := scanner.Text()
+		// Every line of a search is numbered, so any other line is a comment.
+		if !ovidLineRegexp.MatchString(line) {
+			continue
+		}
+		repr.WriteString(ovidLineRegexp.ReplaceAllString(line, "$1 "))
+		repr.WriteString("\n")
+	}
+	return OvidQuery{repr: repr.String()}, scanner.Err()
+}
+
+// NewOvidBackend creates a new backend for compiling Ovid SP search strategies.
+func NewOvidBackend() OvidBackend {
+	return OvidBackend{}
+}
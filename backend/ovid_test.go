@@ -0,0 +1,62 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/hscells/transmute/fields"
+	"github.com/hscells/transmute/ir"
+)
+
+func TestOvidBackend_Compile(t *testing.T) {
+	q := ir.BooleanQuery{
+		Operator: "and",
+		Children: []ir.BooleanQuery{
+			{
+				Operator: "or",
+				Keywords: []ir.Keyword{
+					{QueryString: "Aspergillus ", Fields: []string{fields.MeshHeadings}, Exploded: true},
+					{QueryString: "Aspergillosis", Fields: []string{fields.MeshHeadings}, Exploded: true},
+					{QueryString: "aspergill*", Fields: []string{fields.TitleAbstract}, Truncated: true},
+				},
+				Options: map[string]interface{}{ir.CommentOption: "condition"},
+			},
+			{
+				Operator: "or",
+				Keywords: []ir.Keyword{
+					{QueryString: "Mannans", Fields: []string{fields.MeshHeadings}},
+					{QueryString: "galactomannan*", Fields: []string{fields.TitleAbstract}, Truncated: true},
+				},
+			},
+		},
+	}
+	expected := `1 exp Aspergillus/
+2 exp Aspergillosis/
+3 aspergill*.ti,ab.
+4 or/1-3
+5 Mannans/
+6 galactomannan*.ti,ab.
+7 5 or 6
+8 4 and 7
+`
+	c, err := NewOvidBackend().Compile(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.String()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != expected {
+		t.Fatalf("Expected %v, got %v", expected, got)
+	}
+
+	b := NewOvidBackend()
+	b.StartLine = 10
+	c, err = b.Compile(ir.BooleanQuery{Keywords: []ir.Keyword{{QueryString: "Asthma", Fields: []string{fields.MeshHeadings}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := c.String(); got != "10 Asthma/\n" {
+		t.Fatalf("Expected %v, got %v", "10 Asthma/\n", got)
+	}
+}
@@ -0,0 +1,185 @@
+package backend
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hscells/transmute/fields"
+	"github.com/hscells/transmute/ir"
+)
+
+// ProQuestQuery is a query string for ProQuest Dialog, e.g. `TI,AB(asthma) AND MESH.EXACT.EXPLODE("Asthma")`.
+type ProQuestQuery struct {
+	repr string
+}
+
+// ProQuestBackend is the compiler for ProQuest Dialog queries. The fields of keywords are mapped to the indexes of
+// ProQuest, e.g. `TI(asthma)`, and keywords which search every field are searched anywhere except the full text, with
+// `NOFT(asthma)`. MeSH headings are searched with `MESH.EXACT` (or `MESH.EXACT.EXPLODE` when they are exploded).
+//
+// Adjacency groups use `NEAR/n`, or `PRE/n` when the operands must be in order (ir.InOrderOption). The distance of
+// ProQuest proximity counts the words between the operands, whereas `adj` in the ir counts the distance between the
+// operands, so `adj3` is `NEAR/2`. The distance of an adjacency group (ir.DistanceOption) is used in place of the
+// distance of its operator. Phrases with ir.ProximityOption are searched with `NEAR/n` between their terms.
+//
+// Validate reports the keywords which are not faithfully represented.
+type ProQuestBackend struct{}
+
+// Representation returns the query string.
+func (q ProQuestQuery) Representation() (interface{}, error) {
+	return q.repr, nil
+}
+
+// String returns the query string.
+func (q ProQuestQuery) String() (string, error) {
+	return q.repr, nil
+}
+
+// StringPretty returns the query string.
+func (q ProQuestQuery) StringPretty() (string, error) {
+	return q.repr, nil
+}
+
+// proquestFields maps the fields in the ir to ProQuest indexes.
+var proquestFields = map[string]string{
+	fields.Abstract:              "AB",
+	fields.Affiliation:           "AF",
+	fields.AllFields:             "NOFT",
+	fields.Author:                "AU",
+	fields.Authors:               "AU",
+	fields.HeadingWord:           "SU",
+	fields.Journal:               "PUB",
+	fields.Keywords:              "IF",
+	fields.Language:              "LA",
+	fields.MajorFocusMeshHeading: "MJMESH.EXACT",
+	fields.MeSHMajorTopic:        "MJMESH.EXACT",
+	fields.MeshHeadings:          "MESH.EXACT",
+	fields.MeSHTerms:             "MESH.EXACT",
+	fields.PublicationDate:       "PD",
+	fields.PublicationType:       "DTYPE",
+	fields.TextWord:              "TI,AB",
+	fields.Title:                 "TI",
+	fields.TitleAbstract:         "TI,AB",
+}
+
+// proquestIndex finds the ProQuest index for the fields of a keyword. Keywords with more than one field search the
+// indexes of each field, e.g. `TI,AB,IF`. An empty string is returned when a field has no index.
+func proquestIndex(keywordFields []string) string {
+	var indexes []string
+	seen := make(map[string]bool)
+	for _, field := range sortedFields(keywordFields) {
+		index, ok := proquestFields[field]
+		if !ok {
+			return ""
+		}
+		for _, i := range strings.Split(index, ",") {
+			if !seen[i] {
+				seen[i] = true
+				indexes = append(indexes, i)
+			}
+		}
+	}
+	return strings.Join(indexes, ",")
+}
+
+// proquestKeyword compiles a keyword into a ProQuest term, e.g. `TI,AB("heart attack")` or
+// `MESH.EXACT.EXPLODE("Asthma")`. Keywords whose fields have no index are searched anywhere except the full text.
+func proquestKeyword(keyword ir.Keyword) string {
+	qs := strings.TrimSpace(keyword.QueryString)
+	index := proquestIndex(keyword.Fields)
+	if len(index) == 0 {
+		index = "NOFT"
+	}
+	if strings.HasSuffix(index, "MESH.EXACT") {
+		if keyword.Exploded {
+			index += ".EXPLODE"
+		}
+		return fmt.Sprintf(`%v("%v")`, index, strings.Trim(qs, `"`))
+	}
+	if distance, ok := keyword.Options[ir.ProximityOption]; ok {
+		terms := strings.Fields(strings.Trim(qs, `"`))
+		if len(terms) > 1 {
+			qs = strings.Join(terms, fmt.Sprintf(" NEAR/%v ", distance))
+		}
+	} else if strings.ContainsAny(qs, " \t") && !strings.HasPrefix(qs, `"`) {
+		qs = `"` + qs + `"`
+	}
+	return fmt.Sprintf("%v(%v)", index, qs)
+}
+
+// proquestOperator is the ProQuest operator of a group, e.g. `OR` or `NEAR/2`.
+func proquestOperator(q ir.BooleanQuery) string {
+	operator := strings.ToLower(adjacencyOperator(q))
+	if !strings.HasPrefix(operator, "adj") {
+		return strings.ToUpper(operator)
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(operator, "adj"))
+	if err != nil {
+		n = 1
+	}
+	if n > 0 {
+		n--
+	}
+	if inOrder, ok := q.Options[ir.InOrderOption].(bool); ok && inOrder {
+		return fmt.Sprintf("PRE/%d", n)
+	}
+	return fmt.Sprintf("NEAR/%d", n)
+}
+
+// compileProQuest compiles a query into a ProQuest query string. Nested groups are parenthesised when they combine
+// more than one operand. The first operand of a "not" group is searched, and the others are excluded from it; a "not"
+// group of a single operand excludes it, e.g. `NOT TI(asthma)`.
+func compileProQuest(q ir.BooleanQuery, nested bool) string {
+	var operands []string
+	for _, child := range q.Children {
+		if s := compileProQuest(child, true); len(s) > 0 {
+			operands = append(operands, s)
+		}
+	}
+	for _, keyword := range q.Keywords {
+		operands = append(operands, proquestKeyword(keyword))
+	}
+	if len(operands) == 1 && strings.ToLower(q.Operator) == "not" {
+		// A "not" group of a single operand excludes it from every document.
+		s := "NOT " + operands[0]
+		if nested {
+			return "(" + s + ")"
+		}
+		return s
+	}
+	if len(operands) <= 1 {
+		return strings.Join(operands, "")
+	}
+	operator := proquestOperator(q)
+	if len(operator) == 0 {
+		operator = "AND"
+	}
+	s := strings.Join(operands, " "+operator+" ")
+	if nested {
+		return "(" + s + ")"
+	}
+	return s
+}
+
+// Compile transforms the ir into a ProQuest query string. An error is returned for the keywords which only require
+// their fields to be present, since ProQuest cannot search the presence of fields.
+func (b ProQuestBackend) Compile(q ir.BooleanQuery) (BooleanQuery, error) {
+	if err := checkExists(q, existsUnsupported("proquest")); err != nil {
+		return nil, err
+	}
+	return ProQuestQuery{repr: compileProQuest(q, false)}, nil
+}
+
+// Validate reports the keywords whose fields have no ProQuest index, which are searched anywhere except the full text
+// instead, and the keywords with options which ProQuest does not support.
+func (b ProQuestBackend) Validate(q ir.BooleanQuery) []ir.Warning {
+	return append(unmappedFields(q, func(keyword ir.Keyword) bool {
+		return len(proquestIndex(keyword.Fields)) > 0
+	}), unsupportedOptions(q, ir.BoostOption, ir.ExistsOption, ir.FrequencyOption, ir.FuzzinessOption)...)
+}
+
+// NewProQuestBackend returns a new ProQuest Dialog backend.
+func NewProQuestBackend() ProQuestBackend {
+	return ProQuestBackend{}
+}
@@ -0,0 +1,66 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/hscells/transmute/fields"
+	"github.com/hscells/transmute/ir"
+)
+
+func TestProQuestBackend_Compile(t *testing.T) {
+	q := ir.BooleanQuery{
+		Operator: "not",
+		Children: []ir.BooleanQuery{
+			{
+				Operator: "and",
+				Keywords: []ir.Keyword{{QueryString: "Asthma", Fields: []string{fields.MeshHeadings}, Exploded: true}},
+				Children: []ir.BooleanQuery{
+					{
+						Operator: "or",
+						Keywords: []ir.Keyword{
+							{QueryString: "child*", Fields: []string{fields.TitleAbstract}, Truncated: true},
+							{QueryString: "young people", Fields: []string{fields.AllFields}},
+							{QueryString: `"heart attack"`, Fields: []string{fields.Title}, Options: map[string]interface{}{ir.ProximityOption: 2}},
+						},
+					},
+					{
+						Operator: "adj3",
+						Keywords: []ir.Keyword{
+							{QueryString: "inhaler", Fields: []string{fields.Title, fields.Keywords}},
+							{QueryString: "technique", Fields: []string{fields.Title, fields.Keywords}},
+						},
+						Options: map[string]interface{}{ir.InOrderOption: true},
+					},
+				},
+			},
+			{Keywords: []ir.Keyword{{QueryString: "adult", Fields: []string{fields.Title}}}},
+		},
+	}
+	c, err := NewProQuestBackend().Compile(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := c.String()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `((TI,AB(child*) OR NOFT("young people") OR TI(heart NEAR/2 attack)) AND (IF,TI(inhaler) PRE/2 IF,TI(technique)) AND MESH.EXACT.EXPLODE("Asthma")) NOT TI(adult)`
+	if s != expected {
+		t.Fatalf("Expected %v, got %v", expected, s)
+	}
+}
+
+func TestProQuestBackend_Validate(t *testing.T) {
+	q := ir.BooleanQuery{
+		Operator: "or",
+		Keywords: []ir.Keyword{
+			{QueryString: "asthma", Fields: []string{fields.Title}},
+			{QueryString: "1234", Fields: []string{fields.PMID}},
+			{QueryString: "wheeze", Fields: []string{fields.Abstract}, Options: map[string]interface{}{ir.BoostOption: 2.0}},
+		},
+	}
+	warnings := NewProQuestBackend().Validate(q)
+	if len(warnings) != 2 {
+		t.Fatalf("Expected two warnings, got %v", warnings)
+	}
+}
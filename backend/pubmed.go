@@ -2,6 +2,7 @@ package backend
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"github.com/hscells/cqr"
 	"github.com/hscells/transmute/fields"
@@ -12,6 +13,9 @@ import (
 
 type PubmedBackend struct {
 	ReplaceAdj bool
+	// Variants are the known spellings of truncated keywords, keyed by their query strings, which are searched in place
+	// of the keywords (see ir.BooleanQuery.ExpandTruncation), e.g. `color` and `colour` for `colo?r`.
+	Variants map[string][]string
 }
 
 type PubmedQuery struct {
@@ -30,6 +34,209 @@ func (m PubmedQuery) StringPretty() (string, error) {
 	return m.repr, nil
 }
 
+// pubmedFields maps PubMed field names to fields in the ir.
+var pubmedFields = map[string][]string{
+	"Affiliation":                     {fields.Affiliation},
+	"All Fields":                      {fields.AllFields},
+	"Author":                          {fields.Author},
+	"Authors":                         {fields.Authors},
+	"Author - Corporate":              {fields.AuthorCorporate},
+	"Author - First":                  {fields.AuthorFirst},
+	"Author - Full":                   {fields.AuthorFull},
+	"Author - Identifier":             {fields.AuthorIdentifier},
+	"Author - Last":                   {fields.AuthorLast},
+	"Book":                            {fields.Book},
+	"Date - Completion":               {fields.DateCompletion},
+	"Conflict Of Interest Statements": {fields.ConflictOfInterestStatements},
+	"Date - Create":                   {fields.DateCreate},
+	"Date - Entrez":                   {fields.DateEntrez},
+	"Date - MeSH":                     {fields.DateMeSH},
+	"Date - Modification":             {fields.DateModification},
+	"Date - Publication":              {fields.DatePublication},
+	"EC/RN Number":                    {fields.ECRNNumber},
+	"Editor":                          {fields.Editor},
+	"Filter":                          {fields.Filter},
+	"Grant Number":                    {fields.GrantNumber},
+	"ISBN":                            {fields.ISBN},
+	"Investigator":                    {fields.Investigator},
+	"Investigator - Full":             {fields.InvestigatorFull},
+	"Issue":                           {fields.Issue},
+	"Journal":                         {fields.Journal},
+	"Language":                        {fields.Language},
+	"Location ID":                     {fields.LocationID},
+	"MeSH Major Topic":                {fields.MeSHMajorTopic},
+	"MeSH Subheading":                 {fields.MeSHSubheading},
+	"MeSH Terms":                      {fields.MeSHTerms},
+	"Other Term":                      {fields.OtherTerm},
+	"Pagination":                      {fields.Pagination},
+	"Pharmacological Action":          {fields.PharmacologicalAction},
+	"Publication Type":                {fields.PublicationType},
+	"Publisher":                       {fields.Publisher},
+	"Secondary Source ID":             {fields.SecondarySourceID},
+	"Subject Personal Name":           {fields.SubjectPersonalName},
+	"Supplementary Concept":           {fields.SupplementaryConcept},
+	"Floating MeshHeadings":           {fields.FloatingMeshHeadings},
+	"Text Word":                       {fields.TextWord},
+	"Title":                           {fields.Title},
+	"Title/Abstract":                  {fields.TitleAbstract},
+	"Transliterated Title":            {fields.TransliteratedTitle},
+	"Volume":                          {fields.Volume},
+	"MeSH Headings":                   {fields.MeshHeadings},
+	"Major Focus MeSH Heading":        {fields.MajorFocusMeshHeading},
+	"Publication Date":                {fields.PublicationDate},
+	"Publication Status":              {fields.PublicationStatus},
+	"pmid":                            {fields.PMID},
+}
+
+// pubmedField finds the PubMed field name for the fields of a keyword. An empty string is returned when there is no
+// field name for the fields.
+func pubmedField(keywordFields []string) string {
+	var mf string
+	sort.Strings(keywordFields)
+	for f, mappingFields := range pubmedFields {
+		if len(mappingFields) != len(keywordFields) {
+			continue
+		}
+		for _, field := range keywordFields {
+			for _, f2 := range mappingFields {
+				if field == f2 || field == f {
+					mf = f
+					break
+				}
+			}
+		}
+	}
+	return mf
+}
+
+// pubmedAll is the PubMed term which matches every document.
+const pubmedAll = "all[sb]"
+
+// pubmedExistsHedges are the PubMed terms which only require a field to be present in a document, e.g. `hasabstract`.
+var pubmedExistsHedges = map[string]string{
+	fields.Abstract: "hasabstract",
+}
+
+// pubmedExists compiles a keyword which only requires its fields to be present into the PubMed hedges for the fields,
+// e.g. `hasabstract`. An error is returned when the presence of a field has no hedge, since it cannot be searched.
+func pubmedExists(keyword ir.Keyword) (string, error) {
+	if len(keyword.Fields) == 0 {
+		return "", errors.New("the presence of a keyword without fields cannot be searched in pubmed")
+	}
+	var hedges []string
+	for _, field := range keyword.Fields {
+		hedge, ok := pubmedExistsHedges[field]
+		if !ok {
+			return "", fmt.Errorf("the presence of the field %v cannot be searched in pubmed", field)
+		}
+		hedges = append(hedges, hedge)
+	}
+	if len(hedges) == 1 {
+		return hedges[0], nil
+	}
+	return "(" + strings.Join(hedges, " OR ") + ")", nil
+}
+
+// pubmedExistsError is the error of compiling a keyword which only requires its fields to be present into PubMed.
+func pubmedExistsError(keyword ir.Keyword) error {
+	_, err := pubmedExists(keyword)
+	return err
+}
+
+// pubmedTruncation writes the wildcards of the query string of a keyword as PubMed searches them. PubMed only supports
+// truncation at the end of a term, and has no wildcard for a single character, so an optional wildcard is removed to
+// search the spelling without the character, e.g. `colo?r` is `color`, and a leading wildcard is removed. The internal
+// wildcards which cannot be searched are reported by pubmedWildcardError before a keyword is compiled.
+// https://www.nlm.nih.gov/bsd/disted/pubmedtutorial/020_460.html
+func pubmedTruncation(keyword ir.Keyword) string {
+	// The wildcard characters are searched as wildcards even when the keyword was not marked as truncated.
+	keyword.Truncated = true
+	wildcards := make(map[int]ir.Wildcard)
+	for _, w := range keyword.Wildcards() {
+		wildcards[w.Offset] = w
+	}
+	buff := new(bytes.Buffer)
+	for i, char := range keyword.QueryString {
+		w, ok := wildcards[i]
+		switch {
+		case !ok:
+			buff.WriteRune(char)
+		case w.Character == ir.OptionalWildcard || w.Position == ir.LeadingWildcard:
+			continue
+		case !strings.HasSuffix(buff.String(), "*"):
+			buff.WriteRune('*')
+		}
+	}
+	return buff.String()
+}
+
+// pubmedWildcardError is the error of compiling a keyword with a wildcard inside a term into PubMed, e.g. `gastr*itis`,
+// since PubMed only supports truncation at the end of a term. Optional wildcards are searched as the spelling without
+// the character instead (see pubmedTruncation).
+func pubmedWildcardError(keyword ir.Keyword) error {
+	keyword.Truncated = true
+	for _, w := range keyword.Wildcards() {
+		if w.Position == ir.InternalWildcard && w.Character != ir.OptionalWildcard {
+			return fmt.Errorf("the internal wildcard of %v cannot be searched in pubmed", keyword.QueryString)
+		}
+	}
+	return nil
+}
+
+// checkWildcards returns the error of the first keyword in a query with wildcards that cannot be compiled, as reported
+// by wildcard.
+func checkWildcards(q ir.BooleanQuery, wildcard func(keyword ir.Keyword) error) (err error) {
+	ir.Walk(&q, ir.VisitorFuncs{Keyword: func(k *ir.Keyword) bool {
+		err = wildcard(*k)
+		return err == nil
+	}})
+	return
+}
+
+// pubmedKeyword compiles a keyword into a PubMed term, e.g. `asthma[Title/Abstract]`.
+func pubmedKeyword(keyword ir.Keyword) string {
+	if keyword.Exists() {
+		// The hedges of the keyword are checked by checkExists before it is compiled.
+		hedge, _ := pubmedExists(keyword)
+		return hedge
+	}
+	var mf string
+	qs := pubmedTruncation(keyword)
+
+	qs = escapePubMed(qs)
+
+	// A MeSH heading may be qualified by a subheading, e.g. `asthma/drug therapy[majr]`.
+	if subheading, ok := keyword.Options[ir.SubheadingOption]; ok {
+		qs = fmt.Sprintf("%v/%v", qs, subheading)
+	}
+
+	if len(keyword.Fields) == 1 {
+		if keyword.Fields[0] == fields.MeshHeadings {
+			mf = "Mesh Terms"
+		} else if keyword.Fields[0] == fields.FloatingMeshHeadings {
+			mf = "MeSH Subheading"
+		} else if keyword.Fields[0] == fields.MajorFocusMeshHeading {
+			mf = "MeSH Major Topic"
+		}
+		if len(mf) > 0 && !keyword.Exploded {
+			mf += ":noexp"
+		}
+	}
+
+	if len(mf) == 0 {
+		mf = pubmedField(keyword.Fields)
+		// This should be a sensible enough default.
+		if len(mf) == 0 {
+			mf = "All Fields"
+		}
+	}
+	// Phrases can be searched with a proximity, e.g. `"heart attack"[tiab:~3]`.
+	if distance, ok := keyword.Options[ir.ProximityOption]; ok {
+		mf = fmt.Sprintf("%v:~%v", mf, distance)
+	}
+	return fmt.Sprintf("%v[%v]", qs, mf)
+}
+
 func compilePubmed(q ir.BooleanQuery, level int, replaceAdj bool) (l int, query PubmedQuery) {
 	if q.Keywords == nil && len(q.Operator) == 0 {
 		repr := ""
@@ -49,129 +256,41 @@ func compilePubmed(q ir.BooleanQuery, level int, replaceAdj bool) (l int, query
 	}
 	keywords := make([]string, len(q.Keywords))
 	for i, keyword := range q.Keywords {
-		var mf string
-		qs := keyword.QueryString
-		buff := new(bytes.Buffer)
-
-		// PubMed supports only end-truncation. There is no single character symbol.
-		// https://www.nlm.nih.gov/bsd/disted/pubmedtutorial/020_460.html
-		for i, char := range qs {
-			if i > 0 && (char == '?' || char == '$' || char == '*') {
-				buff.WriteRune('*')
-				if qs[0] == '"' {
-					buff.WriteRune('"')
-				}
-				qs = buff.String()
-				break
-			} else if i == 0 && (char == '?' || char == '$' || char == '*') {
-				continue
-			}
-			buff.WriteRune(char)
-		}
-
-		if len(keyword.Fields) == 1 {
-			if keyword.Fields[0] == fields.MeshHeadings {
-				mf = "Mesh Terms"
-			} else if keyword.Fields[0] == fields.FloatingMeshHeadings {
-				mf = "MeSH Subheading"
-			} else if keyword.Fields[0] == fields.MajorFocusMeshHeading {
-				mf = "MeSH Major Topic"
-			}
-			if len(mf) > 0 && !keyword.Exploded {
-				mf += ":noexp"
-			}
-		}
-
-		if len(mf) == 0 {
-			mapping1 := map[string][]string{
-				"Affiliation":                     {fields.Affiliation},
-				"All Fields":                      {fields.AllFields},
-				"Author":                          {fields.Author},
-				"Authors":                         {fields.Authors},
-				"Author - Corporate":              {fields.AuthorCorporate},
-				"Author - First":                  {fields.AuthorFirst},
-				"Author - Full":                   {fields.AuthorFull},
-				"Author - Identifier":             {fields.AuthorIdentifier},
-				"Author - Last":                   {fields.AuthorLast},
-				"Book":                            {fields.Book},
-				"Date - Completion":               {fields.DateCompletion},
-				"Conflict Of Interest Statements": {fields.ConflictOfInterestStatements},
-				"Date - Create":                   {fields.DateCreate},
-				"Date - Entrez":                   {fields.DateEntrez},
-				"Date - MeSH":                     {fields.DateMeSH},
-				"Date - Modification":             {fields.DateModification},
-				"Date - Publication":              {fields.DatePublication},
-				"EC/RN Number":                    {fields.ECRNNumber},
-				"Editor":                          {fields.Editor},
-				"Filter":                          {fields.Filter},
-				"Grant Number":                    {fields.GrantNumber},
-				"ISBN":                            {fields.ISBN},
-				"Investigator":                    {fields.Investigator},
-				"Investigator - Full":             {fields.InvestigatorFull},
-				"Issue":                           {fields.Issue},
-				"Journal":                         {fields.Journal},
-				"Language":                        {fields.Language},
-				"Location ID":                     {fields.LocationID},
-				"MeSH Major Topic":                {fields.MeSHMajorTopic},
-				"MeSH Subheading":                 {fields.MeSHSubheading},
-				"MeSH Terms":                      {fields.MeSHTerms},
-				"Other Term":                      {fields.OtherTerm},
-				"Pagination":                      {fields.Pagination},
-				"Pharmacological Action":          {fields.PharmacologicalAction},
-				"Publication Type":                {fields.PublicationType},
-				"Publisher":                       {fields.Publisher},
-				"Secondary Source ID":             {fields.SecondarySourceID},
-				"Subject Personal Name":           {fields.SubjectPersonalName},
-				"Supplementary Concept":           {fields.SupplementaryConcept},
-				"Floating MeshHeadings":           {fields.FloatingMeshHeadings},
-				"Text Word":                       {fields.TextWord},
-				"Title":                           {fields.Title},
-				"Title/Abstract":                  {fields.TitleAbstract},
-				"Transliterated Title":            {fields.TransliteratedTitle},
-				"Volume":                          {fields.Volume},
-				"MeSH Headings":                   {fields.MeshHeadings},
-				"Major Focus MeSH Heading":        {fields.MajorFocusMeshHeading},
-				"Publication Date":                {fields.PublicationDate},
-				"Publication Status":              {fields.PublicationStatus},
-				"pmid":                            {fields.PMID},
-			}
-
-			sort.Strings(keyword.Fields)
-			for f, mappingFields := range mapping1 {
-				if len(mappingFields) != len(keyword.Fields) {
-					continue
-				}
-				for _, field := range keyword.Fields {
-					for _, f2 := range mappingFields {
-						if field == f2 || field == f {
-							mf = f
-							break
-						}
-					}
-				}
-			}
-			// This should be a sensible enough default.
-			if len(mf) == 0 {
-				mf = "All Fields"
-			}
-		}
-		qs = fmt.Sprintf("%v[%v]", qs, mf)
-		keywords[i] = qs
+		keywords[i] = pubmedKeyword(keyword)
 		level += 1
 	}
 
-	keywords = append(keywords, children...)
+	// The operands are in the same order as in the ir (children, then keywords), since the first operand of a "not"
+	// group is the one the others are excluded from.
+	operands := append(children, keywords...)
 
 	if strings.Contains(strings.ToLower(q.Operator), "adj") {
 		q.Operator = cqr.AND
 	}
 
-	repr := fmt.Sprintf("(%v)", strings.Join(keywords, strings.ToUpper(fmt.Sprintf(" %v ", q.Operator))))
+	// PubMed cannot negate a single operand, so a "not" group of a single operand excludes it from every document.
+	if strings.ToLower(q.Operator) == "not" && len(operands) == 1 {
+		operands = append([]string{pubmedAll}, operands...)
+	}
+
+	repr := fmt.Sprintf("(%v)", strings.Join(operands, strings.ToUpper(fmt.Sprintf(" %v ", q.Operator))))
 	level += 1
 	return level, PubmedQuery{repr: repr}
 }
 
+// Compile transforms the ir into a PubMed query string. The truncated keywords with Variants are searched as their
+// variants. An error is returned for the keywords which only require fields to be present that PubMed has no hedge
+// for, and for the keywords with wildcards inside a term.
 func (b PubmedBackend) Compile(ir ir.BooleanQuery) (BooleanQuery, error) {
+	if len(b.Variants) > 0 {
+		ir = ir.ExpandTruncation(b.Variants)
+	}
+	if err := checkExists(ir, pubmedExistsError); err != nil {
+		return nil, err
+	}
+	if err := checkWildcards(ir, pubmedWildcardError); err != nil {
+		return nil, err
+	}
 	_, q := compilePubmed(ir, 1, b.ReplaceAdj)
 	return q, nil
 }
@@ -0,0 +1,109 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hscells/cqr"
+	"github.com/hscells/transmute/ir"
+)
+
+// PubMedHistoryLine is a single numbered search in the PubMed search history.
+type PubMedHistoryLine struct {
+	// Number is the number of the search in the history, which later searches refer to as `#n`.
+	Number int `json:"number"`
+	// Query is the search as it is entered into the advanced search builder, e.g. `#1 OR #2`.
+	Query string `json:"query"`
+	// Translation is the search with every reference to an earlier search expanded.
+	Translation string `json:"translation"`
+}
+
+// PubMedHistoryQuery is a PubMed search history, in the order the searches are to be run.
+type PubMedHistoryQuery struct {
+	lines []PubMedHistoryLine
+}
+
+// PubMedHistoryBackend compiles queries into a PubMed search history. Like the Medline backend, each keyword is a
+// numbered search, and each group is a search combining the numbers of its operands, e.g. `#1 OR #2`.
+type PubMedHistoryBackend struct{}
+
+// Representation returns the lines of the search history.
+func (q PubMedHistoryQuery) Representation() (interface{}, error) {
+	return q.lines, nil
+}
+
+// String returns a JSON-encoded representation of the search history.
+func (q PubMedHistoryQuery) String() (string, error) {
+	b, err := json.Marshal(q.lines)
+	return string(b), err
+}
+
+// StringPretty returns a pretty-printed JSON-encoded representation of the search history.
+func (q PubMedHistoryQuery) StringPretty() (string, error) {
+	b, err := json.MarshalIndent(q.lines, "", "    ")
+	return string(b), err
+}
+
+// add appends a search to the history, returning its number.
+func (q *PubMedHistoryQuery) add(query, translation string) int {
+	n := len(q.lines) + 1
+	q.lines = append(q.lines, PubMedHistoryLine{Number: n, Query: query, Translation: translation})
+	return n
+}
+
+// compile adds the searches for a query to the history, returning the numbers of the searches which make up the
+// operands of the query. As in the Medline backend, a group with a single operand does not need a search to combine
+// it, and a group without an operator only wraps its children.
+func (q *PubMedHistoryQuery) compile(b ir.BooleanQuery) []int {
+	var operands []int
+	for _, child := range b.Children {
+		operands = append(operands, q.compile(child)...)
+	}
+	for _, keyword := range b.Keywords {
+		k := pubmedKeyword(keyword)
+		operands = append(operands, q.add(k, k))
+	}
+	// A "not" group of a single operand excludes it from every document, as in the PubMed backend.
+	if strings.ToLower(b.Operator) == "not" && len(operands) == 1 {
+		operands = append([]int{q.add(pubmedAll, pubmedAll)}, operands...)
+	}
+	if len(operands) <= 1 || len(b.Operator) == 0 {
+		return operands
+	}
+
+	// PubMed has no adjacency, so the closest operator is used instead.
+	op := b.Operator
+	if strings.Contains(strings.ToLower(op), "adj") {
+		op = cqr.AND
+	}
+	op = fmt.Sprintf(" %v ", strings.ToUpper(op))
+
+	references := make([]string, len(operands))
+	translations := make([]string, len(operands))
+	for i, n := range operands {
+		references[i] = fmt.Sprintf("#%d", n)
+		translations[i] = q.lines[n-1].Translation
+	}
+	return []int{q.add(strings.Join(references, op), "("+strings.Join(translations, op)+")")}
+}
+
+// Compile transforms the ir into a PubMed search history. As in the PubMed backend, an error is returned for the
+// keywords which only require fields to be present that PubMed has no hedge for, and for the keywords with wildcards
+// inside a term.
+func (b PubMedHistoryBackend) Compile(q ir.BooleanQuery) (BooleanQuery, error) {
+	if err := checkExists(q, pubmedExistsError); err != nil {
+		return nil, err
+	}
+	if err := checkWildcards(q, pubmedWildcardError); err != nil {
+		return nil, err
+	}
+	var h PubMedHistoryQuery
+	h.compile(q)
+	return h, nil
+}
+
+// NewPubMedHistoryBackend creates a new backend for compiling PubMed search histories.
+func NewPubMedHistoryBackend() PubMedHistoryBackend {
+	return PubMedHistoryBackend{}
+}
@@ -0,0 +1,39 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/hscells/transmute/ir"
+)
+
+func TestPubMedHistoryBackend_Compile(t *testing.T) {
+	q := ir.BooleanQuery{
+		Operator: "and",
+		Keywords: []ir.Keyword{medlineKeyword("child*")},
+		Children: []ir.BooleanQuery{{Operator: "or", Keywords: []ir.Keyword{medlineKeyword("asthma"), medlineKeyword("wheez*")}}},
+	}
+	c, err := NewPubMedHistoryBackend().Compile(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := c.Representation()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := r.([]PubMedHistoryLine)
+	expected := []PubMedHistoryLine{
+		{1, "asthma[Title/Abstract]", "asthma[Title/Abstract]"},
+		{2, "wheez*[Title/Abstract]", "wheez*[Title/Abstract]"},
+		{3, "#1 OR #2", "(asthma[Title/Abstract] OR wheez*[Title/Abstract])"},
+		{4, "child*[Title/Abstract]", "child*[Title/Abstract]"},
+		{5, "#3 AND #4", "((asthma[Title/Abstract] OR wheez*[Title/Abstract]) AND child*[Title/Abstract])"},
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %v lines, got %v", len(expected), lines)
+	}
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Fatalf("Expected line %v, got %v", expected[i], lines[i])
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package backend
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hscells/transmute/ir"
+)
+
+// The targets a keyword can be rendered for with RenderKeyword.
+const (
+	// MedlineTarget renders keywords as Medline (Ovid) terms, e.g. `wheez*.ti,ab.` or `exp Asthma/`.
+	MedlineTarget = "medline"
+	// PubMedTarget renders keywords as PubMed terms, e.g. `wheez*[Title/Abstract]`.
+	PubMedTarget = "pubmed"
+	// LuceneTarget renders keywords in the Lucene query string syntax, e.g. `(title:wheez* OR abstract:wheez*)`.
+	LuceneTarget = "lucene"
+)
+
+// luceneKeyword compiles a keyword into the Lucene query string syntax. The keyword is searched in each of its
+// fields, and phrases with a proximity are searched with `~`, e.g. `title:"heart attack"~3`, as are fuzzy terms, e.g.
+// `title:tumour~2`. Boosted keywords are weighted with `^`, e.g. `title:asthma^2`, and keywords which only require
+// their fields to be present are searched with `_exists_`, e.g. `_exists_:text`.
+func luceneKeyword(keyword ir.Keyword) string {
+	qs := escapeLucene(keyword.QueryString, keyword.Truncated)
+	if distance, ok := keyword.Options[ir.ProximityOption]; ok {
+		qs = fmt.Sprintf("%v~%v", qs, distance)
+	} else if fuzziness, ok := keyword.Options[ir.FuzzinessOption]; ok {
+		qs = fmt.Sprintf("%v~%v", qs, fuzziness)
+	}
+	if boost, ok := keyword.Options[ir.BoostOption]; ok {
+		qs = fmt.Sprintf("%v^%v", qs, boost)
+	}
+	if len(keyword.Fields) == 0 {
+		return qs
+	}
+	terms := make([]string, len(keyword.Fields))
+	for i, field := range keyword.Fields {
+		if keyword.Exists() {
+			// A keyword without a query string may only require its fields to be present.
+			terms[i] = "_exists_:" + field
+			continue
+		}
+		terms[i] = field + ":" + qs
+	}
+	if len(terms) == 1 {
+		return terms[0]
+	}
+	return "(" + strings.Join(terms, " OR ") + ")"
+}
+
+// RenderKeyword renders a single keyword qualified by its fields in the syntax of a target (MedlineTarget,
+// PubMedTarget, or LuceneTarget), so that keywords can be composed into output that is not produced by a backend. An
+// error is returned for a keyword which only requires its fields to be present, when the target cannot search them,
+// and for a keyword with a wildcard inside a term, when the target only supports truncation at the end of a term.
+func RenderKeyword(keyword ir.Keyword, target string) (string, error) {
+	switch target {
+	case MedlineTarget:
+		if err := checkExists(ir.BooleanQuery{Keywords: []ir.Keyword{keyword}}, existsUnsupported("medline")); err != nil {
+			return "", err
+		}
+		return NewMedlineBackend().medlineKeyword(keyword), nil
+	case PubMedTarget:
+		if err := checkExists(ir.BooleanQuery{Keywords: []ir.Keyword{keyword}}, pubmedExistsError); err != nil {
+			return "", err
+		}
+		if err := pubmedWildcardError(keyword); err != nil {
+			return "", err
+		}
+		return pubmedKeyword(keyword), nil
+	case LuceneTarget:
+		return renderSpellings(keyword, luceneKeyword)
+	}
+	return "", fmt.Errorf("keywords cannot be rendered for the target %v", target)
+}
+
+// maxSpellings limits the spellings of a keyword with optional wildcards which are searched by the targets without an
+// optional wildcard, since the spellings double with each optional wildcard (see ir.Keyword.ExpandOptional).
+const maxSpellings = 64
+
+// renderSpellings renders a keyword with an optional wildcard, which is not supported by the target, as the spellings
+// of the keyword without the character and with a wildcard for exactly one character, e.g.
+// `(title:color OR title:colo?r)`. An error is returned when the keyword has more than maxSpellings spellings.
+func renderSpellings(keyword ir.Keyword, render func(ir.Keyword) string) (string, error) {
+	q, err := keyword.ExpandOptional(maxSpellings)
+	if err != nil {
+		return "", err
+	}
+	spellings := q.Keywords
+	if len(spellings) == 1 {
+		return render(spellings[0]), nil
+	}
+	terms := make([]string, len(spellings))
+	for i, spelling := range spellings {
+		terms[i] = render(spelling)
+	}
+	return "(" + strings.Join(terms, " OR ") + ")", nil
+}
@@ -0,0 +1,72 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/hscells/transmute/fields"
+	"github.com/hscells/transmute/ir"
+)
+
+func TestRenderKeyword(t *testing.T) {
+	wheeze := ir.Keyword{QueryString: "wheez*", Fields: []string{fields.TitleAbstract}, Truncated: true}
+	asthma := ir.Keyword{QueryString: "Asthma", Fields: []string{fields.MeshHeadings}, Exploded: true}
+	phrase := ir.Keyword{
+		QueryString: `"heart attack"`,
+		Fields:      []string{fields.Title, fields.Abstract},
+		Options:     map[string]interface{}{ir.ProximityOption: 2},
+	}
+	fuzzy := ir.Keyword{
+		QueryString: "tumour",
+		Fields:      []string{fields.TitleAbstract},
+		Options:     map[string]interface{}{ir.FuzzinessOption: 2},
+	}
+	boosted := ir.Keyword{
+		QueryString: "asthma",
+		Fields:      []string{fields.Title},
+		Options:     map[string]interface{}{ir.BoostOption: 1.5},
+	}
+	hasAbstract := ir.Keyword{Fields: []string{fields.Abstract}, Options: map[string]interface{}{ir.ExistsOption: true}}
+	colour := ir.Keyword{QueryString: "colo?r", Fields: []string{fields.Title}, Truncated: true}
+
+	renders := []struct {
+		keyword  ir.Keyword
+		target   string
+		expected string
+	}{
+		{wheeze, MedlineTarget, "wheez*.ti,ab."},
+		{asthma, MedlineTarget, "exp Asthma/"},
+		{ir.Keyword{QueryString: "HIV/AIDS", Fields: []string{fields.MeshHeadings}}, MedlineTarget, `"HIV/AIDS"/`},
+		{wheeze, PubMedTarget, "wheez*[Title/Abstract]"},
+		{asthma, PubMedTarget, "Asthma[Mesh Terms]"},
+		{wheeze, LuceneTarget, "title_abstract:wheez*"},
+		{phrase, LuceneTarget, `(title:"heart attack"~2 OR text:"heart attack"~2)`},
+		{fuzzy, LuceneTarget, "title_abstract:tumour~2"},
+		{boosted, LuceneTarget, "title:asthma^1.5"},
+		{ir.Keyword{QueryString: `"Lancet"`, Fields: []string{fields.Journal}}, LuceneTarget, `journal:"Lancet"`},
+		{hasAbstract, LuceneTarget, "_exists_:text"},
+		{hasAbstract, PubMedTarget, "hasabstract"},
+		{colour, MedlineTarget, "colo?r.ti."},
+		{colour, LuceneTarget, "(title:color OR title:colo?r)"},
+		{ir.Keyword{QueryString: "c++", Fields: []string{fields.Title}}, LuceneTarget, `title:c\+\+`},
+		{ir.Keyword{QueryString: "5-HT", Fields: []string{fields.Title}}, LuceneTarget, `title:5\-HT`},
+		{ir.Keyword{QueryString: "wom#n", Fields: []string{fields.Title}, Truncated: true}, LuceneTarget, `title:wom?n`},
+		{ir.Keyword{QueryString: "TNF-[alpha]", Fields: []string{fields.Title}}, PubMedTarget, `TNF-\[alpha\][Title]`},
+		{ir.Keyword{QueryString: "and/or", Fields: []string{fields.Title}}, MedlineTarget, `"and/or".ti.`},
+	}
+	for _, r := range renders {
+		got, err := RenderKeyword(r.keyword, r.target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != r.expected {
+			t.Fatalf("Expected %v, got %v", r.expected, got)
+		}
+	}
+
+	if _, err := RenderKeyword(wheeze, "unknown"); err == nil {
+		t.Fatal("Expected an error for an unknown target")
+	}
+	if _, err := RenderKeyword(hasAbstract, MedlineTarget); err == nil {
+		t.Fatal("Expected an error for a keyword requiring an abstract in Medline")
+	}
+}
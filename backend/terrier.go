@@ -36,14 +36,6 @@ func (t TerrierBackend) Compile(q ir.BooleanQuery) (BooleanQuery, error) {
 	// Process the keywords.
 	if q.Operator == "and" {
 		tq.repr = "("
-		var keywords []string
-		for _, keyword := range q.Keywords {
-			for _, field := range keyword.Fields {
-				keywords = append(keywords, fmt.Sprintf("+%s:%s", field, keyword.QueryString))
-			}
-		}
-		tq.repr += strings.Join(keywords, " ")
-
 		// Process the children.
 		for _, child := range q.Children {
 			c, err := t.Compile(child)
@@ -53,17 +45,17 @@ func (t TerrierBackend) Compile(q ir.BooleanQuery) (BooleanQuery, error) {
 			s, _ := c.String()
 			tq.repr += s
 		}
-		tq.repr += ")"
-	} else if len(q.Operator) > 3 && q.Operator[0:3] == "adj" {
-		tq.repr += " \""
 
 		var keywords []string
 		for _, keyword := range q.Keywords {
 			for _, field := range keyword.Fields {
-				keywords = append(keywords, fmt.Sprintf("%s:%s", field, keyword.QueryString))
+				keywords = append(keywords, fmt.Sprintf("+%s:%s", field, keyword.QueryString))
 			}
 		}
 		tq.repr += strings.Join(keywords, " ")
+		tq.repr += ")"
+	} else if len(q.Operator) > 3 && q.Operator[0:3] == "adj" {
+		tq.repr += " \""
 
 		// Process the children.
 		for _, child := range q.Children {
@@ -75,11 +67,6 @@ func (t TerrierBackend) Compile(q ir.BooleanQuery) (BooleanQuery, error) {
 			tq.repr += s
 		}
 
-		distance := q.Operator[3:]
-		tq.repr += fmt.Sprintf("\"~%s ", distance)
-	} else {
-		tq.repr = "("
-
 		var keywords []string
 		for _, keyword := range q.Keywords {
 			for _, field := range keyword.Fields {
@@ -88,6 +75,11 @@ func (t TerrierBackend) Compile(q ir.BooleanQuery) (BooleanQuery, error) {
 		}
 		tq.repr += strings.Join(keywords, " ")
 
+		distance := q.Operator[3:]
+		tq.repr += fmt.Sprintf("\"~%s ", distance)
+	} else {
+		tq.repr = "("
+
 		// Process the children.
 		for _, child := range q.Children {
 			c, err := t.Compile(child)
@@ -97,6 +89,14 @@ func (t TerrierBackend) Compile(q ir.BooleanQuery) (BooleanQuery, error) {
 			s, _ := c.String()
 			tq.repr += s
 		}
+
+		var keywords []string
+		for _, keyword := range q.Keywords {
+			for _, field := range keyword.Fields {
+				keywords = append(keywords, fmt.Sprintf("%s:%s", field, keyword.QueryString))
+			}
+		}
+		tq.repr += strings.Join(keywords, " ")
 		tq.repr += ")"
 	}
 
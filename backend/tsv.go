@@ -0,0 +1,71 @@
+package backend
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/hscells/transmute/ir"
+)
+
+// TSVColumns are the columns of each row of a TSV term list.
+var TSVColumns = []string{"term", "fields", "exploded", "truncated"}
+
+// TSVQuery is a flat list of the terms in a query, one row per keyword, for term frequency analysis tools and
+// spreadsheets.
+type TSVQuery struct {
+	rows [][]string
+}
+
+// TSVBackend is the compiler for listing the terms of the ir as tab-separated values.
+type TSVBackend struct{}
+
+// Representation returns the rows of the term list, without the header.
+func (q TSVQuery) Representation() (interface{}, error) {
+	return q.rows, nil
+}
+
+// String returns the term list as tab-separated values, with a header of the TSVColumns.
+func (q TSVQuery) String() (string, error) {
+	lines := []string{strings.Join(TSVColumns, "\t")}
+	for _, row := range q.rows {
+		lines = append(lines, strings.Join(row, "\t"))
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// StringPretty returns the term list; tab-separated values have no pretty form.
+func (q TSVQuery) StringPretty() (string, error) {
+	return q.String()
+}
+
+// tsvValue replaces the characters of a value that would break the rows or columns of the term list with spaces.
+func tsvValue(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' || r == '\r' {
+			return ' '
+		}
+		return r
+	}, s)
+}
+
+// Compile lists each keyword of the ir as a row with the term, the fields of the term separated by commas, and
+// whether the term is exploded or truncated, e.g. `wheez*	title,text	false	true`. The rows are in the order the
+// keywords appear in the query; duplicate terms are not removed.
+func (b TSVBackend) Compile(q ir.BooleanQuery) (BooleanQuery, error) {
+	rows := [][]string{}
+	for _, leaf := range q.Leaves() {
+		k := leaf.Keyword
+		rows = append(rows, []string{
+			tsvValue(k.QueryString),
+			tsvValue(strings.Join(k.Fields, ",")),
+			strconv.FormatBool(k.Exploded),
+			strconv.FormatBool(k.Truncated),
+		})
+	}
+	return TSVQuery{rows: rows}, nil
+}
+
+// NewTSVBackend returns a new TSV backend.
+func NewTSVBackend() TSVBackend {
+	return TSVBackend{}
+}
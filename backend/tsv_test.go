@@ -0,0 +1,37 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/hscells/transmute/fields"
+	"github.com/hscells/transmute/ir"
+)
+
+func TestTSVBackend_Compile(t *testing.T) {
+	q := ir.BooleanQuery{
+		Operator: "and",
+		Keywords: []ir.Keyword{{QueryString: "Asthma", Fields: []string{fields.MeshHeadings}, Exploded: true}},
+		Children: []ir.BooleanQuery{{
+			Operator: "or",
+			Keywords: []ir.Keyword{
+				{QueryString: "wheez*", Fields: []string{fields.Title, fields.Abstract}, Truncated: true},
+				{QueryString: "\"heart\tattack\"", Fields: []string{fields.Title}},
+			},
+		}},
+	}
+	c, err := NewTSVBackend().Compile(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := c.String()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "term\tfields\texploded\ttruncated\n" +
+		"Asthma\tmesh_headings\ttrue\tfalse\n" +
+		"wheez*\ttitle,text\tfalse\ttrue\n" +
+		"\"heart attack\"\ttitle\tfalse\tfalse\n"
+	if s != expected {
+		t.Fatalf("Expected\n%v\ngot\n%v", expected, s)
+	}
+}
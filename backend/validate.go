@@ -0,0 +1,166 @@
+package backend
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hscells/transmute/fields"
+	"github.com/hscells/transmute/ir"
+)
+
+// Validator may optionally be implemented by a Compiler to report the parts of a query that cannot be faithfully
+// represented by the backend, before the query is compiled.
+type Validator interface {
+	Validate(q ir.BooleanQuery) []ir.Warning
+}
+
+// Validate reports the parts of a query that the compiler cannot faithfully represent. Compilers that do not implement
+// Validator are assumed to be able to represent any query.
+func Validate(c Compiler, q ir.BooleanQuery) []ir.Warning {
+	if v, ok := c.(Validator); ok {
+		return v.Validate(q)
+	}
+	return nil
+}
+
+// unmappedFields reports every keyword in a query which the mapped function cannot find a field for.
+func unmappedFields(q ir.BooleanQuery, mapped func(keyword ir.Keyword) bool) (warnings []ir.Warning) {
+	ir.Walk(&q, ir.VisitorFuncs{Keyword: func(k *ir.Keyword) bool {
+		if !mapped(*k) {
+			keyword := *k
+			warnings = append(warnings, ir.Warning{Message: "fields have no mapping", Keyword: &keyword})
+		}
+		return true
+	}})
+	return
+}
+
+// Validate reports the keywords whose fields have no Medline field code, and the boosted, fuzzy, and keywords which
+// only require their fields to be present, since Medline does not rank documents, match terms within an edit distance,
+// or search the presence of fields.
+func (b MedlineBackend) Validate(q ir.BooleanQuery) []ir.Warning {
+	return append(unmappedFields(q, b.mapped), unsupportedOptions(q, ir.BoostOption, ir.FuzzinessOption, ir.ExistsOption)...)
+}
+
+// checkExists returns the error of the first keyword in a query which only requires its fields to be present (see
+// ir.ExistsOption) and cannot be compiled, as reported by exists.
+func checkExists(q ir.BooleanQuery, exists func(keyword ir.Keyword) error) (err error) {
+	ir.Walk(&q, ir.VisitorFuncs{Keyword: func(k *ir.Keyword) bool {
+		if err == nil && k.Exists() {
+			err = exists(*k)
+		}
+		return err == nil
+	}})
+	return
+}
+
+// existsUnsupported is the error of compiling a keyword which only requires its fields to be present for a backend
+// which cannot search the presence of fields.
+func existsUnsupported(backend string) func(keyword ir.Keyword) error {
+	return func(keyword ir.Keyword) error {
+		return fmt.Errorf("the presence of the fields %v cannot be searched in %v", keyword.Fields, backend)
+	}
+}
+
+// unsupportedOptions reports every keyword in a query which has any of the options, which the backend ignores.
+func unsupportedOptions(q ir.BooleanQuery, options ...string) (warnings []ir.Warning) {
+	ir.Walk(&q, ir.VisitorFuncs{Keyword: func(k *ir.Keyword) bool {
+		for _, option := range options {
+			if _, ok := k.Options[option]; ok {
+				keyword := *k
+				warnings = append(warnings, ir.Warning{Message: "the " + option + " of keywords is not supported", Keyword: &keyword})
+			}
+		}
+		return true
+	}})
+	return
+}
+
+// unsupportedAdjacency reports every adjacency group in a query, along with its distance (see ir.DistanceOption), for
+// backends which combine the operands of adjacency groups with `and`.
+func unsupportedAdjacency(q ir.BooleanQuery) (warnings []ir.Warning) {
+	ir.Walk(&q, ir.VisitorFuncs{Query: func(b *ir.BooleanQuery) bool {
+		if operator := adjacencyOperator(*b); strings.HasPrefix(strings.ToLower(operator), "adj") {
+			warnings = append(warnings, ir.Warning{Message: fmt.Sprintf("adjacency is not supported, so `%v` is searched with `and`", operator)})
+		}
+		return true
+	}})
+	return
+}
+
+// unsupportedWildcards reports every keyword in a query which has a wildcard in any of the positions. Optional
+// wildcards are reported by unsupportedOptionalWildcards instead.
+func unsupportedWildcards(q ir.BooleanQuery, positions ...ir.WildcardPosition) (warnings []ir.Warning) {
+	ir.Walk(&q, ir.VisitorFuncs{Keyword: func(k *ir.Keyword) bool {
+		for _, w := range k.Wildcards() {
+			if w.Character != ir.OptionalWildcard && containsPosition(positions, w.Position) {
+				keyword := *k
+				warnings = append(warnings, ir.Warning{Message: w.Position.String() + " wildcards are not supported", Keyword: &keyword})
+				break
+			}
+		}
+		return true
+	}})
+	return
+}
+
+// unsupportedOptionalWildcards reports every keyword in a query which has an optional wildcard, e.g. `colo?r`, for
+// targets which can only search the spellings of the keyword (see ir.BooleanQuery.ExpandTruncation).
+func unsupportedOptionalWildcards(q ir.BooleanQuery) (warnings []ir.Warning) {
+	ir.Walk(&q, ir.VisitorFuncs{Keyword: func(k *ir.Keyword) bool {
+		for _, w := range k.Wildcards() {
+			if w.Character == ir.OptionalWildcard {
+				keyword := *k
+				warnings = append(warnings, ir.Warning{Message: "optional wildcards are not supported, so the spellings of the keyword must be expanded", Keyword: &keyword})
+				break
+			}
+		}
+		return true
+	}})
+	return
+}
+
+// containsPosition determines if a wildcard position is one of the positions.
+func containsPosition(positions []ir.WildcardPosition, position ir.WildcardPosition) bool {
+	for _, p := range positions {
+		if p == position {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate reports the keywords whose fields have no PubMed field name, which are otherwise compiled to search all
+// fields, the keywords with leading or internal wildcards, since PubMed only supports truncation at the end of a
+// term, the keywords with optional wildcards, whose spellings must be expanded (e.g. with ExpandTruncation), the
+// boosted keywords, since PubMed does not rank documents by the weights of keywords, and the fuzzy keywords, since
+// PubMed does not match terms within an edit distance. PubMed has no adjacency, so the adjacency groups, which are
+// searched with `AND` regardless of their distance, are also reported.
+func (b PubmedBackend) Validate(q ir.BooleanQuery) []ir.Warning {
+	warnings := append(b.validateFields(q), unsupportedWildcards(q, ir.LeadingWildcard, ir.InternalWildcard)...)
+	warnings = append(warnings, unsupportedOptionalWildcards(q)...)
+	warnings = append(warnings, unsupportedAdjacency(q)...)
+	return append(warnings, unsupportedOptions(q, ir.BoostOption, ir.FuzzinessOption)...)
+}
+
+// validateFields reports the keywords whose fields have no PubMed field name, or, for keywords which only require their
+// fields to be present, no PubMed hedge (e.g. `hasabstract`).
+func (b PubmedBackend) validateFields(q ir.BooleanQuery) []ir.Warning {
+	return unmappedFields(q, func(keyword ir.Keyword) bool {
+		if keyword.Exists() {
+			for _, field := range keyword.Fields {
+				if _, ok := pubmedExistsHedges[field]; !ok {
+					return false
+				}
+			}
+			return true
+		}
+		if len(keyword.Fields) == 1 {
+			switch keyword.Fields[0] {
+			case fields.MeshHeadings, fields.FloatingMeshHeadings, fields.MajorFocusMeshHeading:
+				return true
+			}
+		}
+		return len(pubmedField(append([]string{}, keyword.Fields...))) > 0
+	})
+}
@@ -0,0 +1,92 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/hscells/transmute/fields"
+	"github.com/hscells/transmute/ir"
+)
+
+func TestValidate_Fields(t *testing.T) {
+	q := ir.BooleanQuery{
+		Operator: "and",
+		Children: []ir.BooleanQuery{{Operator: "or", Keywords: []ir.Keyword{
+			{QueryString: "asthma", Fields: []string{fields.TitleAbstract}},
+			{QueryString: "Asthma", Fields: []string{fields.MeshHeadings}, Exploded: true},
+		}}},
+		Keywords: []ir.Keyword{{QueryString: "wheeze", Fields: []string{"unknown"}}},
+	}
+	for _, c := range []Compiler{NewMedlineBackend(), NewPubmedBackend(), NewProQuestBackend()} {
+		warnings := Validate(c, q)
+		if len(warnings) != 1 || warnings[0].Keyword.QueryString != "wheeze" {
+			t.Fatalf("Expected a warning for the keyword without a mapping, got %v", warnings)
+		}
+		if expected := "fields have no mapping: `wheeze` [unknown]"; warnings[0].String() != expected {
+			t.Fatalf("Expected %v, got %v", expected, warnings[0].String())
+		}
+	}
+
+	// A compiler which does not validate queries is assumed to represent any query.
+	if warnings := Validate(NewCQRBackend(), q); warnings != nil {
+		t.Fatalf("Expected no warnings, got %v", warnings)
+	}
+}
+
+func TestValidate_Boost(t *testing.T) {
+	q := ir.BooleanQuery{
+		Operator: "or",
+		Keywords: []ir.Keyword{
+			{QueryString: "asthma", Fields: []string{fields.Title}, Options: map[string]interface{}{ir.BoostOption: 2.0}},
+			{QueryString: "wheeze", Fields: []string{fields.Title}},
+		},
+	}
+	for _, c := range []Compiler{NewMedlineBackend(), NewPubmedBackend()} {
+		warnings := Validate(c, q)
+		if len(warnings) != 1 || warnings[0].Keyword.QueryString != "asthma" {
+			t.Fatalf("Expected a warning for the boosted keyword, got %v", warnings)
+		}
+	}
+	if warnings := Validate(NewElasticsearchCompiler(), q); len(warnings) != 0 {
+		t.Fatalf("Expected no warnings, got %v", warnings)
+	}
+}
+
+func TestValidate_Fuzziness(t *testing.T) {
+	q := ir.BooleanQuery{
+		Operator: "or",
+		Keywords: []ir.Keyword{
+			{QueryString: "tumour", Fields: []string{fields.Title}, Options: map[string]interface{}{ir.FuzzinessOption: 2}},
+			{QueryString: "cancer", Fields: []string{fields.Title}},
+		},
+	}
+	for _, c := range []Compiler{NewMedlineBackend(), NewPubmedBackend(), NewProQuestBackend()} {
+		warnings := Validate(c, q)
+		if len(warnings) != 1 || warnings[0].Keyword.QueryString != "tumour" {
+			t.Fatalf("Expected a warning for the fuzzy keyword, got %v", warnings)
+		}
+	}
+	if warnings := Validate(NewElasticsearchCompiler(), q); len(warnings) != 0 {
+		t.Fatalf("Expected no warnings, got %v", warnings)
+	}
+}
+
+func TestValidate_Exists(t *testing.T) {
+	exists := func(field string) ir.Keyword {
+		return ir.Keyword{Fields: []string{field}, Options: map[string]interface{}{ir.ExistsOption: true}}
+	}
+	q := ir.BooleanQuery{
+		Operator: "and",
+		Keywords: []ir.Keyword{{QueryString: "asthma", Fields: []string{fields.Title}}, exists(fields.Abstract)},
+	}
+	if warnings := Validate(NewPubmedBackend(), q); len(warnings) != 0 {
+		t.Fatalf("Expected no warnings, got %v", warnings)
+	}
+	if warnings := Validate(NewMedlineBackend(), q); len(warnings) != 1 || !warnings[0].Keyword.Exists() {
+		t.Fatalf("Expected a warning for the keyword requiring an abstract, got %v", warnings)
+	}
+
+	q.Keywords[1] = exists(fields.Journal)
+	if warnings := Validate(NewPubmedBackend(), q); len(warnings) != 1 || !warnings[0].Keyword.Exists() {
+		t.Fatalf("Expected a warning for the keyword requiring a journal, got %v", warnings)
+	}
+}
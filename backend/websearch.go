@@ -0,0 +1,143 @@
+package backend
+
+import (
+	"strings"
+
+	"github.com/hscells/transmute/fields"
+	"github.com/hscells/transmute/ir"
+)
+
+// WebSearchQuery is a query string for a web search engine, e.g. `asthma (child OR adolescent) -adult`.
+type WebSearchQuery struct {
+	repr string
+}
+
+// WebSearchBackend is the compiler for simplified web search engine (e.g. Google or Bing) queries, for quickly checking
+// what a block of a query retrieves. Web search engines do not support most of a query, so the compiled query is only
+// an approximation of it:
+//
+//   - "and" groups (and adjacency groups) are terms separated by spaces, "or" groups use `OR`, and the excluded
+//     operands of "not" groups (or the operand of a "not" group of a single operand) are prefixed with `-`;
+//   - phrases are quoted, and the wildcards of truncated terms are removed;
+//   - terms searched in the title are prefixed with `intitle:`, and the fields of any other terms are dropped.
+//
+// Validate reports the keywords which are not faithfully represented.
+type WebSearchBackend struct{}
+
+// Representation returns the query string.
+func (q WebSearchQuery) Representation() (interface{}, error) {
+	return q.repr, nil
+}
+
+// String returns the query string.
+func (q WebSearchQuery) String() (string, error) {
+	return q.repr, nil
+}
+
+// StringPretty returns the query string.
+func (q WebSearchQuery) StringPretty() (string, error) {
+	return q.repr, nil
+}
+
+// webSearchFields are the fields which are searched by a web search engine without a qualifier.
+var webSearchFields = map[string]bool{
+	fields.AllFields: true,
+	fields.TextWord:  true,
+}
+
+// webSearchKeyword compiles a keyword into a web search term, e.g. `"heart attack"` or `intitle:asthma`.
+func webSearchKeyword(keyword ir.Keyword) string {
+	qs := strings.Trim(keyword.QueryString, `"`)
+	if keyword.Truncated {
+		qs = strings.Map(func(r rune) rune {
+			if strings.ContainsRune("*?#$", r) {
+				return -1
+			}
+			return r
+		}, qs)
+	}
+	if strings.ContainsAny(qs, " \t") {
+		qs = `"` + qs + `"`
+	}
+	if len(keyword.Fields) == 1 && keyword.Fields[0] == fields.Title {
+		qs = "intitle:" + qs
+	}
+	return qs
+}
+
+// compileWebSearch compiles a query into a web search query string. Nested groups are parenthesised when they combine
+// more than one operand.
+func compileWebSearch(q ir.BooleanQuery, nested bool) string {
+	var operands []string
+	for _, child := range q.Children {
+		if s := compileWebSearch(child, true); len(s) > 0 {
+			operands = append(operands, s)
+		}
+	}
+	for _, keyword := range q.Keywords {
+		if keyword.Exists() {
+			continue
+		}
+		operands = append(operands, webSearchKeyword(keyword))
+	}
+	if len(operands) == 1 && strings.ToLower(q.Operator) == "not" {
+		// A "not" group of a single operand excludes it.
+		return "-" + operands[0]
+	}
+	if len(operands) <= 1 {
+		return strings.Join(operands, "")
+	}
+
+	var s string
+	switch strings.ToLower(q.Operator) {
+	case "or":
+		s = strings.Join(operands, " OR ")
+	case "not":
+		// The first operand is searched, and the others are excluded.
+		s = operands[0]
+		for _, operand := range operands[1:] {
+			s += " -" + operand
+		}
+	default:
+		s = strings.Join(operands, " ")
+	}
+	if nested {
+		return "(" + s + ")"
+	}
+	return s
+}
+
+// Compile transforms the ir into a web search query string.
+func (b WebSearchBackend) Compile(q ir.BooleanQuery) (BooleanQuery, error) {
+	return WebSearchQuery{repr: compileWebSearch(q, false)}, nil
+}
+
+// Validate reports the keywords whose fields are dropped, the truncated keywords, whose wildcards are removed, and the
+// keywords which only require their fields to be present, which are dropped.
+func (b WebSearchBackend) Validate(q ir.BooleanQuery) (warnings []ir.Warning) {
+	ir.Walk(&q, ir.VisitorFuncs{Keyword: func(k *ir.Keyword) bool {
+		keyword := *k
+		switch {
+		case keyword.Exists():
+			warnings = append(warnings, ir.Warning{Message: "the presence of fields cannot be searched", Keyword: &keyword})
+		case keyword.Truncated:
+			warnings = append(warnings, ir.Warning{Message: "wildcards are not supported", Keyword: &keyword})
+		}
+		if len(keyword.Fields) == 1 && keyword.Fields[0] == fields.Title {
+			return true
+		}
+		for _, field := range keyword.Fields {
+			if !webSearchFields[field] {
+				warnings = append(warnings, ir.Warning{Message: "fields are not supported, so they are dropped", Keyword: &keyword})
+				break
+			}
+		}
+		return true
+	}})
+	return
+}
+
+// NewWebSearchBackend returns a new web search backend.
+func NewWebSearchBackend() WebSearchBackend {
+	return WebSearchBackend{}
+}
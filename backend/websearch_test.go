@@ -0,0 +1,49 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/hscells/transmute/fields"
+	"github.com/hscells/transmute/ir"
+)
+
+func TestWebSearchBackend_Compile(t *testing.T) {
+	q := ir.BooleanQuery{
+		Operator: "not",
+		Children: []ir.BooleanQuery{
+			{
+				Operator: "and",
+				Keywords: []ir.Keyword{{QueryString: "asthma", Fields: []string{fields.Title}}},
+				Children: []ir.BooleanQuery{{
+					Operator: "or",
+					Keywords: []ir.Keyword{
+						{QueryString: "child*", Fields: []string{fields.TitleAbstract}, Truncated: true},
+						{QueryString: `"young people"`, Fields: []string{fields.AllFields}},
+					},
+				}},
+			},
+			{Operator: "or", Keywords: []ir.Keyword{
+				{QueryString: "adult", Fields: []string{fields.AllFields}},
+				{QueryString: "elderly", Fields: []string{fields.AllFields}},
+			}},
+		},
+	}
+	c, err := NewWebSearchBackend().Compile(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := c.String()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `((child OR "young people") intitle:asthma) -(adult OR elderly)`
+	if s != expected {
+		t.Fatalf("Expected %v, got %v", expected, s)
+	}
+
+	// The truncated keyword in title and abstract loses both its wildcard and its fields.
+	warnings := Validate(NewWebSearchBackend(), q)
+	if len(warnings) != 2 || warnings[0].Keyword.QueryString != "child*" || warnings[1].Keyword.QueryString != "child*" {
+		t.Fatalf("Expected two warnings for child*, got %v", warnings)
+	}
+}
@@ -100,9 +100,12 @@ func main() {
 
 	// The list of available parsers.
 	parsers := map[string]parser.QueryParser{
-		"medline": parser.NewMedlineParser(),
-		"pubmed":  parser.NewPubMedParser(),
-		"cqr":     parser.NewCQRParser(),
+		"medline":  parser.NewMedlineParser(),
+		"pubmed":   parser.NewPubMedParser(),
+		"cqr":      parser.NewCQRParser(),
+		"ebsco":    parser.NewEbscoMedlineParser(),
+		"embase":   parser.NewEmbaseNativeParser(),
+		"proquest": parser.NewProQuestParser(),
 	}
 
 	// The list of available back-ends.
@@ -113,6 +116,16 @@ func main() {
 		"terrier":       backend.NewTerrierBackend(),
 		"medline":       backend.NewMedlineBackend(),
 		"pubmed":        backend.NewPubmedBackend(),
+		"outline":       backend.NewOutlineBackend(),
+		"dot":           backend.NewDotBackend(),
+		"pubmedhistory": backend.NewPubMedHistoryBackend(),
+		"ovid":          backend.NewOvidBackend(),
+		"embase":        backend.NewEmbaseBackend(),
+		"proquest":      backend.NewProQuestBackend(),
+		"blocks":        backend.NewBlocksBackend(),
+		"tsv":           backend.NewTSVBackend(),
+		"websearch":     backend.NewWebSearchBackend(),
+		"lucene":        backend.NewLuceneBackend(),
 	}
 
 	// Grab the parser.
@@ -23,11 +23,13 @@ var (
 	Editor                       = "editor"
 	Filter                       = "filter"
 	GrantNumber                  = "grant_number"
+	HeadingWord                  = "heading_word"
 	ISBN                         = "isbn"
 	Investigator                 = "investigator"
 	InvestigatorFull             = "investigator_full"
 	Issue                        = "issue"
 	Journal                      = "journal"
+	Keywords                     = "keywords"
 	Language                     = "language"
 	LocationID                   = "location_id"
 	MeSHMajorTopic               = "mesh_major_topic"
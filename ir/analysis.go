@@ -1,24 +1,28 @@
 package ir
 
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hscells/transmute/fields"
+)
+
 // Terms extracts a list of query terms from the Boolean query.
 func (b BooleanQuery) Terms() (s []string) {
-	for _, keyword := range b.Keywords {
-		s = append(s, keyword.QueryString)
-	}
-	for _, child := range b.Children {
-		s = append(s, child.Terms()...)
-	}
+	Walk(&b, VisitorFuncs{Keyword: func(k *Keyword) bool {
+		s = append(s, k.QueryString)
+		return true
+	}})
 	return
 }
 
 // Fields extracts the fields from the query.
 func (b BooleanQuery) Fields() (f []string) {
-	for _, keyword := range b.Keywords {
-		f = append(f, keyword.Fields...)
-	}
-	for _, child := range b.Children {
-		f = append(f, child.Fields()...)
-	}
+	Walk(&b, VisitorFuncs{Keyword: func(k *Keyword) bool {
+		f = append(f, k.Fields...)
+		return true
+	}})
 	return
 }
 
@@ -30,3 +34,140 @@ func (b BooleanQuery) FieldCount() (c map[string]int) {
 	}
 	return
 }
+
+// FieldSetCounts counts the number of keywords in a query which search each combination of fields, e.g. how many
+// keywords search the title and abstract, and how many search the MeSH headings. The combinations are keyed by their
+// distinct fields in sorted order, joined by commas, e.g. `abstract,title`. Keywords without any fields are counted
+// with the empty string.
+func (b BooleanQuery) FieldSetCounts() (c map[string]int) {
+	c = map[string]int{}
+	Walk(&b, VisitorFuncs{Keyword: func(k *Keyword) bool {
+		seen := map[string]bool{}
+		var f []string
+		for _, field := range k.Fields {
+			if !seen[field] {
+				seen[field] = true
+				f = append(f, field)
+			}
+		}
+		sort.Strings(f)
+		c[strings.Join(f, ",")]++
+		return true
+	}})
+	return
+}
+
+// MeshHeadings extracts the keywords in the query which search the MeSH headings field.
+func (b BooleanQuery) MeshHeadings() (m []Keyword) {
+	Walk(&b, VisitorFuncs{Keyword: func(k *Keyword) bool {
+		for _, field := range k.Fields {
+			if field == fields.MeshHeadings || field == fields.MajorFocusMeshHeading {
+				m = append(m, *k)
+				break
+			}
+		}
+		return true
+	}})
+	return
+}
+
+// LeafContext is a keyword in a query, along with the operators of the groups that enclose it.
+type LeafContext struct {
+	Keyword Keyword
+	// Path contains the operators from the root of the query down to the group containing the keyword. Groups without
+	// an operator are not included.
+	Path []string
+}
+
+// Leaves extracts every keyword in the query along with the path of operators that lead to it, e.g. `["and", "or"]`
+// for a keyword in an "or" group that is part of an "and" group.
+func (b BooleanQuery) Leaves() (l []LeafContext) {
+	var visit func(q BooleanQuery, path []string)
+	visit = func(q BooleanQuery, path []string) {
+		if len(q.Operator) > 0 {
+			path = append(path[:len(path):len(path)], q.Operator)
+		}
+		for _, keyword := range q.Keywords {
+			l = append(l, LeafContext{Keyword: keyword, Path: path})
+		}
+		for _, child := range q.Children {
+			visit(child, path)
+		}
+	}
+	visit(b, nil)
+	return
+}
+
+// Blocks splits a query into its conceptual blocks: the operands of a top-level "and", e.g. the population,
+// intervention, and study design of a systematic review strategy. Groups without an operator that wrap the top-level
+// group are skipped. Keywords directly under the top-level "and" are each returned as a query containing only that
+// keyword. If the query is not an "and" at the top level, the whole query is returned as a single block.
+func (b BooleanQuery) Blocks() []BooleanQuery {
+	q := b
+	for len(q.Operator) == 0 && len(q.Keywords) == 0 && len(q.Children) == 1 {
+		q = q.Children[0]
+	}
+	if strings.ToLower(q.Operator) != "and" {
+		return []BooleanQuery{b}
+	}
+	return operands(q)
+}
+
+// blockName is the comment of a block, e.g. `population` for a block written below `# population`, or the empty string
+// if the block does not have a comment.
+func blockName(q BooleanQuery) string {
+	for {
+		if comment, ok := q.Options[CommentOption]; ok {
+			return fmt.Sprint(comment)
+		}
+		if isKeyword(q) {
+			if comment, ok := q.Keywords[0].Options[CommentOption]; ok {
+				return fmt.Sprint(comment)
+			}
+		}
+		if len(q.Operator) > 0 || len(q.Keywords) > 0 || len(q.Children) != 1 {
+			return ""
+		}
+		q = q.Children[0]
+	}
+}
+
+// BlockIndex is the index in Blocks of the block named by a comment, or -1 if no block has the name.
+func (b BooleanQuery) BlockIndex(name string) int {
+	for i, block := range b.Blocks() {
+		if blockName(block) == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// RemoveBlock returns a copy of the query without the block at an index in Blocks, e.g. for a leave-one-out analysis of
+// the blocks of a strategy. The remaining blocks are still combined with "and", and a single remaining block replaces
+// the "and" group. Removing the only block of a query results in an empty query. The query is returned unchanged if
+// the index is out of range.
+func (b BooleanQuery) RemoveBlock(i int) BooleanQuery {
+	q := b.Clone()
+	if i < 0 || i >= len(q.Blocks()) {
+		return q
+	}
+	g := &q
+	for len(g.Operator) == 0 && len(g.Keywords) == 0 && len(g.Children) == 1 {
+		g = &g.Children[0]
+	}
+	if strings.ToLower(g.Operator) != "and" {
+		return BooleanQuery{}
+	}
+
+	// The blocks are the children of the group followed by its keywords.
+	if i < len(g.Children) {
+		g.Children = append(g.Children[:i], g.Children[i+1:]...)
+	} else {
+		i -= len(g.Children)
+		g.Keywords = append(g.Keywords[:i], g.Keywords[i+1:]...)
+	}
+	if o := operands(*g); len(o) == 1 {
+		*g = o[0]
+	}
+	return q
+}
@@ -0,0 +1,129 @@
+package ir
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBooleanQuery_Leaves(t *testing.T) {
+	q := BooleanQuery{
+		Children: []BooleanQuery{{
+			Operator: "and",
+			Keywords: []Keyword{kw("a")},
+			Children: []BooleanQuery{
+				{Operator: "or", Keywords: []Keyword{kw("b"), kw("c")}},
+				{Operator: "not", Children: []BooleanQuery{{Operator: "adj3", Keywords: []Keyword{kw("d"), kw("e")}}}, Keywords: []Keyword{kw("f")}},
+			},
+		}},
+	}
+
+	expected := map[string][]string{
+		"a": {"and"},
+		"b": {"and", "or"},
+		"c": {"and", "or"},
+		"d": {"and", "not", "adj3"},
+		"e": {"and", "not", "adj3"},
+		"f": {"and", "not"},
+	}
+	leaves := q.Leaves()
+	if len(leaves) != len(expected) {
+		t.Fatalf("Expected %v leaves, got %v", len(expected), len(leaves))
+	}
+	for _, leaf := range leaves {
+		if !reflect.DeepEqual(leaf.Path, expected[leaf.Keyword.QueryString]) {
+			t.Fatalf("Expected path %v for %v, got %v", expected[leaf.Keyword.QueryString], leaf.Keyword.QueryString, leaf.Path)
+		}
+	}
+}
+
+func TestBooleanQuery_Blocks(t *testing.T) {
+	population := BooleanQuery{Operator: "or", Keywords: []Keyword{kw("asthma"), kw("wheez*")}}
+	intervention := BooleanQuery{Operator: "or", Keywords: []Keyword{kw("steroid*"), kw("inhaler*")}}
+	q := BooleanQuery{
+		Children: []BooleanQuery{{
+			Operator: "and",
+			Keywords: []Keyword{kw("child*")},
+			Children: []BooleanQuery{population, intervention},
+		}},
+	}
+
+	blocks := q.Blocks()
+	if len(blocks) != 3 {
+		t.Fatalf("Expected %v blocks, got %v", 3, len(blocks))
+	}
+	if !reflect.DeepEqual(blocks[0], population) || !reflect.DeepEqual(blocks[1], intervention) ||
+		blocks[2].Keywords[0].QueryString != "child*" {
+		t.Fatalf("Expected the population, intervention, and keyword blocks, got %v", blocks)
+	}
+
+	// A query which is not an and at the top level is a single block.
+	blocks = population.Blocks()
+	if len(blocks) != 1 || !reflect.DeepEqual(blocks[0], population) {
+		t.Fatalf("Expected a single block, got %v", blocks)
+	}
+}
+
+func TestBooleanQuery_RemoveBlock(t *testing.T) {
+	population := BooleanQuery{
+		Operator: "or",
+		Keywords: []Keyword{kw("asthma"), kw("wheez*")},
+		Options:  map[string]interface{}{CommentOption: "population"},
+	}
+	intervention := BooleanQuery{Operator: "or", Keywords: []Keyword{kw("steroid*"), kw("inhaler*")}}
+	q := BooleanQuery{
+		Children: []BooleanQuery{{
+			Operator: "and",
+			Keywords: []Keyword{kw("child*")},
+			Children: []BooleanQuery{population, intervention},
+		}},
+	}
+	original := q.String()
+
+	i := q.BlockIndex("population")
+	if i != 0 {
+		t.Fatalf("Expected %v, got %v", 0, i)
+	}
+	r := q.RemoveBlock(i)
+	blocks := r.Blocks()
+	if len(blocks) != 2 || !reflect.DeepEqual(blocks[0], intervention) || blocks[1].Keywords[0].QueryString != "child*" {
+		t.Fatalf("Expected the intervention and keyword blocks, got %v", blocks)
+	}
+	if q.String() != original {
+		t.Fatalf("Expected %v to be unchanged, got %v", original, q.String())
+	}
+
+	// A single remaining block is no longer combined with and.
+	r = r.RemoveBlock(1)
+	if expected := intervention.String(); r.String() != expected {
+		t.Fatalf("Expected %v, got %v", expected, r.String())
+	}
+	if r = r.RemoveBlock(0); r.String() != (BooleanQuery{}).String() {
+		t.Fatalf("Expected an empty query, got %v", r)
+	}
+
+	if q.BlockIndex("outcome") != -1 || q.RemoveBlock(3).String() != original {
+		t.Fatalf("Expected an unknown block to be left in the query")
+	}
+}
+
+func TestBooleanQuery_FieldSetCounts(t *testing.T) {
+	q := BooleanQuery{
+		Operator: "and",
+		Children: []BooleanQuery{
+			{Operator: "or", Keywords: []Keyword{
+				{QueryString: "asthma", Fields: []string{"title", "abstract"}},
+				{QueryString: "wheez*", Fields: []string{"abstract", "title"}},
+				{QueryString: "Asthma", Fields: []string{"mesh_headings"}},
+			}},
+			{Operator: "or", Keywords: []Keyword{
+				{QueryString: "child*", Fields: []string{"title", "abstract", "title"}},
+				{QueryString: "Child", Fields: []string{"mesh_headings"}},
+				{QueryString: "infant*"},
+			}},
+		},
+	}
+	expected := map[string]int{"abstract,title": 3, "mesh_headings": 2, "": 1}
+	if c := q.FieldSetCounts(); !reflect.DeepEqual(c, expected) {
+		t.Fatalf("Expected %v, got %v", expected, c)
+	}
+}
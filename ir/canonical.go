@@ -0,0 +1,97 @@
+package ir
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// canonicalIgnoredOptions are the options which do not change what a query retrieves, so they are not part of its
+// canonical form.
+var canonicalIgnoredOptions = map[string]bool{
+	SourceOption:  true,
+	CommentOption: true,
+}
+
+// canonicalOptions is the canonical form of the options of a keyword or group which change what it retrieves.
+func canonicalOptions(options map[string]interface{}) string {
+	var o []string
+	for k, v := range options {
+		if !canonicalIgnoredOptions[k] {
+			o = append(o, fmt.Sprintf("%v=%v", k, v))
+		}
+	}
+	sort.Strings(o)
+	return strings.Join(o, ",")
+}
+
+// canonicalKeyword is the canonical form of a keyword: the query string in lower case with its whitespace collapsed,
+// the explosion, the distinct fields in sorted order, and the options.
+func canonicalKeyword(k Keyword) string {
+	seen := make(map[string]bool)
+	var f []string
+	for _, field := range k.Fields {
+		if !seen[field] {
+			seen[field] = true
+			f = append(f, field)
+		}
+	}
+	sort.Strings(f)
+	qs := strings.Join(strings.Fields(strings.ToLower(k.QueryString)), " ")
+	return fmt.Sprintf("%q %v %v {%v}", qs, k.Exploded, f, canonicalOptions(k.Options))
+}
+
+// canonicalGroup is the canonical form of a group, which is the same for groups which are written differently but
+// search the same way, so that queries can be fingerprinted and compared in a Diff. Groups without an operator that
+// wrap a single operand are replaced by the operand, nested "and" and "or" groups are flattened into a group with the
+// same operator, repeated operands of "and" and "or" groups are removed, and an "and" or "or" group of a single
+// operand is replaced by the operand. The operands are then sorted, except the first operand of a "not" group, and the
+// operands of an adjacency group which must be in order.
+func canonicalGroup(b BooleanQuery) string {
+	operator := strings.ToLower(b.Operator)
+	options := canonicalOptions(b.Options)
+	associative := (operator == "and" || operator == "or") && len(options) == 0
+
+	var o []string
+	var add func(q BooleanQuery)
+	add = func(q BooleanQuery) {
+		for _, child := range q.Children {
+			if len(child.Keywords)+len(child.Children) == 1 && len(child.Operator) == 0 {
+				// A group without an operator is the operand it wraps.
+				add(child)
+			} else if associative && strings.ToLower(child.Operator) == operator && len(canonicalOptions(child.Options)) == 0 {
+				add(child)
+			} else {
+				o = append(o, canonicalGroup(child))
+			}
+		}
+		for _, keyword := range q.Keywords {
+			o = append(o, canonicalKeyword(keyword))
+		}
+	}
+	add(b)
+
+	inOrder, _ := b.Options[InOrderOption].(bool)
+	switch {
+	case operator == "not":
+		if len(o) > 1 {
+			sort.Strings(o[1:])
+		}
+	case !inOrder:
+		sort.Strings(o)
+	}
+	if associative || len(operator) == 0 {
+		// Repeated operands of "and" and "or" groups do not change what they retrieve.
+		var distinct []string
+		for i, operand := range o {
+			if i == 0 || operand != o[i-1] {
+				distinct = append(distinct, operand)
+			}
+		}
+		o = distinct
+		if len(o) == 1 {
+			return o[0]
+		}
+	}
+	return fmt.Sprintf("%v{%v}(%v)", operator, options, strings.Join(o, ";"))
+}
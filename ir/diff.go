@@ -0,0 +1,113 @@
+package ir
+
+import "strings"
+
+// Difference is the difference between two queries, e.g. a published search strategy and a reproduction of it.
+type Difference struct {
+	// Added are the keywords in the second query which are not in the first.
+	Added []Keyword
+	// Removed are the keywords in the first query which are not in the second.
+	Removed []Keyword
+	// AddedGroups are the groups in the second query which are not in the first. Only the innermost groups which
+	// differ are reported, rather than every group containing them.
+	AddedGroups []BooleanQuery
+	// RemovedGroups are the groups in the first query which are not in the second. Like AddedGroups, only the
+	// innermost groups which differ are reported.
+	RemovedGroups []BooleanQuery
+}
+
+// diffKeywords finds the keywords of a which are not in b, counting repeated keywords.
+func diffKeywords(a, b BooleanQuery) (d []Keyword) {
+	counts := make(map[string]int)
+	Walk(&b, VisitorFuncs{Keyword: func(k *Keyword) bool {
+		counts[canonicalKeyword(*k)]++
+		return true
+	}})
+	Walk(&a, VisitorFuncs{Keyword: func(k *Keyword) bool {
+		key := canonicalKeyword(*k)
+		if counts[key] > 0 {
+			counts[key]--
+		} else {
+			d = append(d, *k)
+		}
+		return true
+	}})
+	return
+}
+
+// diffGroups finds the innermost groups of a which are not in b, counting repeated groups.
+func diffGroups(a, b BooleanQuery) (d []BooleanQuery) {
+	counts := make(map[string]int)
+	Walk(&b, VisitorFuncs{Query: func(q *BooleanQuery) bool {
+		if len(q.Operator) > 0 {
+			counts[canonicalGroup(*q)]++
+		}
+		return true
+	}})
+	// visit reports whether a group, or any group inside it, is not in b. A group which is in b is not visited any
+	// further, since the groups inside it may be written differently (e.g. `a OR (b OR c)` is `a OR b OR c`).
+	var visit func(q BooleanQuery) bool
+	visit = func(q BooleanQuery) bool {
+		if len(q.Operator) > 0 {
+			key := canonicalGroup(q)
+			if counts[key] > 0 {
+				counts[key]--
+				return false
+			}
+		}
+		differs := false
+		for _, child := range q.Children {
+			differs = visit(child) || differs
+		}
+		if len(q.Operator) == 0 {
+			return differs
+		}
+		if !differs {
+			d = append(d, q)
+		}
+		return true
+	}
+	visit(a)
+	return
+}
+
+// Diff computes the difference between two queries. Keywords and groups are compared by their canonical form (the same
+// as that of Fingerprint), so keywords are compared by their query string (ignoring case and spacing), their explosion,
+// their fields, and the options which change what they retrieve, and groups are compared by their operator, options,
+// and operands, regardless of the order of the operands (except the first operand of "not") and of nested groups of
+// the same operator.
+func Diff(a, b BooleanQuery) Difference {
+	return Difference{
+		Added:         diffKeywords(b, a),
+		Removed:       diffKeywords(a, b),
+		AddedGroups:   diffGroups(b, a),
+		RemovedGroups: diffGroups(a, b),
+	}
+}
+
+// Empty determines if there is no difference between the queries.
+func (d Difference) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.AddedGroups) == 0 && len(d.RemovedGroups) == 0
+}
+
+// String summarises the difference, with a line for each added (`+`) and removed (`-`) keyword and group, e.g.
+// `+ wheez*[title_abstract]`.
+func (d Difference) String() string {
+	if d.Empty() {
+		return "no differences"
+	}
+	var lines []string
+	for _, k := range d.Added {
+		lines = append(lines, "+ "+k.String())
+	}
+	for _, k := range d.Removed {
+		lines = append(lines, "- "+k.String())
+	}
+	for _, g := range d.AddedGroups {
+		lines = append(lines, "+ group "+g.String())
+	}
+	for _, g := range d.RemovedGroups {
+		lines = append(lines, "- group "+g.String())
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,92 @@
+package ir
+
+import "testing"
+
+func TestDiff(t *testing.T) {
+	published := BooleanQuery{
+		Operator: "and",
+		Children: []BooleanQuery{
+			{Operator: "or", Keywords: []Keyword{kw("asthma"), kw("wheez*")}},
+			{Operator: "or", Keywords: []Keyword{kw("steroid*"), kw("inhaler*")}},
+		},
+	}
+	// The same query with the operands in a different order and in a different case.
+	reordered := BooleanQuery{
+		Operator: "AND",
+		Children: []BooleanQuery{
+			{Operator: "OR", Keywords: []Keyword{kw("inhaler*"), kw("Steroid*")}},
+			{Operator: "OR", Keywords: []Keyword{kw("wheez*"), kw("asthma")}},
+		},
+	}
+	if d := Diff(published, reordered); !d.Empty() {
+		t.Fatalf("Expected no differences, got %v", d)
+	}
+
+	reproduction := BooleanQuery{
+		Operator: "and",
+		Children: []BooleanQuery{
+			{Operator: "or", Keywords: []Keyword{kw("asthma"), kw("wheeze")}},
+			{Operator: "or", Keywords: []Keyword{kw("steroid*"), kw("inhaler*")}},
+		},
+	}
+	d := Diff(published, reproduction)
+	if len(d.Added) != 1 || d.Added[0].QueryString != "wheeze" || len(d.Removed) != 1 || d.Removed[0].QueryString != "wheez*" {
+		t.Fatalf("Expected wheeze to be added and wheez* to be removed, got %v", d)
+	}
+	// Only the innermost group that differs is reported.
+	if len(d.AddedGroups) != 1 || d.AddedGroups[0].String() != "asthma[title] OR wheeze[title]" {
+		t.Fatalf("Expected the population group to be added, got %v", d.AddedGroups)
+	}
+	if len(d.RemovedGroups) != 1 || d.RemovedGroups[0].String() != "asthma[title] OR wheez*[title]" {
+		t.Fatalf("Expected the population group to be removed, got %v", d.RemovedGroups)
+	}
+
+	// Moving a keyword between groups changes the structure without adding or removing keywords.
+	moved := BooleanQuery{
+		Operator: "and",
+		Keywords: []Keyword{kw("wheez*")},
+		Children: []BooleanQuery{
+			{Operator: "or", Keywords: []Keyword{kw("asthma")}, Children: []BooleanQuery{{Operator: "or", Keywords: []Keyword{kw("steroid*"), kw("inhaler*")}}}},
+		},
+	}
+	d = Diff(published, moved)
+	if len(d.Added) != 0 || len(d.Removed) != 0 || len(d.AddedGroups) == 0 || len(d.RemovedGroups) == 0 {
+		t.Fatalf("Expected only structural differences, got %v", d)
+	}
+
+	// Queries are compared in the same canonical form as their fingerprints.
+	for _, c := range []struct {
+		a, b BooleanQuery
+		same bool
+	}{
+		{
+			BooleanQuery{Operator: "or", Keywords: []Keyword{kw("a")}, Children: []BooleanQuery{{Operator: "or", Keywords: []Keyword{kw("b"), kw("c")}}}},
+			BooleanQuery{Operator: "or", Keywords: []Keyword{kw("a"), kw("b"), kw("c")}},
+			true,
+		},
+		{
+			BooleanQuery{Operator: "not", Keywords: []Keyword{kw("a"), kw("b"), kw("c")}},
+			BooleanQuery{Operator: "not", Keywords: []Keyword{kw("a"), kw("c"), kw("b")}},
+			true,
+		},
+		{
+			BooleanQuery{Operator: "not", Keywords: []Keyword{kw("a"), kw("b")}},
+			BooleanQuery{Operator: "not", Keywords: []Keyword{kw("b"), kw("a")}},
+			false,
+		},
+		{
+			BooleanQuery{Operator: "adj3", Keywords: []Keyword{kw("a"), kw("b")}},
+			BooleanQuery{Operator: "adj3", Keywords: []Keyword{kw("a"), kw("b")}, Options: map[string]interface{}{InOrderOption: true}},
+			false,
+		},
+		{
+			BooleanQuery{Operator: "or", Keywords: []Keyword{kw("a"), kw("b")}},
+			BooleanQuery{Operator: "or", Keywords: []Keyword{kw("a"), {QueryString: "b", Fields: []string{"title"}, Options: map[string]interface{}{FrequencyOption: 2}}}},
+			false,
+		},
+	} {
+		if d := Diff(c.a, c.b); d.Empty() != c.same {
+			t.Fatalf("Expected %v and %v to be the same (%v), got %v", c.a, c.b, c.same, d)
+		}
+	}
+}
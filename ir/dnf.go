@@ -0,0 +1,217 @@
+package ir
+
+import (
+	"fmt"
+	"strings"
+)
+
+// literal is a single operand of a clause in disjunctive normal form. A literal is either a keyword, or a group that
+// cannot be distributed over (i.e. an adjacency group), and may be negated.
+type literal struct {
+	keyword *Keyword
+	group   *BooleanQuery
+	negated bool
+}
+
+// clause is a conjunction of literals.
+type clause []literal
+
+// dnfConverter distributes queries into clauses, keeping track of the number of clauses created.
+type dnfConverter struct {
+	maxClauses int
+}
+
+// ToDNF converts a query into disjunctive normal form: a top-level "or" of clauses. Each clause is an "and" group
+// of keywords when it contains no negation, otherwise it is a "not" group whose first child is an "and" group of the
+// positive keywords, and whose remaining operands are negated. A clause without positive keywords is a "not" group of
+// its single negated operand, e.g. `NOT a`, or an "and" group of these. Adjacency groups cannot be distributed over,
+// so they are kept intact as a single operand of a clause.
+//
+// Distributing "and" over "or" can grow the query exponentially, so an error is returned if the query expands into
+// more than maxClauses clauses. A maxClauses of zero or less means there is no limit.
+//
+// Like the Medline backend, the operands of a group are its children followed by its keywords, so the first operand of
+// a "not" group is its first child if it has any children.
+func (b BooleanQuery) ToDNF(maxClauses int) (BooleanQuery, error) {
+	c := dnfConverter{maxClauses: maxClauses}
+	clauses, err := c.convert(b, false)
+	if err != nil {
+		return BooleanQuery{}, err
+	}
+
+	dnf := BooleanQuery{Operator: "or"}
+	for _, cl := range clauses {
+		var positive, negative BooleanQuery
+		positive.Operator = "and"
+		negative.Operator = "not"
+		for _, l := range cl {
+			q := &positive
+			if l.negated {
+				q = &negative
+			}
+			if l.keyword != nil {
+				q.Keywords = append(q.Keywords, *l.keyword)
+			} else {
+				q.Children = append(q.Children, *l.group)
+			}
+		}
+		if len(negative.Keywords) == 0 && len(negative.Children) == 0 {
+			dnf.Children = append(dnf.Children, positive)
+		} else if len(positive.Keywords) == 0 && len(positive.Children) == 0 {
+			dnf.Children = append(dnf.Children, negatedClause(negative))
+		} else {
+			negative.Children = append([]BooleanQuery{positive}, negative.Children...)
+			dnf.Children = append(dnf.Children, negative)
+		}
+	}
+	return dnf, nil
+}
+
+// negatedClause is a clause which only has negated operands, as a "not" group of a single operand for each operand,
+// combined in an "and" group when there is more than one, e.g. `(NOT a) AND (NOT b)`.
+func negatedClause(negative BooleanQuery) BooleanQuery {
+	o := operands(negative)
+	if len(o) == 1 {
+		return negative
+	}
+	clause := BooleanQuery{Operator: "and"}
+	for _, operand := range o {
+		if isKeyword(operand) {
+			clause.Children = append(clause.Children, BooleanQuery{Operator: "not", Keywords: operand.Keywords})
+		} else {
+			clause.Children = append(clause.Children, BooleanQuery{Operator: "not", Children: []BooleanQuery{operand}})
+		}
+	}
+	return clause
+}
+
+// operands returns the keywords and children of a query as a single list of queries.
+func operands(b BooleanQuery) []BooleanQuery {
+	o := append([]BooleanQuery{}, b.Children...)
+	for _, keyword := range b.Keywords {
+		o = append(o, BooleanQuery{Keywords: []Keyword{keyword}})
+	}
+	return o
+}
+
+// isKeyword determines if a query is a wrapper around a single keyword.
+func isKeyword(b BooleanQuery) bool {
+	return len(b.Operator) == 0 && len(b.Keywords) == 1 && len(b.Children) == 0
+}
+
+// product computes the cross product of two sets of clauses.
+func (c dnfConverter) product(a, b []clause) ([]clause, error) {
+	if c.maxClauses > 0 && len(a)*len(b) > c.maxClauses {
+		return nil, fmt.Errorf("converting query to dnf exceeds the limit of %d clauses", c.maxClauses)
+	}
+	var p []clause
+	for _, x := range a {
+		for _, y := range b {
+			cl := make(clause, 0, len(x)+len(y))
+			cl = append(cl, x...)
+			cl = append(cl, y...)
+			p = append(p, cl)
+		}
+	}
+	return p, nil
+}
+
+// union concatenates two sets of clauses.
+func (c dnfConverter) union(a, b []clause) ([]clause, error) {
+	if c.maxClauses > 0 && len(a)+len(b) > c.maxClauses {
+		return nil, fmt.Errorf("converting query to dnf exceeds the limit of %d clauses", c.maxClauses)
+	}
+	return append(a, b...), nil
+}
+
+// convert computes the clauses of a query, or of the negation of the query.
+func (c dnfConverter) convert(b BooleanQuery, negated bool) ([]clause, error) {
+	if isKeyword(b) {
+		k := b.Keywords[0]
+		return []clause{{literal{keyword: &k, negated: negated}}}, nil
+	}
+
+	o := operands(b)
+	operator := strings.ToLower(b.Operator)
+
+	switch {
+	case len(operator) == 0:
+		if len(o) != 1 {
+			return nil, fmt.Errorf("cannot convert a group of %d operands without an operator to dnf", len(o))
+		}
+		return c.convert(o[0], negated)
+	case operator == "or" && !negated, operator == "and" && negated:
+		// a OR b, NOT (a AND b) = NOT a OR NOT b
+		var clauses []clause
+		for _, operand := range o {
+			d, err := c.convert(operand, negated)
+			if err != nil {
+				return nil, err
+			}
+			clauses, err = c.union(clauses, d)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return clauses, nil
+	case operator == "and" && !negated, operator == "or" && negated:
+		// a AND b, NOT (a OR b) = NOT a AND NOT b
+		clauses := []clause{{}}
+		for _, operand := range o {
+			d, err := c.convert(operand, negated)
+			if err != nil {
+				return nil, err
+			}
+			clauses, err = c.product(clauses, d)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return clauses, nil
+	case operator == "not" && len(o) == 1:
+		// A not group of a single operand excludes the operand from every document, so it is a negated literal.
+		return c.convert(o[0], !negated)
+	case operator == "not":
+		if len(o) == 0 {
+			return nil, fmt.Errorf("a not group must have at least one operand")
+		}
+		if !negated {
+			// a NOT b = a AND NOT b
+			clauses, err := c.convert(o[0], false)
+			if err != nil {
+				return nil, err
+			}
+			for _, operand := range o[1:] {
+				d, err := c.convert(operand, true)
+				if err != nil {
+					return nil, err
+				}
+				clauses, err = c.product(clauses, d)
+				if err != nil {
+					return nil, err
+				}
+			}
+			return clauses, nil
+		}
+		// NOT (a NOT b) = NOT a OR b
+		clauses, err := c.convert(o[0], true)
+		if err != nil {
+			return nil, err
+		}
+		for _, operand := range o[1:] {
+			d, err := c.convert(operand, false)
+			if err != nil {
+				return nil, err
+			}
+			clauses, err = c.union(clauses, d)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return clauses, nil
+	default:
+		// Any other operator (i.e. adjacency) is kept intact.
+		g := b
+		return []clause{{literal{group: &g, negated: negated}}}, nil
+	}
+}
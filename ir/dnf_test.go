@@ -0,0 +1,110 @@
+package ir
+
+import (
+	"testing"
+)
+
+func kw(s string) Keyword {
+	return Keyword{QueryString: s, Fields: []string{"title"}}
+}
+
+func TestBooleanQuery_ToDNF(t *testing.T) {
+	// (a OR b) AND (c OR d)
+	q := BooleanQuery{
+		Operator: "and",
+		Children: []BooleanQuery{
+			{Operator: "or", Keywords: []Keyword{kw("a"), kw("b")}},
+			{Operator: "or", Keywords: []Keyword{kw("c"), kw("d")}},
+		},
+	}
+
+	dnf, err := q.ToDNF(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dnf.Operator != "or" {
+		t.Fatalf("expected top-level or, got %v", dnf.Operator)
+	}
+	expected := 4
+	got := len(dnf.Children)
+	if expected != got {
+		t.Fatalf("expected %v clauses, got %v", expected, got)
+	}
+	for _, child := range dnf.Children {
+		if child.Operator != "and" || len(child.Keywords) != 2 || len(child.Children) != 0 {
+			t.Fatalf("expected an and clause of two keywords, got %v", child)
+		}
+	}
+}
+
+func TestBooleanQuery_ToDNFNot(t *testing.T) {
+	// a NOT (b OR c) = a AND NOT b AND NOT c
+	q := BooleanQuery{
+		Operator: "not",
+		Children: []BooleanQuery{
+			{Keywords: []Keyword{kw("a")}},
+			{Operator: "or", Keywords: []Keyword{kw("b"), kw("c")}},
+		},
+	}
+
+	dnf, err := q.ToDNF(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dnf.Children) != 1 {
+		t.Fatalf("expected 1 clause, got %v", len(dnf.Children))
+	}
+	c := dnf.Children[0]
+	if c.Operator != "not" || len(c.Keywords) != 2 || len(c.Children) != 1 || c.Children[0].Keywords[0].QueryString != "a" {
+		t.Fatalf("expected a not clause of a, b, and c, got %v", c)
+	}
+
+	// a NOT (b AND c) = (a AND NOT b) OR (a AND NOT c)
+	q.Children[1].Operator = "and"
+	dnf, err = q.ToDNF(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dnf.Children) != 2 {
+		t.Fatalf("expected 2 clauses, got %v", len(dnf.Children))
+	}
+
+	// A not group of a single operand is a negated operand: NOT a, NOT (a OR b) = NOT a AND NOT b, and
+	// NOT (a AND b) = NOT a OR NOT b.
+	for _, c := range []struct {
+		query    BooleanQuery
+		expected string
+	}{
+		{BooleanQuery{Operator: "not", Keywords: []Keyword{kw("a")}}, "(NOT a[title])"},
+		{BooleanQuery{Operator: "not", Children: []BooleanQuery{{Operator: "or", Keywords: []Keyword{kw("a"), kw("b")}}}}, "((NOT a[title]) AND (NOT b[title]))"},
+		{BooleanQuery{Operator: "not", Children: []BooleanQuery{{Operator: "and", Keywords: []Keyword{kw("a"), kw("b")}}}}, "(NOT a[title]) OR (NOT b[title])"},
+		{BooleanQuery{Operator: "and", Children: []BooleanQuery{{Operator: "not", Keywords: []Keyword{kw("b")}}}, Keywords: []Keyword{kw("a")}}, "(a[title] NOT b[title])"},
+	} {
+		dnf, err := c.query.ToDNF(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := dnf.String(); s != c.expected {
+			t.Fatalf("Expected %v, got %v", c.expected, s)
+		}
+	}
+}
+
+func TestBooleanQuery_ToDNFLimit(t *testing.T) {
+	var children []BooleanQuery
+	for i := 0; i < 10; i++ {
+		children = append(children, BooleanQuery{Operator: "or", Keywords: []Keyword{kw("a"), kw("b")}})
+	}
+	q := BooleanQuery{Operator: "and", Children: children}
+
+	if _, err := q.ToDNF(1000); err == nil {
+		t.Fatal("expected an error when the number of clauses exceeds the limit")
+	}
+	dnf, err := q.ToDNF(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dnf.Children) != 1024 {
+		t.Fatalf("expected %v clauses, got %v", 1024, len(dnf.Children))
+	}
+}
@@ -0,0 +1,40 @@
+package ir
+
+import "fmt"
+
+// Filters are the named filters which can be applied to a query with ApplyFilter. Each filter is a query string in
+// PubMed syntax. The standard PubMed Clinical Queries filters are built in, e.g. "Therapy/Broad" and
+// "Diagnosis/Narrow", and more filters can be registered by adding them to the map.
+var Filters = map[string]string{
+	"Therapy/Broad":                     `((clinical[Title/Abstract] AND trial[Title/Abstract]) OR clinical trials as topic[MeSH Terms] OR clinical trial[Publication Type] OR random*[Title/Abstract] OR random allocation[MeSH Terms] OR therapeutic use[MeSH Subheading])`,
+	"Therapy/Narrow":                    `(randomized controlled trial[Publication Type] OR (randomized[Title/Abstract] AND controlled[Title/Abstract] AND trial[Title/Abstract]))`,
+	"Diagnosis/Broad":                   `(sensitiv*[Title/Abstract] OR "sensitivity and specificity"[MeSH Terms] OR diagnose[Title/Abstract] OR diagnosed[Title/Abstract] OR diagnoses[Title/Abstract] OR diagnosing[Title/Abstract] OR diagnosis[Title/Abstract] OR diagnostic[Title/Abstract] OR diagnosis[MeSH:noexp] OR diagnostic*[MeSH:noexp] OR "diagnosis, differential"[MeSH:noexp] OR diagnosis[Subheading:noexp])`,
+	"Diagnosis/Narrow":                  `(specificity[Title/Abstract])`,
+	"Etiology/Broad":                    `(risk*[Title/Abstract] OR risk*[MeSH:noexp] OR cohort studies[MeSH Terms] OR group[Text Word] OR groups[Text Word] OR grouped[Text Word])`,
+	"Etiology/Narrow":                   `((relative[Title/Abstract] AND risk*[Title/Abstract]) OR relative risk[Text Word] OR risks[Text Word] OR cohort studies[MeSH:noexp] OR (cohort[Title/Abstract] AND study[Title/Abstract]) OR (cohort[Title/Abstract] AND studies[Title/Abstract]))`,
+	"Prognosis/Broad":                   `(incidence[MeSH:noexp] OR mortality[MeSH Terms] OR follow up studies[MeSH:noexp] OR prognos*[Text Word] OR predict*[Text Word] OR course*[Text Word])`,
+	"Prognosis/Narrow":                  `(prognos*[Title/Abstract] OR (first[Title/Abstract] AND episode[Title/Abstract]) OR cohort[Title/Abstract])`,
+	"Clinical Prediction Guides/Broad":  `(predict*[tiab] OR predictive value of tests[mh] OR scor*[tiab] OR observ*[tiab] OR observer variation[mh])`,
+	"Clinical Prediction Guides/Narrow": `(validation[tiab] OR validate[tiab])`,
+}
+
+// FilterParser parses the query string of a filter in Filters. This package cannot parse queries itself, so it is set
+// when the parser package is imported.
+var FilterParser func(filter string) (BooleanQuery, error)
+
+// ApplyFilter parses the named filter in Filters, and combines it with the query using an "and" operator. An error is
+// returned if there is no filter with the name, or the filter cannot be parsed.
+func (b BooleanQuery) ApplyFilter(name string) (BooleanQuery, error) {
+	filter, ok := Filters[name]
+	if !ok {
+		return BooleanQuery{}, fmt.Errorf("there is no filter named %v", name)
+	}
+	if FilterParser == nil {
+		return BooleanQuery{}, fmt.Errorf("filters cannot be parsed until the parser package is imported")
+	}
+	f, err := FilterParser(filter)
+	if err != nil {
+		return BooleanQuery{}, fmt.Errorf("the filter %v could not be parsed: %v", name, err)
+	}
+	return Combine("and", b, f), nil
+}
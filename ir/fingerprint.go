@@ -0,0 +1,16 @@
+package ir
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Fingerprint computes a stable hash (as hexadecimal) of the canonical form of a query, so that queries which are
+// written differently but search the same way have the same fingerprint, e.g. to find duplicate search strategies.
+// The canonical form ignores the order of operands (except where it matters, e.g. the first operand of "not"), the
+// case and spacing of query strings, the order of fields, nested groups of the same operator, repeated operands, and
+// options which do not change what the query retrieves, such as comments and sources.
+func (b BooleanQuery) Fingerprint() string {
+	h := sha256.Sum256([]byte(canonicalGroup(b)))
+	return hex.EncodeToString(h[:])
+}
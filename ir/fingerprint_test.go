@@ -0,0 +1,90 @@
+package ir
+
+import "testing"
+
+func TestBooleanQuery_Fingerprint(t *testing.T) {
+	q := BooleanQuery{
+		Operator: "and",
+		Children: []BooleanQuery{
+			{Operator: "or", Keywords: []Keyword{kw("asthma"), kw("wheez*")}},
+			{Operator: "or", Keywords: []Keyword{kw("steroid*"), kw("inhaler*")}},
+		},
+	}
+
+	same := []BooleanQuery{
+		// Reordered operands, and a different case and spacing.
+		{
+			Operator: "AND",
+			Children: []BooleanQuery{
+				{Operator: "OR", Keywords: []Keyword{kw("Inhaler*"), kw(" steroid*")}},
+				{Operator: "OR", Keywords: []Keyword{kw("wheez*"), kw("ASTHMA")}},
+			},
+		},
+		// Nested groups of the same operator, a repeated keyword, and a group wrapping the query.
+		{
+			Children: []BooleanQuery{{
+				Operator: "and",
+				Children: []BooleanQuery{
+					{Operator: "or", Keywords: []Keyword{kw("asthma")}, Children: []BooleanQuery{
+						{Operator: "or", Keywords: []Keyword{kw("wheez*"), kw("asthma")}},
+					}},
+					{Operator: "or", Keywords: []Keyword{kw("steroid*"), kw("inhaler*")}},
+				},
+			}},
+		},
+		// A comment does not change what the query retrieves.
+		{
+			Operator: "and",
+			Options:  map[string]interface{}{CommentOption: "# population"},
+			Children: []BooleanQuery{
+				{Operator: "or", Keywords: []Keyword{kw("asthma"), kw("wheez*")}},
+				{Operator: "or", Keywords: []Keyword{kw("steroid*"), kw("inhaler*")}},
+			},
+		},
+	}
+	for _, s := range same {
+		if q.Fingerprint() != s.Fingerprint() {
+			t.Fatalf("Expected %v to have the same fingerprint as %v", s, q)
+		}
+	}
+
+	different := []BooleanQuery{
+		{
+			Operator: "or",
+			Children: []BooleanQuery{
+				{Operator: "or", Keywords: []Keyword{kw("asthma"), kw("wheez*")}},
+				{Operator: "or", Keywords: []Keyword{kw("steroid*"), kw("inhaler*")}},
+			},
+		},
+		{
+			Operator: "and",
+			Children: []BooleanQuery{
+				{Operator: "or", Keywords: []Keyword{kw("asthma"), {QueryString: "wheez*", Fields: []string{"abstract"}}}},
+				{Operator: "or", Keywords: []Keyword{kw("steroid*"), kw("inhaler*")}},
+			},
+		},
+		// The operands of "not" are not interchangeable.
+		{
+			Operator: "not",
+			Children: []BooleanQuery{
+				{Operator: "or", Keywords: []Keyword{kw("asthma"), kw("wheez*")}},
+				{Operator: "or", Keywords: []Keyword{kw("steroid*"), kw("inhaler*")}},
+			},
+		},
+		{
+			Operator: "not",
+			Children: []BooleanQuery{
+				{Operator: "or", Keywords: []Keyword{kw("steroid*"), kw("inhaler*")}},
+				{Operator: "or", Keywords: []Keyword{kw("asthma"), kw("wheez*")}},
+			},
+		},
+	}
+	seen := map[string]bool{q.Fingerprint(): true}
+	for _, d := range different {
+		f := d.Fingerprint()
+		if seen[f] {
+			t.Fatalf("Expected %v to have a different fingerprint", d)
+		}
+		seen[f] = true
+	}
+}
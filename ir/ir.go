@@ -1,6 +1,67 @@
 // Package ir contains code relating to the immediate representation query structure of a search strategy.
 package ir
 
+const (
+	// ProximityOption is the key in the options of a keyword for the maximum distance (in words) between the terms of
+	// a phrase, e.g. `"heart attack"[tiab:~3]` in PubMed.
+	ProximityOption = "proximity"
+	// InOrderOption is the key in the options of an adjacency group which requires the operands of the group to
+	// appear in the order they are written, e.g. `W3` in EBSCO.
+	InOrderOption = "in_order"
+	// FrequencyOption is the key in the options of a keyword for the minimum number of times the keyword must appear
+	// in a document, e.g. `asthma.ab./freq=3` in Ovid.
+	FrequencyOption = "frequency"
+	// DistanceOption is the key in the options of an adjacency group for the distance between its operands, as counted
+	// by `adj` in the ir, i.e. 1 for `adj` and 3 for `adj3`.
+	DistanceOption = "distance"
+	// RelativeDateOption is the key in the options of a date keyword for a date range relative to when the query is
+	// run (a RelativeDate), e.g. `"last 5 years"[dp]` in PubMed.
+	RelativeDateOption = "relative_date"
+	// SubheadingOption is the key in the options of a MeSH heading keyword for the subheading that qualifies the
+	// heading, e.g. `drug therapy` for `asthma/drug therapy[majr]` in PubMed.
+	SubheadingOption = "subheading"
+	// FuzzinessOption is the key in the options of a keyword for the maximum edit distance of the terms matched by the
+	// keyword, e.g. `tumour~2` in Lucene.
+	FuzzinessOption = "fuzziness"
+	// BoostOption is the key in the options of a keyword for the weight (a float64) of the keyword when ranking the
+	// documents it matches, e.g. `asthma^2` in Lucene.
+	BoostOption = "boost"
+	// LimitOption is the key in the options of a keyword or group for the limits applied to it (a []string), e.g.
+	// `humans` for `limit 7 to humans` in Ovid.
+	LimitOption = "limit"
+	// SourceOption is the key in the options of a keyword for the line of the query the keyword was parsed from (a
+	// Source).
+	SourceOption = "source"
+	// CommentOption is the key in the options of a keyword or group for the comment written above its line in a
+	// search strategy, e.g. `# population block`.
+	CommentOption = "comment"
+	// ExistsOption is the key in the options of a keyword without a query string which only requires its fields to be
+	// present in a document (a bool), e.g. that a document has an abstract.
+	ExistsOption = "exists"
+	// MetadataOption is the key in the options of a query for the text at the end of a query string which is not part
+	// of the query (a []string), e.g. the `Sort by: Most Recent` setting of a search exported from PubMed.
+	MetadataOption = "metadata"
+	// NoteOption is the key in the options of a keyword for a note written inline with the keyword in a query (a
+	// string), e.g. `chronic` for `asthma /* chronic */[tiab]`.
+	NoteOption = "note"
+)
+
+// RelativeDate is a date range which ends on the day a query is run, e.g. the last 5 years.
+type RelativeDate struct {
+	// Amount is the number of units the range spans.
+	Amount int `json:"amount"`
+	// Unit is the unit of the range: "days", "months", or "years".
+	Unit string `json:"unit"`
+}
+
+// Source is a line of a search strategy, e.g. the line a keyword was parsed from.
+type Source struct {
+	// Line is the number of the line in the search strategy, starting at 1.
+	Line int `json:"line"`
+	// Text is the text of the line, without its number.
+	Text string `json:"text"`
+}
+
 // Keyword represents a single string inside a search strategy. When these are reported, however, a keyword not only
 // contains the phrase to search, but the fields in the database to search, how it is truncated, and if it is a mesh
 // term, if the term has been exploded.
@@ -12,6 +73,13 @@ type Keyword struct {
 	Options     map[string]interface{} `json:"options"`
 }
 
+// Exists determines if a keyword only requires its fields to be present in a document (see ExistsOption), rather
+// than searching for a query string.
+func (k Keyword) Exists() bool {
+	exists, _ := k.Options[ExistsOption].(bool)
+	return exists && len(k.QueryString) == 0
+}
+
 // BooleanQuery is the immediate representation of a boolean query for a search engine. This representation groups a
 // list of keywords by a single operator, much like prefix notation. To combine operators, they can be added as children
 // to a query. This means that there is no ambiguity to a query.
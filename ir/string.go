@@ -0,0 +1,60 @@
+package ir
+
+import "strings"
+
+// String renders a keyword in a compact form for diagnostics, e.g. `wheez*[title_abstract]`. Exploded keywords are
+// prefixed with `exp`, as in Ovid, and keywords which only require their fields to exist are rendered as
+// `exists[text]`.
+func (k Keyword) String() string {
+	s := k.QueryString
+	if k.Exists() {
+		s = "exists"
+	}
+	if k.Exploded {
+		s = "exp " + s
+	}
+	if len(k.Fields) > 0 {
+		s += "[" + strings.Join(k.Fields, ",") + "]"
+	}
+	return s
+}
+
+// String renders a query in a compact, canonical form for diagnostics and test failures, e.g.
+// `(asthma[title_abstract] OR wheez*[title_abstract]) AND child*[title_abstract]`. Like the backends, the operands of
+// a group are its children followed by its keywords. Groups nested inside another group are parenthesised, and a
+// "not" group of a single operand is rendered as `NOT` followed by the operand.
+func (b BooleanQuery) String() string {
+	return b.string(false)
+}
+
+func (b BooleanQuery) string(nested bool) string {
+	// A group without an operator that only wraps another group is rendered as that group.
+	if len(b.Operator) == 0 && len(b.Keywords) == 0 && len(b.Children) == 1 {
+		return b.Children[0].string(nested)
+	}
+	var operands []string
+	for _, child := range b.Children {
+		operands = append(operands, child.string(true))
+	}
+	for _, keyword := range b.Keywords {
+		operands = append(operands, keyword.String())
+	}
+	if len(operands) == 1 {
+		// A "not" group of a single operand negates it, e.g. `NOT asthma`.
+		if strings.ToLower(b.Operator) == "not" && nested {
+			return "(NOT " + operands[0] + ")"
+		} else if strings.ToLower(b.Operator) == "not" {
+			return "NOT " + operands[0]
+		}
+		return operands[0]
+	}
+	sep := " "
+	if len(b.Operator) > 0 {
+		sep = " " + strings.ToUpper(b.Operator) + " "
+	}
+	s := strings.Join(operands, sep)
+	if nested {
+		return "(" + s + ")"
+	}
+	return s
+}
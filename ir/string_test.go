@@ -0,0 +1,33 @@
+package ir
+
+import "testing"
+
+func TestBooleanQuery_String(t *testing.T) {
+	field := func(s string) Keyword {
+		return Keyword{QueryString: s, Fields: []string{"ti", "ab"}}
+	}
+	q := BooleanQuery{
+		Operator: "and",
+		Keywords: []Keyword{field("child*")},
+		Children: []BooleanQuery{{Operator: "or", Keywords: []Keyword{field("asthma"), field("wheez*")}}},
+	}
+	if s := q.String(); s != "(asthma[ti,ab] OR wheez*[ti,ab]) AND child*[ti,ab]" {
+		t.Fatalf("Unexpected string %v", s)
+	}
+
+	// Groups of a single operand are not parenthesised.
+	q = BooleanQuery{
+		Operator: "not",
+		Children: []BooleanQuery{{Keywords: []Keyword{{QueryString: "Asthma", Fields: []string{"mesh_headings"}, Exploded: true}}}},
+		Keywords: []Keyword{kw("adult")},
+	}
+	if s := q.String(); s != "exp Asthma[mesh_headings] NOT adult[title]" {
+		t.Fatalf("Unexpected string %v", s)
+	}
+
+	// A "not" group of a single operand negates it.
+	q = BooleanQuery{Operator: "or", Children: []BooleanQuery{{Operator: "not", Keywords: []Keyword{kw("a")}}}, Keywords: []Keyword{kw("b")}}
+	if s := q.String(); s != "(NOT a[title]) OR b[title]" {
+		t.Fatalf("Unexpected string %v", s)
+	}
+}
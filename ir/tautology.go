@@ -0,0 +1,65 @@
+package ir
+
+import "strings"
+
+// tautologyWarning is a warning about a group which is always true or always false because of the operand, which
+// refers to the keyword of the operand when the operand is a keyword.
+func tautologyWarning(message string, operand BooleanQuery) Warning {
+	w := Warning{Message: message}
+	if isKeyword(operand) {
+		keyword := operand.Keywords[0]
+		w.Keyword = &keyword
+	}
+	return w
+}
+
+// DetectTautologies reports the groups of a query which can never match a document, e.g. `A AND NOT A` or `A NOT A`,
+// or which match every document, e.g. `A OR NOT A`, since these are usually a mistake (e.g. made when a query is
+// expanded automatically). Only an operand which is directly both included and excluded by the same group is found;
+// operands are the same when they have the same canonical form, so the same operand written differently is also found.
+func (b BooleanQuery) DetectTautologies() (warnings []Warning) {
+	Walk(&b, VisitorFuncs{Query: func(q *BooleanQuery) bool {
+		o := operands(*q)
+		operator := strings.ToLower(q.Operator)
+		switch operator {
+		case "not":
+			// `A NOT A` excludes everything the group searches.
+			for i := 1; i < len(o); i++ {
+				if excluded := o[i]; canonicalGroup(excluded) == canonicalGroup(o[0]) {
+					warnings = append(warnings, tautologyWarning("group is always false, as `not` excludes the operand it excludes from", excluded))
+				}
+			}
+		case "and", "or":
+			included := make(map[string]bool)
+			for _, operand := range o {
+				included[canonicalGroup(operand)] = true
+			}
+			for _, child := range q.Children {
+				if strings.ToLower(child.Operator) != "not" {
+					continue
+				}
+				excluded := operands(child)
+				if len(excluded) == 1 {
+					// A `not` group of a single operand, e.g. `NOT A`, excludes the operand from every document.
+					if !included[canonicalGroup(excluded[0])] {
+						continue
+					}
+					if operator == "and" {
+						warnings = append(warnings, tautologyWarning("group is always false, as an operand is both required and excluded", excluded[0]))
+					} else {
+						warnings = append(warnings, tautologyWarning("group is always true, as it searches both an operand and everything but the operand", excluded[0]))
+					}
+				} else if operator == "and" {
+					// `A AND (B NOT A)` is also never true.
+					for _, e := range excluded[1:] {
+						if included[canonicalGroup(e)] {
+							warnings = append(warnings, tautologyWarning("group is always false, as an operand is both required and excluded", e))
+						}
+					}
+				}
+			}
+		}
+		return true
+	}})
+	return
+}
@@ -0,0 +1,56 @@
+package ir
+
+import "testing"
+
+func TestBooleanQuery_DetectTautologies(t *testing.T) {
+	not := func(operands ...Keyword) BooleanQuery {
+		return BooleanQuery{Operator: "not", Keywords: operands}
+	}
+	queries := []struct {
+		query    BooleanQuery
+		expected []string
+	}{
+		{
+			// A OR NOT A.
+			BooleanQuery{Operator: "or", Keywords: []Keyword{kw("asthma")}, Children: []BooleanQuery{not(kw("asthma"))}},
+			[]string{"group is always true, as it searches both an operand and everything but the operand"},
+		},
+		{
+			// A AND NOT A, where the operands are written differently.
+			BooleanQuery{Operator: "and", Keywords: []Keyword{kw("Asthma")}, Children: []BooleanQuery{not(kw(" asthma"))}},
+			[]string{"group is always false, as an operand is both required and excluded"},
+		},
+		{
+			// A NOT A.
+			not(kw("asthma"), kw("wheeze"), kw("asthma")),
+			[]string{"group is always false, as `not` excludes the operand it excludes from"},
+		},
+		{
+			// A AND (B NOT A).
+			BooleanQuery{Operator: "and", Keywords: []Keyword{kw("asthma")}, Children: []BooleanQuery{not(kw("child"), kw("asthma"))}},
+			[]string{"group is always false, as an operand is both required and excluded"},
+		},
+		{
+			// A OR (B NOT A) and A AND NOT B are not always true or false.
+			BooleanQuery{Operator: "or", Keywords: []Keyword{kw("asthma")}, Children: []BooleanQuery{
+				not(kw("child"), kw("asthma")),
+				{Operator: "and", Keywords: []Keyword{kw("asthma")}, Children: []BooleanQuery{not(kw("child"))}},
+			}},
+			nil,
+		},
+	}
+	for _, q := range queries {
+		warnings := q.query.DetectTautologies()
+		if len(warnings) != len(q.expected) {
+			t.Fatalf("Expected %v, got %v", q.expected, warnings)
+		}
+		for i, w := range warnings {
+			if w.Message != q.expected[i] {
+				t.Fatalf("Expected %v, got %v", q.expected[i], w.Message)
+			}
+			if w.Keyword == nil {
+				t.Fatalf("Expected the warning to refer to a keyword, got %v", w)
+			}
+		}
+	}
+}
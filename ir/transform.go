@@ -0,0 +1,401 @@
+package ir
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Combine wraps queries as the operands of a new query with the given operator. Operands without an operator that
+// contain only a single keyword or child are unwrapped, and operands that already use the same operator are flattened
+// into the new query when the operator is associative ("and" or "or"), so combining `a OR b` and `c` with "or" gives
+// `a OR b OR c` rather than `(a OR b) OR c`.
+func Combine(op string, queries ...BooleanQuery) BooleanQuery {
+	q := BooleanQuery{Operator: op}
+	associative := strings.ToLower(op) == "and" || strings.ToLower(op) == "or"
+	for _, query := range queries {
+		// Unwrap queries that only wrap a single operand.
+		for len(query.Operator) == 0 && len(query.Keywords) == 0 && len(query.Children) == 1 {
+			query = query.Children[0]
+		}
+		switch {
+		case len(query.Operator) == 0 && len(query.Keywords) == 1 && len(query.Children) == 0:
+			q.Keywords = append(q.Keywords, query.Keywords[0])
+		case associative && strings.ToLower(query.Operator) == strings.ToLower(op) && len(query.Options) == 0:
+			q.Keywords = append(q.Keywords, query.Keywords...)
+			q.Children = append(q.Children, query.Children...)
+		default:
+			q.Children = append(q.Children, query)
+		}
+	}
+	return q
+}
+
+// NormalizeTerms applies a normalisation function (e.g. strings.ToLower) to the query string of every keyword in a
+// query. The fields of the keywords are not changed. A copy of the query is returned (see Clone), so the original
+// query is not modified, and modifying the fields or options of the copy does not modify those of the original.
+func (b BooleanQuery) NormalizeTerms(normalize func(string) string) BooleanQuery {
+	q := b.Clone()
+	Walk(&q, VisitorFuncs{Keyword: func(k *Keyword) bool {
+		k.QueryString = normalize(k.QueryString)
+		return true
+	}})
+	return q
+}
+
+// ExpandTruncation replaces a truncated keyword with an "or" group of its variants, for targets which do not support
+// wildcards, e.g. `child*` with the variants `child`, `children`, and `childhood`. The variants are looked up by the
+// query string of the keyword, and then by the query string without its trailing truncation. Each variant keeps the
+// fields and options of the keyword. A keyword which is not truncated, or which has no variants, is returned as a
+// query containing only the keyword.
+func (k Keyword) ExpandTruncation(variants map[string][]string) BooleanQuery {
+	v, ok := variants[k.QueryString]
+	if !ok {
+		v = variants[strings.TrimRight(k.QueryString, "*?$#")]
+	}
+	if !k.Truncated || len(v) == 0 {
+		return BooleanQuery{Keywords: []Keyword{k}}
+	}
+	q := BooleanQuery{Operator: "or"}
+	for _, variant := range v {
+		keyword := k
+		keyword.QueryString = variant
+		keyword.Truncated = false
+		q.Keywords = append(q.Keywords, keyword)
+	}
+	return q
+}
+
+// ExpandTruncation replaces every truncated keyword in a query that has variants with an "or" group of its variants
+// (see Keyword.ExpandTruncation). The variants of a keyword in an "or" group are added to the group itself. As the
+// operands of a group are its children followed by its keywords, the keywords of a "not" group, or of an adjacency
+// group with InOrderOption, are moved to its children when any of them are expanded, so that the order of the
+// operands is kept. A new query is returned, so the original query is not modified.
+func (b BooleanQuery) ExpandTruncation(variants map[string][]string) BooleanQuery {
+	return b.replaceKeywords(func(k Keyword) BooleanQuery {
+		return k.ExpandTruncation(variants)
+	})
+}
+
+// Replace replaces every keyword in a query that matches with a copy of another query, e.g. to replace a MeSH heading
+// that has been renamed with its new heading, or with an "or" group of the headings it was split into. A replacement
+// that is only a single keyword replaces the keyword itself, and the operands of an "or" replacement in an "or" group
+// are added to the group itself. The order of the operands of a "not" group, or of an adjacency group with
+// InOrderOption, is kept, as in ExpandTruncation. A new query is returned, so the original query is not modified.
+func (b BooleanQuery) Replace(match func(Keyword) bool, with BooleanQuery) BooleanQuery {
+	return b.replaceKeywords(func(k Keyword) BooleanQuery {
+		if !match(k) {
+			return BooleanQuery{Keywords: []Keyword{k}}
+		}
+		return with.Clone()
+	})
+}
+
+// replaceKeywords replaces every keyword in a query with the query that replace returns for it.
+func (b BooleanQuery) replaceKeywords(replace func(Keyword) BooleanQuery) BooleanQuery {
+	q := b
+	q.Keywords = nil
+	q.Children = nil
+	for _, child := range b.Children {
+		q.Children = append(q.Children, child.replaceKeywords(replace))
+	}
+
+	replaced := make([]BooleanQuery, len(b.Keywords))
+	nested := false
+	for i, keyword := range b.Keywords {
+		replaced[i] = replace(keyword)
+		nested = nested || !isKeyword(replaced[i])
+	}
+
+	op := strings.ToLower(b.Operator)
+	inOrder, _ := b.Options[InOrderOption].(bool)
+	for _, r := range replaced {
+		switch {
+		case (op == "not" || inOrder) && nested:
+			q.Children = append(q.Children, r)
+		case isKeyword(r):
+			q.Keywords = append(q.Keywords, r.Keywords[0])
+		case op == "or" && len(b.Options) == 0 && strings.ToLower(r.Operator) == "or" && len(r.Options) == 0:
+			q.Keywords = append(q.Keywords, r.Keywords...)
+			q.Children = append(q.Children, r.Children...)
+		default:
+			q.Children = append(q.Children, r)
+		}
+	}
+	return q
+}
+
+// sameExceptFields determines if two keywords are the same keyword searched in different fields.
+func sameExceptFields(a, b Keyword) bool {
+	return a.QueryString == b.QueryString && a.Exploded == b.Exploded && a.Truncated == b.Truncated &&
+		reflect.DeepEqual(a.Options, b.Options)
+}
+
+// MergeFieldVariants merges the keywords of every "or" group which are the same keyword searched in different fields
+// into a single keyword searching the union of the fields, e.g. `asthma[ti] OR asthma[ab]` becomes `asthma[ti,ab]`.
+// The merged keyword takes the place of the first of the keywords. An "or" group left with a single keyword and no
+// children is replaced by a group without an operator that contains the keyword. A new query is returned, so the
+// original query is not modified.
+func (b BooleanQuery) MergeFieldVariants() BooleanQuery {
+	q := b.Clone()
+	Walk(&q, VisitorFuncs{Query: func(g *BooleanQuery) bool {
+		if strings.ToLower(g.Operator) != "or" {
+			return true
+		}
+		var keywords []Keyword
+		for _, keyword := range g.Keywords {
+			merged := false
+			for i := range keywords {
+				if sameExceptFields(keywords[i], keyword) {
+					for _, field := range keyword.Fields {
+						if !containsField(keywords[i].Fields, field) {
+							keywords[i].Fields = append(keywords[i].Fields, field)
+						}
+					}
+					merged = true
+					break
+				}
+			}
+			if !merged {
+				keywords = append(keywords, keyword)
+			}
+		}
+		g.Keywords = keywords
+		if len(g.Keywords) == 1 && len(g.Children) == 0 && len(g.Options) == 0 {
+			g.Operator = ""
+		}
+		return true
+	}})
+	return q
+}
+
+// containsField determines if a field is one of the fields.
+func containsField(fields []string, field string) bool {
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// cloneOptions copies the options of a keyword or query. Values which are lists or maps, such as limits or metadata,
+// are copied as well, so that they are not shared with the original options.
+func cloneOptions(options map[string]interface{}) map[string]interface{} {
+	if options == nil {
+		return nil
+	}
+	o := make(map[string]interface{}, len(options))
+	for k, v := range options {
+		o[k] = cloneOption(v)
+	}
+	return o
+}
+
+// cloneOption copies the value of an option when it is a list or a map, including the lists and maps inside it.
+func cloneOption(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []string:
+		return append([]string(nil), v...)
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, e := range v {
+			l[i] = cloneOption(e)
+		}
+		return l
+	case map[string]interface{}:
+		return cloneOptions(v)
+	case map[string]string:
+		m := make(map[string]string, len(v))
+		for k, e := range v {
+			m[k] = e
+		}
+		return m
+	}
+	return v
+}
+
+// Clone returns a copy of the keyword which does not share its fields or options with the original keyword.
+func (k Keyword) Clone() Keyword {
+	if k.Fields != nil {
+		k.Fields = append(make([]string, 0, len(k.Fields)), k.Fields...)
+	}
+	k.Options = cloneOptions(k.Options)
+	return k
+}
+
+// Clone returns a deep copy of the query, so that the copy can be modified in place (e.g. with Walk) without modifying
+// the original query. Every keyword, child, and options map is copied.
+func (b BooleanQuery) Clone() BooleanQuery {
+	q := b
+	if b.Keywords != nil {
+		q.Keywords = make([]Keyword, len(b.Keywords))
+		for i, keyword := range b.Keywords {
+			q.Keywords[i] = keyword.Clone()
+		}
+	}
+	if b.Children != nil {
+		q.Children = make([]BooleanQuery, len(b.Children))
+		for i, child := range b.Children {
+			q.Children[i] = child.Clone()
+		}
+	}
+	q.Options = cloneOptions(b.Options)
+	return q
+}
+
+// NormalizeNot rewrites every "not" group with more than two operands into nested "not" groups of two operands, for
+// targets which only support excluding a single operand at a time (i.e. `a AND NOT b`), e.g. `a NOT b NOT c` becomes
+// `(a NOT b) NOT c`. The first operand is the operand that the others are excluded from, so a keyword which is the
+// first operand of a group excluding a group is wrapped in a group of its own to keep it first. The options of a
+// rewritten group are kept by the outermost group. A new query is returned, so the original query is not modified.
+func (b BooleanQuery) NormalizeNot() BooleanQuery {
+	q := b
+	if b.Children != nil {
+		q.Children = make([]BooleanQuery, len(b.Children))
+		for i, child := range b.Children {
+			q.Children[i] = child.NormalizeNot()
+		}
+	}
+	if strings.ToLower(q.Operator) != "not" || len(q.Keywords)+len(q.Children) <= 2 {
+		return q
+	}
+
+	o := operands(q)
+	n := o[0]
+	for _, operand := range o[1:] {
+		pair := BooleanQuery{Operator: q.Operator}
+		if isKeyword(n) && isKeyword(operand) {
+			pair.Keywords = []Keyword{n.Keywords[0], operand.Keywords[0]}
+		} else {
+			pair.Children = []BooleanQuery{n}
+			if isKeyword(operand) {
+				pair.Keywords = operand.Keywords
+			} else {
+				pair.Children = append(pair.Children, operand)
+			}
+		}
+		n = pair
+	}
+	n.Options = q.Options
+	return n
+}
+
+// PushNegationDown applies De Morgan's laws to move every "not" onto the keywords of a query, for targets which only
+// support negating a single term (e.g. `-asthma`) rather than a group. `NOT (a OR b)` becomes `NOT a AND NOT b`, and
+// `NOT (a AND b)` becomes `NOT a OR NOT b`. The negated keywords of a group which also has operands that are not
+// negated are excluded from those operands, so `a NOT (b OR c)` becomes `a NOT b NOT c`; the other negated keywords
+// are "not" groups of the single keyword (e.g. `NOT a OR b`). Adjacency groups cannot be negated term by term, so they
+// are negated (or excluded) as a whole. The options of a rewritten group are kept, and a new query is returned, so the
+// original query is not modified.
+func (b BooleanQuery) PushNegationDown() BooleanQuery {
+	return pushNegation(b, false)
+}
+
+// pushNegation moves the negation of a query, when it is negated, and every "not" inside the query onto its keywords.
+func pushNegation(b BooleanQuery, negated bool) BooleanQuery {
+	negate := func(q BooleanQuery) BooleanQuery {
+		if isKeyword(q) {
+			return BooleanQuery{Operator: "not", Keywords: q.Keywords}
+		}
+		return BooleanQuery{Operator: "not", Children: []BooleanQuery{q}}
+	}
+	if isKeyword(b) {
+		k := b.Keywords[0].Clone()
+		if negated {
+			return negate(BooleanQuery{Keywords: []Keyword{k}})
+		}
+		return BooleanQuery{Keywords: []Keyword{k}, Options: cloneOptions(b.Options)}
+	}
+
+	o := operands(b)
+	var pushed []BooleanQuery
+	operator := strings.ToLower(b.Operator)
+	switch {
+	case len(operator) == 0 && len(o) == 1:
+		return pushNegation(o[0], negated)
+	case operator == "not" && len(o) == 1:
+		// NOT (NOT a) = a
+		return pushNegation(o[0], !negated)
+	case operator == "not":
+		// a NOT b = a AND NOT b, and NOT (a NOT b) = NOT a OR b
+		pushed = append(pushed, pushNegation(o[0], negated))
+		for _, operand := range o[1:] {
+			pushed = append(pushed, pushNegation(operand, !negated))
+		}
+		operator = "and"
+		if negated {
+			operator = "or"
+		}
+	case operator == "and" || operator == "or":
+		// NOT (a AND b) = NOT a OR NOT b, and NOT (a OR b) = NOT a AND NOT b
+		for _, operand := range o {
+			pushed = append(pushed, pushNegation(operand, negated))
+		}
+		if negated {
+			operator = map[string]string{"and": "or", "or": "and"}[operator]
+		}
+	default:
+		// Adjacency groups (and malformed groups) are negated as a whole.
+		q := b.Clone()
+		if negated {
+			return negate(q)
+		}
+		return q
+	}
+
+	// Groups of the same operator are flattened, e.g. `NOT (a OR b) AND c` becomes `NOT a AND NOT b AND c`.
+	var flattened []BooleanQuery
+	for _, operand := range pushed {
+		if !isKeyword(operand) && operand.Operator == operator && len(operand.Options) == 0 {
+			flattened = append(flattened, operands(operand)...)
+		} else {
+			flattened = append(flattened, operand)
+		}
+	}
+
+	// The negated operands of an "and" group are excluded from the others, e.g. `a AND NOT b AND NOT c` becomes
+	// `a NOT b NOT c`, so that a negated keyword is only a group of its own when there is nothing to exclude it from.
+	if operator == "and" {
+		var included, excluded []BooleanQuery
+		for _, operand := range flattened {
+			if strings.ToLower(operand.Operator) == "not" && len(operand.Keywords)+len(operand.Children) == 1 {
+				excluded = append(excluded, operands(operand)[0])
+			} else {
+				included = append(included, operand)
+			}
+		}
+		if len(included) > 0 && len(excluded) > 0 {
+			from := included[0]
+			if len(included) > 1 {
+				from = group("and", included, nil)
+			}
+			return group("not", append([]BooleanQuery{from}, excluded...), cloneOptions(b.Options))
+		}
+	}
+	return group(operator, flattened, cloneOptions(b.Options))
+}
+
+// group creates a group of operands, where the keywords of the operands are keywords of the group. The first operand
+// of a "not" group is the one the others are excluded from, and the children of a group come before its keywords, so a
+// keyword which is the first operand is kept as a child when there are other operands which are groups.
+func group(operator string, o []BooleanQuery, options map[string]interface{}) BooleanQuery {
+	q := BooleanQuery{Operator: operator, Options: options}
+	for i, operand := range o {
+		if isKeyword(operand) && !(i == 0 && strings.ToLower(operator) == "not" && hasGroup(o[1:])) {
+			q.Keywords = append(q.Keywords, operand.Keywords...)
+		} else {
+			q.Children = append(q.Children, operand)
+		}
+	}
+	return q
+}
+
+// hasGroup determines if any of the operands is a group rather than a keyword.
+func hasGroup(o []BooleanQuery) bool {
+	for _, operand := range o {
+		if !isKeyword(operand) {
+			return true
+		}
+	}
+	return false
+}
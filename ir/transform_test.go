@@ -0,0 +1,358 @@
+package ir
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCombine(t *testing.T) {
+	population := BooleanQuery{Operator: "or", Keywords: []Keyword{kw("asthma"), kw("wheeze")}}
+	intervention := BooleanQuery{Operator: "or", Keywords: []Keyword{kw("steroid*"), kw("inhaler*")}}
+	outcome := BooleanQuery{Keywords: []Keyword{kw("hospitalisation")}}
+
+	q := Combine("and", population, intervention, outcome)
+	if q.Operator != "and" || len(q.Children) != 2 || len(q.Keywords) != 1 {
+		t.Fatalf("expected an and group of two children and one keyword, got %v", q)
+	}
+
+	// Combining with the same operator flattens the query.
+	q = Combine("and", q, BooleanQuery{Operator: "and", Keywords: []Keyword{kw("child*"), kw("adolescent*")}})
+	if q.Operator != "and" || len(q.Children) != 2 || len(q.Keywords) != 3 {
+		t.Fatalf("expected an and group of two children and three keywords, got %v", q)
+	}
+
+	// Combining with a different operator nests the query.
+	q = Combine("or", q, population)
+	if q.Operator != "or" || len(q.Children) != 1 || len(q.Keywords) != 2 {
+		t.Fatalf("expected an or group of one child and two keywords, got %v", q)
+	}
+}
+
+func TestBooleanQuery_NormalizeTerms(t *testing.T) {
+	q := BooleanQuery{
+		Operator: "or",
+		Keywords: []Keyword{{QueryString: " Asthma ", Fields: []string{"Title"}}},
+		Children: []BooleanQuery{{
+			Operator: "and",
+			Keywords: []Keyword{kw("WHEEZE"), kw("asthma")},
+			Options:  map[string]interface{}{CommentOption: "population"},
+		}},
+	}
+
+	n := q.NormalizeTerms(func(s string) string {
+		return strings.ToLower(strings.TrimSpace(s))
+	})
+	terms := n.Terms()
+	if len(terms) != 3 || terms[0] != "asthma" || terms[1] != "wheeze" || terms[2] != "asthma" {
+		t.Fatalf("Expected normalised terms, got %v", terms)
+	}
+	if n.Keywords[0].Fields[0] != "Title" {
+		t.Fatalf("Expected fields to be unchanged, got %v", n.Keywords[0].Fields)
+	}
+
+	// The original query is not modified.
+	if q.Keywords[0].QueryString != " Asthma " || q.Children[0].Keywords[0].QueryString != "WHEEZE" {
+		t.Fatalf("Expected the original query to be unchanged, got %v", q.Terms())
+	}
+
+	// The fields and options of the normalised query are not shared with the original query.
+	n.Keywords[0].Fields[0] = "Abstract"
+	n.Children[0].Options[CommentOption] = "intervention"
+	if q.Keywords[0].Fields[0] != "Title" || q.Children[0].Options[CommentOption] != "population" {
+		t.Fatalf("Expected the original query to be unchanged, got %v", q)
+	}
+}
+
+func TestBooleanQuery_ExpandTruncation(t *testing.T) {
+	variants := map[string][]string{
+		"child":    {"child", "children", "childhood"},
+		"steroid*": {"steroid", "steroids"},
+	}
+	truncated := func(s string) Keyword {
+		return Keyword{QueryString: s, Fields: []string{"title"}, Truncated: true}
+	}
+
+	q := truncated("child*").ExpandTruncation(variants)
+	if q.Operator != "or" || len(q.Keywords) != 3 || q.Keywords[1].QueryString != "children" ||
+		q.Keywords[1].Truncated || q.Keywords[1].Fields[0] != "title" {
+		t.Fatalf("Expected an or group of three variants, got %v", q)
+	}
+
+	// Keywords without variants are not expanded.
+	q = truncated("adolescen*").ExpandTruncation(variants)
+	if len(q.Operator) != 0 || len(q.Keywords) != 1 || q.Keywords[0].QueryString != "adolescen*" {
+		t.Fatalf("Expected the keyword to be unchanged, got %v", q)
+	}
+
+	// Variants are added directly to an or group, and nested in other groups.
+	q = BooleanQuery{
+		Operator: "and",
+		Keywords: []Keyword{truncated("child*"), kw("asthma")},
+		Children: []BooleanQuery{{Operator: "or", Keywords: []Keyword{truncated("steroid*"), kw("inhaler")}}},
+	}
+	e := q.ExpandTruncation(variants)
+	if len(e.Keywords) != 1 || len(e.Children) != 2 || len(e.Children[0].Keywords) != 3 || len(e.Children[1].Keywords) != 3 {
+		t.Fatalf("Expected expanded variants, got %v", e)
+	}
+	if len(q.Keywords) != 2 || len(q.Children[0].Keywords) != 2 {
+		t.Fatalf("Expected the original query to be unchanged, got %v", q)
+	}
+
+	// The operands of a not group keep their order.
+	q = BooleanQuery{Operator: "not", Keywords: []Keyword{kw("asthma"), truncated("child*")}}
+	e = q.ExpandTruncation(variants)
+	if len(e.Keywords) != 0 || len(e.Children) != 2 || e.Children[0].Keywords[0].QueryString != "asthma" ||
+		e.Children[1].Operator != "or" {
+		t.Fatalf("Expected the positive operand to remain first, got %v", e)
+	}
+}
+
+func TestBooleanQuery_Replace(t *testing.T) {
+	heading := func(s string) Keyword {
+		return Keyword{QueryString: s, Fields: []string{"mesh_headings"}, Exploded: true}
+	}
+	renamed := func(k Keyword) bool {
+		return k.QueryString == "Mental Retardation" && k.Fields[0] == "mesh_headings"
+	}
+	q := BooleanQuery{
+		Operator: "and",
+		Keywords: []Keyword{kw("Mental Retardation"), heading("Mental Retardation")},
+		Children: []BooleanQuery{{Operator: "or", Keywords: []Keyword{heading("Mental Retardation"), kw("child*")}}},
+	}
+
+	// A single keyword replaces the keyword itself.
+	r := q.Replace(renamed, BooleanQuery{Keywords: []Keyword{heading("Intellectual Disability")}})
+	expected := "(exp Intellectual Disability[mesh_headings] OR child*[title]) AND Mental Retardation[title] AND exp Intellectual Disability[mesh_headings]"
+	if r.String() != expected {
+		t.Fatalf("Expected %v, got %v", expected, r.String())
+	}
+
+	// An or group is nested in an and group, and added directly to an or group.
+	r = q.Replace(renamed, BooleanQuery{Operator: "or", Keywords: []Keyword{heading("Intellectual Disability"), heading("Learning Disabilities")}})
+	expected = "(exp Intellectual Disability[mesh_headings] OR exp Learning Disabilities[mesh_headings] OR child*[title]) AND " +
+		"(exp Intellectual Disability[mesh_headings] OR exp Learning Disabilities[mesh_headings]) AND Mental Retardation[title]"
+	if r.String() != expected {
+		t.Fatalf("Expected %v, got %v", expected, r.String())
+	}
+	if len(q.Keywords) != 2 || q.Keywords[1].QueryString != "Mental Retardation" || q.Children[0].Keywords[0].QueryString != "Mental Retardation" {
+		t.Fatalf("Expected the original query to be unchanged, got %v", q)
+	}
+
+	// Each replacement is a copy, so modifying one does not modify the others.
+	r.Children[0].Keywords[0].QueryString = "modified"
+	if r.Children[1].Keywords[0].QueryString != "Intellectual Disability" {
+		t.Fatalf("Expected the replacements not to be shared, got %v", r)
+	}
+
+	// The operands of an adjacency group in order are kept in order.
+	ordered := BooleanQuery{
+		Operator: "adj2",
+		Keywords: []Keyword{kw("severe"), kw("Mental Retardation")},
+		Options:  map[string]interface{}{InOrderOption: true},
+	}
+	r = ordered.Replace(func(k Keyword) bool { return k.QueryString == "severe" },
+		BooleanQuery{Operator: "or", Keywords: []Keyword{kw("severe"), kw("profound")}})
+	expected = "(severe[title] OR profound[title]) ADJ2 Mental Retardation[title]"
+	if r.String() != expected {
+		t.Fatalf("Expected %v, got %v", expected, r.String())
+	}
+}
+
+func TestBooleanQuery_Clone(t *testing.T) {
+	q := BooleanQuery{
+		Operator: "and",
+		Keywords: []Keyword{{QueryString: "asthma", Fields: []string{"title"}, Options: map[string]interface{}{ProximityOption: 3}}},
+		Children: []BooleanQuery{{Operator: "or", Keywords: []Keyword{kw("wheeze")}, Options: map[string]interface{}{CommentOption: "population"}}},
+	}
+	original := q.String()
+
+	c := q.Clone()
+	Walk(&c, VisitorFuncs{Keyword: func(k *Keyword) bool {
+		k.QueryString = strings.ToUpper(k.QueryString)
+		if len(k.Fields) > 0 {
+			k.Fields[0] = "abstract"
+		}
+		if k.Options != nil {
+			k.Options[ProximityOption] = 1
+		}
+		return true
+	}})
+	c.Children[0].Options[CommentOption] = "intervention"
+	c.Children[0].Keywords = append(c.Children[0].Keywords, kw("cough"))
+
+	if q.String() != original || q.Keywords[0].Options[ProximityOption] != 3 || q.Children[0].Options[CommentOption] != "population" {
+		t.Fatalf("Expected the original query to be unchanged, got %v", q)
+	}
+	if c.Keywords[0].Fields[0] != "abstract" || len(c.Children[0].Keywords) != 2 {
+		t.Fatalf("Expected the clone to be modified, got %v", c)
+	}
+}
+
+func TestBooleanQuery_CloneOptions(t *testing.T) {
+	q := BooleanQuery{
+		Keywords: []Keyword{{QueryString: "asthma", Fields: []string{"title"}, Options: map[string]interface{}{
+			LimitOption: []interface{}{"humans"},
+			"nested":    map[string]interface{}{"limits": []string{"english"}},
+		}}},
+		Options: map[string]interface{}{LimitOption: []string{"humans"}, MetadataOption: []string{"Sort by: Most Recent"}},
+	}
+	c := q.Clone()
+	c.Options[LimitOption].([]string)[0] = "animals"
+	c.Options[MetadataOption].([]string)[0] = "Filters: English"
+	c.Keywords[0].Options[LimitOption].([]interface{})[0] = "animals"
+	c.Keywords[0].Options["nested"].(map[string]interface{})["limits"].([]string)[0] = "french"
+
+	if q.Options[LimitOption].([]string)[0] != "humans" || q.Options[MetadataOption].([]string)[0] != "Sort by: Most Recent" {
+		t.Fatalf("Expected the options of the original query to be unchanged, got %v", q.Options)
+	}
+	if q.Keywords[0].Options[LimitOption].([]interface{})[0] != "humans" ||
+		q.Keywords[0].Options["nested"].(map[string]interface{})["limits"].([]string)[0] != "english" {
+		t.Fatalf("Expected the options of the original keyword to be unchanged, got %v", q.Keywords[0].Options)
+	}
+}
+
+func TestBooleanQuery_MergeFieldVariants(t *testing.T) {
+	field := func(s, f string) Keyword {
+		return Keyword{QueryString: s, Fields: []string{f}}
+	}
+	q := BooleanQuery{
+		Operator: "and",
+		Children: []BooleanQuery{
+			{Operator: "or", Keywords: []Keyword{field("asthma", "title"), field("wheeze", "title"), field("asthma", "text"), field("wheeze", "text")}},
+			{Operator: "or", Keywords: []Keyword{field("child*", "title"), field("child*", "text")}},
+			{Operator: "or", Keywords: []Keyword{field("steroid", "title"), {QueryString: "steroid", Fields: []string{"text"}, Truncated: true}}},
+		},
+	}
+	original := q.String()
+
+	m := q.MergeFieldVariants()
+	if q.String() != original {
+		t.Fatalf("Expected %v to be unchanged, got %v", original, q.String())
+	}
+	expected := "(asthma[title,text] OR wheeze[title,text]) AND child*[title,text] AND (steroid[title] OR steroid[text])"
+	if m.String() != expected {
+		t.Fatalf("Expected %v, got %v", expected, m.String())
+	}
+}
+
+func TestBooleanQuery_NormalizeNot(t *testing.T) {
+	// a NOT b NOT c
+	q := BooleanQuery{Operator: "not", Keywords: []Keyword{kw("a"), kw("b"), kw("c")}, Options: map[string]interface{}{CommentOption: "exclusions"}}
+	n := q.NormalizeNot()
+	expected := BooleanQuery{
+		Operator: "not",
+		Children: []BooleanQuery{{Operator: "not", Keywords: []Keyword{kw("a"), kw("b")}}},
+		Keywords: []Keyword{kw("c")},
+		Options:  map[string]interface{}{CommentOption: "exclusions"},
+	}
+	if !reflect.DeepEqual(n, expected) {
+		t.Fatalf("Expected %v, got %v", expected, n)
+	}
+	if len(q.Keywords) != 3 {
+		t.Fatalf("Expected the original query not to be modified, got %v", q)
+	}
+
+	// a NOT (b OR c) NOT d, where the keyword excluded from must stay first.
+	q = BooleanQuery{
+		Operator: "not",
+		Children: []BooleanQuery{{Keywords: []Keyword{kw("a")}}, {Operator: "or", Keywords: []Keyword{kw("b"), kw("c")}}},
+		Keywords: []Keyword{kw("d")},
+	}
+	expected = BooleanQuery{
+		Operator: "not",
+		Children: []BooleanQuery{{Operator: "not", Children: q.Children}},
+		Keywords: []Keyword{kw("d")},
+	}
+	if n := q.NormalizeNot(); !reflect.DeepEqual(n, expected) {
+		t.Fatalf("Expected %v, got %v", expected, n)
+	}
+
+	// Groups of two operands are not changed, including nested groups.
+	q = BooleanQuery{Operator: "and", Children: []BooleanQuery{{Operator: "not", Keywords: []Keyword{kw("a"), kw("b")}}}, Keywords: []Keyword{kw("c")}}
+	if n := q.NormalizeNot(); !reflect.DeepEqual(n, q) {
+		t.Fatalf("Expected %v, got %v", q, n)
+	}
+}
+
+func TestBooleanQuery_PushNegationDown(t *testing.T) {
+	not := func(operands ...BooleanQuery) BooleanQuery {
+		return BooleanQuery{Operator: "not", Children: operands}
+	}
+	group := func(operator string, keywords ...string) BooleanQuery {
+		q := BooleanQuery{Operator: operator}
+		for _, k := range keywords {
+			q.Keywords = append(q.Keywords, kw(k))
+		}
+		return q
+	}
+	a := BooleanQuery{Keywords: []Keyword{kw("a")}}
+
+	queries := []struct {
+		query    BooleanQuery
+		expected BooleanQuery
+	}{
+		{
+			// NOT (a OR b) = NOT a AND NOT b
+			not(group("or", "a", "b")),
+			BooleanQuery{Operator: "and", Children: []BooleanQuery{group("not", "a"), group("not", "b")}},
+		},
+		{
+			// NOT (a AND b) = NOT a OR NOT b
+			not(group("and", "a", "b")),
+			BooleanQuery{Operator: "or", Children: []BooleanQuery{group("not", "a"), group("not", "b")}},
+		},
+		{
+			// a NOT (b OR c) = a AND NOT b AND NOT c = a NOT b NOT c
+			not(a, group("or", "b", "c")),
+			group("not", "a", "b", "c"),
+		},
+		{
+			// (a OR b) AND NOT c = (a OR b) NOT c
+			BooleanQuery{Operator: "and", Children: []BooleanQuery{group("or", "a", "b"), not(group("or", "c"))}},
+			BooleanQuery{Operator: "not", Children: []BooleanQuery{group("or", "a", "b")}, Keywords: []Keyword{kw("c")}},
+		},
+		{
+			// a AND b AND NOT c = (a AND b) NOT c
+			BooleanQuery{Operator: "and", Children: []BooleanQuery{not(group("or", "c"))}, Keywords: []Keyword{kw("a"), kw("b")}},
+			BooleanQuery{Operator: "not", Children: []BooleanQuery{group("and", "a", "b")}, Keywords: []Keyword{kw("c")}},
+		},
+		{
+			// The keyword excluded from stays first when an adjacency group is excluded from it.
+			not(a, group("adj3", "b", "c")),
+			not(a, group("adj3", "b", "c")),
+		},
+		{
+			// a NOT (b AND c) = a AND (NOT b OR NOT c)
+			not(a, group("and", "b", "c")),
+			BooleanQuery{
+				Operator: "and",
+				Children: []BooleanQuery{{Operator: "or", Children: []BooleanQuery{group("not", "b"), group("not", "c")}}},
+				Keywords: []Keyword{kw("a")},
+			},
+		},
+		{
+			// NOT (a NOT b) = NOT a OR b
+			not(group("not", "a", "b")),
+			BooleanQuery{Operator: "or", Children: []BooleanQuery{group("not", "a")}, Keywords: []Keyword{kw("b")}},
+		},
+		{
+			// (a OR b) AND NOT (c AND NOT d) = (a OR b) AND (NOT c OR d)
+			BooleanQuery{Operator: "and", Children: []BooleanQuery{group("or", "a", "b"), not(group("not", "c", "d"))}},
+			BooleanQuery{Operator: "and", Children: []BooleanQuery{
+				group("or", "a", "b"),
+				{Operator: "or", Children: []BooleanQuery{group("not", "c")}, Keywords: []Keyword{kw("d")}},
+			}},
+		},
+		{
+			// An adjacency group is negated as a whole.
+			not(group("adj3", "a", "b")),
+			not(group("adj3", "a", "b")),
+		},
+	}
+	for _, q := range queries {
+		if got := q.query.PushNegationDown(); !reflect.DeepEqual(got, q.expected) {
+			t.Fatalf("Expected %v, got %v", q.expected, got)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package ir
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Validate checks that a query is well-formed, since backends assume that they are given a well-formed query. A
+// problem is returned for each group with an operator that does not combine at least two operands (except a `not`
+// group of a single operand, which negates the operand, e.g. `NOT a`), each group without an operator that combines
+// more than one operand, and each keyword without a query string (unless it only requires its fields to exist) or
+// without fields. A well-formed query has no problems.
+func (b BooleanQuery) Validate() (problems []Warning) {
+	Walk(&b, VisitorFuncs{
+		Query: func(q *BooleanQuery) bool {
+			n := len(q.Keywords) + len(q.Children)
+			switch {
+			case len(q.Operator) == 0 && n > 1:
+				problems = append(problems, Warning{Message: fmt.Sprintf("a group without an operator combines %d operands", n)})
+			case len(q.Operator) > 0 && n == 0:
+				problems = append(problems, Warning{Message: fmt.Sprintf("operator `%v` has no operands", q.Operator)})
+			case len(q.Operator) > 0 && n == 1 && strings.ToLower(q.Operator) != "not":
+				problems = append(problems, Warning{Message: fmt.Sprintf("operator `%v` has a single operand", q.Operator)})
+			}
+			return true
+		},
+		Keyword: func(k *Keyword) bool {
+			if len(strings.TrimSpace(k.QueryString)) == 0 && !k.Exists() {
+				problems = append(problems, Warning{Message: "keyword has an empty query string", Keyword: k})
+			}
+			if len(k.Fields) == 0 {
+				problems = append(problems, Warning{Message: "keyword has no fields", Keyword: k})
+			}
+			return true
+		},
+	})
+	return
+}
@@ -0,0 +1,55 @@
+package ir
+
+import "testing"
+
+func TestBooleanQuery_Validate(t *testing.T) {
+	valid := BooleanQuery{
+		Operator: "or",
+		Children: []BooleanQuery{{
+			Operator: "not",
+			Keywords: []Keyword{kw("asthma")},
+			Children: []BooleanQuery{{Operator: "or", Keywords: []Keyword{kw("child*"), kw("infant*")}}},
+		}, {
+			// A keyword without a query string may only require its fields to be present.
+			Operator: "and",
+			Keywords: []Keyword{kw("wheeze"), {Fields: []string{"text"}, Options: map[string]interface{}{ExistsOption: true}}},
+		}, {
+			// A `not` group of a single operand negates the operand.
+			Operator: "not",
+			Keywords: []Keyword{kw("adult*")},
+		}},
+	}
+	if problems := valid.Validate(); len(problems) != 0 {
+		t.Fatalf("Expected no problems, got %v", problems)
+	}
+
+	invalid := BooleanQuery{
+		Operator: "and",
+		Keywords: []Keyword{{QueryString: "asthma"}, kw(" ")},
+		Children: []BooleanQuery{
+			{Operator: "or", Keywords: []Keyword{kw("wheez*")}},
+			{Operator: "or"},
+			{Keywords: []Keyword{kw("a"), kw("b")}},
+		},
+	}
+	expected := []string{
+		"operator `or` has a single operand",
+		"operator `or` has no operands",
+		"a group without an operator combines 2 operands",
+		"keyword has no fields",
+		"keyword has an empty query string",
+	}
+	problems := invalid.Validate()
+	if len(problems) != len(expected) {
+		t.Fatalf("Expected %v problems, got %v", len(expected), problems)
+	}
+	found := map[string]bool{}
+	for _, problem := range problems {
+		found[problem.Message] = true
+	}
+	for _, message := range expected {
+		if !found[message] {
+			t.Fatalf("Expected the problem %v, got %v", message, problems)
+		}
+	}
+}
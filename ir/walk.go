@@ -0,0 +1,51 @@
+package ir
+
+// Visitor is used by Walk to visit each query and keyword in a tree. Both methods receive a pointer into the tree, so
+// a visitor may also modify the query as it is walked.
+type Visitor interface {
+	// VisitQuery is called for each query, before its keywords and children. Returning false stops the walk.
+	VisitQuery(q *BooleanQuery) bool
+	// VisitKeyword is called for each keyword. Returning false stops the walk.
+	VisitKeyword(k *Keyword) bool
+}
+
+// VisitorFuncs is a Visitor made from functions. Either function may be nil, in which case the walk continues.
+type VisitorFuncs struct {
+	Query   func(q *BooleanQuery) bool
+	Keyword func(k *Keyword) bool
+}
+
+// VisitQuery calls the Query function, if it is set.
+func (v VisitorFuncs) VisitQuery(q *BooleanQuery) bool {
+	if v.Query == nil {
+		return true
+	}
+	return v.Query(q)
+}
+
+// VisitKeyword calls the Keyword function, if it is set.
+func (v VisitorFuncs) VisitKeyword(k *Keyword) bool {
+	if v.Keyword == nil {
+		return true
+	}
+	return v.Keyword(k)
+}
+
+// Walk traverses a query depth-first. For each query, the query itself is visited, then its keywords, and then its
+// children in order. Walk returns false if the visitor stopped the walk early.
+func Walk(q *BooleanQuery, v Visitor) bool {
+	if !v.VisitQuery(q) {
+		return false
+	}
+	for i := range q.Keywords {
+		if !v.VisitKeyword(&q.Keywords[i]) {
+			return false
+		}
+	}
+	for i := range q.Children {
+		if !Walk(&q.Children[i], v) {
+			return false
+		}
+	}
+	return true
+}
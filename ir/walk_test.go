@@ -0,0 +1,67 @@
+package ir
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hscells/transmute/fields"
+)
+
+func TestWalk(t *testing.T) {
+	q := BooleanQuery{
+		Operator: "and",
+		Keywords: []Keyword{kw("a")},
+		Children: []BooleanQuery{
+			{Operator: "or", Keywords: []Keyword{kw("b"), kw("c")}},
+			{Operator: "or", Keywords: []Keyword{kw("d")}},
+		},
+	}
+
+	var visited []string
+	complete := Walk(&q, VisitorFuncs{
+		Query: func(q *BooleanQuery) bool {
+			visited = append(visited, q.Operator)
+			return true
+		},
+		Keyword: func(k *Keyword) bool {
+			visited = append(visited, k.QueryString)
+			return true
+		},
+	})
+	expected := []string{"and", "a", "or", "b", "c", "or", "d"}
+	if !complete || !reflect.DeepEqual(visited, expected) {
+		t.Fatalf("Expected to visit %v, got %v", expected, visited)
+	}
+
+	// The walk stops as soon as the visitor returns false.
+	visited = nil
+	complete = Walk(&q, VisitorFuncs{Keyword: func(k *Keyword) bool {
+		visited = append(visited, k.QueryString)
+		return k.QueryString != "b"
+	}})
+	expected = []string{"a", "b"}
+	if complete || !reflect.DeepEqual(visited, expected) {
+		t.Fatalf("Expected to visit %v, got %v", expected, visited)
+	}
+
+	// Keywords can be modified while walking.
+	Walk(&q, VisitorFuncs{Keyword: func(k *Keyword) bool {
+		k.Fields = []string{fields.Title}
+		return true
+	}})
+	if c := q.FieldCount()[fields.Title]; c != 4 {
+		t.Fatalf("Expected %v keywords to be modified, got %v", 4, c)
+	}
+}
+
+func TestBooleanQuery_MeshHeadings(t *testing.T) {
+	q := BooleanQuery{
+		Operator: "or",
+		Keywords: []Keyword{{QueryString: "asthma", Fields: []string{fields.MeshHeadings}, Exploded: true}},
+		Children: []BooleanQuery{{Operator: "and", Keywords: []Keyword{kw("wheeze"), {QueryString: "lung", Fields: []string{fields.MajorFocusMeshHeading}}}}},
+	}
+	m := q.MeshHeadings()
+	if len(m) != 2 || m[0].QueryString != "asthma" || m[1].QueryString != "lung" {
+		t.Fatalf("Expected MeSH headings %v, got %v", []string{"asthma", "lung"}, m)
+	}
+}
@@ -0,0 +1,20 @@
+package ir
+
+import "fmt"
+
+// Warning describes a problem with a query that does not prevent it from being parsed or compiled, but which means
+// the query may not be interpreted the way it was written.
+type Warning struct {
+	// Message describes the problem.
+	Message string
+	// Keyword is the keyword the problem relates to, if any.
+	Keyword *Keyword
+}
+
+// String formats the warning, including the query string of the keyword the warning relates to.
+func (w Warning) String() string {
+	if w.Keyword == nil {
+		return w.Message
+	}
+	return fmt.Sprintf("%v: `%v` %v", w.Message, w.Keyword.QueryString, w.Keyword.Fields)
+}
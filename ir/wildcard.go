@@ -0,0 +1,159 @@
+package ir
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WildcardPosition is where a wildcard appears in a term of a keyword.
+type WildcardPosition int
+
+const (
+	// TrailingWildcard is a wildcard at the end of a term, e.g. `child*`.
+	TrailingWildcard WildcardPosition = iota
+	// LeadingWildcard is a wildcard at the start of a term, e.g. `*ectomy`.
+	LeadingWildcard
+	// InternalWildcard is a wildcard inside a term, e.g. `gastr*itis`.
+	InternalWildcard
+)
+
+// wildcardCharacters are the characters that may remain in the query string of a truncated keyword. Parsers replace
+// most truncation characters with `*`, however the OptionalWildcard `?`, and `#` for exactly one character, are kept.
+const wildcardCharacters = "*?#$"
+
+// OptionalWildcard is the wildcard for a single optional character, e.g. `colo?r` searches both `color` and `colour`.
+// It is written `?` in Ovid, `#` in EBSCO, and `$` in Embase.
+const OptionalWildcard = '?'
+
+// SingleWildcard is the wildcard for exactly one character, e.g. `wom#n` searches both `woman` and `women`. It is
+// written `#` in Ovid, and `?` in EBSCO, Embase, and Lucene.
+const SingleWildcard = '#'
+
+// Wildcard is a single wildcard in the query string of a keyword.
+type Wildcard struct {
+	// Character is the wildcard character, e.g. `*` or `?`.
+	Character rune
+	// Offset is the byte offset of the wildcard in the query string.
+	Offset int
+	// Position is where the wildcard appears in its term.
+	Position WildcardPosition
+}
+
+// String returns the name of the position.
+func (p WildcardPosition) String() string {
+	switch p {
+	case LeadingWildcard:
+		return "leading"
+	case InternalWildcard:
+		return "internal"
+	default:
+		return "trailing"
+	}
+}
+
+// Wildcards finds the wildcards in the query string of a keyword. The position of a wildcard is relative to the term of
+// a phrase it appears in, so `"*ectomy surgery"` has a leading wildcard. A keyword which is not truncated has no
+// wildcards.
+func (k Keyword) Wildcards() (w []Wildcard) {
+	if !k.Truncated {
+		return nil
+	}
+	start := 0
+	for start < len(k.QueryString) {
+		// Terms are separated by spaces, and the quotes of a phrase are not part of a term.
+		end := strings.IndexAny(k.QueryString[start:], " \t\n")
+		if end < 0 {
+			end = len(k.QueryString)
+		} else {
+			end += start
+		}
+		term := strings.Trim(k.QueryString[start:end], `"`)
+		offset := start + strings.Index(k.QueryString[start:end], term)
+		for i, c := range term {
+			if !strings.ContainsRune(wildcardCharacters, c) {
+				continue
+			}
+			position := InternalWildcard
+			if strings.Trim(term[i:], wildcardCharacters) == "" {
+				position = TrailingWildcard
+			} else if strings.Trim(term[:i], wildcardCharacters) == "" {
+				position = LeadingWildcard
+			}
+			w = append(w, Wildcard{Character: c, Offset: offset + i, Position: position})
+		}
+		start = end + 1
+	}
+	return
+}
+
+// HasWildcard determines if a keyword has a wildcard in any of the positions.
+func (k Keyword) HasWildcard(positions ...WildcardPosition) bool {
+	for _, w := range k.Wildcards() {
+		for _, p := range positions {
+			if w.Position == p {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ExpandOptional replaces a keyword with an optional wildcard with an "or" group of the spellings of the keyword, for
+// targets which have a wildcard for exactly one character but not an optional one (e.g. Lucene, whose `?` matches
+// exactly one character), e.g. `colo?r` becomes `color OR colo#r`. Each optional wildcard is replaced with nothing, and
+// with a SingleWildcard. The keyword of each spelling is only truncated if it still contains wildcards. A keyword
+// without an optional wildcard is returned as a query containing only the keyword.
+//
+// The number of spellings doubles with each optional wildcard, so an error is returned when there would be more than
+// maxSpellings spellings. A maxSpellings of zero or less means there is no limit.
+//
+// Targets without a wildcard for exactly one character (e.g. PubMed) can only search the spellings of a keyword which
+// are known, so these are expanded with ExpandTruncation instead, e.g. with the variants `color` and `colour` of
+// `colo?r`.
+func (k Keyword) ExpandOptional(maxSpellings int) (BooleanQuery, error) {
+	if !k.Truncated || !strings.ContainsRune(k.QueryString, OptionalWildcard) {
+		return BooleanQuery{Keywords: []Keyword{k}}, nil
+	}
+	n := strings.Count(k.QueryString, string(OptionalWildcard))
+	if maxSpellings > 0 && (n >= 31 || 1<<uint(n) > maxSpellings) {
+		return BooleanQuery{}, fmt.Errorf("expanding the optional wildcards of `%v` exceeds the limit of %d spellings",
+			k.QueryString, maxSpellings)
+	}
+	spellings := []string{""}
+	for _, c := range k.QueryString {
+		var next []string
+		for _, s := range spellings {
+			if c != OptionalWildcard {
+				next = append(next, s+string(c))
+				continue
+			}
+			next = append(next, s, s+string(SingleWildcard))
+		}
+		spellings = next
+	}
+	q := BooleanQuery{Operator: "or"}
+	for _, spelling := range spellings {
+		keyword := k.Clone()
+		keyword.QueryString = spelling
+		keyword.Truncated = strings.ContainsAny(spelling, wildcardCharacters)
+		q.Keywords = append(q.Keywords, keyword)
+	}
+	return q, nil
+}
+
+// ExpandOptional replaces every keyword in a query that has an optional wildcard with an "or" group of its spellings
+// (see Keyword.ExpandOptional), in the same way as ExpandTruncation. A new query is returned, so the original query is
+// not modified. An error is returned when any keyword would have more than maxSpellings spellings.
+func (b BooleanQuery) ExpandOptional(maxSpellings int) (q BooleanQuery, err error) {
+	Walk(&b, VisitorFuncs{Keyword: func(k *Keyword) bool {
+		_, err = k.ExpandOptional(maxSpellings)
+		return err == nil
+	}})
+	if err != nil {
+		return BooleanQuery{}, err
+	}
+	return b.replaceKeywords(func(k Keyword) BooleanQuery {
+		q, _ := k.ExpandOptional(maxSpellings)
+		return q
+	}), nil
+}
@@ -0,0 +1,81 @@
+package ir
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKeyword_Wildcards(t *testing.T) {
+	queries := []struct {
+		keyword  Keyword
+		expected []Wildcard
+	}{
+		{Keyword{QueryString: "child*", Truncated: true}, []Wildcard{{'*', 5, TrailingWildcard}}},
+		{Keyword{QueryString: "*ectomy", Truncated: true}, []Wildcard{{'*', 0, LeadingWildcard}}},
+		{Keyword{QueryString: "gastr*itis", Truncated: true}, []Wildcard{{'*', 5, InternalWildcard}}},
+		{Keyword{QueryString: "wom?n", Truncated: true}, []Wildcard{{'?', 3, InternalWildcard}}},
+		{Keyword{QueryString: `"*ectomy surg*"`, Truncated: true}, []Wildcard{{'*', 1, LeadingWildcard}, {'*', 13, TrailingWildcard}}},
+		{Keyword{QueryString: "child*"}, nil},
+	}
+	for _, q := range queries {
+		got := q.keyword.Wildcards()
+		if !reflect.DeepEqual(got, q.expected) {
+			t.Fatalf("Expected %v, got %v", q.expected, got)
+		}
+	}
+
+	k := Keyword{QueryString: "gastr*itis", Truncated: true}
+	if k.HasWildcard(LeadingWildcard, TrailingWildcard) || !k.HasWildcard(InternalWildcard) {
+		t.Fatalf("Expected %v to only have an internal wildcard", k.QueryString)
+	}
+}
+
+func TestKeyword_ExpandOptional(t *testing.T) {
+	queries := map[string]string{
+		"colo?r":     "color[title] OR colo#r[title]",
+		"behavio?r":  "behavior[title] OR behavio#r[title]",
+		"behavio?r*": "behavior*[title] OR behavio#r*[title]",
+		"p?ediatric": "pediatric[title] OR p#ediatric[title]",
+		"child*":     "child*[title]",
+	}
+	for query, expected := range queries {
+		k := kw(query)
+		k.Truncated = true
+		q, err := k.ExpandOptional(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := q.String(); s != expected {
+			t.Fatalf("Expected %v for %v, got %v", expected, query, s)
+		}
+	}
+
+	q, err := Keyword{QueryString: "colo?r", Fields: []string{"title"}, Truncated: true}.ExpandOptional(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Keywords[0].Truncated || !q.Keywords[1].Truncated {
+		t.Fatalf("Expected only the spelling with a wildcard to be truncated, got %v", q)
+	}
+
+	// The spellings of a keyword in an or group are added to the group.
+	k := kw("colo?r")
+	k.Truncated = true
+	b, err := BooleanQuery{Operator: "or", Keywords: []Keyword{k, kw("vision")}}.ExpandOptional(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Keywords) != 3 || len(b.Children) != 0 {
+		t.Fatalf("Expected an or group of three keywords, got %v", b)
+	}
+
+	// The spellings double with each optional wildcard, so they are limited.
+	k = kw("a?b?c?d?")
+	k.Truncated = true
+	if _, err := k.ExpandOptional(8); err == nil {
+		t.Fatalf("Expected an error expanding the 16 spellings of %v", k.QueryString)
+	}
+	if _, err := (BooleanQuery{Operator: "or", Keywords: []Keyword{k}}).ExpandOptional(16); err != nil {
+		t.Fatal(err)
+	}
+}
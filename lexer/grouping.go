@@ -0,0 +1,218 @@
+package lexer
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	groupingOperatorRegex, _ = regexp.Compile("^(or|and|not|adj[0-9]*)$")
+)
+
+// groupingPrecedence determines how tightly each operator binds in an infix grouping line. Adjacency operators share
+// the precedence of `and`, and `not` binds tighter than both, so that it only excludes from the operand before it.
+var groupingPrecedence = map[string]int{
+	"or":  0,
+	"and": 1,
+	"not": 2,
+}
+
+// groupingNode is an intermediate tree built from an infix grouping line. A node is either a reference to a line in
+// the query, or an operator grouping other nodes.
+type groupingNode struct {
+	reference int
+	operator  string
+	children  []groupingNode
+}
+
+// groupingParser is a small recursive descent parser for infix grouping lines.
+type groupingParser struct {
+	tokens []string
+	pos    int
+}
+
+// tokeniseGrouping splits an infix grouping line into references, operators, and parenthesis.
+func tokeniseGrouping(line string) []string {
+	line = strings.Replace(line, "(", " ( ", -1)
+	line = strings.Replace(line, ")", " ) ", -1)
+	return strings.Fields(line)
+}
+
+// groupingOperatorPrecedence returns the precedence of an operator in a grouping line, and whether the token is an
+// operator at all.
+func groupingOperatorPrecedence(token string) (int, bool) {
+	token = strings.ToLower(token)
+	if !groupingOperatorRegex.MatchString(token) {
+		return 0, false
+	}
+	if p, ok := groupingPrecedence[token]; ok {
+		return p, true
+	}
+	return groupingPrecedence["and"], true
+}
+
+// IsInfixGrouping determines if a line is an infix grouping line that cannot be handled by ProcessInfixOperators, i.e.
+// it contains parenthesis or mixes more than one kind of operator, for example `1 or 2 and 3` or `4 and (5 or 6)`.
+func IsInfixGrouping(line string) bool {
+	tokens := tokeniseGrouping(line)
+	if len(tokens) == 0 {
+		return false
+	}
+	operators := map[string]bool{}
+	parenthesis := false
+	for _, token := range tokens {
+		if token == "(" || token == ")" {
+			parenthesis = true
+		} else if _, ok := groupingOperatorPrecedence(token); ok {
+			operators[strings.ToLower(token)] = true
+		} else if !numberRegex.MatchString(token) {
+			return false
+		}
+	}
+	return len(operators) > 0 && (parenthesis || len(operators) > 1)
+}
+
+// parse parses an expression where every operator binds at least as tightly as minPrecedence.
+func (p *groupingParser) parse(minPrecedence int) (groupingNode, error) {
+	lhs, err := p.parsePrimary()
+	if err != nil {
+		return groupingNode{}, err
+	}
+	for p.pos < len(p.tokens) {
+		operator := p.tokens[p.pos]
+		precedence, ok := groupingOperatorPrecedence(operator)
+		if !ok {
+			if operator == ")" {
+				break
+			}
+			return groupingNode{}, fmt.Errorf("expected an operator in grouping line, got `%v`", operator)
+		}
+		if precedence < minPrecedence {
+			break
+		}
+		p.pos++
+		// `1 and not 2` is the same as `1 not 2`.
+		if strings.ToLower(operator) == "and" && p.pos < len(p.tokens) && strings.ToLower(p.tokens[p.pos]) == "not" {
+			operator = p.tokens[p.pos]
+			precedence = groupingPrecedence["not"]
+			p.pos++
+		}
+		// Operators of the same precedence are left associative.
+		rhs, err := p.parse(precedence + 1)
+		if err != nil {
+			return groupingNode{}, err
+		}
+		lhs = combineGrouping(operator, lhs, rhs)
+	}
+	return lhs, nil
+}
+
+// parsePrimary parses either a single reference or a parenthesised expression.
+func (p *groupingParser) parsePrimary() (groupingNode, error) {
+	if p.pos >= len(p.tokens) {
+		return groupingNode{}, errors.New("unexpected end of grouping line")
+	}
+	token := p.tokens[p.pos]
+	p.pos++
+	if token == "(" {
+		n, err := p.parse(0)
+		if err != nil {
+			return groupingNode{}, err
+		}
+		if p.pos >= len(p.tokens) || p.tokens[p.pos] != ")" {
+			return groupingNode{}, errors.New("unbalanced parenthesis in grouping line")
+		}
+		p.pos++
+		return n, nil
+	}
+	reference, err := strconv.Atoi(token)
+	if err != nil {
+		return groupingNode{}, fmt.Errorf("expected a line reference in grouping line, got `%v`", token)
+	}
+	return groupingNode{reference: reference}, nil
+}
+
+// combineGrouping joins two nodes with an operator. Chains of the same operator are flattened into a single group so
+// that `1 or 2 or 3` is one group of three references rather than two nested groups. Only `and` and `or` are
+// associative, so only these flatten a right-hand group.
+func combineGrouping(operator string, lhs, rhs groupingNode) groupingNode {
+	n := groupingNode{operator: operator}
+	if len(lhs.operator) > 0 && strings.ToLower(lhs.operator) == strings.ToLower(operator) {
+		n.children = append(n.children, lhs.children...)
+	} else {
+		n.children = append(n.children, lhs)
+	}
+	op := strings.ToLower(operator)
+	if len(rhs.operator) > 0 && strings.ToLower(rhs.operator) == op && (op == "and" || op == "or") {
+		n.children = append(n.children, rhs.children...)
+	} else {
+		n.children = append(n.children, rhs)
+	}
+	return n
+}
+
+// ProcessInfixGrouping replaces the references in an infix grouping line that mixes operators and parenthesis with the
+// actual query string. The precedence of the operators in the line is:
+//
+//   - parenthesis are evaluated first;
+//   - `not` binds tighter than `and` and `adjN`, which bind tighter than `or`;
+//   - `and not` is the same as `not`;
+//   - operators of the same precedence are evaluated left to right.
+//
+// This means `1 or 2 and 3` is read as `1 or (2 and 3)`, and `1 and 2 not 3` is read as `1 and (2 not 3)`. A `not`
+// must follow the operand it excludes from, so `not 1 or 2` is an error. Groups
+// that do not correspond to a line in the query are added to groups using negative references, so they can be expanded
+// in the same way as the other lines by ExpandQuery.
+func ProcessInfixGrouping(queries map[int]string, line string, groups map[int]map[string]map[int]string) (map[string]map[int]string, error) {
+	group, _, err := processInfixGrouping(queries, line, groups, map[int][]int{})
+	return group, err
+}
+
+// processInfixGrouping is ProcessInfixGrouping, which also records the references of the operands of each group added
+// to groups in order, in the order they appear in the line. The references of the operands of the line itself are
+// returned in the same way.
+func processInfixGrouping(queries map[int]string, line string, groups map[int]map[string]map[int]string, order map[int][]int) (map[string]map[int]string, []int, error) {
+	p := groupingParser{tokens: tokeniseGrouping(line)}
+	root, err := p.parse(0)
+	if err != nil {
+		return map[string]map[int]string{}, nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return map[string]map[int]string{}, nil, fmt.Errorf("unbalanced parenthesis in grouping line `%v`", line)
+	}
+	if len(root.operator) == 0 {
+		return map[string]map[int]string{}, nil, fmt.Errorf("grouping line `%v` does not combine any references", line)
+	}
+
+	// Find the next free synthetic reference.
+	next := -1
+	for k := range groups {
+		if k-1 < next {
+			next = k - 1
+		}
+	}
+
+	var expand func(node groupingNode) (map[string]map[int]string, []int)
+	expand = func(node groupingNode) (map[string]map[int]string, []int) {
+		extracted := map[int]string{}
+		var references []int
+		for _, child := range node.children {
+			if len(child.operator) == 0 {
+				extracted[child.reference] = queries[child.reference-1]
+				references = append(references, child.reference)
+			} else {
+				reference := next
+				next--
+				groups[reference], order[reference] = expand(child)
+				extracted[reference] = ""
+				references = append(references, reference)
+			}
+		}
+		return map[string]map[int]string{node.operator: extracted}, references
+	}
+	group, references := expand(root)
+	return group, references, nil
+}
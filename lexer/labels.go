@@ -0,0 +1,195 @@
+package lexer
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// DefaultLabelPrefixes are the prefixes of line labels (and of the references to them in combining lines) which are
+// recognised when LexOptions.LabelPrefixes is empty: `S` for EBSCO (e.g. `S1 AND S2`), and `#` for search histories
+// (e.g. `#1 OR #2`).
+var DefaultLabelPrefixes = []string{"S", "#"}
+
+var (
+	labelPrefixRegex, _ = regexp.Compile(`(?i)^(or|and|not|adj[0-9]*)/(\S+)$`)
+	labelLimitRegex, _  = regexp.Compile(`(?i)^(limit\s+)(\S+)(\s+to\s+.+)$`)
+)
+
+// labelRegexp creates the regular expression which matches a line label, or a reference to one, which may start with
+// one of the prefixes (in any case), e.g. `S1`, `#1`, `1a`, `1.1`, or `1.`. DefaultLabelPrefixes are used when there
+// are no prefixes.
+func labelRegexp(prefixes []string) *regexp.Regexp {
+	if len(prefixes) == 0 {
+		prefixes = DefaultLabelPrefixes
+	}
+	quoted := make([]string, len(prefixes))
+	for i, prefix := range prefixes {
+		quoted[i] = regexp.QuoteMeta(prefix)
+	}
+	r, _ := regexp.Compile(`(?i)^(` + strings.Join(quoted, "|") + `)?[0-9]+([a-z]|\.[0-9]+)*\.?$`)
+	return r
+}
+
+// normaliseLabel removes the parts of a line label that are not used when the line is referenced, so that a line
+// labelled `1.` can be referenced as `1`, `S1`, or `#1`, and a line labelled `S1` can be referenced as `s1`.
+func normaliseLabel(label string) string {
+	return strings.TrimLeftFunc(strings.TrimSuffix(strings.ToLower(label), "."), func(r rune) bool {
+		return !unicode.IsDigit(r)
+	})
+}
+
+// endsWithOperator determines if a line ends with an operator, so that the line after it must continue it.
+func endsWithOperator(line string) bool {
+	tokens := strings.Fields(line)
+	if len(tokens) < 2 {
+		return false
+	}
+	_, ok := groupingOperatorPrecedence(tokens[len(tokens)-1])
+	return ok
+}
+
+// onlyLabels determines if every line of a query is only a line label, e.g. `1.`, so that there is nothing to search.
+// A label must end with a full stop to be a label on its own, since a query may search a single number, e.g. `2019`.
+func onlyLabels(query string, label *regexp.Regexp) bool {
+	for _, line := range strings.Split(query, "\n") {
+		tokens := strings.Fields(line)
+		if len(tokens) > 1 || len(tokens) == 1 && !(label.MatchString(tokens[0]) && strings.HasSuffix(tokens[0], ".")) {
+			return false
+		}
+	}
+	return true
+}
+
+// joinContinuations appends each line of a numbered query which does not start with a line label to the line before
+// it, e.g. an operator that has been wrapped onto a line of its own. A line after a line ending in an operator is also
+// a continuation, even when it looks like a label, e.g. the `2` of `3. 1 or` followed by `2`. The comments are keyed
+// by the lines of the joined query; a comment above a continuation line is added to the comment of the line it is
+// joined to.
+func joinContinuations(query string, comments map[int]string, label *regexp.Regexp) (string, map[int]string) {
+	lines := strings.Split(query, "\n")
+	if first := strings.Fields(lines[0]); len(first) == 0 || !label.MatchString(first[0]) {
+		return query, comments
+	}
+	var joined []string
+	joinedComments := map[int]string{}
+	for i, line := range lines {
+		comment, ok := comments[i+1]
+		if tokens := strings.Fields(line); i > 0 && len(tokens) > 0 && (!label.MatchString(tokens[0]) || endsWithOperator(joined[len(joined)-1])) {
+			joined[len(joined)-1] += " " + strings.TrimSpace(line)
+			if ok {
+				joinedComments[len(joined)] = strings.TrimSpace(joinedComments[len(joined)] + " " + comment)
+			}
+			continue
+		}
+		joined = append(joined, line)
+		if ok {
+			joinedComments[len(joined)] = comment
+		}
+	}
+	return strings.Join(joined, "\n"), joinedComments
+}
+
+// relabel numbers the lines of a query that uses labels other than the line numbers, e.g. `S1` and `S2` in EBSCO, or
+// `1a` and `1.1` for sub-lines, and replaces the labels referenced in the combining lines with the line numbers. The
+// labels are matched by label (see labelRegexp). A query that is already numbered by its lines, and whose combining
+// lines only reference the line numbers, is returned as is. An error is returned when a combining line references a
+// label that is not the label of a line.
+func relabel(query string, label *regexp.Regexp) (string, error) {
+	lines := strings.Split(query, "\n")
+	labels := map[string]int{}
+	numbered := true
+	for i, line := range lines {
+		parts := strings.SplitN(strings.TrimSpace(line), " ", 2)
+		if !label.MatchString(parts[0]) {
+			return query, nil
+		}
+		labels[normaliseLabel(parts[0])] = i + 1
+		if strings.TrimSuffix(parts[0], ".") != strconv.Itoa(i+1) {
+			numbered = false
+		}
+		// A reference with a prefix, e.g. `#1` in `3. #1 or #2`, must be replaced even when the lines are numbered.
+		if len(parts) == 2 {
+			if tokens, ok := combiningTokens(parts[1], label); ok {
+				for _, token := range tokens {
+					if label.MatchString(token) && !numberRegex.MatchString(token) {
+						numbered = false
+					}
+				}
+			}
+		}
+	}
+	if numbered {
+		return query, nil
+	}
+
+	reference := func(ref string) (string, error) {
+		if n, ok := labels[normaliseLabel(ref)]; ok {
+			return strconv.Itoa(n), nil
+		}
+		return "", fmt.Errorf("unrecognised line label `%v`", ref)
+	}
+
+	for i, line := range lines {
+		parts := strings.SplitN(strings.TrimSpace(line), " ", 2)
+		rest := ""
+		if len(parts) == 2 {
+			rest = strings.TrimSpace(parts[1])
+		}
+
+		if m := labelLimitRegex.FindStringSubmatch(rest); len(m) == 4 {
+			// A limit line, e.g. `limit S3 to humans`.
+			ref, err := reference(m[2])
+			if err != nil {
+				return "", err
+			}
+			rest = m[1] + ref + m[3]
+		} else if m := labelPrefixRegex.FindStringSubmatch(rest); len(m) == 3 {
+			// A prefix combining line, e.g. `or/1a-1c` or `or/1a,2`.
+			sep := "-"
+			if strings.Contains(m[2], ",") {
+				sep = ","
+			}
+			refs := strings.Split(m[2], sep)
+			for j, r := range refs {
+				ref, err := reference(r)
+				if err != nil {
+					return "", err
+				}
+				refs[j] = ref
+			}
+			rest = m[1] + "/" + strings.Join(refs, sep)
+		} else if tokens, ok := combiningTokens(rest, label); ok {
+			// An infix combining line, e.g. `S1 OR (S2 AND S3)`.
+			for j, token := range tokens {
+				if _, ok := groupingOperatorPrecedence(token); !ok && token != "(" && token != ")" {
+					ref, err := reference(token)
+					if err != nil {
+						return "", err
+					}
+					tokens[j] = ref
+				}
+			}
+			rest = strings.Join(tokens, " ")
+		}
+		lines[i] = fmt.Sprintf("%d. %s", i+1, rest)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// combiningTokens tokenises a line if it is an infix combining line, e.g. `S1 OR (S2 AND S3)`, which only contains the
+// labels matched by label, operators, and parenthesis.
+func combiningTokens(line string, label *regexp.Regexp) ([]string, bool) {
+	tokens := tokeniseGrouping(line)
+	if len(tokens) == 0 {
+		return nil, false
+	}
+	for _, token := range tokens {
+		if _, ok := groupingOperatorPrecedence(token); !ok && token != "(" && token != ")" && !label.MatchString(token) {
+			return nil, false
+		}
+	}
+	return tokens, true
+}
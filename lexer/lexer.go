@@ -5,14 +5,20 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"unicode"
 )
 
 var (
 	numberRegex, _ = regexp.Compile("^[0-9]+$")
 	prefixRegex, _ = regexp.Compile("^(or|and|not|OR|AND|NOT|adj[0-9]+)/[0-9]+-[0-9]+$")
 	namedRegex, _  = regexp.Compile("^(or|and|not|OR|AND|NOT|adj[0-9]+)/[0-9]+,[0-9]+$")
+	slashRegex, _  = regexp.Compile("^([^/\\s]+)(/[0-9]+[-,][0-9]+)$")
+	adjRegex, _    = regexp.Compile("(?i)^adj[0-9]*$")
+	distRegex, _   = regexp.Compile("[0-9]*$")
+	limitRegex, _  = regexp.Compile(`(?i)^limit\s+([0-9]+)\s+to\s+(.+)$`)
 )
 
 // Node contains the encoding of the query as a tree.
@@ -21,11 +27,82 @@ type Node struct {
 	Reference int
 	Operator  string
 	Children  []Node
+	// Comment is the text of any comment lines directly before the line of the node.
+	Comment string
+	// Limits are the limits of the node when its line is an Ovid limit line, e.g. `humans` for `limit 7 to humans`.
+	// The node is otherwise the same as the node of the line that is limited.
+	Limits []string
 }
 
 // LexOptions allows for configuration of how the query string is lexed.
 type LexOptions struct {
 	FormatParenthesis bool
+	// CommentPrefix starts a line that is a comment rather than part of the query, e.g. `# population block`. When
+	// empty, `#` is used. A prefix followed by a number (e.g. `#1` in a PubMed search history) is not a comment.
+	CommentPrefix string
+	// ImplicitCombine combines the lines of a query which has no combining lines, e.g. concept lines exported one per
+	// line or separated by semicolons (`asthma; child*; steroid*`), rather than only lexing the first line. Semicolons
+	// inside quotes do not separate lines.
+	ImplicitCombine bool
+	// ImplicitOperator is the operator the lines are combined with when ImplicitCombine is set. When empty, `and` is
+	// used.
+	ImplicitOperator string
+	// LabelPrefixes are the prefixes which the labels of the lines of a query, and the references to them in the
+	// combining lines, may start with, e.g. `S` for EBSCO (`S1 AND S2`) or `#` for a search history (`#1 OR #2`). The
+	// prefixes are not case sensitive. When empty, DefaultLabelPrefixes are used.
+	LabelPrefixes []string
+	// Operators maps localised operators in lower case (e.g. `oder`) to the operators they are lexed as (e.g. `or`), so
+	// that combining lines written with localised operators, e.g. `1 oder 2` or `oder/1-3`, are recognised.
+	Operators map[string]string
+	// Adjacency recognises proximity operators other than `adj`, e.g. `(?i)^near/[0-9]+$`, which are lexed as `adj`
+	// with the distance that follows them, e.g. `1 near/3 2` is `1 adj3 2`.
+	Adjacency *regexp.Regexp
+}
+
+// stripComments removes the comment lines from a query, so that the comments do not change the numbering of the lines
+// in the query. The comments are returned keyed by the reference of the line that follows them.
+func stripComments(query string, prefix string) (string, map[int]string) {
+	if len(prefix) == 0 {
+		prefix = "#"
+	}
+	comments := map[int]string{}
+	var lines, comment []string
+	for _, line := range strings.Split(query, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, prefix) {
+			text := strings.TrimSpace(trimmed[len(prefix):])
+			if len(text) == 0 || !unicode.IsDigit(rune(text[0])) {
+				if len(text) > 0 {
+					comment = append(comment, text)
+				}
+				continue
+			}
+		}
+		if len(comment) > 0 {
+			comments[len(lines)+1] = strings.Join(comment, " ")
+			comment = nil
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n"), comments
+}
+
+// attachComments sets the comment of each node in a tree from the comments of the lines they reference.
+func attachComments(node Node, comments map[int]string) Node {
+	node.Comment = comments[node.Reference]
+	for i, child := range node.Children {
+		node.Children[i] = attachComments(child, comments)
+	}
+	return node
+}
+
+// attachLimits sets the limits of each node in a tree from the limits of the lines they reference.
+func attachLimits(node Node, limits map[int][]string) Node {
+	node.Limits = limits[node.Reference]
+	for i, child := range node.Children {
+		node.Children[i] = attachLimits(child, limits)
+	}
+	return node
 }
 
 // ProcessInfixOperators replaces the references in an infix query with the actual query string.
@@ -85,8 +162,84 @@ func ProcessNamedOperators(queries map[int]string, operator string) (map[string]
 	return ProcessInfixOperators(queries, infix)
 }
 
-// ExpandQuery takes a query that has been processed and expands it into a tree.
+// canonicalCombining replaces the localised operators of a combining line, e.g. `1 oder (2 oder 3)` or `oder/1-3`,
+// with the operators they map to in the Operators of the options, and the proximity operators recognised by the
+// Adjacency of the options, e.g. `1 near/3 2`, with `adj`. Lines that do not only combine references are returned
+// unchanged.
+func canonicalCombining(line string, options LexOptions) string {
+	if len(options.Operators) == 0 && options.Adjacency == nil {
+		return line
+	}
+	canonical := func(token string) (string, bool) {
+		if op, ok := options.Operators[strings.ToLower(token)]; ok {
+			return op, true
+		}
+		if options.Adjacency != nil && !adjRegex.MatchString(token) && options.Adjacency.MatchString(token) {
+			return "adj" + distRegex.FindString(token), true
+		}
+		return token, false
+	}
+	if m := slashRegex.FindStringSubmatch(line); len(m) == 3 {
+		if op, ok := canonical(m[1]); ok {
+			return op + m[2]
+		}
+		return line
+	}
+	tokens := tokeniseGrouping(line)
+	replaced, references := false, false
+	for i, token := range tokens {
+		if op, ok := canonical(token); ok {
+			tokens[i] = op
+			replaced = true
+		} else if numberRegex.MatchString(token) {
+			references = true
+		} else if _, ok := groupingOperatorPrecedence(token); !ok && token != "(" && token != ")" {
+			return line
+		}
+	}
+	if !replaced || !references {
+		return line
+	}
+	return strings.Join(tokens, " ")
+}
+
+// infixReferences returns the references combined by an infix combining line, e.g. `2 not 1`, in the order they appear
+// in the line.
+func infixReferences(line string) []int {
+	var references []int
+	for _, token := range strings.Fields(line) {
+		if numberRegex.MatchString(token) {
+			reference, _ := strconv.Atoi(token)
+			references = append(references, reference)
+		}
+	}
+	return references
+}
+
+// operandReferences returns the references of the operands of a line of a processed query, in the order of order when
+// it has the order of the line, and in ascending order otherwise.
+func operandReferences(operands map[int]string, order []int) []int {
+	if len(order) == len(operands) {
+		return order
+	}
+	references := make([]int, 0, len(operands))
+	for reference := range operands {
+		references = append(references, reference)
+	}
+	sort.Ints(references)
+	return references
+}
+
+// ExpandQuery takes a query that has been processed and expands it into a tree. The children of each node are in the
+// order of their references.
 func ExpandQuery(query map[int]map[string]map[int]string) (Node, error) {
+	return expandQuery(query, nil)
+}
+
+// expandQuery is ExpandQuery, where the children of a node are in the order of the references of the operands of its
+// line in order (e.g. the order they appear in a combining line), if there is one. The order matters for `not`, which
+// excludes the operands after the first from the first.
+func expandQuery(query map[int]map[string]map[int]string, order map[int][]int) (Node, error) {
 	var bottomReference int
 	var operator string
 
@@ -120,7 +273,9 @@ func ExpandQuery(query map[int]map[string]map[int]string) (Node, error) {
 	var recursionDepth int
 	expand = func(node Node, query map[int]map[string]map[int]string) (Node, error) {
 		recursionDepth++
-		for k, v := range query[node.Reference][node.Operator] {
+		operands := query[node.Reference][node.Operator]
+		for _, k := range operandReferences(operands, order[node.Reference]) {
+			v := operands[k]
 			// If we find a query in the top-level, process that.
 			if innerQuery, ok := query[k]; ok {
 				for operator := range innerQuery {
@@ -146,18 +301,38 @@ func ExpandQuery(query map[int]map[string]map[int]string) (Node, error) {
 }
 
 // Lex creates the abstract syntax tree for the query. It will preprocess the query to try to normalise it. This
-// function only creates the tree; it does not attempt to parse the individual lines in the query.
+// function only creates the tree; it does not attempt to parse the individual lines in the query. Comment lines are
+// removed, and their text is attached to the node of the line that follows them. Lines may be labelled other than by
+// their numbers (e.g. `S1` or `1a`), as long as the combining lines reference these labels. In a numbered query, a line
+// without a label continues the line before it. An error is returned if the query is empty, or only contains
+// whitespace, comments, and line labels.
 func Lex(query string, options LexOptions) (Node, error) {
+	if options.ImplicitCombine {
+		query = splitStatements(query, options.CommentPrefix)
+	}
+	label := labelRegexp(options.LabelPrefixes)
+	query, comments := stripComments(query, options.CommentPrefix)
+	query, comments = joinContinuations(query, comments, label)
+	if len(strings.TrimSpace(query)) == 0 || onlyLabels(query, label) {
+		return Node{}, errors.New("the query is empty")
+	}
+	query, err := relabel(query, label)
+	if err != nil {
+		return Node{}, err
+	}
 	query = PreProcess(query, options)
 
 	// reference -> operator -> reference -> query_string
 	depth1Query := map[int]map[string]map[int]string{}
+	// reference -> references of the operands, in the order of the combining line
+	order := map[int][]int{}
 	queries := map[int]string{}
+	limits := map[int][]string{}
+	lastLimit := 0
 
-	var err error
 	// In the first pass, we create a depth-1 query structure.
 	for reference, line := range strings.Split(query, "\n") {
-		line = strings.TrimSpace(line)
+		line = canonicalCombining(strings.TrimSpace(line), options)
 		// First check if we are looking at an operator.
 
 		if numberRegex.MatchString(line) {
@@ -169,12 +344,35 @@ func Lex(query string, options LexOptions) (Node, error) {
 			line = queries[int(ref)-1]
 		}
 
-		if numberRegex.MatchString(strings.Split(line, " ")[0]) {
+		if m := limitRegex.FindStringSubmatch(line); len(m) == 3 {
+			// A limit line restricts an earlier line, e.g. `limit 7 to humans`, so it is the earlier line with a limit.
+			ref, err := strconv.Atoi(m[1])
+			if err != nil || ref < 1 || ref > reference {
+				return Node{}, fmt.Errorf("limit line `%v` does not reference an earlier line", line)
+			}
+			limits[reference+1] = append(append([]string{}, limits[ref]...), strings.TrimSpace(m[2]))
+			if group, ok := depth1Query[ref]; ok {
+				depth1Query[reference+1] = group
+				order[reference+1] = order[ref]
+			}
+			queries[reference] = queries[ref-1]
+			lastLimit = reference + 1
+			continue
+		}
+
+		if IsInfixGrouping(line) {
+			// Assume we are looking at `N OP (N OP N)`.
+			depth1Query[reference+1], order[reference+1], err = processInfixGrouping(queries, line, depth1Query, order)
+			if err != nil {
+				return Node{}, err
+			}
+		} else if numberRegex.MatchString(strings.Split(line, " ")[0]) {
 			// Assume we are looking at `N OP N OP N`.
 			depth1Query[reference+1], err = ProcessInfixOperators(queries, line)
 			if err != nil {
 				return Node{}, err
 			}
+			order[reference+1] = infixReferences(line)
 		} else if prefixRegex.MatchString(line) {
 			// Assume we are looking at `OP/N-N
 			depth1Query[reference+1], err = ProcessPrefixOperators(queries, line)
@@ -187,16 +385,38 @@ func Lex(query string, options LexOptions) (Node, error) {
 			if err != nil {
 				return Node{}, err
 			}
+			order[reference+1] = infixReferences(strings.Replace(strings.SplitN(line, "/", 2)[1], ",", " ", -1))
 		}
 
 		// We can be pretty sure that the string is for a query
 		queries[reference] = line
 	}
 
+	if len(depth1Query) == 0 && options.ImplicitCombine && lastLimit == 0 && len(queries) > 1 {
+		// The lines are combined as if the query ended with a combining line, e.g. `and/1-3`.
+		op := options.ImplicitOperator
+		if len(op) == 0 {
+			op = "and"
+		}
+		depth1Query[len(queries)+1], err = ProcessPrefixOperators(queries, fmt.Sprintf("%v/1-%d", strings.ToLower(op), len(queries)))
+		if err != nil {
+			return Node{}, err
+		}
+	}
+
 	if len(depth1Query) == 0 {
-		return Node{Value: queries[0], Reference: 1}, nil
-	} else {
-		// In the second pass, we then parse a second time recursively to expand the inner queries at depth 1.
-		return ExpandQuery(depth1Query)
+		node := attachComments(Node{Value: queries[0], Reference: 1}, comments)
+		// A query of a single line may still be limited by a limit line after it.
+		if lastLimit > 0 {
+			node.Value = queries[lastLimit-1]
+			node.Limits = limits[lastLimit]
+		}
+		return node, nil
+	}
+	// In the second pass, we then parse a second time recursively to expand the inner queries at depth 1.
+	ast, err := expandQuery(depth1Query, order)
+	if err != nil {
+		return Node{}, err
 	}
+	return attachLimits(attachComments(ast, comments), limits), nil
 }
@@ -1,6 +1,8 @@
 package lexer
 
 import (
+	"sort"
+	"strings"
 	"testing"
 )
 
@@ -16,7 +18,7 @@ var (
 )
 
 func Test_Lex_MedlineQuery(t *testing.T) {
-	ast, err := Lex(string(medlineQueryString))
+	ast, err := Lex(string(medlineQueryString), LexOptions{})
 	if err != nil {
 		panic(err)
 	}
@@ -29,7 +31,7 @@ func Test_Lex_MedlineQuery(t *testing.T) {
 }
 
 func Test_Lex_PubMedQuery(t *testing.T) {
-	ast, err := Lex(string(pubmedQueryString))
+	ast, err := Lex(string(pubmedQueryString), LexOptions{})
 	if err != nil {
 		panic(err)
 	}
@@ -40,3 +42,302 @@ func Test_Lex_PubMedQuery(t *testing.T) {
 		t.Fatalf("expected %v children, got %v", expected, got)
 	}
 }
+
+// groupingString renders a node as a canonical string so that trees can be compared regardless of the order children
+// were expanded in.
+func groupingString(node Node) string {
+	if len(node.Operator) == 0 {
+		return node.Value
+	}
+	var children []string
+	for _, child := range node.Children {
+		children = append(children, groupingString(child))
+	}
+	sort.Strings(children)
+	return "(" + strings.Join(children, " "+strings.ToLower(node.Operator)+" ") + ")"
+}
+
+func Test_Lex_InfixGrouping(t *testing.T) {
+	lines := `1. a.ti.
+2. b.ti.
+3. c.ti.
+4. d.ti.
+`
+	tests := []struct {
+		grouping string
+		expected string
+	}{
+		{"1 or 2 and 3", "((b.ti. and c.ti.) or a.ti.)"},
+		{"1 and 2 or 3", "((a.ti. and b.ti.) or c.ti.)"},
+		{"1 or 2 or 3 and 4", "((c.ti. and d.ti.) or a.ti. or b.ti.)"},
+		{"4 and (1 or 2)", "((a.ti. or b.ti.) and d.ti.)"},
+		{"(1 or 2) and (3 or 4)", "((a.ti. or b.ti.) and (c.ti. or d.ti.))"},
+		{"1 and (2 or (3 and 4))", "(((c.ti. and d.ti.) or b.ti.) and a.ti.)"},
+		{"(1 or 2 or 3) and 4", "((a.ti. or b.ti. or c.ti.) and d.ti.)"},
+		{"1 and 2 not 3", "((b.ti. not c.ti.) and a.ti.)"},
+		{"1 and not 2", "(a.ti. not b.ti.)"},
+		{"1 or 2 not 3", "((b.ti. not c.ti.) or a.ti.)"},
+		{"(1 and 2)", "(a.ti. and b.ti.)"},
+	}
+
+	for _, test := range tests {
+		ast, err := Lex(lines+"5. "+test.grouping, LexOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := groupingString(ast)
+		if got != test.expected {
+			t.Errorf("%v: expected %v, got %v", test.grouping, test.expected, got)
+		}
+	}
+}
+
+func Test_Lex_InfixGroupingLeadingNot(t *testing.T) {
+	// A not must follow the line it excludes from.
+	if _, err := Lex("1. a.ti.\n2. b.ti.\n3. not 1 or 2", LexOptions{}); err == nil {
+		t.Error("expected an error for a leading not")
+	}
+}
+
+func Test_Lex_InfixGroupingUnbalanced(t *testing.T) {
+	for _, grouping := range []string{"(1 or 2", "1 or 2)", "1 or (2 and)"} {
+		_, err := Lex("1. a.ti.\n2. b.ti.\n3. "+grouping, LexOptions{})
+		if err == nil {
+			t.Errorf("%v: expected an error", grouping)
+		}
+	}
+}
+
+// orderedString renders a node as a string with its children in the order they were expanded in.
+func orderedString(node Node) string {
+	if len(node.Operator) == 0 {
+		return node.Value
+	}
+	var children []string
+	for _, child := range node.Children {
+		children = append(children, orderedString(child))
+	}
+	return "(" + strings.Join(children, " "+strings.ToLower(node.Operator)+" ") + ")"
+}
+
+func Test_Lex_NotOperandOrder(t *testing.T) {
+	lines := `1. a.ti.
+2. b.ti.
+3. c.ti.
+4. d.ti.
+`
+	tests := []struct {
+		combining string
+		expected  string
+	}{
+		{"(1 or 2) not 3", "((a.ti. or b.ti.) not c.ti.)"},
+		{"3 not (1 or 2)", "(c.ti. not (a.ti. or b.ti.))"},
+		{"(1 and 2) not 3", "((a.ti. and b.ti.) not c.ti.)"},
+		{"(1 or 2) and 3 not 4", "((a.ti. or b.ti.) and (c.ti. not d.ti.))"},
+		{"2 not 1", "(b.ti. not a.ti.)"},
+		{"4 not 1 not 2", "(d.ti. not a.ti. not b.ti.)"},
+		{"not/3,1", "(c.ti. not a.ti.)"},
+		{"or/1-4", "(a.ti. or b.ti. or c.ti. or d.ti.)"},
+	}
+
+	for _, test := range tests {
+		// The children were once expanded in the random order of a map, so check the order more than once.
+		for i := 0; i < 10; i++ {
+			ast, err := Lex(lines+"5. "+test.combining, LexOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := orderedString(ast)
+			if got != test.expected {
+				t.Fatalf("%v: expected %v, got %v", test.combining, test.expected, got)
+			}
+		}
+	}
+}
+
+func Test_Lex_Comments(t *testing.T) {
+	query := `# population block
+1. exp Sleep Apnea Syndromes/
+2. OSA.mp.
+#
+# combine the population
+3. or/1-2`
+	ast, err := Lex(query, LexOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ast.Children) != 2 || ast.Reference != 3 {
+		t.Fatalf("expected line 3 to combine 2 children, got %v", ast)
+	}
+	if ast.Comment != "combine the population" {
+		t.Fatalf("expected comment on line 3, got %v", ast.Comment)
+	}
+	for _, child := range ast.Children {
+		if (child.Reference == 1) != (child.Comment == "population block") {
+			t.Fatalf("expected comment only on line 1, got %v on line %v", child.Comment, child.Reference)
+		}
+	}
+
+	// A custom prefix.
+	ast, err = Lex("-- population\nasthma[tiab]", LexOptions{CommentPrefix: "--"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ast.Comment != "population" || ast.Value != "asthma[tiab]" {
+		t.Fatalf("expected comment on line 1, got %v", ast)
+	}
+
+	// References in a PubMed search history are not comments.
+	q, comments := stripComments("#1 asthma\n# note\n#2 wheeze", "")
+	if q != "#1 asthma\n#2 wheeze" || comments[2] != "note" {
+		t.Fatalf("expected one comment on line 2, got %v and %v", q, comments)
+	}
+}
+
+func Test_Lex_Limits(t *testing.T) {
+	ast, err := Lex("1. a.ti.\n2. b.ti.\n3. 1 or 2\n4. limit 3 to humans", LexOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ast.Children) != 2 || ast.Reference != 4 {
+		t.Fatalf("expected line 4 to limit 2 children, got %v", ast)
+	}
+	if len(ast.Limits) != 1 || ast.Limits[0] != "humans" {
+		t.Fatalf("expected limits %v, got %v", []string{"humans"}, ast.Limits)
+	}
+
+	// A limit may only refer to an earlier line.
+	if _, err := Lex("1. a.ti.\n2. limit 3 to humans", LexOptions{}); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func Test_Lex_Labels(t *testing.T) {
+	for _, query := range []string{
+		"S1 (MH \"Asthma\")\nS2 TI wheeze\nS3 TI child*\nS4 S1 OR (S2 AND S3)",
+		"1a. asthma.ti.\n1b. wheeze.ti.\n1.1 child*.ti.\n2. or/1a-1b\n3. 2 and 1.1",
+	} {
+		ast, err := Lex(query, LexOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		values := map[string]bool{}
+		var visit func(node Node)
+		visit = func(node Node) {
+			if len(node.Value) > 0 {
+				values[node.Value] = true
+			}
+			for _, child := range node.Children {
+				visit(child)
+			}
+		}
+		visit(ast)
+		if len(ast.Children) != 2 || len(values) != 3 {
+			t.Fatalf("expected the combining line to reference 3 lines, got %v", ast)
+		}
+	}
+
+	// A label that is not the label of a line is an error.
+	if _, err := Lex("S1 asthma\nS2 S1 OR S3", LexOptions{}); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func Test_Lex_LabelReferences(t *testing.T) {
+	queries := []struct {
+		query    string
+		options  LexOptions
+		expected string
+	}{
+		{"S1 TI asthma\nS2 TI wheeze\nS3 S1 AND S2", LexOptions{}, "(TI asthma and TI wheeze)"},
+		{"#1 asthma[tiab]\n#2 wheeze[tiab]\n#3 #1 OR #2", LexOptions{}, "(asthma[tiab] or wheeze[tiab])"},
+		// The references of numbered lines may also have a prefix.
+		{"1. asthma.ti.\n2. wheeze.ti.\n3. #1 OR #2", LexOptions{}, "(asthma.ti. or wheeze.ti.)"},
+		{"1. asthma.ti.\n2. wheeze.ti.\n3. s1 and S2", LexOptions{}, "(asthma.ti. and wheeze.ti.)"},
+		{"L1 TI asthma\nL2 TI wheeze\nL3 L1 OR L2", LexOptions{LabelPrefixes: []string{"L"}}, "(TI asthma or TI wheeze)"},
+	}
+	for _, query := range queries {
+		ast, err := Lex(query.query, query.options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := orderedString(ast); got != query.expected {
+			t.Fatalf("%v: expected %v, got %v", query.query, query.expected, got)
+		}
+	}
+}
+
+func Test_Lex_Continuations(t *testing.T) {
+	query := `1. asthma.ti,ab.
+2. wheez*.ti,ab.
+3. 1
+or
+2
+# the intervention
+4. (steroid*.ti,ab.
+or
+inhaler*.ti,ab.)
+5. 3 and 4`
+	ast, err := Lex(query, LexOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ast.Children) != 2 || ast.Reference != 5 {
+		t.Fatalf("expected line 5 to combine 2 children, got %v", ast)
+	}
+	for _, child := range ast.Children {
+		switch child.Reference {
+		case 3:
+			if child.Operator != "or" || len(child.Children) != 2 {
+				t.Fatalf("expected line 3 to combine lines 1 and 2, got %v", child)
+			}
+		case 4:
+			if child.Value != "(steroid*.ti,ab. or inhaler*.ti,ab.)" || child.Comment != "the intervention" {
+				t.Fatalf("expected line 4 to be joined, got %v", child)
+			}
+		default:
+			t.Fatalf("unexpected child %v", child)
+		}
+	}
+}
+
+func Test_Lex_ImplicitCombine(t *testing.T) {
+	query := `(asthma or wheez*).ti,ab.; exp Steroids/; "child; adolescent".ti.;`
+	ast, err := Lex(query, LexOptions{ImplicitCombine: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ast.Operator != "and" || ast.Reference != 4 || len(ast.Children) != 3 {
+		t.Fatalf("expected line 4 to and 3 children, got %v", ast)
+	}
+	for _, child := range ast.Children {
+		if child.Reference == 3 && child.Value != `"child; adolescent".ti.` {
+			t.Fatalf("expected the quoted semicolon not to separate lines, got %v", child)
+		}
+	}
+
+	ast, err = Lex("asthma.ti.\nwheez*.ti.", LexOptions{ImplicitCombine: true, ImplicitOperator: "OR"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ast.Operator != "or" || len(ast.Children) != 2 {
+		t.Fatalf("expected the lines to be or'd, got %v", ast)
+	}
+
+	// Queries with combining lines are not changed.
+	ast, err = Lex("1. asthma.ti.\n2. wheez*.ti.\n3. 1 or 2", LexOptions{ImplicitCombine: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ast.Operator != "or" || ast.Reference != 3 {
+		t.Fatalf("expected line 3 to combine the query, got %v", ast)
+	}
+}
+
+func Test_Lex_Empty(t *testing.T) {
+	for _, query := range []string{"", "   ", "\n\t\n", "# only a comment", "1. ", "1.\n2."} {
+		if _, err := Lex(query, LexOptions{}); err == nil {
+			t.Errorf("%q: expected an error", query)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package lexer
+
+import "strings"
+
+// splitStatements puts each statement of a query on a line of its own, where statements are separated by semicolons
+// or new lines. Semicolons inside quotes do not separate statements, and comment lines (starting with prefix, or `#`
+// when prefix is empty) are not split. Empty statements are removed.
+func splitStatements(query string, prefix string) string {
+	if len(prefix) == 0 {
+		prefix = "#"
+	}
+	var statements []string
+	for _, line := range strings.Split(query, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), prefix) {
+			statements = append(statements, line)
+			continue
+		}
+		quoted := false
+		start := 0
+		for i, c := range line {
+			switch {
+			case c == '"':
+				quoted = !quoted
+			case c == ';' && !quoted:
+				statements = append(statements, line[start:i])
+				start = i + 1
+			}
+		}
+		statements = append(statements, line[start:])
+	}
+
+	var lines []string
+	for _, statement := range statements {
+		if len(strings.TrimSpace(statement)) > 0 {
+			lines = append(lines, strings.TrimSpace(statement))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,103 @@
+package parser
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+
+	"github.com/hscells/transmute/ir"
+	"github.com/hscells/transmute/lexer"
+)
+
+// cacheKey identifies a parsed query in a CachingParser.
+type cacheKey struct {
+	format string
+	query  string
+}
+
+// cacheEntry is a parsed query in a CachingParser.
+type cacheEntry struct {
+	key   cacheKey
+	query ir.BooleanQuery
+}
+
+// CachingParser lexes and parses queries of several formats, keeping the most recently parsed queries so that popular
+// queries are only parsed once. The least recently used query is evicted when the cache is full. Queries are cloned on
+// the way out, so callers may modify the queries they are given. A CachingParser is safe for concurrent use.
+type CachingParser struct {
+	// Parsers are the query parsers for each format, e.g. "pubmed".
+	Parsers map[string]QueryParser
+	// LexOptions are the options used to lex the queries of each format. A format without options is lexed with the
+	// LexOptions of its parser.
+	LexOptions map[string]lexer.LexOptions
+
+	size    int
+	mu      sync.Mutex
+	recent  *list.List
+	entries map[cacheKey]*list.Element
+}
+
+// NewCachingParser creates a parser which caches up to size parsed queries of the formats of the parsers.
+func NewCachingParser(parsers map[string]QueryParser, size int) *CachingParser {
+	return &CachingParser{
+		Parsers:    parsers,
+		LexOptions: map[string]lexer.LexOptions{},
+		size:       size,
+		recent:     list.New(),
+		entries:    map[cacheKey]*list.Element{},
+	}
+}
+
+// Parse lexes and parses a query of a format, or returns a copy of the query if it has been parsed recently. Queries
+// which cannot be parsed are not cached.
+func (c *CachingParser) Parse(format, query string) (ir.BooleanQuery, error) {
+	key := cacheKey{format: format, query: query}
+
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok {
+		c.recent.MoveToFront(e)
+		q := e.Value.(cacheEntry).query.Clone()
+		c.mu.Unlock()
+		return q, nil
+	}
+	c.mu.Unlock()
+
+	p, ok := c.Parsers[format]
+	if !ok {
+		return ir.BooleanQuery{}, fmt.Errorf("%v is not a valid parser", format)
+	}
+	if options, ok := c.LexOptions[format]; ok {
+		p.LexOptions = options
+	}
+	q, err := p.ParseString(query)
+	if err != nil {
+		return ir.BooleanQuery{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// The fields of parsed keywords may be shared with the field mapping of the parser, so even a query which is not
+	// cached is cloned.
+	if c.size <= 0 {
+		return q.Clone(), nil
+	}
+	// The query may have been parsed concurrently while the lock was not held.
+	if e, ok := c.entries[key]; ok {
+		c.recent.MoveToFront(e)
+	} else {
+		c.entries[key] = c.recent.PushFront(cacheEntry{key: key, query: q})
+		for c.recent.Len() > c.size {
+			e := c.recent.Back()
+			c.recent.Remove(e)
+			delete(c.entries, e.Value.(cacheEntry).key)
+		}
+	}
+	return q.Clone(), nil
+}
+
+// Len is the number of queries in the cache.
+func (c *CachingParser) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.recent.Len()
+}
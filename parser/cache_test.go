@@ -0,0 +1,68 @@
+package parser
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/hscells/transmute/lexer"
+)
+
+func TestCachingParser_Parse(t *testing.T) {
+	c := NewCachingParser(map[string]QueryParser{"pubmed": NewPubMedParser()}, 2)
+	c.LexOptions["pubmed"] = lexer.LexOptions{FormatParenthesis: true}
+
+	q, err := c.Parse("pubmed", "(asthma[tiab] OR wheeze[tiab])")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := q.String()
+
+	// Modifying a query must not modify the cached query.
+	q.Children[0].Keywords[0].QueryString = "modified"
+	q.Children[0].Keywords[0].Fields[0] = "modified"
+	q, err = c.Parse("pubmed", "(asthma[tiab] OR wheeze[tiab])")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.String() != expected {
+		t.Fatalf("Expected %v, got %v", expected, q.String())
+	}
+
+	// The least recently used query is evicted.
+	for _, query := range []string{"(a[tiab] OR b[tiab])", "(c[tiab] OR d[tiab])"} {
+		if _, err := c.Parse("pubmed", query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c.Len() != 2 {
+		t.Fatalf("Expected %v, got %v", 2, c.Len())
+	}
+	if _, ok := c.entries[cacheKey{format: "pubmed", query: "(asthma[tiab] OR wheeze[tiab])"}]; ok {
+		t.Fatalf("Expected the least recently used query to be evicted")
+	}
+
+	if _, err := c.Parse("medline", "1. asthma.ti."); err == nil {
+		t.Fatalf("Expected an error for an unknown format")
+	}
+}
+
+func TestCachingParser_Concurrent(t *testing.T) {
+	c := NewCachingParser(map[string]QueryParser{"medline": NewMedlineParser()}, 4)
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q, err := c.Parse("medline", "1. asthma.ti,ab.\n2. wheeze.ti,ab.\n3. or/1-2")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			q.Keywords = nil
+		}()
+	}
+	wg.Wait()
+	if c.Len() != 1 {
+		t.Fatalf("Expected %v, got %v", 1, c.Len())
+	}
+}
@@ -0,0 +1,87 @@
+package parser
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/hscells/transmute/ir"
+	"github.com/hscells/transmute/lexer"
+)
+
+var (
+	clefSectionRegexp, _  = regexp.Compile("^(Topic|Title|Objective|Type|Query|Pids):\\s*(.*)$")
+	clefNumberedRegexp, _ = regexp.Compile("^[0-9]+\\.?\\s")
+)
+
+// CLEFTopic is a topic from the CLEF eHealth Technology Assisted Review (TAR) collections.
+type CLEFTopic struct {
+	// ID is the identifier of the topic, i.e. the Cochrane review it was taken from, e.g. `CD007394`.
+	ID string
+	// Title is the title of the systematic review.
+	Title string
+	// Query is the parsed search strategy of the topic.
+	Query ir.BooleanQuery
+}
+
+// ParseCLEFTopic reads a CLEF TAR topic file and parses the query of the topic. A topic is made up of sections that
+// begin with a heading, e.g. `Topic: CD007394`, `Title:`, and `Query:`, where the query spans every line up to the next
+// heading. Queries written as numbered Ovid search strategies are parsed with the Medline parser, and all other
+// queries with the PubMed parser.
+func ParseCLEFTopic(reader io.Reader) (CLEFTopic, error) {
+	var topic CLEFTopic
+	var query []string
+	var section string
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if m := clefSectionRegexp.FindStringSubmatch(line); len(m) == 3 {
+			section = m[1]
+			line = m[2]
+		}
+		if len(line) == 0 {
+			continue
+		}
+		switch section {
+		case "Topic":
+			topic.ID = line
+		case "Title":
+			topic.Title = strings.TrimSpace(topic.Title + " " + line)
+		case "Query":
+			query = append(query, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return CLEFTopic{}, err
+	}
+
+	if len(topic.ID) == 0 {
+		return CLEFTopic{}, errors.New("topic does not contain a topic id")
+	}
+	if len(query) == 0 {
+		return CLEFTopic{}, errors.New("topic does not contain a query")
+	}
+
+	p := NewMedlineParser()
+	options := lexer.LexOptions{}
+	q := strings.Join(query, "\n")
+	if !clefNumberedRegexp.MatchString(query[0]) {
+		// PubMed queries are a single expression, which the lexer expects to be parenthesised.
+		p = NewPubMedParser()
+		options.FormatParenthesis = true
+		q = "(" + strings.Join(query, " ") + ")"
+	}
+
+	ast, err := lexer.Lex(q, options)
+	if err != nil {
+		return CLEFTopic{}, err
+	}
+	topic.Query, err = p.Parse(ast)
+	if err != nil {
+		return CLEFTopic{}, err
+	}
+	return topic, nil
+}
@@ -0,0 +1,56 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCLEFTopic(t *testing.T) {
+	medline := `Topic: CD007394
+
+Title: Galactomannan detection for invasive aspergillosis in immunocompromised
+patients
+
+Query:
+1. exp Aspergillus/
+2. exp Aspergillosis/
+3. (aspergill* or fungal infection*).ti,ab.
+4. or/1-3
+
+Pids:
+    24514094
+    21056906
+`
+	topic, err := ParseCLEFTopic(strings.NewReader(medline))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if topic.ID != "CD007394" {
+		t.Fatalf("Expected topic %v, got %v", "CD007394", topic.ID)
+	}
+	if topic.Title != "Galactomannan detection for invasive aspergillosis in immunocompromised patients" {
+		t.Fatalf("Unexpected title %v", topic.Title)
+	}
+	if len(topic.Query.Terms()) != 4 {
+		t.Fatalf("Expected %v terms, got %v", 4, len(topic.Query.Terms()))
+	}
+
+	pubmed := `Topic: CD008122
+Title: Rapid diagnostic tests for diagnosing uncomplicated P. falciparum malaria
+Query:
+(malaria[tiab] OR plasmodium[tiab]) AND (rapid diagnostic test*[tiab] OR RDT[tiab])
+Pids:
+    12345678
+`
+	topic, err = ParseCLEFTopic(strings.NewReader(pubmed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if topic.ID != "CD008122" || len(topic.Query.Terms()) != 4 {
+		t.Fatalf("Expected topic %v with %v terms, got %v with %v", "CD008122", 4, topic.ID, len(topic.Query.Terms()))
+	}
+
+	if _, err := ParseCLEFTopic(strings.NewReader("Title: no query\n")); err == nil {
+		t.Fatal("Expected an error for a topic without a query")
+	}
+}
@@ -39,11 +39,11 @@ func transformSingle(rep map[string]interface{}, mapping map[string][]string) ir
 	var exploded, truncated bool
 	options := make(map[string]interface{})
 	if o, ok := rep["options"].(map[string]interface{}); ok {
-		if v, ok := rep["options"].(map[string]interface{})["exploded"]; ok {
-			exploded = v.(bool)
+		if v, ok := o[cqr.ExplodedString].(bool); ok {
+			exploded = v
 		}
-		if v, ok := rep["options"].(map[string]interface{})["truncated"]; ok {
-			truncated = v.(bool)
+		if v, ok := o[cqr.TruncatedString].(bool); ok {
+			truncated = v
 		}
 		options = o
 	}
@@ -75,7 +75,10 @@ func TestCQR(t *testing.T) {
 		Operator:  "",
 		Reference: 1,
 	}
-	queryRep := NewCQRParser().Parse(ast)
+	queryRep, err := NewCQRParser().Parse(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	//t.Log(queryRep)
 
@@ -0,0 +1,89 @@
+package parser
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// formatCues are the structural cues of the query formats that DetectFormat recognises, keyed by the name of the
+// format (as used for the parsers of the transmute command, e.g. "pubmed").
+var formatCues = map[string][]*regexp.Regexp{
+	"pubmed": {
+		// A field tag, e.g. `asthma[tiab]` or `Asthma[Mesh:noexp]`.
+		regexp.MustCompile(`\[[A-Za-z][A-Za-z /:~0-9-]*\]`),
+		// A reference to a line of a search history, e.g. `#1 AND #2`.
+		regexp.MustCompile(`(?i)(^|[\s(])#[0-9]+(\s+(and|or|not)\b|\)|$)`),
+	},
+	"medline": {
+		// A field suffix, e.g. `asthma.ti,ab.`.
+		regexp.MustCompile(`\.[a-z]{2}(,[a-z]{2})*\.(\s|\)|$)`),
+		// A subject heading, e.g. `exp Asthma/`.
+		regexp.MustCompile(`(?im)^\s*([0-9]+\.?\s+)?(exp\s+)?[^\s/][^/\n]*/\s*$`),
+		// A prefix combining line, e.g. `or/1-5`.
+		regexp.MustCompile(`(?i)\b(or|and)/[0-9]+[-,][0-9]+\b`),
+		// An infix combining line, e.g. `3. 1 or 2`.
+		regexp.MustCompile(`(?im)^\s*[0-9]+\.?\s+[0-9]+(\s+(and|or|not)\s+[0-9]+)+\s*$`),
+		// An adjacency operator, e.g. `heart adj3 attack`.
+		regexp.MustCompile(`(?i)\badj[0-9]*\b`),
+	},
+	"ebsco": {
+		// A field tag before a term, e.g. `TI asthma` or `MH "Asthma+"`.
+		regexp.MustCompile(`(^|[\s(])(TI|AB|MH|MM|TX|SU|KW|AU)\s+["(A-Za-z]`),
+		// A line reference, e.g. `S1 OR S2`.
+		regexp.MustCompile(`\bS[0-9]+\s+(AND|OR|NOT)\s+S[0-9]+\b`),
+		// A proximity operator, e.g. `heart N3 attack`.
+		regexp.MustCompile(`\s[NW][0-9]+\s`),
+	},
+	"embase": {
+		// A field suffix, e.g. `asthma:ti,ab`.
+		regexp.MustCompile(`:[a-z]{2,3}(,[a-z]{2,3})*(\s|\)|$)`),
+		// An Emtree term, e.g. `'asthma'/exp`.
+		regexp.MustCompile(`'[^']+'/(exp|de|mj)\b`),
+		// A proximity operator, e.g. `heart NEAR/3 attack`.
+		regexp.MustCompile(`(?i)\b(near|next)/[0-9]+\b`),
+	},
+}
+
+// booleanOperatorRegexp matches the operators of a plain Boolean query, e.g. `asthma AND (child OR adolescent)`.
+var booleanOperatorRegexp = regexp.MustCompile(`(?i)\s(and|or|not)\s`)
+
+// DetectFormat guesses the format of a raw query from its structure, so that the query can be parsed without the
+// format being chosen by hand. The format is one of "cqr" (a JSON object), "pubmed" (e.g. `asthma[tiab]`), "medline"
+// (Ovid, e.g. `asthma.ti,ab.` or `exp Asthma/`), "ebsco" (e.g. `TI asthma`), "embase" (e.g. `asthma:ti,ab`), or
+// "boolean" for a plain Boolean query without any cues of a format.
+//
+// The confidence is between 0 and 1. For the formats recognised by their cues, it is the number of cues of the format
+// found in the query, divided by one more than the number of cues of every format, so a query with more cues, and
+// fewer cues of other formats, is detected more confidently. A plain Boolean query is detected with a confidence of
+// 0.5 when it contains operators, and 0.25 otherwise.
+func DetectFormat(raw string) (format string, confidence float64) {
+	raw = strings.TrimSpace(raw)
+	if strings.HasPrefix(raw, "{") {
+		var v map[string]interface{}
+		if err := json.Unmarshal([]byte(raw), &v); err == nil {
+			return "cqr", 1
+		}
+		return "cqr", 0.5
+	}
+
+	best, total := 0, 0
+	for _, name := range []string{"pubmed", "medline", "ebsco", "embase"} {
+		n := 0
+		for _, cue := range formatCues[name] {
+			n += len(cue.FindAllStringIndex(raw, -1))
+		}
+		total += n
+		if n > best {
+			format, best = name, n
+		}
+	}
+	if best > 0 {
+		return format, float64(best) / float64(total+1)
+	}
+
+	if booleanOperatorRegexp.MatchString(raw) {
+		return "boolean", 0.5
+	}
+	return "boolean", 0.25
+}
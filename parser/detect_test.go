@@ -0,0 +1,32 @@
+package parser
+
+import "testing"
+
+func TestDetectFormat(t *testing.T) {
+	queries := map[string]string{
+		`{"operator": "or", "children": [{"query": "asthma", "fields": ["title"]}]}`: "cqr",
+		`(asthma[tiab] OR wheez*[tiab]) AND "Child"[Mesh]`:                           "pubmed",
+		"#1 AND #2": "pubmed",
+		"1. exp Asthma/\n2. (wheez* or whistl*).ti,ab.\n3. or/1-2": "medline",
+		`(heart adj3 attack).ab.`:                                  "medline",
+		"S1 TI asthma\nS2 AB wheez*\nS3 S1 OR S2":                  "ebsco",
+		`'asthma'/exp OR (wheez* NEAR/3 child*):ti,ab`:             "embase",
+		"asthma AND (child OR adolescent)":                         "boolean",
+	}
+	for query, expected := range queries {
+		format, confidence := DetectFormat(query)
+		if format != expected {
+			t.Fatalf("Expected %v for %v, got %v", expected, query, format)
+		}
+		if confidence <= 0 || confidence > 1 {
+			t.Fatalf("Expected a confidence between 0 and 1 for %v, got %v", query, confidence)
+		}
+	}
+
+	// More cues of a format give more confidence.
+	_, one := DetectFormat("asthma.ti.")
+	_, many := DetectFormat("1. exp Asthma/\n2. asthma.ti,ab.\n3. or/1-2")
+	if one >= many {
+		t.Fatalf("Expected more confidence from more cues, got %v and %v", one, many)
+	}
+}
@@ -0,0 +1,208 @@
+package parser
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hscells/transmute/fields"
+	"github.com/hscells/transmute/ir"
+)
+
+// EbscoMedlineFieldMapping maps the field tags of the EBSCOhost MEDLINE interface.
+var EbscoMedlineFieldMapping = map[string][]string{
+	"AB":      {fields.Abstract},
+	"AD":      {fields.Affiliation},
+	"AF":      {fields.Affiliation},
+	"AU":      {fields.Authors},
+	"DE":      {fields.MeshHeadings},
+	"JN":      {fields.Journal},
+	"KW":      {fields.Keywords},
+	"LA":      {fields.Language},
+	"MH":      {fields.MeshHeadings},
+	"MJ":      {fields.MajorFocusMeshHeading},
+	"MM":      {fields.MajorFocusMeshHeading},
+	"PM":      {fields.PMID},
+	"PT":      {fields.PublicationType},
+	"SO":      {fields.Journal},
+	"SU":      {fields.MeshHeadings},
+	"TI":      {fields.Title},
+	"TX":      {fields.AllFields},
+	"ZT":      {fields.PublicationType},
+	"ZZ":      {fields.PublicationType},
+	"default": {fields.AllFields},
+}
+
+var (
+	ebscoProximityRegexp, _ = regexp.Compile("^(N|W)([0-9]+)$")
+	ebscoTagRegexp, _       = regexp.Compile("^[A-Z]{2}$")
+)
+
+// EbscoMedlineTransformer is an implementation of a QueryTransformer for the EBSCOhost MEDLINE interface. Fields are
+// specified as tags before a term or group, e.g. `TI asthma` or `AB (asthma OR wheez*)`, MeSH headings are exploded
+// with a trailing `+`, e.g. `MH "Asthma+"`, and proximity is expressed with `Nn` (any order) and `Wn` (in order).
+type EbscoMedlineTransformer struct {
+	// Operators maps localised operators in lower case (e.g. FrenchOperators) to the operators of the ir. The English
+	// operators are always recognised.
+	Operators map[string]string
+
+	warner
+	explainer
+	termLimiter
+}
+
+// withWarnings returns a copy of the transformer which collects its warnings.
+func (e EbscoMedlineTransformer) withWarnings(warnings *[]ir.Warning) QueryTransformer {
+	e.warner = warner{warnings: warnings}
+	return e
+}
+
+// localisedOperators returns the localised operators of the transformer.
+func (e EbscoMedlineTransformer) localisedOperators() map[string]string {
+	return e.Operators
+}
+
+// withExplanations returns a copy of the transformer which records how it interprets the tokens of a query.
+func (e EbscoMedlineTransformer) withExplanations(explanations *[]TokenExplanation) QueryTransformer {
+	e.explainer = explainer{explanations: explanations}
+	return e
+}
+
+// withTermLimit returns a copy of the transformer which counts the keywords it creates against a limit.
+func (e EbscoMedlineTransformer) withTermLimit(limit termLimiter) QueryTransformer {
+	e.termLimiter = limit
+	return e
+}
+
+// ebscoOperator determines if a token is an EBSCO operator. Proximity binds tighter than `NOT`, which binds tighter
+// than `AND`, which binds tighter than `OR`. EBSCO proximity counts the number of words between terms, whereas `adj` in
+// the ir counts the distance between terms, so `N3` is `adj4`.
+func ebscoOperator(token string) (infixOperator, bool) {
+	switch strings.ToLower(token) {
+	case "or":
+		return infixOperator{Operator: "or", Precedence: 0}, true
+	case "and":
+		return infixOperator{Operator: "and", Precedence: 1}, true
+	case "not":
+		return infixOperator{Operator: "not", Precedence: 2}, true
+	}
+	if m := ebscoProximityRegexp.FindStringSubmatch(token); len(m) == 3 {
+		n, err := strconv.Atoi(m[2])
+		if err != nil {
+			return infixOperator{}, false
+		}
+		op := infixOperator{Operator: "adj" + strconv.Itoa(n+1), Precedence: 3}
+		if m[1] == "W" {
+			op.Options = map[string]interface{}{ir.InOrderOption: true}
+		}
+		return op, true
+	}
+	return infixOperator{}, false
+}
+
+// operator determines if a token is an EBSCO operator, after mapping any localised operator.
+func (e EbscoMedlineTransformer) operator(token string) (infixOperator, bool) {
+	return ebscoOperator(canonicalOperator(token, e.Operators))
+}
+
+// tag determines if a token is a field tag known to the mapping.
+func (e EbscoMedlineTransformer) tag(token string, mapping map[string][]string) ([]string, bool) {
+	if !ebscoTagRegexp.MatchString(token) {
+		return nil, false
+	}
+	f, ok := mapping[token]
+	return f, ok
+}
+
+// ebscoWildcards swaps the EBSCO wildcards for those of the ir.
+var ebscoWildcards = strings.NewReplacer("?", "#", "#", string(ir.OptionalWildcard))
+
+// keyword transforms the text of an EBSCO term into a keyword. The fields of the keyword are set later by any tag
+// qualifying the term.
+func (e EbscoMedlineTransformer) keyword(text string) ir.Keyword {
+	k := ir.Keyword{QueryString: strings.TrimSpace(text)}
+	if strings.ContainsAny(k.QueryString, "*?#") {
+		k.Truncated = true
+		// The wildcards of EBSCO are the reverse of Ovid; `?` matches exactly one character, and `#` is optional.
+		k.QueryString = ebscoWildcards.Replace(k.QueryString)
+	}
+	return k
+}
+
+// qualify sets the fields of the keywords in a query, handling the explosion of MeSH headings.
+func (e EbscoMedlineTransformer) qualify(q ir.BooleanQuery, f []string) ir.BooleanQuery {
+	for i, keyword := range q.Keywords {
+		if len(keyword.Fields) > 0 {
+			continue
+		}
+		q.Keywords[i].Fields = f
+		if len(f) == 1 && (f[0] == fields.MeshHeadings || f[0] == fields.MajorFocusMeshHeading) {
+			qs := strings.Trim(keyword.QueryString, `"`)
+			if strings.HasSuffix(qs, "+") {
+				q.Keywords[i].Exploded = true
+				qs = strings.TrimSuffix(qs, "+")
+			}
+			q.Keywords[i].QueryString = qs
+		}
+	}
+	for i, child := range q.Children {
+		q.Children[i] = e.qualify(child, f)
+	}
+	return q
+}
+
+// parse parses an EBSCO query into the ir.
+func (e EbscoMedlineTransformer) parse(query string, mapping map[string][]string) (ir.BooleanQuery, error) {
+	p := infixParser{
+		tokens:   tokeniseInfix(query, `"`),
+		operator: e.operator,
+		keyword:  e.keyword,
+		prefix: func(token string) ([]string, bool) {
+			return e.tag(token, mapping)
+		},
+		qualify: e.qualify,
+		explain: e.explanations,
+		limit:   e.termLimiter,
+	}
+	q, err := p.Parse()
+	if err != nil {
+		return ir.BooleanQuery{}, err
+	}
+	return e.qualify(q, mapping["default"]), nil
+}
+
+// TransformSingle implements the transformation of a single EBSCO term, optionally qualified by a field tag.
+func (e EbscoMedlineTransformer) TransformSingle(query string, mapping map[string][]string) ir.Keyword {
+	q, err := e.parse(query, mapping)
+	if err != nil || !isInfixKeyword(q) {
+		e.warn(nil, "unable to parse `%v` as a single EBSCO term", query)
+		return e.qualify(ir.BooleanQuery{Keywords: []ir.Keyword{e.keyword(query)}}, mapping["default"]).Keywords[0]
+	}
+	return q.Keywords[0]
+}
+
+// TransformNested implements the transformation of an EBSCO query containing operators.
+func (e EbscoMedlineTransformer) TransformNested(query string, mapping map[string][]string) ir.BooleanQuery {
+	q, err := e.parse(query, mapping)
+	if err != nil {
+		e.warn(nil, "%v", err)
+		return ir.BooleanQuery{}
+	}
+	return q
+}
+
+// IsNested determines if a line of an EBSCO query contains operators, rather than a single (possibly parenthesised)
+// term.
+func (e EbscoMedlineTransformer) IsNested(query string) bool {
+	for _, token := range tokeniseInfix(query, `"`) {
+		if _, ok := e.operator(token); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// NewEbscoMedlineParser creates a new parser for MEDLINE queries written for the EBSCOhost interface.
+func NewEbscoMedlineParser() QueryParser {
+	return QueryParser{FieldMapping: EbscoMedlineFieldMapping, Parser: EbscoMedlineTransformer{}}
+}
@@ -0,0 +1,126 @@
+package parser
+
+import (
+	"github.com/hscells/transmute/backend"
+	"github.com/hscells/transmute/fields"
+	"github.com/hscells/transmute/ir"
+	"github.com/hscells/transmute/lexer"
+	"testing"
+)
+
+var (
+	ebscoQueryString = `1. MH "Asthma+"
+2. TI asthma OR AB asthma
+3. TI (wheez* N3 child*)
+4. MJ "Respiratory Sounds"
+5. 1 OR 2 OR 3 OR 4`
+)
+
+func TestEbscoMedline_Parse(t *testing.T) {
+	ast, err := lexer.Lex(ebscoQueryString, lexer.LexOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	queryRep, err := NewEbscoMedlineParser().Parse(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := 6
+	got := len(queryRep.Terms())
+	if expected != got {
+		t.Fatalf("Expected %v terms, got %v", expected, got)
+	}
+
+	fc := queryRep.FieldCount()
+	if fc[fields.MeshHeadings] != 1 || fc[fields.Title] != 3 || fc[fields.Abstract] != 1 || fc[fields.MajorFocusMeshHeading] != 1 {
+		t.Fatalf("Unexpected field counts %v", fc)
+	}
+}
+
+func TestEbscoMedline_TransformSingle(t *testing.T) {
+	e := EbscoMedlineTransformer{}
+
+	k := e.TransformSingle(`MH "Sleep Apnea, Obstructive+"`, EbscoMedlineFieldMapping)
+	if k.QueryString != "Sleep Apnea, Obstructive" || !k.Exploded || k.Fields[0] != fields.MeshHeadings {
+		t.Fatalf("Unexpected keyword %v", k)
+	}
+
+	k = e.TransformSingle(`(MH "Asthma")`, EbscoMedlineFieldMapping)
+	if k.QueryString != "Asthma" || k.Exploded || k.Fields[0] != fields.MeshHeadings {
+		t.Fatalf("Unexpected keyword %v", k)
+	}
+
+	k = e.TransformSingle(`TI heart attack*`, EbscoMedlineFieldMapping)
+	if k.QueryString != "heart attack*" || !k.Truncated || k.Fields[0] != fields.Title {
+		t.Fatalf("Unexpected keyword %v", k)
+	}
+
+	// The optional wildcard of EBSCO is `#`, and `?` matches exactly one character.
+	k = e.TransformSingle(`TI behavio#r wom?n`, EbscoMedlineFieldMapping)
+	if k.QueryString != "behavio?r wom#n" || !k.Truncated || k.Fields[0] != fields.Title {
+		t.Fatalf("Unexpected keyword %v", k)
+	}
+
+	k = e.TransformSingle(`asthma`, EbscoMedlineFieldMapping)
+	if k.QueryString != "asthma" || k.Fields[0] != fields.AllFields {
+		t.Fatalf("Unexpected keyword %v", k)
+	}
+}
+
+func TestEbscoMedline_Proximity(t *testing.T) {
+	q := EbscoMedlineTransformer{}.TransformNested(`TI (wheez* N3 child*) OR AB (asthma W2 attack*)`, EbscoMedlineFieldMapping)
+
+	if q.Operator != "or" || len(q.Children) != 2 {
+		t.Fatalf("Expected an or group of two proximity groups, got %v", q)
+	}
+	if q.Children[0].Operator != "adj4" || q.Children[0].Keywords[0].Fields[0] != fields.Title {
+		t.Fatalf("Unexpected proximity group %v", q.Children[0])
+	}
+	if q.Children[1].Operator != "adj3" || q.Children[1].Options[ir.InOrderOption] != true {
+		t.Fatalf("Unexpected proximity group %v", q.Children[1])
+	}
+}
+
+func TestEbscoMedline_SourceFields(t *testing.T) {
+	e := EbscoMedlineTransformer{}
+	for query, expected := range map[string]string{
+		`SO "Lancet"`:          fields.Journal,
+		`JN "BMJ"`:             fields.Journal,
+		`DE "Asthma"`:          fields.MeshHeadings,
+		`ZZ "Journal Article"`: fields.PublicationType,
+	} {
+		k := e.TransformSingle(query, EbscoMedlineFieldMapping)
+		if len(k.Fields) != 1 || k.Fields[0] != expected {
+			t.Fatalf("Expected %v to search %v, got %v", query, expected, k.Fields)
+		}
+	}
+}
+
+func TestEbscoMedline_Not(t *testing.T) {
+	// The keyword before `NOT` is the one the group is excluded from, so it stays first when the group is compiled.
+	for _, c := range []struct {
+		parser   QueryParser
+		query    string
+		expected string
+	}{
+		{NewEbscoMedlineParser(), `TI asthma NOT (TI child OR TI infant)`, "((asthma[Title]) NOT (child[Title] OR infant[Title]))"},
+		{NewPubMedParser(), `asthma[tiab] NOT (child[tiab] OR infant[tiab])`, "((asthma[Title/Abstract]) NOT (child[Title/Abstract] OR infant[Title/Abstract]))"},
+	} {
+		q, err := c.parser.ParseString(c.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := backend.NewPubmedBackend().Compile(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := b.String()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.expected {
+			t.Fatalf("Expected %v, got %v", c.expected, got)
+		}
+	}
+}
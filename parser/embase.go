@@ -0,0 +1,238 @@
+package parser
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hscells/transmute/fields"
+	"github.com/hscells/transmute/ir"
+)
+
+// EmbaseNativeFieldMapping maps the field qualifiers of the native Embase (embase.com) interface. Emtree headings are
+// mapped to the MeSH heading fields.
+var EmbaseNativeFieldMapping = map[string][]string{
+	"ab":       {fields.Abstract},
+	"au":       {fields.Authors},
+	"de":       {fields.MeshHeadings},
+	"exp":      {fields.MeshHeadings},
+	"it":       {fields.PublicationType},
+	"jt":       {fields.Journal},
+	"kw":       {fields.Keywords},
+	"la":       {fields.Language},
+	"mj":       {fields.MajorFocusMeshHeading},
+	"ti":       {fields.Title},
+	"ti,ab":    {fields.TitleAbstract},
+	"ti,ab,kw": {fields.TitleAbstract, fields.Keywords},
+	"default":  {fields.AllFields},
+}
+
+var (
+	embaseProximityRegexp, _ = regexp.Compile("^(near|next)/([0-9]+)$")
+	embaseFieldRegexp, _     = regexp.Compile(`:([a-z]{2}(,[a-z]{2})*)$`)
+	embaseEmtreeRegexp, _    = regexp.Compile(`/(exp|de|mj)$`)
+)
+
+// EmbaseNativeTransformer is an implementation of a QueryTransformer for the native Embase (embase.com) interface,
+// as opposed to Embase searched through Ovid. Emtree headings are single-quoted and followed by `/exp` (exploded),
+// `/de` (not exploded), or `/mj` (major focus), e.g. `'asthma'/exp`. Fields are specified with a suffix on a term or
+// group, e.g. `asthma:ti,ab` or `(asthma OR wheez*):ti`, and proximity is expressed with `NEAR/n` (any order) and
+// `NEXT/n` (in order).
+type EmbaseNativeTransformer struct {
+	// Operators maps localised operators in lower case (e.g. FrenchOperators) to the operators of the ir. The English
+	// operators are always recognised.
+	Operators map[string]string
+
+	warner
+	explainer
+	termLimiter
+}
+
+// withWarnings returns a copy of the transformer which collects its warnings.
+func (e EmbaseNativeTransformer) withWarnings(warnings *[]ir.Warning) QueryTransformer {
+	e.warner = warner{warnings: warnings}
+	return e
+}
+
+// localisedOperators returns the localised operators of the transformer.
+func (e EmbaseNativeTransformer) localisedOperators() map[string]string {
+	return e.Operators
+}
+
+// withExplanations returns a copy of the transformer which records how it interprets the tokens of a query.
+func (e EmbaseNativeTransformer) withExplanations(explanations *[]TokenExplanation) QueryTransformer {
+	e.explainer = explainer{explanations: explanations}
+	return e
+}
+
+// withTermLimit returns a copy of the transformer which counts the keywords it creates against a limit.
+func (e EmbaseNativeTransformer) withTermLimit(limit termLimiter) QueryTransformer {
+	e.termLimiter = limit
+	return e
+}
+
+// embaseOperator determines if a token is an Embase operator. Embase evaluates proximity first, then `NOT`, then
+// `AND`, and finally `OR`. `NEAR/n` matches terms within n words of each other, which is the same as `adjn` in the ir.
+func embaseOperator(token string) (infixOperator, bool) {
+	token = strings.ToLower(token)
+	switch token {
+	case "or":
+		return infixOperator{Operator: "or", Precedence: 0}, true
+	case "and":
+		return infixOperator{Operator: "and", Precedence: 1}, true
+	case "not":
+		return infixOperator{Operator: "not", Precedence: 2}, true
+	}
+	if m := embaseProximityRegexp.FindStringSubmatch(token); len(m) == 3 {
+		n, err := strconv.Atoi(m[2])
+		if err != nil {
+			return infixOperator{}, false
+		}
+		op := infixOperator{Operator: "adj" + strconv.Itoa(n), Precedence: 3}
+		if m[1] == "next" {
+			op.Options = map[string]interface{}{ir.InOrderOption: true}
+		}
+		return op, true
+	}
+	return infixOperator{}, false
+}
+
+// embaseFields maps a comma separated list of Embase field qualifiers, e.g. `ti,ab`, to fields.
+func embaseFields(qualifier string, mapping map[string][]string) ([]string, bool) {
+	if f, ok := mapping[qualifier]; ok {
+		return f, true
+	}
+	var f []string
+	for _, part := range strings.Split(qualifier, ",") {
+		m, ok := mapping[part]
+		if !ok {
+			return nil, false
+		}
+		f = append(f, m...)
+	}
+	return f, true
+}
+
+// operator determines if a token is an Embase operator, after mapping any localised operator.
+func (e EmbaseNativeTransformer) operator(token string) (infixOperator, bool) {
+	return embaseOperator(canonicalOperator(token, e.Operators))
+}
+
+// suffix determines if a token qualifies the fields of the group that precedes it, e.g. `:ti,ab`.
+func (e EmbaseNativeTransformer) suffix(token string, mapping map[string][]string) ([]string, bool) {
+	if !strings.HasPrefix(token, ":") || !embaseFieldRegexp.MatchString(token) {
+		return nil, false
+	}
+	f, ok := embaseFields(strings.ToLower(token[1:]), mapping)
+	if !ok {
+		e.warn(nil, "the field `%v` does not have a mapping defined", token)
+	}
+	return f, ok
+}
+
+// embaseWildcards swaps the Embase wildcards for those of the ir.
+var embaseWildcards = strings.NewReplacer("?", string(ir.SingleWildcard), "$", string(ir.OptionalWildcard))
+
+// keyword transforms the text of an Embase term, including any Emtree or field suffixes, into a keyword.
+func (e EmbaseNativeTransformer) keyword(text string, mapping map[string][]string) ir.Keyword {
+	k := ir.Keyword{}
+	text = strings.TrimSpace(text)
+
+	if m := embaseFieldRegexp.FindStringSubmatch(strings.ToLower(text)); len(m) > 0 {
+		if f, ok := embaseFields(m[1], mapping); ok {
+			k.Fields = f
+			text = text[:len(text)-len(m[0])]
+		}
+	}
+
+	// Emtree suffixes may be combined, e.g. `'asthma'/exp/mj`.
+	for {
+		m := embaseEmtreeRegexp.FindStringSubmatch(strings.ToLower(text))
+		if len(m) == 0 {
+			break
+		}
+		switch m[1] {
+		case "exp":
+			k.Exploded = true
+			if len(k.Fields) == 0 {
+				k.Fields = mapping["exp"]
+			}
+		case "de":
+			if len(k.Fields) == 0 {
+				k.Fields = mapping["de"]
+			}
+		case "mj":
+			k.Fields = mapping["mj"]
+		}
+		text = text[:len(text)-len(m[0])]
+	}
+
+	text = strings.TrimSpace(text)
+	if len(text) > 1 && text[0] == '\'' && text[len(text)-1] == '\'' {
+		text = text[1 : len(text)-1]
+	}
+	k.QueryString = text
+	if strings.ContainsAny(k.QueryString, "*?$") {
+		k.Truncated = true
+		// In Embase, `?` matches exactly one character, and `$` is optional.
+		k.QueryString = embaseWildcards.Replace(k.QueryString)
+	}
+	return k
+}
+
+// parse parses an Embase query into the ir.
+func (e EmbaseNativeTransformer) parse(query string, mapping map[string][]string) (ir.BooleanQuery, error) {
+	p := infixParser{
+		tokens:   tokeniseInfix(query, `'"`),
+		operator: e.operator,
+		keyword: func(text string) ir.Keyword {
+			return e.keyword(text, mapping)
+		},
+		suffix: func(token string) ([]string, bool) {
+			return e.suffix(token, mapping)
+		},
+		explain: e.explanations,
+		limit:   e.termLimiter,
+	}
+	q, err := p.Parse()
+	if err != nil {
+		return ir.BooleanQuery{}, err
+	}
+	return qualifyInfix(q, mapping["default"]), nil
+}
+
+// TransformSingle implements the transformation of a single Embase term.
+func (e EmbaseNativeTransformer) TransformSingle(query string, mapping map[string][]string) ir.Keyword {
+	q, err := e.parse(query, mapping)
+	if err != nil || !isInfixKeyword(q) {
+		e.warn(nil, "unable to parse `%v` as a single Embase term", query)
+		return qualifyInfix(ir.BooleanQuery{Keywords: []ir.Keyword{e.keyword(query, mapping)}}, mapping["default"]).Keywords[0]
+	}
+	return q.Keywords[0]
+}
+
+// TransformNested implements the transformation of an Embase query containing operators.
+func (e EmbaseNativeTransformer) TransformNested(query string, mapping map[string][]string) ir.BooleanQuery {
+	q, err := e.parse(query, mapping)
+	if err != nil {
+		e.warn(nil, "%v", err)
+		return ir.BooleanQuery{}
+	}
+	return q
+}
+
+// IsNested determines if a line of an Embase query contains operators, rather than a single (possibly parenthesised)
+// term.
+func (e EmbaseNativeTransformer) IsNested(query string) bool {
+	for _, token := range tokeniseInfix(query, `'"`) {
+		if _, ok := e.operator(token); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// NewEmbaseNativeParser creates a new parser for queries written for the native Embase (embase.com) interface.
+func NewEmbaseNativeParser() QueryParser {
+	return QueryParser{FieldMapping: EmbaseNativeFieldMapping, Parser: EmbaseNativeTransformer{}}
+}
@@ -0,0 +1,101 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/hscells/transmute/fields"
+	"github.com/hscells/transmute/ir"
+	"github.com/hscells/transmute/lexer"
+)
+
+var (
+	embaseQueryString = `1. 'asthma'/exp
+2. 'respiratory sound'/de
+3. (wheez* OR asthma*):ti,ab
+4. 1 OR 2 OR 3`
+)
+
+func TestEmbaseNative_Parse(t *testing.T) {
+	ast, err := lexer.Lex(embaseQueryString, lexer.LexOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	queryRep, err := NewEmbaseNativeParser().Parse(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := 4
+	got := len(queryRep.Terms())
+	if expected != got {
+		t.Fatalf("Expected %v terms, got %v", expected, got)
+	}
+
+	fc := queryRep.FieldCount()
+	if fc[fields.MeshHeadings] != 2 || fc[fields.TitleAbstract] != 2 {
+		t.Fatalf("Unexpected field counts %v", fc)
+	}
+}
+
+func TestEmbaseNative_TransformSingle(t *testing.T) {
+	e := EmbaseNativeTransformer{}
+
+	k := e.TransformSingle(`'sleep disordered breathing'/exp`, EmbaseNativeFieldMapping)
+	if k.QueryString != "sleep disordered breathing" || !k.Exploded || k.Fields[0] != fields.MeshHeadings {
+		t.Fatalf("Unexpected keyword %v", k)
+	}
+
+	k = e.TransformSingle(`'asthma'/de`, EmbaseNativeFieldMapping)
+	if k.QueryString != "asthma" || k.Exploded || k.Fields[0] != fields.MeshHeadings {
+		t.Fatalf("Unexpected keyword %v", k)
+	}
+
+	k = e.TransformSingle(`'asthma'/exp/mj`, EmbaseNativeFieldMapping)
+	if k.QueryString != "asthma" || !k.Exploded || k.Fields[0] != fields.MajorFocusMeshHeading {
+		t.Fatalf("Unexpected keyword %v", k)
+	}
+
+	k = e.TransformSingle(`'heart attack*':ti,ab`, EmbaseNativeFieldMapping)
+	if k.QueryString != "heart attack*" || !k.Truncated || k.Fields[0] != fields.TitleAbstract {
+		t.Fatalf("Unexpected keyword %v", k)
+	}
+
+	k = e.TransformSingle(`asthma:ti`, EmbaseNativeFieldMapping)
+	if k.QueryString != "asthma" || k.Fields[0] != fields.Title {
+		t.Fatalf("Unexpected keyword %v", k)
+	}
+
+	k = e.TransformSingle(`asthma`, EmbaseNativeFieldMapping)
+	if k.QueryString != "asthma" || k.Fields[0] != fields.AllFields {
+		t.Fatalf("Unexpected keyword %v", k)
+	}
+}
+
+func TestEmbaseNative_Proximity(t *testing.T) {
+	q := EmbaseNativeTransformer{}.TransformNested(`(wheez* NEAR/3 child*):ti OR (asthma NEXT/2 attack*):ab`, EmbaseNativeFieldMapping)
+
+	if q.Operator != "or" || len(q.Children) != 2 {
+		t.Fatalf("Expected an or group of two proximity groups, got %v", q)
+	}
+	if q.Children[0].Operator != "adj3" || q.Children[0].Keywords[0].Fields[0] != fields.Title {
+		t.Fatalf("Unexpected proximity group %v", q.Children[0])
+	}
+	if q.Children[1].Operator != "adj2" || q.Children[1].Options[ir.InOrderOption] != true || q.Children[1].Keywords[1].Fields[0] != fields.Abstract {
+		t.Fatalf("Unexpected proximity group %v", q.Children[1])
+	}
+}
+
+func TestEmbaseNative_Wildcards(t *testing.T) {
+	// In Embase, `?` matches exactly one character, and `$` is optional, whereas `?` is optional in the ir.
+	for query, expected := range map[string]string{
+		`wom?n:ti`:   "wom#n",
+		`colo$r:ti`:  "colo?r",
+		`wheez*:ti`:  "wheez*",
+		`an$emia:ab`: "an?emia",
+	} {
+		k := EmbaseNativeTransformer{}.TransformSingle(query, EmbaseNativeFieldMapping)
+		if k.QueryString != expected || !k.Truncated {
+			t.Fatalf("Expected %v for %v, got %v", expected, query, k)
+		}
+	}
+}
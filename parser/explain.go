@@ -0,0 +1,175 @@
+package parser
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/hscells/transmute/ir"
+	"github.com/hscells/transmute/lexer"
+)
+
+// TokenKind is how a token of a query was interpreted.
+type TokenKind string
+
+const (
+	// OperatorToken is an operator, e.g. `OR`, `adj3`, or the operator of a combining line.
+	OperatorToken TokenKind = "operator"
+	// KeywordToken is the text of a keyword, e.g. `heart attack[tiab]` or `wheez*.ti,ab.`.
+	KeywordToken TokenKind = "keyword"
+	// GroupingToken is a parenthesis which opens or closes a group.
+	GroupingToken TokenKind = "grouping"
+	// FieldToken is a field qualifier of a group or operand, e.g. the `.ti,ab.` of `(a or b).ti,ab.` or the `TI` of
+	// `TI (a OR b)`.
+	FieldToken TokenKind = "field"
+	// ReferenceToken is a reference to a line of the query by a combining line, e.g. the `1` of `or/1-3`.
+	ReferenceToken TokenKind = "reference"
+	// UnparsedToken is text which could not be parsed, and was transformed by a fallback (e.g. reading the operators
+	// left to right) instead.
+	UnparsedToken TokenKind = "unparsed"
+)
+
+// TokenExplanation is how a token of a query was interpreted when the query was parsed.
+type TokenExplanation struct {
+	// Line is the line of the query the token is on, starting at 1.
+	Line int
+	// Token is the text of the token.
+	Token string
+	// Kind is how the token was interpreted.
+	Kind TokenKind
+	// Operator is the operator of the ir that an operator token was read as, e.g. "not" for `AND NOT`.
+	Operator string
+	// Fields are the fields of a keyword, or the fields set by a field qualifier.
+	Fields []string
+	// Keyword is the keyword that a keyword token was transformed into, with its resolved fields.
+	Keyword *ir.Keyword
+	// Default reports that a keyword was given the default fields of the field mapping, e.g. as neither the keyword
+	// nor any field qualifier set its fields, or as its field does not have a mapping.
+	Default bool
+}
+
+// explainDefaultField stands in for the default fields of a field mapping while a query is explained.
+const explainDefaultField = "default"
+
+// explainer records how a transformer interprets the tokens of a query. Nothing is recorded when explanations is nil.
+type explainer struct {
+	explanations *[]TokenExplanation
+}
+
+// explainingTransformer is a QueryTransformer that can record how it interprets the tokens of a query.
+type explainingTransformer interface {
+	withExplanations(explanations *[]TokenExplanation) QueryTransformer
+}
+
+// Explain parses a query in the same way as ParseString, but rather than returning the query, it describes how each
+// token of the query was interpreted: as an operator, a keyword (with its resolved fields), a grouping symbol, a field
+// qualifier, or a reference to another line. Keywords which were given the default fields are marked. A query that
+// cannot be lexed has no explanations.
+//
+// The tokens of a line are only explained token by token when the transformer of the parser can record them (e.g. the
+// PubMed, Medline, EBSCO, and Embase transformers); otherwise the whole line is explained as a single keyword.
+func (q QueryParser) Explain(raw string) []TokenExplanation {
+	ast, err := lexer.Lex(raw, q.lexOptions())
+	if err != nil {
+		return nil
+	}
+
+	// The transformer is given a placeholder for the default fields, so that the keywords which were given the default
+	// fields can be told apart from the keywords which were given the same fields by the query.
+	mapping := make(map[string][]string, len(q.FieldMapping))
+	for k, v := range q.FieldMapping {
+		mapping[k] = v
+	}
+	mapping["default"] = []string{explainDefaultField}
+	defaults := func(f []string) ([]string, bool) {
+		if len(f) == 0 || (len(f) == 1 && f[0] == explainDefaultField) {
+			return q.FieldMapping["default"], true
+		}
+		return f, false
+	}
+
+	var explanations, line []TokenExplanation
+	transformer := q.Parser
+	if e, ok := q.Parser.(explainingTransformer); ok {
+		transformer = e.withExplanations(&line)
+	}
+
+	// explainLine adds the tokens of a line of the query to the explanations, or the whole line when its tokens were
+	// not recorded by the transformer.
+	explainLine := func(node lexer.Node) {
+		line = line[:0]
+		var query ir.BooleanQuery
+		if (len(node.Children) == 0 && node.Reference == 1) || q.isNested(node.Value) {
+			query = transformer.TransformNested(node.Value, mapping)
+		} else {
+			query = ir.BooleanQuery{Keywords: []ir.Keyword{transformer.TransformSingle(node.Value, mapping)}}
+		}
+		if len(line) == 0 {
+			if isInfixKeyword(query) {
+				keyword := query.Keywords[0]
+				line = append(line, TokenExplanation{Token: node.Value, Kind: KeywordToken, Keyword: &keyword, Fields: keyword.Fields})
+			} else {
+				line = append(line, TokenExplanation{Token: node.Value, Kind: UnparsedToken})
+			}
+		}
+		for _, e := range line {
+			e.Line = node.Reference
+			switch e.Kind {
+			case KeywordToken:
+				keyword := *e.Keyword
+				keyword.Fields, e.Default = defaults(keyword.Fields)
+				e.Keyword, e.Fields = &keyword, keyword.Fields
+			case FieldToken:
+				e.Fields, _ = defaults(e.Fields)
+			}
+			explanations = append(explanations, e)
+		}
+	}
+
+	// explainCombining adds the tokens of a combining line to the explanations: its operator, followed by the lines it
+	// refers to. A group of the line in parenthesis, e.g. the `(2 or 3)` of `1 and (2 or 3)`, is explained on the line
+	// in the same way, between its parenthesis.
+	var explainCombining func(node lexer.Node, line int)
+	explainCombining = func(node lexer.Node, line int) {
+		explanations = append(explanations, TokenExplanation{Line: line, Token: node.Operator, Kind: OperatorToken, Operator: q.operator(node.Operator)})
+		for _, child := range node.Children {
+			if len(child.Operator) > 0 && child.Reference < 0 {
+				explanations = append(explanations, TokenExplanation{Line: line, Token: "(", Kind: GroupingToken})
+				explainCombining(child, line)
+				explanations = append(explanations, TokenExplanation{Line: line, Token: ")", Kind: GroupingToken})
+			} else if len(child.Operator) > 0 || child.Reference > 0 {
+				explanations = append(explanations, TokenExplanation{Line: line, Token: strconv.Itoa(child.Reference), Kind: ReferenceToken})
+			}
+		}
+	}
+
+	// A line is explained once, however many lines refer to it. The groups in parenthesis of a combining line do not
+	// have a line of their own, so their tokens are explained on the line of the group that encloses them.
+	seen := make(map[int]bool)
+	var visit func(node lexer.Node, line int)
+	visit = func(node lexer.Node, line int) {
+		if node.Reference > 0 {
+			if seen[node.Reference] {
+				return
+			}
+			seen[node.Reference] = true
+			line = node.Reference
+		}
+		if len(node.Operator) == 0 {
+			explainLine(node)
+			return
+		}
+		for _, child := range node.Children {
+			visit(child, line)
+		}
+		if node.Reference > 0 {
+			explainCombining(node, line)
+		}
+	}
+	visit(ast, ast.Reference)
+
+	// Lines are visited in the order they are referred to, so the explanations are put back into the order of the query.
+	sort.SliceStable(explanations, func(i, j int) bool {
+		return explanations[i].Line < explanations[j].Line
+	})
+	return explanations
+}
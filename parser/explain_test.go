@@ -0,0 +1,85 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hscells/transmute/fields"
+)
+
+func TestQueryParser_Explain(t *testing.T) {
+	type token struct {
+		Line     int
+		Token    string
+		Kind     TokenKind
+		Operator string
+		Fields   []string
+		Default  bool
+	}
+	explain := func(p QueryParser, query string) []token {
+		var tokens []token
+		for _, e := range p.Explain(query) {
+			tokens = append(tokens, token{e.Line, e.Token, e.Kind, e.Operator, e.Fields, e.Default})
+		}
+		return tokens
+	}
+
+	got := explain(NewMedlineParser(), "1. (asthma or wheez*).ti,ab.\n2. child*\n3. 1 and 2")
+	expected := []token{
+		{1, "(", GroupingToken, "", nil, false},
+		{1, "asthma", KeywordToken, "", []string{fields.TitleAbstract}, false},
+		{1, "or", OperatorToken, "or", nil, false},
+		{1, "wheez*", KeywordToken, "", []string{fields.TitleAbstract}, false},
+		{1, ")", GroupingToken, "", nil, false},
+		{1, ".ti,ab.", FieldToken, "", []string{fields.TitleAbstract}, false},
+		{2, "child*", KeywordToken, "", []string{fields.AllFields}, true},
+		{3, "and", OperatorToken, "and", nil, false},
+		{3, "1", ReferenceToken, "", nil, false},
+		{3, "2", ReferenceToken, "", nil, false},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Expected %v, got %v", expected, got)
+	}
+
+	got = explain(NewPubMedParser(), `heart attack[tiab] AND NOT animals[mh]`)
+	expected = []token{
+		{1, "heart attack[tiab]", KeywordToken, "", []string{fields.TitleAbstract}, false},
+		{1, "AND", OperatorToken, "not", nil, false},
+		{1, "NOT", OperatorToken, "not", nil, false},
+		{1, "animals[mh]", KeywordToken, "", []string{fields.MeshHeadings}, false},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Expected %v, got %v", expected, got)
+	}
+
+	got = explain(NewEbscoMedlineParser(), `TI (asthma OR wheeze)`)
+	expected = []token{
+		{1, "TI", FieldToken, "", []string{fields.Title}, false},
+		{1, "(", GroupingToken, "", nil, false},
+		{1, "asthma", KeywordToken, "", []string{fields.Title}, false},
+		{1, "OR", OperatorToken, "or", nil, false},
+		{1, "wheeze", KeywordToken, "", []string{fields.Title}, false},
+		{1, ")", GroupingToken, "", nil, false},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Expected %v, got %v", expected, got)
+	}
+
+	// A group in parenthesis of a combining line is explained on the line, rather than as a reference to another line.
+	got = explain(NewMedlineParser(), "1. asthma.ti.\n2. wheeze.ti.\n3. child.ti.\n4. 1 and (2 or 3)")
+	expected = []token{
+		{1, "asthma.ti.", KeywordToken, "", []string{fields.Title}, false},
+		{2, "wheeze.ti.", KeywordToken, "", []string{fields.Title}, false},
+		{3, "child.ti.", KeywordToken, "", []string{fields.Title}, false},
+		{4, "and", OperatorToken, "and", nil, false},
+		{4, "1", ReferenceToken, "", nil, false},
+		{4, "(", GroupingToken, "", nil, false},
+		{4, "or", OperatorToken, "or", nil, false},
+		{4, "2", ReferenceToken, "", nil, false},
+		{4, "3", ReferenceToken, "", nil, false},
+		{4, ")", GroupingToken, "", nil, false},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Expected %v, got %v", expected, got)
+	}
+}
@@ -0,0 +1,10 @@
+package parser
+
+import "github.com/hscells/transmute/ir"
+
+// init sets the parser of the filters applied with ir.BooleanQuery.ApplyFilter, which are written in PubMed syntax.
+func init() {
+	ir.FilterParser = func(filter string) (ir.BooleanQuery, error) {
+		return NewPubMedParser().ParseString(filter)
+	}
+}
@@ -0,0 +1,37 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/hscells/transmute/ir"
+)
+
+func TestBooleanQuery_ApplyFilter(t *testing.T) {
+	q, err := NewPubMedParser().ParseString(`asthma[tiab]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name := range ir.Filters {
+		f, err := q.ApplyFilter(name)
+		if err != nil {
+			t.Fatalf("Expected %v to be applied, got %v", name, err)
+		}
+		if f.Operator != "and" || len(f.Keywords) == 0 || f.Keywords[0].QueryString != "asthma" {
+			t.Fatalf("Expected asthma to be and'd with %v, got %v", name, f)
+		}
+	}
+
+	f, err := q.ApplyFilter("Therapy/Narrow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `((randomized[title_abstract] AND controlled[title_abstract] AND trial[title_abstract]) OR randomized controlled trial[publication_type]) AND asthma[title_abstract]`
+	if f.String() != expected {
+		t.Fatalf("Expected %v, got %v", expected, f.String())
+	}
+
+	if _, err := q.ApplyFilter("Therapy/Wide"); err == nil {
+		t.Fatalf("Expected an error for an unknown filter, got none")
+	}
+}
@@ -0,0 +1,337 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/hscells/transmute/ir"
+)
+
+// infixOperator is an operator recognised by an infixParser.
+type infixOperator struct {
+	// Operator is the operator used in the ir, e.g. "and" or "adj3".
+	Operator string
+	// Precedence determines how tightly the operator binds; higher binds tighter.
+	Precedence int
+	// Options are set on the group the operator creates.
+	Options map[string]interface{}
+}
+
+// infixParser is a recursive descent parser for infix queries made up of operands separated by operators, where
+// operands may be qualified by fields that come before or after them. It is used by the parsers for databases that
+// do not use the numbered lines of Ovid.
+//
+// The parsers all give `not` the same semantics: it excludes the operand after it from the operand before it, so
+// `a AND NOT b` is the same as `a NOT b`. A `not` without an operand before it, e.g. `NOT a OR b`, excludes the operand
+// after it from every document, and binds tighter than any other operator, so the query is `(NOT a) OR b`. How tightly
+// the operators bind otherwise depends on the database, e.g. `not` binds tighter than `and` in Ovid, so `a AND b NOT c`
+// is `a AND (b NOT c)`, whereas PubMed reads its operators left to right, so the query is `(a AND b) NOT c`.
+type infixParser struct {
+	tokens []string
+	pos    int
+
+	// operator determines if a token is an operator.
+	operator func(token string) (infixOperator, bool)
+	// keyword transforms the text of an operand into a keyword.
+	keyword func(text string) ir.Keyword
+	// prefix determines if a token qualifies the fields of the operand that follows it, e.g. `TI asthma` in EBSCO.
+	prefix func(token string) ([]string, bool)
+	// suffix determines if a token qualifies the fields of the group that precedes it, e.g. `(a OR b):ti` in Embase.
+	suffix func(token string) ([]string, bool)
+	// qualify sets the fields of the keywords in an operand. When it is not set, the fields are set on all keywords
+	// which do not already have fields.
+	qualify func(q ir.BooleanQuery, f []string) ir.BooleanQuery
+	// explain records how the tokens are interpreted, when it is set.
+	explain *[]TokenExplanation
+	// limit counts the keywords as they are created, so that parsing stops once there are too many of them.
+	limit termLimiter
+}
+
+// record adds the explanation of a token when the parser explains its tokens.
+func (p *infixParser) record(e TokenExplanation) {
+	if p.explain != nil {
+		*p.explain = append(*p.explain, e)
+	}
+}
+
+// explained is the number of tokens that have been explained.
+func (p *infixParser) explained() int {
+	if p.explain == nil {
+		return 0
+	}
+	return len(*p.explain)
+}
+
+// qualifyExplained sets the fields of the keywords explained since the start of an operand, in the same way as the
+// fields of the keywords of the operand are set.
+func (p *infixParser) qualifyExplained(start int, f []string) {
+	if p.explain == nil {
+		return
+	}
+	for i := start; i < len(*p.explain); i++ {
+		e := &(*p.explain)[i]
+		if e.Kind != KeywordToken || e.Keyword == nil {
+			continue
+		}
+		keyword := p.qualifyFields(ir.BooleanQuery{Keywords: []ir.Keyword{*e.Keyword}}, f).Keywords[0]
+		e.Keyword, e.Fields = &keyword, keyword.Fields
+	}
+}
+
+// tokeniseInfix splits a query into tokens. Parenthesis are always tokens on their own, and a quote at the start of a
+// token continues the token until the matching quote. A backslash escapes the next character, which is kept in the
+// token along with the backslash.
+func tokeniseInfix(query string, quotes string) []string {
+	var tokens []string
+	var token []rune
+	var quote rune
+	escaped := false
+	flush := func() {
+		if len(token) > 0 {
+			tokens = append(tokens, string(token))
+			token = nil
+		}
+	}
+	for _, char := range query {
+		switch {
+		case escaped || char == '\\':
+			escaped = !escaped
+			token = append(token, char)
+		case quote != 0:
+			token = append(token, char)
+			if char == quote {
+				quote = 0
+			}
+		case len(token) == 0 && strings.ContainsRune(quotes, char):
+			quote = char
+			token = append(token, char)
+		case char == '(' || char == ')':
+			flush()
+			tokens = append(tokens, string(char))
+		case unicode.IsSpace(char):
+			flush()
+		default:
+			token = append(token, char)
+		}
+	}
+	flush()
+	return tokens
+}
+
+// Parse parses the tokens into a query.
+func (p *infixParser) Parse() (ir.BooleanQuery, error) {
+	if len(p.tokens) == 0 {
+		return ir.BooleanQuery{}, errors.New("empty query")
+	}
+	start := p.explained()
+	var counted int
+	if p.limit.terms != nil {
+		counted = *p.limit.terms
+	}
+	q, err := p.parse(0)
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected `%v` in query", p.tokens[p.pos])
+	}
+	if err != nil {
+		// The query is transformed some other way when it cannot be parsed, so its tokens were not interpreted, and
+		// its keywords were not created unless there were too many of them.
+		if p.explain != nil {
+			*p.explain = (*p.explain)[:start]
+		}
+		if p.limit.terms != nil && !p.limit.termsExceeded() {
+			*p.limit.terms = counted
+		}
+		return ir.BooleanQuery{}, err
+	}
+	return q, nil
+}
+
+// parse parses an expression where every operator binds at least as tightly as minPrecedence. Operators of the same
+// precedence are left associative.
+func (p *infixParser) parse(minPrecedence int) (ir.BooleanQuery, error) {
+	lhs, err := p.parsePrimary()
+	if err != nil {
+		return ir.BooleanQuery{}, err
+	}
+	for p.pos < len(p.tokens) {
+		op, ok := p.operator(p.tokens[p.pos])
+		if !ok || op.Precedence < minPrecedence {
+			break
+		}
+		token := p.tokens[p.pos]
+		p.pos++
+		// `a AND NOT b` is the same as `a NOT b`.
+		if op.Operator == "and" && p.pos < len(p.tokens) {
+			if next, ok := p.operator(p.tokens[p.pos]); ok && next.Operator == "not" {
+				op = next
+				p.record(TokenExplanation{Token: token, Kind: OperatorToken, Operator: op.Operator})
+				token = p.tokens[p.pos]
+				p.pos++
+			}
+		}
+		p.record(TokenExplanation{Token: token, Kind: OperatorToken, Operator: op.Operator})
+		rhs, err := p.parse(op.Precedence + 1)
+		if err != nil {
+			return ir.BooleanQuery{}, err
+		}
+		lhs = combineInfix(op, lhs, rhs)
+	}
+	return lhs, nil
+}
+
+// parsePrimary parses a single operand: a parenthesised expression, or a keyword. Either may be qualified by fields.
+func (p *infixParser) parsePrimary() (ir.BooleanQuery, error) {
+	if p.pos >= len(p.tokens) {
+		return ir.BooleanQuery{}, errors.New("unexpected end of query")
+	}
+	token := p.tokens[p.pos]
+
+	if p.prefix != nil {
+		if f, ok := p.prefix(token); ok {
+			p.record(TokenExplanation{Token: token, Kind: FieldToken, Fields: f})
+			start := p.explained()
+			p.pos++
+			q, err := p.parsePrimary()
+			if err != nil {
+				return ir.BooleanQuery{}, err
+			}
+			p.qualifyExplained(start, f)
+			return p.qualifyFields(q, f), nil
+		}
+	}
+
+	if token == "(" {
+		start := p.explained()
+		p.record(TokenExplanation{Token: token, Kind: GroupingToken})
+		p.pos++
+		q, err := p.parse(0)
+		if err != nil {
+			return ir.BooleanQuery{}, err
+		}
+		if p.pos >= len(p.tokens) || p.tokens[p.pos] != ")" {
+			return ir.BooleanQuery{}, errors.New("unbalanced parenthesis in query")
+		}
+		p.record(TokenExplanation{Token: p.tokens[p.pos], Kind: GroupingToken})
+		p.pos++
+		if p.suffix != nil && p.pos < len(p.tokens) {
+			if f, ok := p.suffix(p.tokens[p.pos]); ok {
+				p.qualifyExplained(start, f)
+				p.record(TokenExplanation{Token: p.tokens[p.pos], Kind: FieldToken, Fields: f})
+				p.pos++
+				q = p.qualifyFields(q, f)
+			}
+		}
+		return q, nil
+	}
+
+	if token == ")" {
+		return ir.BooleanQuery{}, errors.New("unbalanced parenthesis in query")
+	}
+	if op, ok := p.operator(token); ok {
+		if op.Operator != "not" {
+			return ir.BooleanQuery{}, fmt.Errorf("operator `%v` is missing an operand", op.Operator)
+		}
+		// A `not` without an operand before it excludes the operand after it from every document, and binds tighter
+		// than any other operator.
+		p.record(TokenExplanation{Token: token, Kind: OperatorToken, Operator: op.Operator})
+		p.pos++
+		operand, err := p.parsePrimary()
+		if err != nil {
+			return ir.BooleanQuery{}, err
+		}
+		q := ir.BooleanQuery{Operator: op.Operator, Options: op.Options}
+		if isInfixKeyword(operand) {
+			q.Keywords = operand.Keywords
+		} else {
+			q.Children = []ir.BooleanQuery{operand}
+		}
+		return q, nil
+	}
+
+	// Consecutive terms that are not separated by an operator are a single keyword.
+	var terms []string
+	for p.pos < len(p.tokens) {
+		token := p.tokens[p.pos]
+		if token == "(" || token == ")" {
+			break
+		}
+		if _, ok := p.operator(token); ok {
+			break
+		}
+		if p.prefix != nil {
+			if _, ok := p.prefix(token); ok && len(terms) > 0 {
+				break
+			}
+		}
+		terms = append(terms, token)
+		p.pos++
+	}
+	if err := p.limit.addTerm(); err != nil {
+		return ir.BooleanQuery{}, err
+	}
+	text := strings.Join(terms, " ")
+	keyword := p.keyword(text)
+	p.record(TokenExplanation{Token: text, Kind: KeywordToken, Fields: keyword.Fields, Keyword: &keyword})
+	return ir.BooleanQuery{Keywords: []ir.Keyword{keyword}}, nil
+}
+
+// qualifyFields sets the fields of the keywords in an operand.
+func (p *infixParser) qualifyFields(q ir.BooleanQuery, f []string) ir.BooleanQuery {
+	if p.qualify != nil {
+		return p.qualify(q, f)
+	}
+	return qualifyInfix(q, f)
+}
+
+// qualifyInfix sets the fields of all keywords in a query which do not already have fields.
+func qualifyInfix(q ir.BooleanQuery, f []string) ir.BooleanQuery {
+	for i, keyword := range q.Keywords {
+		if len(keyword.Fields) == 0 {
+			q.Keywords[i].Fields = f
+		}
+	}
+	for i, child := range q.Children {
+		q.Children[i] = qualifyInfix(child, f)
+	}
+	return q
+}
+
+// isInfixKeyword determines if a query is a single keyword without an operator.
+func isInfixKeyword(q ir.BooleanQuery) bool {
+	return len(q.Operator) == 0 && len(q.Keywords) == 1 && len(q.Children) == 0
+}
+
+// isUnaryNot determines if a query is a `not` group of a single operand, which excludes the operand from every
+// document.
+func isUnaryNot(q ir.BooleanQuery) bool {
+	return strings.ToLower(q.Operator) == "not" && len(q.Keywords)+len(q.Children) == 1
+}
+
+// combineInfix joins two operands with an operator. Chains of the same operator are flattened into a single group, so
+// `a OR b OR c` becomes one group of three keywords. Only "and" and "or" are associative, so only these flatten the
+// right-hand operand. A "not" group of a single operand is never flattened, since it excludes its operand from every
+// document rather than from the operand before it.
+func combineInfix(op infixOperator, lhs, rhs ir.BooleanQuery) ir.BooleanQuery {
+	q := ir.BooleanQuery{Operator: op.Operator, Options: op.Options}
+	add := func(operand ir.BooleanQuery, flatten bool) {
+		if isInfixKeyword(operand) {
+			q.Keywords = append(q.Keywords, operand.Keywords...)
+		} else if flatten && operand.Operator == op.Operator && len(operand.Options) == 0 && len(op.Options) == 0 &&
+			!isUnaryNot(operand) {
+			q.Keywords = append(q.Keywords, operand.Keywords...)
+			q.Children = append(q.Children, operand.Children...)
+		} else {
+			q.Children = append(q.Children, operand)
+		}
+	}
+	add(lhs, true)
+	// The first operand of a "not" group is the one the others are excluded from, and the children of a group come
+	// before its keywords, so the left-hand operand is kept as a child when the right-hand operand is a group.
+	if op.Operator == "not" && len(q.Children) == 0 && !isInfixKeyword(rhs) {
+		q = ir.BooleanQuery{Operator: op.Operator, Options: op.Options, Children: []ir.BooleanQuery{lhs}}
+	}
+	add(rhs, op.Operator == "and" || op.Operator == "or")
+	return q
+}
@@ -0,0 +1,84 @@
+package parser
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hscells/transmute/ir"
+)
+
+// maxManyLine is the longest line ParseMany reads, since a query written on a single line may be much longer than the
+// lines bufio.Scanner reads by default.
+const maxManyLine = 16 * 1024 * 1024
+
+// BlockError is an error from parsing a single query in a file containing many queries.
+type BlockError struct {
+	// Block is the index of the query in the file, starting at zero.
+	Block int
+	Err   error
+}
+
+func (e BlockError) Error() string {
+	return fmt.Sprintf("query %d: %v", e.Block, e.Err)
+}
+
+// BlockErrors are the errors from parsing each of the queries in a file containing many queries.
+type BlockErrors []BlockError
+
+func (e BlockErrors) Error() string {
+	s := make([]string, len(e))
+	for i, err := range e {
+		s[i] = err.Error()
+	}
+	return strings.Join(s, "\n")
+}
+
+// ParseMany reads a file containing many independent queries, and parses each of them with ParseString, so that each
+// query is lexed with the LexOptions of the parser. Queries are separated by a line containing only the delimiter, or
+// by blank lines if the delimiter is empty. A query is returned for each block in the file, in order. If any of the
+// queries could not be parsed, the query for that block is empty and the error returned is a BlockErrors containing
+// the error for each of these blocks.
+func (q QueryParser) ParseMany(reader io.Reader, delimiter string) ([]ir.BooleanQuery, error) {
+	var blocks []string
+	var block []string
+	flush := func() {
+		if len(block) > 0 {
+			blocks = append(blocks, strings.Join(block, "\n"))
+			block = nil
+		}
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxManyLine)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if (len(delimiter) == 0 && len(strings.TrimSpace(line)) == 0) ||
+			(len(delimiter) > 0 && strings.TrimSpace(line) == delimiter) {
+			flush()
+			continue
+		}
+		if len(strings.TrimSpace(line)) > 0 {
+			block = append(block, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+
+	queries := make([]ir.BooleanQuery, len(blocks))
+	var errs BlockErrors
+	for i, b := range blocks {
+		var err error
+		queries[i], err = q.ParseString(b)
+		if err != nil {
+			errs = append(errs, BlockError{Block: i, Err: err})
+		}
+	}
+	if len(errs) > 0 {
+		return queries, errs
+	}
+	return queries, nil
+}
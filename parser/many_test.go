@@ -0,0 +1,48 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMany(t *testing.T) {
+	file := `1. MMSE*.ti,ab.
+2. sMMSE.ti,ab.
+3. or/1-2
+
+1. exp Sleep Apnea Syndromes/
+2. OSA.mp.
+3. (1 or 2
+
+1. Folstein*.ti,ab.
+2. MiniMental.ti,ab.
+3. \"mini mental stat*\".ti,ab.
+4. or/1-3
+`
+	queries, err := NewMedlineParser().ParseMany(strings.NewReader(file), "")
+	if len(queries) != 3 {
+		t.Fatalf("Expected %v queries, got %v", 3, len(queries))
+	}
+	errs, ok := err.(BlockErrors)
+	if !ok || len(errs) != 1 || errs[0].Block != 1 {
+		t.Fatalf("Expected an error for the second query, got %v", err)
+	}
+	if len(queries[0].Terms()) != 2 || len(queries[2].Terms()) != 3 {
+		t.Fatalf("Expected 2 and 3 terms, got %v and %v", len(queries[0].Terms()), len(queries[2].Terms()))
+	}
+
+	queries, err = NewMedlineParser().ParseMany(strings.NewReader(strings.Replace(file, "\n\n", "\n----\n", -1)), "----")
+	if len(queries) != 3 || err == nil {
+		t.Fatalf("Expected %v queries and an error, got %v and %v", 3, len(queries), err)
+	}
+
+	// Each query is lexed with the options of the parser, and a query may be longer than the lines read by default.
+	long := "(asthma[tiab] OR " + strings.Repeat("wheeze", 20000) + "[tiab])"
+	queries, err = NewPubMedParser().ParseMany(strings.NewReader("(child[tiab] OR infant[tiab])\n\n"+long), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queries) != 2 || len(queries[0].Terms()) != 2 || len(queries[1].Terms()) != 2 {
+		t.Fatalf("Expected 2 queries of 2 terms, got %v", queries)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"github.com/hscells/transmute/fields"
 	"github.com/hscells/transmute/ir"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"unicode"
 	"unicode/utf8"
@@ -28,7 +30,9 @@ var MedlineFieldMapping = map[string][]string{
 	"fe":       {fields.Editor},
 	"fs":       {fields.FloatingMeshHeadings},
 	"fx":       {fields.FloatingMeshHeadings},
-	"kf":       {fields.AllFields},
+	"hw":       {fields.HeadingWord},
+	"kf":       {fields.Keywords},
+	"kw":       {fields.Keywords},
 	"ot":       {fields.Title},
 	"mp":       {fields.AllFields},
 	"mh":       {fields.MeshHeadings},
@@ -41,23 +45,93 @@ var MedlineFieldMapping = map[string][]string{
 	"sh":       {fields.MeSHSubheading},
 	"tw":       {fields.TextWord},
 	"ti":       {fields.Title},
+	"ui":       {fields.PMID},
+	"xs":       {fields.MeSHSubheading},
 	"ja":       {fields.Journal},
 	"jn":       {fields.Journal},
 	"jw":       {fields.Journal},
 	"pmid":     {fields.PMID},
 	"ti,ab":    {fields.TitleAbstract},
 	"ti,ab,sh": {fields.AllFields},
+	"ti,ab,kw": {fields.TitleAbstract, fields.Keywords},
 	"default":  {fields.AllFields},
 }
 
-var adjMatchRegexp, _ = regexp.Compile("^adj[0-9]*$")
+// defaultAdjacencyRegexp recognises the adjacency operators of the ir, e.g. `adj`, `adj3`, or `adj10`.
+var defaultAdjacencyRegexp, _ = regexp.Compile("^adj[0-9]*$")
 var medlineFieldRegexp, _ = regexp.Compile(".[a-z]{2}.")
 
+// medlineFrequencyRegexp matches the minimum frequency which follows the fields of a line, e.g. the `/freq=3` of
+// `asthma.ab./freq=3`.
+var medlineFrequencyRegexp, _ = regexp.Compile(`(?i)\s*/freq=([0-9]+)$`)
+
+// medlineExplodeRegexp matches an exploded MeSH heading without its slash, e.g. `exp Asthma` or
+// `exp "Respiratory Tract Infections"`.
+var medlineExplodeRegexp, _ = regexp.Compile(`(?i)^exp\s+(.+)$`)
+
+// medlineSuffixRegexp matches the fields which follow a group, e.g. the `.ti,ab.` of `(asthma or wheeze).ti,ab.`. The
+// field codes may be in upper case, and the closing period may be left out.
+var medlineSuffixRegexp, _ = regexp.Compile(`(?i)^\.([a-z]+(?:,[a-z]+)*)\.?$`)
+
 // MedlineTransformer is an implementation of a QueryTransformer in the parser package.
-type MedlineTransformer struct{}
+type MedlineTransformer struct {
+	// DropEmptyKeywords skips keywords in nested queries whose query string is empty or made up only of stop words.
+	DropEmptyKeywords bool
+	// StopWords is the set of stop words used by DropEmptyKeywords. When nil, DefaultStopWords is used.
+	StopWords map[string]bool
+	// Operators maps localised operators in lower case (e.g. FrenchOperators) to the operators of the ir. The English
+	// operators are always recognised.
+	Operators map[string]string
+	// AdjacencyOperator recognises proximity operators other than `adj`, e.g. `(?i)^near/[0-9]+$`. They are adjacency
+	// operators in the ir, with the distance that follows them, e.g. `NEAR/3` is `adj3`, so that every backend
+	// recognises them. When nil, only `adj` is an adjacency operator.
+	AdjacencyOperator *regexp.Regexp
+
+	warner
+	explainer
+	termLimiter
+}
+
+// withWarnings returns a copy of the transformer which collects its warnings.
+func (p MedlineTransformer) withWarnings(warnings *[]ir.Warning) QueryTransformer {
+	p.warner = warner{warnings: warnings}
+	return p
+}
+
+// localisedOperators returns the localised operators of the transformer.
+func (p MedlineTransformer) localisedOperators() map[string]string {
+	return p.Operators
+}
+
+// adjacencyOperator returns the proximity operators of the transformer.
+func (p MedlineTransformer) adjacencyOperator() *regexp.Regexp {
+	return p.AdjacencyOperator
+}
+
+// operator maps a localised or proximity operator to the operator of the ir. Any other token is returned unchanged.
+func (p MedlineTransformer) operator(token string) string {
+	return canonicalAdjacency(canonicalOperator(token, p.Operators), p.AdjacencyOperator)
+}
 
-// TransformFields maps a string of fields into a slice of mapped fields.
+// withExplanations returns a copy of the transformer which records how it interprets the tokens of a query.
+func (p MedlineTransformer) withExplanations(explanations *[]TokenExplanation) QueryTransformer {
+	p.explainer = explainer{explanations: explanations}
+	return p
+}
+
+// withTermLimit returns a copy of the transformer which counts the keywords it creates against a limit.
+func (p MedlineTransformer) withTermLimit(limit termLimiter) QueryTransformer {
+	p.termLimiter = limit
+	return p
+}
+
+// TransformFields maps a string of fields into a slice of mapped fields. Field codes which are not in the mapping are
+// looked up in lower case, so `TI,AB` is mapped the same as `ti,ab`.
 func (p MedlineTransformer) TransformFields(fields string, mapping map[string][]string) []string {
+	fields = strings.TrimSpace(fields)
+	if _, ok := mapping[fields]; !ok {
+		fields = strings.ToLower(fields)
+	}
 	//parts := strings.Split(fields, ",")
 	//var mappedFields []string
 	//for _, field := range parts {
@@ -66,11 +140,32 @@ func (p MedlineTransformer) TransformFields(fields string, mapping map[string][]
 	//sort.Strings(mappedFields)
 	if field, ok := mapping[fields]; ok {
 		return field
+	} else if field, ok := mapping[reorderFields(fields, mapping)]; ok {
+		return field
 	} else {
+		p.warn(nil, "the field `%v` does not have a mapping defined, using the default fields", fields)
 		return mapping["default"]
 	}
 }
 
+// reorderFields finds the key of the mapping which contains the same field codes as a combined field code listed in
+// another order, e.g. `ti,ab` for `ab,ti`. An empty string is returned if there is no such key.
+func reorderFields(fields string, mapping map[string][]string) string {
+	codes := strings.Split(fields, ",")
+	sort.Strings(codes)
+	for key := range mapping {
+		keyCodes := strings.Split(key, ",")
+		if len(keyCodes) != len(codes) {
+			continue
+		}
+		sort.Strings(keyCodes)
+		if strings.Join(keyCodes, ",") == strings.Join(codes, ",") {
+			return key
+		}
+	}
+	return ""
+}
+
 func reverse(s string) string {
 	runes := []rune(s)
 	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
@@ -81,37 +176,89 @@ func reverse(s string) string {
 
 // TransformNested implements the transformation of a nested query.
 func (p MedlineTransformer) TransformNested(query string, mapping map[string][]string) ir.BooleanQuery {
-	var fieldsString string
-	for i := len(query) - 1; i > 0; i-- {
-		if query[i] == ')' {
-			break
+	// A query made up of a single line, e.g. `exp Asthma/`, is not nested at all.
+	if !strings.ContainsRune(query, '(') {
+		nested := false
+		for _, token := range tokeniseInfix(query, `"`) {
+			if p.IsOperator(strings.ToLower(token)) {
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			return ir.BooleanQuery{Keywords: []ir.Keyword{p.TransformSingle(query, mapping)}}
 		}
-		fieldsString += string(query[i])
 	}
-	fieldsString = reverse(fieldsString)
-
-	fieldsString = ReversePreservingCombiningCharacters(fieldsString)
-	query = strings.Replace(query, fieldsString, "", 1)
-
-	//var queryFields []string
-	//fieldsString = strings.Replace(fieldsString, ".", "", -1)
-	//for _, field := range strings.Split(fieldsString, ",") {
-	//	queryFields = append(queryFields, mapping[field]...)
-	//}
 
-	// Add a default field to the keyword if none have been defined
-	//if len(queryFields) == 0 {
-	//	queryFields = mapping["default"]
-	//}
+	q, err := p.parseNested(query, mapping)
+	if err != nil {
+		if p.termsExceeded() {
+			// The query has too many keywords to be transformed some other way.
+			return ir.BooleanQuery{}
+		}
+		p.warn(nil, "unable to parse `%v` (%v), falling back to the default fields", query, err)
+		return p.ParseInfixKeywords(query, mapping["default"], mapping)
+	}
+	return q
+}
 
-	var queryFields []string
-	if field, ok := mapping[fieldsString]; ok {
-		queryFields = field
-	} else {
-		queryFields = mapping["default"]
+// parseNested parses a nested query where fields may follow any group or term, e.g. `((a or b).ti,ab. and c).mp.`.
+// The fields that follow a group are set on the keywords of the group which do not already have fields, so fields on
+// an inner group take precedence over the fields of the groups that enclose it. Keywords which still do not have fields
+// are given the default fields of the mapping.
+func (p MedlineTransformer) parseNested(query string, mapping map[string][]string) (ir.BooleanQuery, error) {
+	ip := infixParser{
+		tokens: tokeniseInfix(query, `"`),
+		operator: func(token string) (infixOperator, bool) {
+			token = p.operator(strings.ToLower(token))
+			if !p.IsOperator(token) {
+				return infixOperator{}, false
+			}
+			switch token {
+			case "or":
+				return infixOperator{Operator: token, Precedence: 0}, true
+			case "and":
+				return infixOperator{Operator: token, Precedence: 1}, true
+			case "not":
+				return infixOperator{Operator: token, Precedence: 2}, true
+			}
+			return infixOperator{Operator: token, Precedence: 3}, true
+		},
+		keyword: func(text string) ir.Keyword {
+			return p.TransformSingle(text, mapping)
+		},
+		suffix: func(token string) ([]string, bool) {
+			if m := medlineSuffixRegexp.FindStringSubmatch(token); len(m) == 2 {
+				return p.TransformFields(m[1], mapping), true
+			}
+			return nil, false
+		},
+		explain: p.explanations,
+		limit:   p.termLimiter,
 	}
+	q, err := ip.Parse()
+	if err != nil {
+		return ir.BooleanQuery{}, err
+	}
+	q = p.dropKeywords(qualifyInfix(q, mapping["default"]))
+	if len(q.Operator) == 0 {
+		return q, nil
+	}
+	// Like ParseInfixKeywords, the query is wrapped in a group without an operator.
+	return ir.BooleanQuery{Children: []ir.BooleanQuery{q}}, nil
+}
 
-	return p.ParseInfixKeywords(query, queryFields, mapping)
+// dropKeywords removes the keywords from a query which have an empty query string, or which are made up only of stop
+// words when DropEmptyKeywords is set (see dropKeywords).
+func (p MedlineTransformer) dropKeywords(q ir.BooleanQuery) ir.BooleanQuery {
+	return dropKeywords(q, func(k ir.Keyword) bool {
+		if len(k.QueryString) > 0 && !(p.DropEmptyKeywords && isEmptyKeyword(k, p.StopWords)) {
+			return true
+		} else if len(k.QueryString) > 0 {
+			p.warn(&k, "dropped a keyword made up only of stop words")
+		}
+		return false
+	})
 }
 
 // TransformSingle implements the transformation of a single, stand-alone query. This is called from TransformNested
@@ -124,16 +271,28 @@ func (p MedlineTransformer) TransformSingle(query string, mapping map[string][]s
 	// Trim the query string to prevent whitespace such as newlines interfering with string processing.
 	query = strings.TrimSpace(query)
 
+	// The minimum frequency of a keyword follows its fields, e.g. `asthma.ab./freq=3`.
+	var options map[string]interface{}
+	if m := medlineFrequencyRegexp.FindStringSubmatch(query); len(m) == 2 {
+		frequency, _ := strconv.Atoi(m[1])
+		options = map[string]interface{}{ir.FrequencyOption: frequency}
+		query = query[:len(query)-len(m[0])]
+	}
+
 	if len(query) > 0 && query[len(query)-1] == '/' {
 		// Check to see if we are looking at a mesh heading string.
-		expParts := strings.Split(query, " ")
-		if expParts[0] == "exp" {
-			queryString = strings.Join(expParts[1:], " ")
+		queryString = strings.TrimSpace(query[:len(query)-1])
+		if m := medlineExplodeRegexp.FindStringSubmatch(queryString); len(m) == 2 {
+			queryString = m[1]
 			exploded = true
+		}
+		// A heading may be quoted, e.g. `exp "Respiratory Tract Infections"/`, in which case the quotes (and any
+		// spaces or slashes inside them) belong to the heading rather than the query.
+		if len(queryString) >= 2 && queryString[0] == '"' && queryString[len(queryString)-1] == '"' {
+			queryString = queryString[1 : len(queryString)-1]
 		} else {
-			queryString = query
+			queryString = strings.Replace(queryString, "/", "", -1)
 		}
-		queryString = strings.Replace(queryString, "/", "", -1)
 		queryFields = mapping["mh"]
 	} else {
 		// Otherwise try to parse a regular looking query.
@@ -141,6 +300,8 @@ func (p MedlineTransformer) TransformSingle(query string, mapping map[string][]s
 		if len(parts) > 1 {
 			queryString = strings.Join(parts[0:len(parts)-2], ".")
 			queryFields = p.TransformFields(parts[len(parts)-2], mapping)
+			// An exploded subheading, e.g. `th.xs.`, also searches the narrower subheadings.
+			exploded = strings.ToLower(parts[len(parts)-2]) == "xs"
 		} else {
 			queryString = query
 		}
@@ -161,6 +322,7 @@ func (p MedlineTransformer) TransformSingle(query string, mapping map[string][]s
 		Fields:      queryFields,
 		Exploded:    exploded,
 		Truncated:   truncated,
+		Options:     options,
 	}
 }
 
@@ -173,7 +335,7 @@ func (p MedlineTransformer) TransformPrefixGroupToQueryGroup(prefix []string, qu
 
 	token := prefix[0]
 	if p.IsOperator(token) {
-		queryGroup.Operator = token
+		queryGroup.Operator = p.operator(token)
 	} else if token == "(" {
 		var subGroup ir.BooleanQuery
 		prefix, subGroup = p.TransformPrefixGroupToQueryGroup(prefix[1:], ir.BooleanQuery{}, fields, mapping)
@@ -224,7 +386,7 @@ func (p MedlineTransformer) TransformPrefixGroupToQueryGroup(prefix []string, qu
 			//	log.Printf("no inner or outer fields are defined for nested query `%v`, using default (%v)", token, mapping["default"])
 			//	k.Fields = mapping["default"]
 			//}
-			if len(k.QueryString) > 0 {
+			if len(k.QueryString) > 0 && !(p.DropEmptyKeywords && isEmptyKeyword(k, p.StopWords)) {
 				queryGroup.Keywords = append(queryGroup.Keywords, k)
 			}
 		}
@@ -341,7 +503,7 @@ func (p MedlineTransformer) ParseInfixKeywords(line string, fields []string, map
 			if p.IsOperator(t) {
 				keyword = previousToken
 				stack = append(stack, strings.TrimSpace(keyword))
-				stack = append(stack, strings.TrimSpace(t))
+				stack = append(stack, p.operator(strings.TrimSpace(t)))
 				previousToken = ""
 				keyword = ""
 			} else {
@@ -417,10 +579,11 @@ func ReversePreservingCombiningCharacters(s string) string {
 
 // IsOperator tests to see if a string is a valid PubMed/Medline operator.
 func (p MedlineTransformer) IsOperator(s string) bool {
+	s = p.operator(s)
 	return s == "or" ||
 		s == "and" ||
 		s == "not" ||
-		adjMatchRegexp.MatchString(s)
+		defaultAdjacencyRegexp.MatchString(s)
 }
 
 func NewMedlineParser() QueryParser {
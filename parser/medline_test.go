@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"github.com/hscells/transmute/fields"
 	"github.com/hscells/transmute/lexer"
 	"testing"
 )
@@ -21,7 +22,7 @@ func TestBooleanQuery_Terms(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	queryRep := NewMedlineParser().Parse(ast)
+	queryRep, err := NewMedlineParser().Parse(ast)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -38,7 +39,7 @@ func TestBooleanQuery_Fields(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	queryRep := NewMedlineParser().Parse(ast)
+	queryRep, err := NewMedlineParser().Parse(ast)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -55,7 +56,7 @@ func TestBooleanQuery_FieldCount(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	queryRep := NewMedlineParser().Parse(ast)
+	queryRep, err := NewMedlineParser().Parse(ast)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -66,3 +67,215 @@ func TestBooleanQuery_FieldCount(t *testing.T) {
 		t.Fatalf("Expected %v fields, got %v", expected, got)
 	}
 }
+
+func TestMedline_KeywordFields(t *testing.T) {
+	m := MedlineTransformer{}
+
+	k := m.TransformSingle("asthma.kw.", MedlineFieldMapping)
+	if len(k.Fields) != 1 || k.Fields[0] != fields.Keywords {
+		t.Fatalf("Expected fields %v, got %v", []string{fields.Keywords}, k.Fields)
+	}
+
+	k = m.TransformSingle("asthma.ti,ab,kw.", MedlineFieldMapping)
+	if len(k.Fields) != 2 || k.Fields[0] != fields.TitleAbstract || k.Fields[1] != fields.Keywords {
+		t.Fatalf("Expected fields %v, got %v", []string{fields.TitleAbstract, fields.Keywords}, k.Fields)
+	}
+}
+
+func TestMedline_OvidFieldCodes(t *testing.T) {
+	ast, err := lexer.Lex("1. asthma.hw.\n2. drug therapy.xs.\n3. 12345678.ui.\n4. or/1-3", lexOptionsMedline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := NewMedlineParser().Parse(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keywords := q.Keywords
+	if len(keywords) != 3 {
+		t.Fatalf("Expected %v keywords, got %v", 3, len(keywords))
+	}
+	expected := map[string]string{
+		"asthma":       fields.HeadingWord,
+		"drug therapy": fields.MeSHSubheading,
+		"12345678":     fields.PMID,
+	}
+	for _, keyword := range keywords {
+		if len(keyword.Fields) != 1 || keyword.Fields[0] != expected[keyword.QueryString] {
+			t.Fatalf("Expected fields %v for %v, got %v", expected[keyword.QueryString], keyword.QueryString, keyword.Fields)
+		}
+		if keyword.Exploded != (keyword.QueryString == "drug therapy") {
+			t.Fatalf("Expected only the subheading to be exploded, got %v", keywords)
+		}
+	}
+}
+
+func TestMedline_DropEmptyKeywords(t *testing.T) {
+	query := `(the or asthma or wheeze).ti,ab.`
+
+	q := MedlineTransformer{}.TransformNested(query, MedlineFieldMapping)
+	if got := len(q.Terms()); got != 3 {
+		t.Fatalf("Expected %v terms, got %v", 3, got)
+	}
+
+	q = MedlineTransformer{DropEmptyKeywords: true}.TransformNested(query, MedlineFieldMapping)
+	if terms := q.Terms(); len(terms) != 2 || terms[0] != "asthma" {
+		t.Fatalf("Expected terms %v, got %v", []string{"asthma", "wheeze"}, terms)
+	}
+
+	q = MedlineTransformer{DropEmptyKeywords: true, StopWords: map[string]bool{"wheeze": true}}.TransformNested(query, MedlineFieldMapping)
+	if terms := q.Terms(); len(terms) != 2 || terms[0] != "the" {
+		t.Fatalf("Expected terms %v, got %v", []string{"the", "asthma"}, terms)
+	}
+
+	// A group left with a single operand is replaced by the operand.
+	p := QueryParser{FieldMapping: MedlineFieldMapping, Parser: MedlineTransformer{DropEmptyKeywords: true}}
+	q, err := p.ParseString("1. ((the or asthma) and child).ti,ab.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := q.String(); s != "asthma[title_abstract] AND child[title_abstract]" {
+		t.Fatalf("Unexpected query %v", s)
+	}
+}
+
+func TestMedline_DanglingOperator(t *testing.T) {
+	for _, operator := range []string{"and", "or", "not"} {
+		for _, query := range []string{"1. asthma " + operator, "1. (asthma " + operator + ").ti,ab."} {
+			ast, err := lexer.Lex(query, lexer.LexOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := NewMedlineParser().Parse(ast); err == nil {
+				t.Fatalf("Expected an error for dangling operator in %v", query)
+			}
+		}
+	}
+
+	ast, err := lexer.Lex("1. asthma.ti,ab.\n2. wheeze.ti,ab.\n3. 1 or 2", lexer.LexOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewMedlineParser().Parse(ast); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMedline_QuotedOperators(t *testing.T) {
+	queries := map[string][]string{
+		`1. ("heart and lung" or asthma).ti,ab.`:    {`"heart and lung"`, "asthma"},
+		`1. "heart and lung".ti,ab.`:                {`"heart and lung"`},
+		`1. ("not otherwise specified" OR nos).ti.`: {`"not otherwise specified"`, "nos"},
+	}
+	for query, expected := range queries {
+		ast, err := lexer.Lex(query, lexer.LexOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		q, err := NewMedlineParser().Parse(ast)
+		if err != nil {
+			t.Fatal(err)
+		}
+		terms := q.Terms()
+		if len(terms) != len(expected) {
+			t.Fatalf("Expected terms %v, got %v", expected, terms)
+		}
+		for i := range expected {
+			if terms[i] != expected[i] {
+				t.Fatalf("Expected terms %v, got %v", expected, terms)
+			}
+		}
+	}
+
+	// Unquoted operators are operators regardless of their case.
+	q := MedlineTransformer{}.TransformNested(`(heart AND lung).ti,ab.`, MedlineFieldMapping)
+	if len(q.Children) != 1 || q.Children[0].Operator != "and" || len(q.Children[0].Keywords) != 2 {
+		t.Fatalf("Expected an and group of two keywords, got %v", q)
+	}
+}
+
+func TestMedline_NestedFields(t *testing.T) {
+	queries := map[string]string{
+		`((a or b).ti,ab. and c).mp.`:     "(a[title_abstract] OR b[title_abstract]) AND c[all_fields]",
+		`((a or b).ti,ab. and c).ti,ab.`:  "(a[title_abstract] OR b[title_abstract]) AND c[title_abstract]",
+		`((a or b).ti. and (c or d).ab.)`: "(a[title] OR b[title]) AND (c[text] OR d[text])",
+		`((a or b) and c.ti.).ab.`:        "(a[text] OR b[text]) AND c[title]",
+		`(a or b)`:                        "a[all_fields] OR b[all_fields]",
+	}
+	for query, expected := range queries {
+		if s := (MedlineTransformer{}).TransformNested(query, MedlineFieldMapping).String(); s != expected {
+			t.Fatalf("Expected %v for %v, got %v", expected, query, s)
+		}
+	}
+}
+
+func TestMedline_GroupFields(t *testing.T) {
+	// The fields of a group are distributed to every keyword in the group which does not have its own fields.
+	queries := map[string]string{
+		`(asthma or wheez* or "heart attack").ti,ab.`: `asthma[title_abstract] OR wheez*[title_abstract] OR "heart attack"[title_abstract]`,
+		`(asthma or wheeze.ti. or cough).ti,ab.`:      "asthma[title_abstract] OR wheeze[title] OR cough[title_abstract]",
+		`(asthma or wheeze).TI,AB.`:                   "asthma[title_abstract] OR wheeze[title_abstract]",
+		`(asthma or wheeze).ti,ab`:                    "asthma[title_abstract] OR wheeze[title_abstract]",
+		`(asthma or wheeze) .ab,ti.`:                  "asthma[title_abstract] OR wheeze[title_abstract]",
+	}
+	for query, expected := range queries {
+		q, err := NewMedlineParser().ParseString("1. " + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if q.String() != expected {
+			t.Fatalf("Expected %v for %v, got %v", expected, query, q.String())
+		}
+	}
+}
+
+func TestMedline_ReorderedFields(t *testing.T) {
+	for _, query := range []string{`asthma.ti,ab.`, `asthma.ab,ti.`} {
+		k := MedlineTransformer{}.TransformSingle(query, MedlineFieldMapping)
+		if len(k.Fields) != 1 || k.Fields[0] != fields.TitleAbstract {
+			t.Fatalf("Expected [%v] for %v, got %v", fields.TitleAbstract, query, k.Fields)
+		}
+	}
+}
+
+func TestMedline_QuotedHeadings(t *testing.T) {
+	queries := map[string]struct {
+		heading  string
+		exploded bool
+	}{
+		`exp "Respiratory Tract Infections"/`: {"Respiratory Tract Infections", true},
+		`EXP Respiratory Tract Infections/`:   {"Respiratory Tract Infections", true},
+		`"Respiratory Tract Infections"/`:     {"Respiratory Tract Infections", false},
+		`"HIV/AIDS"/`:                         {"HIV/AIDS", false},
+		`exp Asthma/`:                         {"Asthma", true},
+	}
+	for query, expected := range queries {
+		k := MedlineTransformer{}.TransformSingle(query, MedlineFieldMapping)
+		if k.QueryString != expected.heading || k.Exploded != expected.exploded || k.Fields[0] != fields.MeshHeadings {
+			t.Fatalf("Expected %v (exploded %v) for %v, got %v", expected.heading, expected.exploded, query, k)
+		}
+	}
+}
+
+func TestMedline_NotCombiningLine(t *testing.T) {
+	lines := "1. a.ti.\n2. b.ti.\n3. c.ti.\n4. "
+
+	q, err := NewMedlineParser().ParseString(lines + "(1 or 2) not 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Operator != "not" || len(q.Children) != 1 || q.Children[0].Operator != "or" || len(q.Children[0].Keywords) != 2 ||
+		len(q.Keywords) != 1 || q.Keywords[0].QueryString != "c" {
+		t.Fatalf("Expected (a or b) not c, got %v", q)
+	}
+
+	// The keyword being excluded from must stay the first operand, before the group it excludes.
+	q, err = NewMedlineParser().ParseString(lines + "3 not (1 or 2)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Operator != "not" || len(q.Keywords) != 0 || len(q.Children) != 2 ||
+		len(q.Children[0].Keywords) != 1 || q.Children[0].Keywords[0].QueryString != "c" || q.Children[1].Operator != "or" {
+		t.Fatalf("Expected c not (a or b), got %v", q)
+	}
+}
@@ -0,0 +1,54 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// normalizeReplacer replaces the Unicode characters that look like quotes or spaces with their ASCII equivalents,
+	// and removes zero width spaces.
+	normalizeReplacer = strings.NewReplacer(
+		"\u201c", `"`, "\u201d", `"`, "\u201e", `"`, "\u201f", `"`, "\u2033", `"`, "\u00ab", `"`, "\u00bb", `"`,
+		"\u2018", "'", "\u2019", "'", "\u201a", "'", "\u201b", "'", "\u2032", "'",
+		"\u00a0", " ", "\u2000", " ", "\u2001", " ", "\u2002", " ", "\u2003", " ", "\u2004", " ", "\u2005", " ",
+		"\u2006", " ", "\u2007", " ", "\u2008", " ", "\u2009", " ", "\u200a", " ", "\u202f", " ", "\u205f", " ",
+		"\u3000", " ", "\t", " ",
+		"\u200b", "", "\ufeff", "",
+	)
+	normalizeOperatorRegexp, _ = regexp.Compile(`(?i)\b(and|or|not|adj[0-9]*)\b`)
+	normalizeSpaceRegexp, _    = regexp.Compile(` {2,}`)
+)
+
+// Normalize cleans up a query pasted from a document or web page before it is lexed. Quotes and spaces that are
+// Unicode look-alikes (e.g. smart quotes and non-breaking spaces) are replaced by ASCII quotes and spaces, runs of
+// spaces are collapsed, and the operators outside of quotes are lower cased (e.g. `And` and `OR` become `and` and
+// `or`). The lines of the query are kept, so numbered search strategies can be normalized as well.
+func Normalize(raw string) string {
+	lines := strings.Split(strings.Replace(normalizeReplacer.Replace(raw), "\r\n", "\n", -1), "\n")
+	for i, line := range lines {
+		line = strings.TrimSpace(normalizeSpaceRegexp.ReplaceAllString(line, " "))
+
+		// The operators are only lower cased outside of quotes, so that phrases are searched as written.
+		var s strings.Builder
+		start, quoted := 0, false
+		for j := 0; j < len(line); j++ {
+			if line[j] != '"' || (j > 0 && line[j-1] == '\\') {
+				continue
+			}
+			if quoted {
+				s.WriteString(line[start : j+1])
+			} else {
+				s.WriteString(normalizeOperatorRegexp.ReplaceAllStringFunc(line[start:j+1], strings.ToLower))
+			}
+			start, quoted = j+1, !quoted
+		}
+		if quoted {
+			s.WriteString(line[start:])
+		} else {
+			s.WriteString(normalizeOperatorRegexp.ReplaceAllStringFunc(line[start:], strings.ToLower))
+		}
+		lines[i] = s.String()
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,17 @@
+package parser
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	for raw, expected := range map[string]string{
+		"\u201cheart attack\u201d[tiab] OR\u00a0\u00a0asthma[tiab]":        `"heart attack"[tiab] or asthma[tiab]`,
+		"(asthma And wheeze).ti,ab.":                                       "(asthma and wheeze).ti,ab.",
+		`"Sleep And Breathing"[ta] NOT child*[tiab]`:                       `"Sleep And Breathing"[ta] not child*[tiab]`,
+		"1. asthma.ti.\r\n2. wheeze.ti.\r\n3. OR/1-2\r\n4. (a ADJ3 b).ti.": "1. asthma.ti.\n2. wheeze.ti.\n3. or/1-2\n4. (a adj3 b).ti.",
+		"parkinson\u200b\u2019s[tiab]":                                     "parkinson's[tiab]",
+	} {
+		if got := Normalize(raw); got != expected {
+			t.Fatalf("Expected %v, got %v", expected, got)
+		}
+	}
+}
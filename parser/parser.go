@@ -3,6 +3,13 @@
 package parser
 
 import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
 	"github.com/hscells/transmute/ir"
 	"github.com/hscells/transmute/lexer"
 )
@@ -16,40 +23,549 @@ type QueryTransformer interface {
 	TransformNested(query string, mapping map[string][]string) ir.BooleanQuery
 }
 
+// NestedQueryTransformer may optionally be implemented by a QueryTransformer to determine which lines of a query are
+// nested queries. Otherwise, only lines that start with a `(` are considered nested queries.
+type NestedQueryTransformer interface {
+	IsNested(query string) bool
+}
+
+// DefaultStopWords is the set of stop words used to drop keywords when a transformer does not configure its own.
+var DefaultStopWords = map[string]bool{
+	"a":    true,
+	"an":   true,
+	"as":   true,
+	"at":   true,
+	"be":   true,
+	"by":   true,
+	"for":  true,
+	"from": true,
+	"in":   true,
+	"is":   true,
+	"it":   true,
+	"of":   true,
+	"on":   true,
+	"the":  true,
+	"to":   true,
+	"was":  true,
+	"with": true,
+}
+
+// isEmptyKeyword determines if a keyword has an empty query string, or a query string made up only of stop words. When
+// stopWords is nil, DefaultStopWords is used.
+func isEmptyKeyword(k ir.Keyword, stopWords map[string]bool) bool {
+	if k.Exists() {
+		return false
+	}
+	if stopWords == nil {
+		stopWords = DefaultStopWords
+	}
+	for _, term := range strings.Fields(strings.ToLower(strings.Trim(k.QueryString, `"`))) {
+		if !stopWords[term] {
+			return false
+		}
+	}
+	return true
+}
+
+// dropKeywords removes the keywords from a query which keep does not keep. A group which is left with a single operand
+// is replaced by the operand, and a group which is left without operands is removed, as is a "not" group whose first
+// operand (the operand the others are excluded from) is removed, since there is nothing left to exclude from.
+func dropKeywords(q ir.BooleanQuery, keep func(k ir.Keyword) bool) ir.BooleanQuery {
+	not := strings.ToLower(q.Operator) == "not"
+	n := len(q.Keywords) + len(q.Children)
+	empty := false
+
+	var children []ir.BooleanQuery
+	var keywords []ir.Keyword
+	for i, child := range q.Children {
+		child = dropKeywords(child, keep)
+		switch {
+		case len(child.Keywords)+len(child.Children) == 0:
+			empty = empty || not && i == 0
+		case len(child.Operator) == 0 && len(child.Keywords) == 1 && len(child.Children) == 0 && !not && len(child.Options) == 0:
+			// A group left with a single keyword is replaced by the keyword.
+			keywords = append(keywords, child.Keywords...)
+		default:
+			children = append(children, child)
+		}
+	}
+	for i, k := range q.Keywords {
+		if keep(k) {
+			keywords = append(keywords, k)
+		} else {
+			empty = empty || not && i == 0 && len(q.Children) == 0
+		}
+	}
+	q.Children = children
+	q.Keywords = keywords
+
+	switch m := len(q.Keywords) + len(q.Children); {
+	case empty || m == 0:
+		return ir.BooleanQuery{}
+	case m == 1 && m < n && len(q.Operator) > 0:
+		// Only a group which has lost operands is replaced, so that a dangling operator is still found.
+		if len(q.Children) == 1 {
+			return q.Children[0]
+		}
+		return ir.BooleanQuery{Keywords: q.Keywords}
+	}
+	return q
+}
+
 // QueryParser represents the full implementation of a query parser.
 type QueryParser struct {
 	// FieldMapping determines how fields are mapped for a query.
 	FieldMapping map[string][]string
 
+	// LexOptions are the options used to lex a query in ParseString.
+	LexOptions lexer.LexOptions
+
 	// Parser is an implemented QueryTransformer.
 	Parser QueryTransformer
+
+	// MaxDepth limits how deeply parenthesis may be nested in a line of a query. Queries which exceed the limit are not
+	// parsed, which protects against adversarial input. A MaxDepth of zero or less means there is no limit.
+	MaxDepth int
+
+	// MaxTerms limits how many keywords a query may contain. Parsing stops as soon as the query exceeds the limit, which
+	// protects against input that expands to a very large query. A MaxTerms of zero or less means there is no limit.
+	MaxTerms int
+
+	// NormalizeCase lowercases the query string of every keyword, for search engines that are case-insensitive.
+	NormalizeCase bool
+
+	// AdjacencyDistance records the distance of every adjacency group in its options (ir.DistanceOption), so that
+	// backends which require an explicit distance do not need to parse it from the operator. A bare `adj` has a
+	// distance of 1.
+	AdjacencyDistance bool
+
+	// SourceLines records the line of the query each keyword was parsed from in its options (ir.SourceOption), e.g. to
+	// show which line of the original strategy a term came from.
+	SourceLines bool
+}
+
+var (
+	// FrenchOperators maps the operators of French database interfaces to the operators of the ir.
+	FrenchOperators = map[string]string{"et": "and", "ou": "or", "sauf": "not"}
+	// GermanOperators maps the operators of German database interfaces to the operators of the ir.
+	GermanOperators = map[string]string{"und": "and", "oder": "or", "nicht": "not"}
+)
+
+// canonicalOperator maps a localised operator, e.g. `OU`, to the operator of the ir, e.g. `or`, using a map of lower
+// case localised operators. Any other token is returned unchanged.
+func canonicalOperator(token string, operators map[string]string) string {
+	if op, ok := operators[strings.ToLower(token)]; ok {
+		return op
+	}
+	return token
+}
+
+// localisedTransformer is a QueryTransformer that recognises localised operators, e.g. `oder`.
+type localisedTransformer interface {
+	localisedOperators() map[string]string
+}
+
+// operators are the localised operators recognised by the transformer of the parser.
+func (q QueryParser) operators() map[string]string {
+	if l, ok := q.Parser.(localisedTransformer); ok {
+		return l.localisedOperators()
+	}
+	return nil
+}
+
+// adjacencyTransformer is a QueryTransformer that recognises proximity operators other than `adj`, e.g. `NEAR/3`.
+type adjacencyTransformer interface {
+	adjacencyOperator() *regexp.Regexp
+}
+
+// adjacency recognises the proximity operators of the transformer of the parser, if it has any.
+func (q QueryParser) adjacency() *regexp.Regexp {
+	if a, ok := q.Parser.(adjacencyTransformer); ok {
+		return a.adjacencyOperator()
+	}
+	return nil
+}
+
+// nestingDepth computes how deeply parenthesis are nested in a line of a query. Parenthesis inside quotes are not
+// counted, and a quote escaped with a backslash does not start or end a quote.
+func nestingDepth(query string) int {
+	depth, max := 0, 0
+	insideQuote := false
+	escaped := false
+	for _, char := range query {
+		switch {
+		case escaped:
+			escaped = false
+		case char == '\\':
+			escaped = true
+		case char == '"':
+			insideQuote = !insideQuote
+		case insideQuote:
+		case char == '(':
+			depth++
+			if depth > max {
+				max = depth
+			}
+		case char == ')':
+			depth--
+		}
+	}
+	return max
+}
+
+// checkText determines if a line of a query can be parsed, before it is transformed.
+func (q QueryParser) checkText(query string) error {
+	if q.MaxDepth > 0 && nestingDepth(query) > q.MaxDepth {
+		return fmt.Errorf("query nesting exceeds limit (%d)", q.MaxDepth)
+	}
+	return checkDanglingText(query, q.operator)
+}
+
+// countTerms adds the keywords of a part of a query to the number of keywords parsed so far, and returns an error if
+// the query now exceeds MaxTerms. A transformer which counts its keywords as it creates them (see termLimiter) has
+// already added them since before, so only the keywords it did not count, e.g. those of a line it transformed without
+// the infix parser, are added.
+func (q QueryParser) countTerms(terms *int, before int, query ir.BooleanQuery) error {
+	if q.MaxTerms <= 0 {
+		return nil
+	}
+	if n := len(query.Terms()); *terms-before < n {
+		*terms = before + n
+	}
+	if *terms > q.MaxTerms {
+		return fmt.Errorf("query terms exceed limit (%d)", q.MaxTerms)
+	}
+	return nil
+}
+
+// termLimiter counts the keywords a transformer creates while a query is parsed, so that the infix parser stops at the
+// first keyword over MaxTerms, rather than after a whole line of the query has been transformed. Nothing is counted
+// when terms is nil.
+type termLimiter struct {
+	terms *int
+	max   int
+}
+
+// addTerm counts a keyword, and returns an error if there are now more keywords than the limit.
+func (l termLimiter) addTerm() error {
+	if l.terms == nil {
+		return nil
+	}
+	*l.terms++
+	if *l.terms > l.max {
+		return fmt.Errorf("query terms exceed limit (%d)", l.max)
+	}
+	return nil
+}
+
+// termsExceeded determines if there are more keywords than the limit, in which case a transformer should not attempt
+// to transform the query some other way.
+func (l termLimiter) termsExceeded() bool {
+	return l.terms != nil && *l.terms > l.max
+}
+
+// limitingTransformer is a QueryTransformer that can count the keywords it creates against MaxTerms.
+type limitingTransformer interface {
+	withTermLimit(limit termLimiter) QueryTransformer
+}
+
+// isNested determines if a line of a query is a nested query.
+func (q QueryParser) isNested(query string) bool {
+	if n, ok := q.Parser.(NestedQueryTransformer); ok {
+		return n.IsNested(query)
+	}
+	return len(query) > 0 && query[0] == '('
+}
+
+var (
+	quotedRegexp, _    = regexp.Compile(`"(?:[^"\\]|\\.)*"`)
+	operatorRegexp, _  = regexp.Compile(`(?i)^(and|or|not|adj[0-9]*)$`)
+	adjacencyRegexp, _ = regexp.Compile(`(?i)^adj([0-9]*)$`)
+	distanceRegexp, _  = regexp.Compile(`[0-9]*$`)
+)
+
+// canonicalAdjacency maps a proximity operator recognised by adjacency, e.g. `near/3`, to the adjacency operator of
+// the ir with the same distance, e.g. `adj3`. Any other token is returned unchanged.
+func canonicalAdjacency(token string, adjacency *regexp.Regexp) string {
+	if adjacency == nil || adjacencyRegexp.MatchString(token) || !adjacency.MatchString(token) {
+		return token
+	}
+	return "adj" + distanceRegexp.FindString(token)
+}
+
+// operator maps a localised or proximity operator to the operator of the ir, using the operators of the transformer of
+// the parser. Any other token is returned unchanged.
+func (q QueryParser) operator(token string) string {
+	return canonicalAdjacency(canonicalOperator(token, q.operators()), q.adjacency())
+}
+
+// checkDanglingText determines if a line of a query ends with an operator, or has an operator immediately before a
+// closing parenthesis, e.g. `asthma and` or `(asthma or)`. Likewise, a line or group may not start with an operator,
+// e.g. `(or asthma)`, other than a `not`, which excludes the operand after it from every document, e.g.
+// `(not asthma or wheeze)`. operator maps a token to the operator of the ir (see QueryParser.operator). Quoted phrases
+// are not considered.
+func checkDanglingText(query string, operator func(token string) string) error {
+	query = strings.TrimSpace(quotedRegexp.ReplaceAllString(query, `""`))
+	tokens := tokeniseInfix(query, `"`)
+	for i, token := range tokens {
+		op := operator(strings.ToLower(token))
+		if !operatorRegexp.MatchString(op) {
+			continue
+		}
+		if i == len(tokens)-1 || tokens[i+1] == ")" {
+			return fmt.Errorf("dangling operator `%v` in `%v` is missing an operand", token, query)
+		}
+		if (i == 0 || tokens[i-1] == "(") && op != "not" {
+			return fmt.Errorf("leading operator `%v` in `%v` is missing an operand", token, query)
+		}
+	}
+	return nil
+}
+
+// checkDangling determines if any group in a query has an operator but fewer than two operands. A `not` group of a
+// single operand excludes the operand from every document, so it only needs the one operand.
+func checkDangling(q ir.BooleanQuery) error {
+	operands := len(q.Keywords) + len(q.Children)
+	if len(q.Operator) > 0 && operands < 2 && !(strings.ToLower(q.Operator) == "not" && operands == 1) {
+		return fmt.Errorf("dangling operator `%v` is missing an operand", q.Operator)
+	}
+	for _, child := range q.Children {
+		if err := checkDangling(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// warner reports the problems a transformer finds with a query that do not prevent it from being transformed. The
+// warnings are collected when the transformer is used by ParseWithWarnings, and are otherwise logged.
+type warner struct {
+	warnings *[]ir.Warning
+}
+
+// warn reports a warning, optionally about a keyword.
+func (w warner) warn(keyword *ir.Keyword, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	if w.warnings == nil {
+		log.Println(message)
+		return
+	}
+	*w.warnings = append(*w.warnings, ir.Warning{Message: message, Keyword: keyword})
+}
+
+// warningTransformer is a QueryTransformer that can collect its warnings rather than logging them.
+type warningTransformer interface {
+	withWarnings(warnings *[]ir.Warning) QueryTransformer
+}
+
+// ParseResult is a parsed query, along with the warnings found while parsing it.
+type ParseResult struct {
+	Query    ir.BooleanQuery
+	Warnings []ir.Warning
+}
+
+// ParseWithWarnings parses the AST in the same way as Parse, but rather than logging the problems found with the query
+// that do not prevent it from being parsed (e.g. a field that does not have a mapping, so the default fields are used),
+// they are returned as warnings in the result.
+func (q QueryParser) ParseWithWarnings(ast lexer.Node) (ParseResult, error) {
+	var warnings []ir.Warning
+	if w, ok := q.Parser.(warningTransformer); ok {
+		q.Parser = w.withWarnings(&warnings)
+	}
+	query, err := q.Parse(ast)
+	if err != nil {
+		return ParseResult{}, err
+	}
+	return ParseResult{Query: query, Warnings: warnings}, nil
 }
 
 // Parse takes an AST created from lexing a query and parses each node in it. It uses the TransformNested and
 // TransformSingle functions defined by the Parser and the Field mapping to create an immediate representation tree.
-func (q QueryParser) Parse(ast lexer.Node) ir.BooleanQuery {
+// An error is returned if the query is empty (or only contains parenthesis), if an operator in the query is missing an
+// operand, or if the query is nested deeper than MaxDepth or has more keywords than MaxTerms.
+func (q QueryParser) Parse(ast lexer.Node) (ir.BooleanQuery, error) {
+	if len(ast.Children) == 0 && len(strings.Trim(ast.Value, "() \t\r\n")) == 0 {
+		return ir.BooleanQuery{}, errors.New("the query is empty")
+	}
+	terms := 0
+	if l, ok := q.Parser.(limitingTransformer); ok && q.MaxTerms > 0 {
+		q.Parser = l.withTermLimit(termLimiter{terms: &terms, max: q.MaxTerms})
+	}
 	if ast.Children == nil && ast.Reference == 1 {
-		return q.Parser.TransformNested(ast.Value, q.FieldMapping)
+		if err := q.checkText(ast.Value); err != nil {
+			return ir.BooleanQuery{}, err
+		}
+		query := q.withSources(q.Parser.TransformNested(ast.Value, q.FieldMapping), ast)
+		query.Options = withLimits(withComment(query.Options, ast), ast)
+		if err := q.countTerms(&terms, 0, query); err != nil {
+			return ir.BooleanQuery{}, err
+		}
+		return q.finish(query)
 	}
-	var visit func(node lexer.Node, query ir.BooleanQuery) ir.BooleanQuery
-	visit = func(node lexer.Node, query ir.BooleanQuery) ir.BooleanQuery {
-		query.Operator = node.Operator
+	var visit func(node lexer.Node, query ir.BooleanQuery) (ir.BooleanQuery, error)
+	visit = func(node lexer.Node, query ir.BooleanQuery) (ir.BooleanQuery, error) {
+		query.Operator = q.operator(node.Operator)
+		query.Options = withLimits(withComment(query.Options, node), node)
 		//fmt.Println("::::", node, len(node.Children))
 		for _, child := range node.Children {
 			if len(child.Operator) == 0 {
+				if err := q.checkText(child.Value); err != nil {
+					return ir.BooleanQuery{}, err
+				}
 				// Nested query.
-				if len(child.Value) > 0 && child.Value[0] == '(' {
-					query.Children = append(query.Children, q.Parser.TransformNested(child.Value, q.FieldMapping))
+				before := terms
+				if q.isNested(child.Value) {
+					nested := q.withSources(q.Parser.TransformNested(child.Value, q.FieldMapping), child)
+					nested.Options = withLimits(withComment(nested.Options, child), child)
+					if err := q.countTerms(&terms, before, nested); err != nil {
+						return ir.BooleanQuery{}, err
+					}
+					query.Children = append(query.Children, nested)
 				} else {
 					// Regular line of a query.
-					query.Keywords = append(query.Keywords, q.Parser.TransformSingle(child.Value, q.FieldMapping))
+					keyword := q.Parser.TransformSingle(child.Value, q.FieldMapping)
+					keyword.Options = q.withSource(withLimits(withComment(keyword.Options, child), child), child)
+					if err := q.countTerms(&terms, before, ir.BooleanQuery{Keywords: []ir.Keyword{keyword}}); err != nil {
+						return ir.BooleanQuery{}, err
+					}
+					query.Keywords = append(query.Keywords, keyword)
 				}
 			} else {
-				query.Children = append(query.Children, visit(child, ir.BooleanQuery{}))
+				c, err := visit(child, ir.BooleanQuery{})
+				if err != nil {
+					return ir.BooleanQuery{}, err
+				}
+				query.Children = append(query.Children, c)
 			}
 		}
+		// The operands of a group are its children followed by its keywords, so when the operand that a "not" excludes
+		// from is a keyword, and it excludes a group, the keyword is moved into a group of its own to keep it first.
+		if strings.ToLower(query.Operator) == "not" && len(query.Keywords) > 0 && len(query.Children) > 0 &&
+			len(node.Children) > 0 && len(node.Children[0].Operator) == 0 && !q.isNested(node.Children[0].Value) {
+			first := ir.BooleanQuery{Keywords: query.Keywords[:1]}
+			query.Children = append([]ir.BooleanQuery{first}, query.Children...)
+			query.Keywords = query.Keywords[1:]
+		}
+		return query, nil
+	}
+
+	query, err := visit(ast, ir.BooleanQuery{})
+	if err != nil {
+		return ir.BooleanQuery{}, err
+	}
+	return q.finish(query)
+}
+
+// lexOptions are the LexOptions of the parser, where the localised and proximity operators of the transformer are
+// lexed as the operators of the ir when the options do not set any.
+func (q QueryParser) lexOptions() lexer.LexOptions {
+	options := q.LexOptions
+	if options.Operators == nil {
+		options.Operators = q.operators()
+	}
+	if options.Adjacency == nil {
+		options.Adjacency = q.adjacency()
+	}
+	return options
+}
+
+// ParseString lexes a query with the LexOptions of the parser and then parses it, so that a query does not need to be
+// lexed separately. Errors from both lexing and parsing are returned.
+func (q QueryParser) ParseString(raw string) (ir.BooleanQuery, error) {
+	ast, err := lexer.Lex(raw, q.lexOptions())
+	if err != nil {
+		return ir.BooleanQuery{}, err
+	}
+	return q.Parse(ast)
+}
+
+// withComment adds the comment of a line in a query to the options of the keyword or group transformed from the line.
+// The options are copied, so options shared between keywords are not modified.
+func withComment(options map[string]interface{}, node lexer.Node) map[string]interface{} {
+	if len(node.Comment) == 0 {
+		return options
+	}
+	o := map[string]interface{}{}
+	for k, v := range options {
+		o[k] = v
+	}
+	o[ir.CommentOption] = node.Comment
+	return o
+}
+
+// withLimits adds the limits of a line in a query, e.g. `humans` for `limit 7 to humans`, to the options of the keyword
+// or group transformed from the line. Like withComment, the options are copied.
+func withLimits(options map[string]interface{}, node lexer.Node) map[string]interface{} {
+	if len(node.Limits) == 0 {
+		return options
+	}
+	o := map[string]interface{}{}
+	for k, v := range options {
+		o[k] = v
+	}
+	o[ir.LimitOption] = node.Limits
+	return o
+}
+
+// withSource adds the line a keyword was transformed from to the options of the keyword when SourceLines is set. Like
+// withComment, the options are copied.
+func (q QueryParser) withSource(options map[string]interface{}, node lexer.Node) map[string]interface{} {
+	if !q.SourceLines {
+		return options
+	}
+	o := map[string]interface{}{}
+	for k, v := range options {
+		o[k] = v
+	}
+	o[ir.SourceOption] = ir.Source{Line: node.Reference, Text: node.Value}
+	return o
+}
+
+// withSources adds the line a nested query was transformed from to the options of each of its keywords when
+// SourceLines is set.
+func (q QueryParser) withSources(query ir.BooleanQuery, node lexer.Node) ir.BooleanQuery {
+	if !q.SourceLines {
 		return query
 	}
+	ir.Walk(&query, ir.VisitorFuncs{Keyword: func(k *ir.Keyword) bool {
+		k.Options = q.withSource(k.Options, node)
+		return true
+	}})
+	return query
+}
 
-	return visit(ast, ir.BooleanQuery{})
+// finish checks and normalises a query once it has been transformed.
+func (q QueryParser) finish(query ir.BooleanQuery) (ir.BooleanQuery, error) {
+	if err := checkDangling(query); err != nil {
+		return ir.BooleanQuery{}, err
+	}
+	if q.NormalizeCase {
+		query = query.NormalizeTerms(strings.ToLower)
+	}
+	if q.AdjacencyDistance {
+		ir.Walk(&query, ir.VisitorFuncs{Query: func(b *ir.BooleanQuery) bool {
+			if d, ok := adjacencyDistance(b.Operator); ok {
+				options := map[string]interface{}{ir.DistanceOption: d}
+				for k, v := range b.Options {
+					options[k] = v
+				}
+				b.Options = options
+			}
+			return true
+		}})
+	}
+	return query, nil
+}
+
+// adjacencyDistance determines the distance of an adjacency operator, e.g. 1 for `adj` and 3 for `adj3`.
+func adjacencyDistance(operator string) (int, bool) {
+	m := adjacencyRegexp.FindStringSubmatch(operator)
+	if len(m) != 2 {
+		return 0, false
+	}
+	if len(m[1]) == 0 {
+		return 1, true
+	}
+	d, err := strconv.Atoi(m[1])
+	return d, err == nil
 }
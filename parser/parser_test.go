@@ -0,0 +1,367 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hscells/transmute/ir"
+	"github.com/hscells/transmute/lexer"
+)
+
+func TestQueryParser_MaxDepth(t *testing.T) {
+	query := strings.Repeat("(", 50) + "asthma[tiab]" + strings.Repeat(")", 50)
+	ast, err := lexer.Lex(query, lexOptionsPubMed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewPubMedParser()
+	p.MaxDepth = 10
+	_, err = p.Parse(ast)
+	if err == nil || err.Error() != "query nesting exceeds limit (10)" {
+		t.Fatalf("Expected a nesting error, got %v", err)
+	}
+
+	// Parenthesis inside quotes do not count towards the depth.
+	ast, err = lexer.Lex(`(("((((((((((("[tiab] OR asthma[tiab]))`, lexOptionsPubMed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Parse(ast); err != nil {
+		t.Fatal(err)
+	}
+
+	p.MaxDepth = 0
+	ast, err = lexer.Lex(query, lexOptionsPubMed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Parse(ast); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestQueryParser_MaxTerms(t *testing.T) {
+	p := NewMedlineParser()
+	p.MaxTerms = 3
+	// Line 1 is referenced twice, so the query has four keywords.
+	query := "1. a.ti,ab.\n2. b.ti,ab.\n3. c.ti,ab.\n4. or/1-3\n5. 4 and 1"
+	_, err := p.ParseString(query)
+	if err == nil || err.Error() != "query terms exceed limit (3)" {
+		t.Fatalf("Expected a terms error, got %v", err)
+	}
+	p.MaxTerms = 4
+	if _, err := p.ParseString(query); err != nil {
+		t.Fatal(err)
+	}
+
+	p = NewPubMedParser()
+	p.LexOptions = lexOptionsPubMed
+	p.MaxTerms = 2
+	_, err = p.ParseString(`asthma[tiab] OR wheeze[tiab] OR cough[tiab]`)
+	if err == nil || err.Error() != "query terms exceed limit (2)" {
+		t.Fatalf("Expected a terms error, got %v", err)
+	}
+	p.MaxTerms = 0
+	if _, err := p.ParseString(`asthma[tiab] OR wheeze[tiab] OR cough[tiab]`); err != nil {
+		t.Fatal(err)
+	}
+
+	// A line is not transformed some other way when it has too many keywords to be parsed.
+	p = NewMedlineParser()
+	p.MaxTerms = 2
+	_, err = p.ParseString("1. (asthma or wheeze or cough).ti,ab.")
+	if err == nil || err.Error() != "query terms exceed limit (2)" {
+		t.Fatalf("Expected a terms error, got %v", err)
+	}
+
+	// The keywords are counted as they are created, so parsing stops at the first keyword over the limit.
+	created, terms := 0, 0
+	ip := infixParser{
+		tokens:   tokeniseInfix("asthma OR wheeze OR cough OR dyspnea", `"`),
+		operator: ebscoOperator,
+		keyword: func(text string) ir.Keyword {
+			created++
+			return ir.Keyword{QueryString: text}
+		},
+		limit: termLimiter{terms: &terms, max: 2},
+	}
+	if _, err := ip.Parse(); err == nil || err.Error() != "query terms exceed limit (2)" {
+		t.Fatalf("Expected a terms error, got %v", err)
+	}
+	if created != 2 {
+		t.Fatalf("Expected 2 keywords to be created, got %v", created)
+	}
+}
+
+func TestQueryParser_NormalizeCase(t *testing.T) {
+	ast, err := lexer.Lex(`(Asthma[Mesh] OR WHEEZE[tiab])`, lexOptionsPubMed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewPubMedParser()
+	p.NormalizeCase = true
+	q, err := p.Parse(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	terms := q.Terms()
+	if len(terms) != 2 || terms[0] != "asthma" || terms[1] != "wheeze" {
+		t.Fatalf("Expected terms %v, got %v", []string{"asthma", "wheeze"}, terms)
+	}
+}
+
+func TestQueryParser_LocalisedOperators(t *testing.T) {
+	queries := []struct {
+		transformer QueryTransformer
+		mapping     map[string][]string
+		query       string
+		expected    string
+	}{
+		{
+			PubMedTransformer{Operators: FrenchOperators}, PubMedFieldMapping,
+			`((asthma[tiab] OU wheez*[tiab]) ET child*[tiab])`,
+			"(asthma[title_abstract] OR wheez*[title_abstract]) AND child*[title_abstract]",
+		},
+		{
+			MedlineTransformer{Operators: GermanOperators}, MedlineFieldMapping,
+			`(asthma ODER wheez*).ti,ab.`,
+			"asthma[title_abstract] OR wheez*[title_abstract]",
+		},
+		{
+			EbscoMedlineTransformer{Operators: FrenchOperators}, EbscoMedlineFieldMapping,
+			`TI asthma OU AB wheez*`,
+			"asthma[title] OR wheez*[text]",
+		},
+		{
+			// The English operators are still recognised.
+			PubMedTransformer{Operators: FrenchOperators}, PubMedFieldMapping,
+			`(asthma[tiab] OR wheez*[tiab])`,
+			"asthma[title_abstract] OR wheez*[title_abstract]",
+		},
+	}
+	for _, q := range queries {
+		if s := q.transformer.TransformNested(q.query, q.mapping).String(); s != q.expected {
+			t.Fatalf("Expected %v, got %v", q.expected, s)
+		}
+	}
+}
+
+func TestQueryParser_LocalisedCombiningLines(t *testing.T) {
+	p := QueryParser{FieldMapping: MedlineFieldMapping, Parser: MedlineTransformer{Operators: GermanOperators}}
+	for query, expected := range map[string]string{
+		"1. asthma.ti.\n2. wheeze.ti.\n3. 1 oder 2":                            "asthma[title] OR wheeze[title]",
+		"1. asthma.ti.\n2. wheeze.ti.\n3. oder/1-2":                            "asthma[title] OR wheeze[title]",
+		"1. asthma.ti.\n2. wheeze.ti.\n3. child.ti.\n4. 1 und (2 oder 3)":      "(wheeze[title] OR child[title]) AND asthma[title]",
+		"1. asthma.ti.\n2. wheeze.ti.\n3. child.ti.\n4. 1 nicht 2\n5. 4 und 3": "(asthma[title] NOT wheeze[title]) AND child[title]",
+	} {
+		q, err := p.ParseString(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := q.String(); s != expected {
+			t.Fatalf("Expected %v, got %v", expected, s)
+		}
+	}
+
+	for _, query := range []string{"1. asthma oder", "1. (oder asthma und wheeze).ti.", "1. (asthma und nicht).ti."} {
+		if _, err := p.ParseString(query); err == nil {
+			t.Fatalf("Expected an error parsing %v", query)
+		}
+	}
+}
+
+func TestQueryParser_ParseWithWarnings(t *testing.T) {
+	ast, err := lexer.Lex(`(asthma[foo] OR wheeze[tiab])`, lexer.LexOptions{FormatParenthesis: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewPubMedParser().ParseWithWarnings(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Query.Terms()) != 2 {
+		t.Fatalf("Expected %v terms, got %v", 2, r.Query)
+	}
+	if len(r.Warnings) != 1 || !strings.Contains(r.Warnings[0].Message, "`foo`") {
+		t.Fatalf("Expected a warning for the field `foo`, got %v", r.Warnings)
+	}
+
+	ast, err = lexer.Lex("1. asthma.zz.\n2. wheeze.ti,ab.\n3. or/1-2", lexer.LexOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err = NewMedlineParser().ParseWithWarnings(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Warnings) != 1 || !strings.Contains(r.Warnings[0].Message, "zz") {
+		t.Fatalf("Expected a warning for the field `zz`, got %v", r.Warnings)
+	}
+}
+
+func TestQueryParser_AdjacencyDistance(t *testing.T) {
+	for query, expected := range map[string]int{
+		"1. (sleep adj apnea).ti,ab.":  1,
+		"1. (sleep adj3 apnea).ti,ab.": 3,
+	} {
+		ast, err := lexer.Lex(query, lexer.LexOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := NewMedlineParser()
+		p.AdjacencyDistance = true
+		q, err := p.Parse(ast)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var distances []interface{}
+		ir.Walk(&q, ir.VisitorFuncs{Query: func(b *ir.BooleanQuery) bool {
+			if d, ok := b.Options[ir.DistanceOption]; ok {
+				distances = append(distances, d)
+			}
+			return true
+		}})
+		if len(distances) != 1 || distances[0] != expected {
+			t.Fatalf("Expected a distance of %v for %v, got %v in %v", expected, query, distances, q)
+		}
+	}
+}
+
+func TestQueryParser_ParseString(t *testing.T) {
+	q, err := NewPubMedParser().ParseString("(asthma[tiab] OR wheeze[tiab])")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if terms := q.Terms(); len(terms) != 2 {
+		t.Fatalf("Expected %v terms, got %v", 2, terms)
+	}
+
+	q, err = NewMedlineParser().ParseString("1. asthma.ti,ab.\n2. wheeze.ti,ab.\n3. or/1-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if terms := q.Terms(); len(terms) != 2 {
+		t.Fatalf("Expected %v terms, got %v", 2, terms)
+	}
+
+	// Errors from lexing the query are returned.
+	if _, err := NewMedlineParser().ParseString("1. asthma.ti,ab.\n2. 1 or (3"); err == nil {
+		t.Fatal("Expected an error")
+	}
+}
+
+func TestQueryParser_ImplicitCombine(t *testing.T) {
+	p := NewMedlineParser()
+	p.LexOptions = lexer.LexOptions{ImplicitCombine: true}
+	q, err := p.ParseString("exp Asthma/; (wheez* or whistl*).ti,ab.; child*.ti.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "(wheez*[title_abstract] OR whistl*[title_abstract]) AND exp Asthma[mesh_headings] AND child*[title]"
+	if q.String() != expected {
+		t.Fatalf("Expected %v, got %v", expected, q.String())
+	}
+}
+
+func TestQueryParser_SourceLines(t *testing.T) {
+	ast, err := lexer.Lex("1. exp Asthma/\n2. (wheez* or whistl*).ti,ab.\n3. 1 or 2", lexer.LexOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewMedlineParser()
+	p.SourceLines = true
+	q, err := p.Parse(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]ir.Source{
+		"Asthma":  {Line: 1, Text: "exp Asthma/"},
+		"wheez*":  {Line: 2, Text: "(wheez* or whistl*).ti,ab."},
+		"whistl*": {Line: 2, Text: "(wheez* or whistl*).ti,ab."},
+	}
+	n := 0
+	ir.Walk(&q, ir.VisitorFuncs{Keyword: func(k *ir.Keyword) bool {
+		n++
+		if source := k.Options[ir.SourceOption]; source != expected[k.QueryString] {
+			t.Fatalf("Expected %v to come from %v, got %v", k.QueryString, expected[k.QueryString], source)
+		}
+		return true
+	}})
+	if n != len(expected) {
+		t.Fatalf("Expected %v keywords, got %v", len(expected), n)
+	}
+}
+
+func TestQueryParser_NotPrecedence(t *testing.T) {
+	queries := []struct {
+		parser   QueryParser
+		options  lexer.LexOptions
+		query    string
+		expected string
+	}{
+		{NewMedlineParser(), lexer.LexOptions{}, "1. (a and not b).ti.", "a[title] NOT b[title]"},
+		{NewMedlineParser(), lexer.LexOptions{}, "1. (a not b).ti.", "a[title] NOT b[title]"},
+		{NewMedlineParser(), lexer.LexOptions{}, "1. (a and b not c).ti.", "(b[title] NOT c[title]) AND a[title]"},
+		{NewMedlineParser(), lexer.LexOptions{}, "1. (not a or b).ti.", "(NOT a[title]) OR b[title]"},
+		{NewMedlineParser(), lexer.LexOptions{}, "1. (not a not b).ti.", "(NOT a[title]) NOT b[title]"},
+		{NewMedlineParser(), lexer.LexOptions{}, "1. (not child).ti.", "NOT child[title]"},
+		{NewPubMedParser(), lexOptionsPubMed, "(a[ti] AND NOT b[ti])", "a[title] NOT b[title]"},
+		{NewPubMedParser(), lexOptionsPubMed, "(a[ti] NOT b[ti])", "a[title] NOT b[title]"},
+		{NewPubMedParser(), lexOptionsPubMed, "(a[ti] AND b[ti] NOT c[ti])", "(a[title] AND b[title]) NOT c[title]"},
+		{NewPubMedParser(), lexOptionsPubMed, "(NOT a[ti] OR b[ti])", "(NOT a[title]) OR b[title]"},
+		{NewPubMedParser(), lexOptionsPubMed, "(a[ti] OR b[ti] AND c[ti])", "(a[title] OR b[title]) AND c[title]"},
+		{NewEbscoMedlineParser(), lexer.LexOptions{}, "TI a AND NOT TI b", "a[title] NOT b[title]"},
+		{NewEbscoMedlineParser(), lexer.LexOptions{}, "TI a NOT TI b", "a[title] NOT b[title]"},
+		{NewEbscoMedlineParser(), lexer.LexOptions{}, "TI a AND TI b NOT TI c", "(b[title] NOT c[title]) AND a[title]"},
+		{NewEbscoMedlineParser(), lexer.LexOptions{}, "NOT TI a OR TI b", "(NOT a[title]) OR b[title]"},
+		{NewEmbaseNativeParser(), lexer.LexOptions{}, "a:ti AND NOT b:ti", "a[title] NOT b[title]"},
+		{NewEmbaseNativeParser(), lexer.LexOptions{}, "a:ti NOT b:ti", "a[title] NOT b[title]"},
+		{NewEmbaseNativeParser(), lexer.LexOptions{}, "a:ti AND b:ti NOT c:ti", "(b[title] NOT c[title]) AND a[title]"},
+		{NewEmbaseNativeParser(), lexer.LexOptions{}, "NOT a:ti OR b:ti", "(NOT a[title]) OR b[title]"},
+	}
+	for _, q := range queries {
+		ast, err := lexer.Lex(q.query, q.options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := q.parser.Parse(ast)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.String() != q.expected {
+			t.Fatalf("Expected %v for %v, got %v", q.expected, q.query, got)
+		}
+	}
+}
+
+func TestQueryParser_Empty(t *testing.T) {
+	parsers := map[string]QueryParser{
+		"medline": NewMedlineParser(),
+		"pubmed":  NewPubMedParser(),
+		"ebsco":   NewEbscoMedlineParser(),
+		"embase":  NewEmbaseNativeParser(),
+		"cqr":     NewCQRParser(),
+	}
+	for name, p := range parsers {
+		for _, query := range []string{"", "   ", "\n\t\n", "()", "( ( ) )"} {
+			if _, err := p.ParseString(query); err == nil || err.Error() != "the query is empty" {
+				t.Fatalf("Expected the query %q to be empty with the %v parser, got %v", query, name, err)
+			}
+			if _, err := p.Parse(lexer.Node{Value: query, Reference: 1}); err == nil {
+				t.Fatalf("Expected an error parsing the node %q with the %v parser", query, name)
+			}
+		}
+		// A line label without a line is empty once it is lexed.
+		if _, err := p.ParseString("1. "); err == nil || err.Error() != "the query is empty" {
+			t.Fatalf("Expected the query %q to be empty with the %v parser, got %v", "1. ", name, err)
+		}
+	}
+
+	// The transformers do not index into an empty query.
+	for _, query := range []string{"", "   "} {
+		PubMedTransformer{}.TransformNested(query, PubMedFieldMapping)
+		MedlineTransformer{}.TransformNested(query, MedlineFieldMapping)
+	}
+}
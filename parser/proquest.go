@@ -0,0 +1,232 @@
+package parser
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hscells/transmute/fields"
+	"github.com/hscells/transmute/ir"
+)
+
+// ProQuestFieldMapping maps the indexes of ProQuest Dialog.
+var ProQuestFieldMapping = map[string][]string{
+	"AB":           {fields.Abstract},
+	"AF":           {fields.Affiliation},
+	"ALL":          {fields.AllFields},
+	"AU":           {fields.Authors},
+	"DTYPE":        {fields.PublicationType},
+	"IF":           {fields.Keywords},
+	"LA":           {fields.Language},
+	"MESH":         {fields.MeshHeadings},
+	"MESH.EXACT":   {fields.MeshHeadings},
+	"MJMESH":       {fields.MajorFocusMeshHeading},
+	"MJMESH.EXACT": {fields.MajorFocusMeshHeading},
+	"NOFT":         {fields.AllFields},
+	"PD":           {fields.PublicationDate},
+	"PUB":          {fields.Journal},
+	"SU":           {fields.HeadingWord},
+	"TI":           {fields.Title},
+	"default":      {fields.AllFields},
+}
+
+var (
+	proquestProximityRegexp, _ = regexp.Compile(`(?i)^(?:(near|pre)(?:/([0-9]+))?|(n|p)/([0-9]+))$`)
+	proquestIndexRegexp, _     = regexp.Compile(`^[A-Z]+(\.[A-Z]+)*(,[A-Z]+(\.[A-Z]+)*)*$`)
+)
+
+// proquestExplode marks the fields of an exploded index, e.g. `MESH.EXACT.EXPLODE`, until they are set on the keywords
+// the index qualifies.
+const proquestExplode = ".EXPLODE"
+
+// proquestDistance is the distance of `NEAR` and `PRE` when it is not given.
+const proquestDistance = 4
+
+// ProQuestTransformer is an implementation of a QueryTransformer for ProQuest Dialog. Fields are specified as indexes
+// before a term or group, e.g. `TI,AB(asthma OR wheez*)`, MeSH headings are exploded with `.EXPLODE`, e.g.
+// `MESH.EXACT.EXPLODE("Asthma")`, and proximity is expressed with `NEAR/n` (any order) and `PRE/n` (in order), or
+// `N/n` and `P/n`.
+type ProQuestTransformer struct {
+	warner
+	explainer
+	termLimiter
+}
+
+// withWarnings returns a copy of the transformer which collects its warnings.
+func (p ProQuestTransformer) withWarnings(warnings *[]ir.Warning) QueryTransformer {
+	p.warner = warner{warnings: warnings}
+	return p
+}
+
+// withExplanations returns a copy of the transformer which records how it interprets the tokens of a query.
+func (p ProQuestTransformer) withExplanations(explanations *[]TokenExplanation) QueryTransformer {
+	p.explainer = explainer{explanations: explanations}
+	return p
+}
+
+// withTermLimit returns a copy of the transformer which counts the keywords it creates against a limit.
+func (p ProQuestTransformer) withTermLimit(limit termLimiter) QueryTransformer {
+	p.termLimiter = limit
+	return p
+}
+
+// proquestOperator determines if a token is a ProQuest operator. Proximity binds tighter than `AND`, which binds
+// tighter than `OR`, which binds tighter than `NOT`, so `a OR b NOT c` is `(a OR b) NOT c`. ProQuest proximity counts
+// the number of words between terms, whereas `adj` in the ir counts the distance between terms, so `NEAR/3` is `adj4`.
+func proquestOperator(token string) (infixOperator, bool) {
+	switch strings.ToLower(token) {
+	case "not":
+		return infixOperator{Operator: "not", Precedence: 0}, true
+	case "or":
+		return infixOperator{Operator: "or", Precedence: 1}, true
+	case "and":
+		return infixOperator{Operator: "and", Precedence: 2}, true
+	}
+	if m := proquestProximityRegexp.FindStringSubmatch(token); len(m) == 5 {
+		operator, distance := m[1]+m[3], m[2]+m[4]
+		n := proquestDistance
+		if len(distance) > 0 {
+			var err error
+			if n, err = strconv.Atoi(distance); err != nil {
+				return infixOperator{}, false
+			}
+		}
+		op := infixOperator{Operator: "adj" + strconv.Itoa(n+1), Precedence: 3}
+		if o := strings.ToLower(operator); o == "pre" || o == "p" {
+			op.Options = map[string]interface{}{ir.InOrderOption: true}
+		}
+		return op, true
+	}
+	return infixOperator{}, false
+}
+
+// index determines if a token is a list of ProQuest indexes known to the mapping, e.g. `TI,AB`. The fields of an
+// exploded index are followed by proquestExplode.
+func (p ProQuestTransformer) index(token string, mapping map[string][]string) ([]string, bool) {
+	if !proquestIndexRegexp.MatchString(token) {
+		return nil, false
+	}
+	var f []string
+	exploded := false
+	for _, index := range strings.Split(token, ",") {
+		if strings.HasSuffix(index, proquestExplode) {
+			index = strings.TrimSuffix(index, proquestExplode)
+			exploded = true
+		}
+		indexFields, ok := mapping[index]
+		if !ok {
+			return nil, false
+		}
+		for _, field := range indexFields {
+			if !containsString(f, field) {
+				f = append(f, field)
+			}
+		}
+	}
+	if exploded {
+		f = append(f, proquestExplode)
+	}
+	return f, true
+}
+
+// containsString determines if a slice contains a string.
+func containsString(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+// keyword transforms the text of a ProQuest term into a keyword. The fields of the keyword are set later by any index
+// qualifying the term.
+func (p ProQuestTransformer) keyword(text string) ir.Keyword {
+	k := ir.Keyword{QueryString: strings.TrimSpace(text)}
+	if strings.ContainsAny(k.QueryString, "*?") {
+		k.Truncated = true
+		// In ProQuest, `?` matches exactly one character.
+		k.QueryString = strings.Replace(k.QueryString, "?", string(ir.SingleWildcard), -1)
+	}
+	return k
+}
+
+// qualify sets the fields of the keywords in a query, handling the explosion of MeSH headings.
+func (p ProQuestTransformer) qualify(q ir.BooleanQuery, f []string) ir.BooleanQuery {
+	keywordFields := f
+	exploded := len(f) > 0 && f[len(f)-1] == proquestExplode
+	if exploded {
+		keywordFields = f[:len(f)-1]
+	}
+	for i, keyword := range q.Keywords {
+		if len(keyword.Fields) > 0 {
+			continue
+		}
+		q.Keywords[i].Fields = keywordFields
+		q.Keywords[i].Exploded = exploded
+		if len(keywordFields) == 1 &&
+			(keywordFields[0] == fields.MeshHeadings || keywordFields[0] == fields.MajorFocusMeshHeading) {
+			q.Keywords[i].QueryString = strings.Trim(keyword.QueryString, `"`)
+		}
+	}
+	for i, child := range q.Children {
+		q.Children[i] = p.qualify(child, f)
+	}
+	return q
+}
+
+// parse parses a ProQuest query into the ir.
+func (p ProQuestTransformer) parse(query string, mapping map[string][]string) (ir.BooleanQuery, error) {
+	ip := infixParser{
+		tokens:   tokeniseInfix(query, `"`),
+		operator: proquestOperator,
+		keyword:  p.keyword,
+		prefix: func(token string) ([]string, bool) {
+			return p.index(token, mapping)
+		},
+		qualify: p.qualify,
+		explain: p.explanations,
+		limit:   p.termLimiter,
+	}
+	q, err := ip.Parse()
+	if err != nil {
+		return ir.BooleanQuery{}, err
+	}
+	return p.qualify(q, mapping["default"]), nil
+}
+
+// TransformSingle implements the transformation of a single ProQuest term, optionally qualified by an index.
+func (p ProQuestTransformer) TransformSingle(query string, mapping map[string][]string) ir.Keyword {
+	q, err := p.parse(query, mapping)
+	if err != nil || !isInfixKeyword(q) {
+		p.warn(nil, "unable to parse `%v` as a single ProQuest term", query)
+		return p.qualify(ir.BooleanQuery{Keywords: []ir.Keyword{p.keyword(query)}}, mapping["default"]).Keywords[0]
+	}
+	return q.Keywords[0]
+}
+
+// TransformNested implements the transformation of a ProQuest query containing operators.
+func (p ProQuestTransformer) TransformNested(query string, mapping map[string][]string) ir.BooleanQuery {
+	q, err := p.parse(query, mapping)
+	if err != nil {
+		p.warn(nil, "%v", err)
+		return ir.BooleanQuery{}
+	}
+	return q
+}
+
+// IsNested determines if a line of a ProQuest query contains operators, rather than a single (possibly qualified)
+// term.
+func (p ProQuestTransformer) IsNested(query string) bool {
+	for _, token := range tokeniseInfix(query, `"`) {
+		if _, ok := proquestOperator(token); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// NewProQuestParser creates a new parser for queries written for ProQuest Dialog.
+func NewProQuestParser() QueryParser {
+	return QueryParser{FieldMapping: ProQuestFieldMapping, Parser: ProQuestTransformer{}}
+}
@@ -0,0 +1,68 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/hscells/transmute/backend"
+	"github.com/hscells/transmute/fields"
+	"github.com/hscells/transmute/ir"
+)
+
+func TestProQuest_TransformSingle(t *testing.T) {
+	p := ProQuestTransformer{}
+
+	k := p.TransformSingle(`MESH.EXACT.EXPLODE("Sleep Apnea, Obstructive")`, ProQuestFieldMapping)
+	if k.QueryString != "Sleep Apnea, Obstructive" || !k.Exploded || k.Fields[0] != fields.MeshHeadings {
+		t.Fatalf("Unexpected keyword %v", k)
+	}
+
+	k = p.TransformSingle(`TI,AB(wom?n)`, ProQuestFieldMapping)
+	if k.QueryString != "wom#n" || !k.Truncated || len(k.Fields) != 2 || k.Fields[0] != fields.Title ||
+		k.Fields[1] != fields.Abstract {
+		t.Fatalf("Unexpected keyword %v", k)
+	}
+
+	k = p.TransformSingle(`asthma`, ProQuestFieldMapping)
+	if k.QueryString != "asthma" || k.Fields[0] != fields.AllFields {
+		t.Fatalf("Unexpected keyword %v", k)
+	}
+}
+
+func TestProQuest_Proximity(t *testing.T) {
+	q := ProQuestTransformer{}.TransformNested(`TI(wheez* NEAR/3 child*) OR AB(asthma PRE/2 attack*)`, ProQuestFieldMapping)
+
+	if q.Operator != "or" || len(q.Children) != 2 {
+		t.Fatalf("Expected an or group of two proximity groups, got %v", q)
+	}
+	if q.Children[0].Operator != "adj4" || q.Children[0].Keywords[0].Fields[0] != fields.Title {
+		t.Fatalf("Unexpected proximity group %v", q.Children[0])
+	}
+	if q.Children[1].Operator != "adj3" || q.Children[1].Options[ir.InOrderOption] != true {
+		t.Fatalf("Unexpected proximity group %v", q.Children[1])
+	}
+}
+
+func TestProQuest_RoundTrip(t *testing.T) {
+	// A query compiled by the ProQuest backend parses back into the same query.
+	for _, query := range []string{
+		`(AB,TI(asthma) OR AB,TI(wheez*)) AND MESH.EXACT.EXPLODE("Asthma")`,
+		`(TI(asthma) OR AB(wheez*)) NOT MJMESH.EXACT("Child")`,
+		`(TI(wheez*) NEAR/2 TI(child*)) AND (AB(asthma) PRE/1 AB(attack*))`,
+	} {
+		q, err := NewProQuestParser().ParseString(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := backend.NewProQuestBackend().Compile(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := b.String()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != query {
+			t.Fatalf("Expected %v, got %v", query, got)
+		}
+	}
+}
@@ -1,14 +1,88 @@
 package parser
 
 import (
+	"fmt"
 	"github.com/hscells/transmute/fields"
 	"github.com/hscells/transmute/ir"
-	"log"
+	"github.com/hscells/transmute/lexer"
+	"regexp"
+	"strconv"
 	"strings"
 	"unicode"
 )
 
-type PubMedTransformer struct{}
+type PubMedTransformer struct {
+	// MinusExclusion treats a term with a leading minus, e.g. `asthma -pediatric`, as excluded from the terms before
+	// it, i.e. `asthma NOT pediatric`. Hyphenated terms such as `beta-blocker` are not affected.
+	MinusExclusion bool
+	// FieldPrefix allows the field of a term to come before the term, e.g. `tiab:asthma`, as well as after it, e.g.
+	// `asthma[tiab]`. The field must be in the field mapping.
+	FieldPrefix bool
+	// DropEmptyKeywords skips keywords in nested queries whose query string is empty or made up only of stop words.
+	DropEmptyKeywords bool
+	// StopWords is the set of stop words used by DropEmptyKeywords. When nil, DefaultStopWords is used.
+	StopWords map[string]bool
+	// Operators maps localised operators in lower case (e.g. FrenchOperators) to the operators of the ir. The English
+	// operators are always recognised.
+	Operators map[string]string
+	// AdjacencyOperator recognises proximity operators other than `adj`, e.g. `(?i)^near/[0-9]+$`. They are adjacency
+	// operators in the ir, with the distance that follows them, e.g. `NEAR/3` is `adj3`, so that every backend
+	// recognises them. When nil, only `adj` is an adjacency operator.
+	AdjacencyOperator *regexp.Regexp
+	// InlineNotes reads a note written inline with a term between `/*` and `*/`, e.g. `asthma /* chronic */[tiab]`,
+	// into the ir.NoteOption of the keyword, rather than as part of the term. Notes are not read unless it is set, so
+	// that a term containing `/*` is kept as it is.
+	InlineNotes bool
+
+	warner
+	explainer
+	termLimiter
+}
+
+// withWarnings returns a copy of the transformer which collects its warnings.
+func (t PubMedTransformer) withWarnings(warnings *[]ir.Warning) QueryTransformer {
+	t.warner = warner{warnings: warnings}
+	return t
+}
+
+// localisedOperators returns the localised operators of the transformer.
+func (t PubMedTransformer) localisedOperators() map[string]string {
+	return t.Operators
+}
+
+// adjacencyOperator returns the proximity operators of the transformer.
+func (t PubMedTransformer) adjacencyOperator() *regexp.Regexp {
+	return t.AdjacencyOperator
+}
+
+// operator maps a localised or proximity operator to the operator of the ir. Any other token is returned unchanged.
+func (t PubMedTransformer) operator(token string) string {
+	return canonicalAdjacency(canonicalOperator(token, t.Operators), t.AdjacencyOperator)
+}
+
+// withExplanations returns a copy of the transformer which records how it interprets the tokens of a query.
+func (t PubMedTransformer) withExplanations(explanations *[]TokenExplanation) QueryTransformer {
+	t.explainer = explainer{explanations: explanations}
+	return t
+}
+
+// withTermLimit returns a copy of the transformer which counts the keywords it creates against a limit.
+func (t PubMedTransformer) withTermLimit(limit termLimiter) QueryTransformer {
+	t.termLimiter = limit
+	return t
+}
+
+var pubmedProximityRegexp, _ = regexp.Compile(`:~\s*([0-9]+)\s*$`)
+var pubmedNoteRegexp, _ = regexp.Compile(`/\*(.*?)\*/`)
+var pubmedFieldPrefixRegexp, _ = regexp.Compile(`^\s*([A-Za-z][A-Za-z /-]*):\s*([^\s].*)$`)
+var pubmedRelativeDateRegexp, _ = regexp.Compile(`(?i)^"?\s*last\s+([0-9]+)\s+(day|month|year)s?\s*"?$`)
+var pubmedExplosionRegexp, _ = regexp.Compile(`(?i)\s*:\s*(no)?exp\s*$`)
+var pubmedFuzzyRegexp, _ = regexp.Compile(`^\s*([^\s"~]+)~([0-9]+)\s*$`)
+var pubmedBoostRegexp, _ = regexp.Compile(`^\s*(.*[^\s])\^([0-9]*\.?[0-9]+)\s*$`)
+
+// pubmedMetadataRegexp matches the start of the settings which a search exported from PubMed can end with, and which
+// are not part of the query, e.g. `Sort by: Most Recent` or `Filters: Humans, English`.
+var pubmedMetadataRegexp, _ = regexp.Compile(`(?i)\b(sort by|filters( applied)?|display options|search details)\s*:`)
 
 var PubMedFieldMapping = map[string][]string{
 	"Mesh":                              {fields.MeshHeadings},
@@ -18,6 +92,7 @@ var PubMedFieldMapping = map[string][]string{
 	"Mesh Terms":                        {fields.MeshHeadings},
 	"mesh terms":                        {fields.MeshHeadings},
 	"MAJR":                              {fields.MajorFocusMeshHeading},
+	"majr":                              {fields.MajorFocusMeshHeading},
 	"mesh major topic":                  {fields.MajorFocusMeshHeading},
 	"Subheading":                        {fields.FloatingMeshHeadings},
 	"subheading":                        {fields.FloatingMeshHeadings},
@@ -77,6 +152,9 @@ var PubMedFieldMapping = map[string][]string{
 	"pt":                                {fields.PublicationType},
 	"sb":                                {fields.PublicationStatus},
 	"tiab":                              {fields.TitleAbstract},
+	"dp":                                {fields.PublicationDate},
+	"pdat":                              {fields.PublicationDate},
+	"edat":                              {fields.DateEntrez},
 	"text":                              {fields.TitleAbstract},
 	fields.Affiliation:                  {fields.Affiliation},
 	fields.AllFields:                    {fields.AllFields},
@@ -131,35 +209,181 @@ var PubMedFieldMapping = map[string][]string{
 	"default":                           {fields.AllFields},
 }
 
+// pubmedFieldIndex finds the start of the field of a term, i.e. the first `[` that is not escaped with a backslash. If
+// the term does not have a field, -1 is returned.
+func pubmedFieldIndex(query string) int {
+	escaped := false
+	for i, char := range query {
+		switch {
+		case escaped:
+			escaped = false
+		case char == '\\':
+			escaped = true
+		case char == '[':
+			return i
+		}
+	}
+	return -1
+}
+
+// pubmedUnescape removes the backslashes from the escaped characters in a term, so `TNF-\[alpha\]` becomes
+// `TNF-[alpha]`.
+func pubmedUnescape(query string) string {
+	var s []rune
+	escaped := false
+	for _, char := range query {
+		if char == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		s = append(s, char)
+	}
+	return string(s)
+}
+
+// isPubMedDate determines if the fields of a keyword are a date field.
+func isPubMedDate(f []string) bool {
+	if len(f) != 1 {
+		return false
+	}
+	switch f[0] {
+	case fields.PublicationDate, fields.DatePublication, fields.DateEntrez, fields.DateCreate, fields.DateCompletion,
+		fields.DateMeSH, fields.DateModification:
+		return true
+	}
+	return false
+}
+
+// isPubMedHeading determines if the fields of a keyword are a MeSH heading field.
+func isPubMedHeading(f []string) bool {
+	return len(f) == 1 && (f[0] == fields.MeshHeadings || f[0] == fields.MajorFocusMeshHeading || f[0] == fields.MeSHMajorTopic)
+}
+
+// pubmedSubheading splits a MeSH heading qualified by a subheading, e.g. `asthma/drug therapy`, into the heading and
+// the subheading.
+func pubmedSubheading(queryString string) (string, string, bool) {
+	qs := strings.Trim(strings.TrimSpace(queryString), `"`)
+	i := strings.LastIndex(qs, "/")
+	if i <= 0 || i == len(qs)-1 {
+		return queryString, "", false
+	}
+	return strings.TrimSpace(qs[:i]), strings.TrimSpace(qs[i+1:]), true
+}
+
+// pubmedExistsHedges are the PubMed terms which only require a field to be present in a document, e.g. `hasabstract`,
+// and the fields they require.
+var pubmedExistsHedges = map[string]string{
+	"hasabstract": fields.Abstract,
+}
+
+// TransformSingle transforms a single PubMed term, e.g. `asthma[tiab]`, into a keyword.
 func (t PubMedTransformer) TransformSingle(query string, mapping map[string][]string) ir.Keyword {
+	var notes []string
+	if t.InlineNotes {
+		query, notes = splitPubMedNotes(query)
+	}
+	k := t.transformSingle(query, mapping)
+	if len(notes) > 0 {
+		options := make(map[string]interface{}, len(k.Options)+1)
+		for key, v := range k.Options {
+			options[key] = v
+		}
+		options[ir.NoteOption] = strings.Join(notes, "; ")
+		k.Options = options
+	}
+	return k
+}
+
+// splitPubMedNotes removes the notes written inline with a term, e.g. `/* chronic */`, from the term, and returns them.
+func splitPubMedNotes(query string) (string, []string) {
+	var notes []string
+	for _, m := range pubmedNoteRegexp.FindAllStringSubmatch(query, -1) {
+		if note := strings.TrimSpace(m[1]); len(note) > 0 {
+			notes = append(notes, note)
+		}
+	}
+	if len(notes) == 0 {
+		return query, nil
+	}
+	return strings.TrimSpace(pubmedNoteRegexp.ReplaceAllString(query, " ")), notes
+}
+
+// joinPubMedNotes joins the tokens of a note written inline with a term (see InlineNotes) into a single token, so that
+// the words of the note are not read as operators.
+func joinPubMedNotes(tokens []string) []string {
+	var joined []string
+	inside := false
+	for _, token := range tokens {
+		if inside {
+			joined[len(joined)-1] += " " + token
+		} else {
+			joined = append(joined, token)
+		}
+		if i := strings.LastIndex(token, "/*"); i >= 0 {
+			inside = !strings.Contains(token[i:], "*/")
+		} else if strings.Contains(token, "*/") {
+			inside = false
+		}
+	}
+	return joined
+}
+
+// transformSingle transforms a single PubMed term, once any inline notes are removed from it.
+func (t PubMedTransformer) transformSingle(query string, mapping map[string][]string) ir.Keyword {
+	// A hedge such as `hasabstract` is a keyword without a query string which only requires its field to be present.
+	if field, ok := pubmedExistsHedges[strings.ToLower(strings.TrimSpace(query))]; ok {
+		return ir.Keyword{Fields: []string{field}, Options: map[string]interface{}{ir.ExistsOption: true}}
+	}
+
+	// A field that comes before the term, e.g. `tiab:asthma`, is moved after the term, e.g. `asthma[tiab]`.
+	if t.FieldPrefix && pubmedFieldIndex(query) < 0 {
+		if m := pubmedFieldPrefixRegexp.FindStringSubmatch(query); len(m) == 3 {
+			if _, ok := mapping[m[1]]; ok {
+				query = fmt.Sprintf("%s[%s]", strings.TrimSpace(m[2]), m[1])
+			}
+		}
+	}
+
 	var queryString string
 	var queryFields []string
-	exploded := true
+	var options map[string]interface{}
+	// Only MeSH headings can be exploded, so a keyword is only exploded when the field is a MeSH heading.
+	exploded := false
 
-	if strings.ContainsRune(query, '[') {
+	if i := pubmedFieldIndex(query); i >= 0 {
 		// This query string most likely has a field.
-		parts := strings.Split(query, "[")
-		queryString = parts[0]
+		parts := strings.Split(query[i+1:], "[")
+		queryString = query[:i]
 		// This might be a field, but needs some processing.
-		possibleField := strings.Replace(parts[1], "]", "", -1)
+		possibleField := strings.Replace(parts[0], "]", "", -1)
 
 		// Set the exploded option on the keyword.
-		if strings.Contains(strings.ToLower(possibleField), "mesh") || strings.Contains(strings.ToLower(possibleField), "heading") {
+		if f := strings.ToLower(possibleField); strings.Contains(f, "mesh") || strings.Contains(f, "heading") || strings.Contains(f, "majr") {
 			exploded = true
 		}
 
-		// PubMed fields have this weird thing where they specify the mesh explosion in the field.
-		// This is handled in this step.
-		if strings.Contains(strings.ToLower(possibleField), ":noexp") {
-			exploded = false
-			possibleField = strings.Replace(strings.ToLower(possibleField), ":noexp", "", -1)
+		// Phrases may also specify the proximity of the terms in the phrase in the field, e.g. `"heart attack"[tiab:~3]`.
+		if m := pubmedProximityRegexp.FindStringSubmatch(possibleField); len(m) == 2 {
+			distance, err := strconv.Atoi(m[1])
+			if err == nil {
+				options = map[string]interface{}{ir.ProximityOption: distance}
+			}
+			possibleField = strings.TrimSpace(possibleField[:len(possibleField)-len(m[0])])
+		}
+
+		// PubMed fields have this weird thing where they specify the mesh explosion in the field, either explicitly
+		// exploded (`:exp`) or not (`:noexp`). This is handled in this step.
+		if m := pubmedExplosionRegexp.FindStringSubmatch(possibleField); len(m) == 2 {
+			exploded = len(m[1]) == 0
+			possibleField = strings.ToLower(possibleField[:len(possibleField)-len(m[0])])
 		}
 
 		// If we are unable to map the field then we can explode.
 		if field, ok := mapping[possibleField]; ok {
 			queryFields = field
 		} else {
-			log.Printf("the field `%v` does not have a mapping defined\n", possibleField)
+			t.warn(nil, "the field `%v` of `%v` does not have a mapping defined, using the default fields", possibleField, query)
 			queryFields = mapping["default"]
 		}
 	} else {
@@ -168,10 +392,53 @@ func (t PubMedTransformer) TransformSingle(query string, mapping map[string][]st
 
 	// Add a default field to the keyword if none have been defined.
 	if len(queryFields) == 0 {
-		log.Printf("using default field (%v) since %v has no queryFields\n", mapping["default"], query)
+		t.warn(nil, "using default field (%v) since %v has no queryFields", mapping["default"], query)
 		queryFields = mapping["default"]
 	}
 
+	// A MeSH heading may be qualified by a subheading, e.g. `asthma/drug therapy[majr]`.
+	if isPubMedHeading(queryFields) {
+		if heading, subheading, ok := pubmedSubheading(queryString); ok {
+			if options == nil {
+				options = make(map[string]interface{})
+			}
+			options[ir.SubheadingOption] = subheading
+			queryString = heading
+		}
+	}
+
+	// Date fields may be searched relative to the date the query is run, e.g. `"last 5 years"[dp]`.
+	if m := pubmedRelativeDateRegexp.FindStringSubmatch(queryString); len(m) == 3 && isPubMedDate(queryFields) {
+		if n, err := strconv.Atoi(m[1]); err == nil {
+			if options == nil {
+				options = make(map[string]interface{})
+			}
+			options[ir.RelativeDateOption] = ir.RelativeDate{Amount: n, Unit: strings.ToLower(m[2]) + "s"}
+		}
+	}
+
+	// A keyword followed by a weight, e.g. `asthma^2`, is boosted when ranking the documents it matches.
+	if m := pubmedBoostRegexp.FindStringSubmatch(queryString); len(m) == 3 {
+		if boost, err := strconv.ParseFloat(m[2], 64); err == nil {
+			if options == nil {
+				options = make(map[string]interface{})
+			}
+			options[ir.BoostOption] = boost
+			queryString = m[1]
+		}
+	}
+
+	// A term followed by an edit distance, e.g. `tumour~2`, is a fuzzy term rather than a truncated term.
+	if m := pubmedFuzzyRegexp.FindStringSubmatch(queryString); len(m) == 3 {
+		if n, err := strconv.Atoi(m[2]); err == nil {
+			if options == nil {
+				options = make(map[string]interface{})
+			}
+			options[ir.FuzzinessOption] = n
+			queryString = m[1]
+		}
+	}
+
 	// PubMed uses $ to represent the stem of a word. Instead let's just replace it by the wildcard operator.
 	truncated := false
 	if strings.ContainsAny(queryString, "*$?~") {
@@ -182,19 +449,184 @@ func (t PubMedTransformer) TransformSingle(query string, mapping map[string][]st
 	queryString = strings.Replace(queryString, "~", "*", -1)
 	//queryString = strings.Replace(queryString, "*", " ", -1)
 
-	queryString = strings.TrimSpace(queryString)
+	// Escaped characters, e.g. `\[`, are literal characters of the query string.
+	queryString = strings.TrimSpace(pubmedUnescape(queryString))
 
 	return ir.Keyword{
 		QueryString: queryString,
 		Fields:      queryFields,
 		Exploded:    exploded,
 		Truncated:   truncated,
+		Options:     options,
 	}
 }
 
 func (t PubMedTransformer) TransformNested(query string, mapping map[string][]string) ir.BooleanQuery {
+	query, metadata := splitPubMedMetadata(query)
+	if t.MinusExclusion {
+		query = t.rewriteExclusions(query)
+	}
 	query = ReversePreservingCombiningCharacters(reverse(query))
-	return t.ParseInfixKeywords(query, mapping)
+	q, err := t.parseNested(query, mapping)
+	if err != nil {
+		if t.termsExceeded() {
+			// The query has too many keywords to be transformed some other way.
+			return ir.BooleanQuery{}
+		}
+		// Text after the last field or group that cannot be parsed is not part of the query, so it is kept with the
+		// metadata rather than losing the query before it.
+		if i := strings.LastIndexAny(query, "])"); i >= 0 && len(strings.TrimSpace(query[i+1:])) > 0 {
+			if q, err := t.parseNested(query[:i+1], mapping); err == nil {
+				trailing := strings.TrimSpace(query[i+1:])
+				t.warn(nil, "unable to parse `%v` at the end of the query, keeping it as metadata of the query", trailing)
+				return withMetadata(q, append([]string{trailing}, metadata...))
+			}
+		}
+		t.warn(nil, "unable to parse `%v` (%v), falling back to reading the operators left to right", query, err)
+		return withMetadata(t.ParseInfixKeywords(query, mapping), metadata)
+	}
+	return withMetadata(q, metadata)
+}
+
+// splitPubMedMetadata splits the settings at the end of a search exported from PubMed (see pubmedMetadataRegexp) from
+// the query, e.g. `Sort by: Most Recent`, so that they do not stop the query from being parsed. Each setting is
+// returned separately.
+func splitPubMedMetadata(query string) (string, []string) {
+	locs := pubmedMetadataRegexp.FindAllStringIndex(query, -1)
+	if len(locs) == 0 {
+		return query, nil
+	}
+	var metadata []string
+	for i, loc := range locs {
+		end := len(query)
+		if i+1 < len(locs) {
+			end = locs[i+1][0]
+		}
+		metadata = append(metadata, strings.TrimSpace(query[loc[0]:end]))
+	}
+	return strings.TrimSpace(query[:locs[0][0]]), metadata
+}
+
+// withMetadata adds the text which is not part of a query to the MetadataOption of the query. The options are copied,
+// so options shared between queries are not modified.
+func withMetadata(q ir.BooleanQuery, metadata []string) ir.BooleanQuery {
+	if len(metadata) == 0 {
+		return q
+	}
+	options := make(map[string]interface{}, len(q.Options)+1)
+	for k, v := range q.Options {
+		options[k] = v
+	}
+	options[ir.MetadataOption] = metadata
+	q.Options = options
+	return q
+}
+
+// pubmedOperator determines if a token is a PubMed operator. PubMed reads `AND`, `OR`, and `NOT` from left to right,
+// so they bind equally tightly, e.g. `a OR b AND c` is `(a OR b) AND c`. Adjacency binds tightest.
+func (t PubMedTransformer) pubmedOperator(token string) (infixOperator, bool) {
+	token = t.operator(strings.ToLower(token))
+	switch {
+	case token == "or", token == "and", token == "not":
+		return infixOperator{Operator: token, Precedence: 0}, true
+	case defaultAdjacencyRegexp.MatchString(token):
+		return infixOperator{Operator: token, Precedence: 1}, true
+	}
+	return infixOperator{}, false
+}
+
+// parseNested parses a nested PubMed query. Consecutive terms that are not separated by an operator, e.g.
+// `heart attack[tiab]` or `asthma[MeSH Terms]`, are a single keyword.
+func (t PubMedTransformer) parseNested(query string, mapping map[string][]string) (ir.BooleanQuery, error) {
+	tokens := tokeniseInfix(query, `"`)
+	if t.InlineNotes {
+		tokens = joinPubMedNotes(tokens)
+	}
+	ip := infixParser{
+		tokens:   tokens,
+		operator: t.pubmedOperator,
+		keyword: func(text string) ir.Keyword {
+			return t.TransformSingle(text, mapping)
+		},
+		explain: t.explanations,
+		limit:   t.termLimiter,
+	}
+	q, err := ip.Parse()
+	if err != nil {
+		return ir.BooleanQuery{}, err
+	}
+	q = t.dropKeywords(q)
+	if len(q.Operator) == 0 {
+		return q, nil
+	}
+	// Like ParseInfixKeywords, the query is wrapped in a group without an operator.
+	return ir.BooleanQuery{Children: []ir.BooleanQuery{q}}, nil
+}
+
+// dropKeywords removes the keywords from a query which have an empty query string, or which are made up only of stop
+// words when DropEmptyKeywords is set (see dropKeywords).
+func (t PubMedTransformer) dropKeywords(q ir.BooleanQuery) ir.BooleanQuery {
+	return dropKeywords(q, func(k ir.Keyword) bool {
+		if !(t.DropEmptyKeywords && isEmptyKeyword(k, t.StopWords)) {
+			return true
+		}
+		t.warn(&k, "dropped an empty keyword, or a keyword made up only of stop words")
+		return false
+	})
+}
+
+// rewriteExclusions rewrites terms excluded with a leading minus as `NOT` operators against everything before them in
+// the same group, so `asthma OR wheeze -pediatric` becomes `((asthma OR wheeze) NOT pediatric)`. A minus is only an
+// exclusion at the start of an unquoted term that follows another term, so hyphenated terms such as `beta-blocker`
+// and a minus at the start of a group are left alone.
+func (t PubMedTransformer) rewriteExclusions(query string) string {
+	// groups contains the text of each group that has been opened but not yet closed.
+	groups := []string{""}
+	insideQuote := false
+	excluded := false
+	prev := ' '
+	// previousTerm is the last complete term, which must exist and must not be an operator for a minus to exclude.
+	previousTerm, term := "", ""
+	for i, char := range query {
+		current := len(groups) - 1
+		if char == '"' && prev != '\\' {
+			insideQuote = !insideQuote
+		}
+		if !insideQuote && char == '-' && unicode.IsSpace(prev) && i+1 < len(query) && !unicode.IsSpace(rune(query[i+1])) &&
+			len(previousTerm) > 0 && !t.IsOperator(strings.ToLower(previousTerm)) {
+			groups[current] = "(" + strings.TrimSpace(groups[current]) + ") NOT "
+			excluded = true
+			prev = char
+			continue
+		}
+		switch {
+		case insideQuote:
+			groups[current] += string(char)
+			term += string(char)
+		case char == '(':
+			groups = append(groups, "")
+			previousTerm, term = "", ""
+		case char == ')' && current > 0:
+			inner := groups[current]
+			groups = groups[:current]
+			groups[current-1] += "(" + inner + ")"
+			previousTerm, term = ")", ""
+		case unicode.IsSpace(char):
+			groups[current] += string(char)
+			if len(term) > 0 {
+				previousTerm = term
+			}
+			term = ""
+		default:
+			groups[current] += string(char)
+			term += string(char)
+		}
+		prev = char
+	}
+	if !excluded {
+		return query
+	}
+	return "(" + strings.Join(groups, "") + ")"
 }
 
 func (t PubMedTransformer) RemoveParenthesis(expr []string) []string {
@@ -257,8 +689,20 @@ func (t PubMedTransformer) ParseInfixKeywords(line string, mapping map[string][]
 
 	depth := 0
 	insideQuote := false
+	escaped := false
 
 	for _, char := range line {
+		// A backslash escapes the next character, e.g. `\[` or `\"`, which is kept in the keyword as-is so that it is
+		// not treated as the start of a field or a quote.
+		if escaped || char == '\\' {
+			escaped = !escaped
+			currentToken += string(char)
+			if depth == 0 {
+				endTokens += string(char)
+			}
+			continue
+		}
+
 		// Here we attempt to parse a keyword that is quoted.
 		if char == '"' && !insideQuote {
 			insideQuote = true
@@ -278,7 +722,7 @@ func (t PubMedTransformer) ParseInfixKeywords(line string, mapping map[string][]
 			if t.IsOperator(tok) {
 				keyword = previousToken
 				stack = append(stack, strings.TrimSpace(keyword))
-				stack = append(stack, strings.TrimSpace(tok))
+				stack = append(stack, t.operator(strings.TrimSpace(tok)))
 				previousToken = ""
 				keyword = ""
 			} else {
@@ -293,7 +737,7 @@ func (t PubMedTransformer) ParseInfixKeywords(line string, mapping map[string][]
 			continue
 		} else if char == ')' {
 			depth--
-			if len(keyword) > 0 || len(currentToken) > 0 {
+			if len(keyword) > 0 || len(currentToken) > 0 || len(strings.TrimSpace(previousToken)) > 0 {
 				stack = append(stack, strings.TrimSpace(keyword+" "+previousToken+" "+currentToken))
 				keyword = ""
 				currentToken = ""
@@ -315,7 +759,7 @@ func (t PubMedTransformer) ParseInfixKeywords(line string, mapping map[string][]
 	}
 
 	prefix := t.ConvertInfixToPrefix(stack)
-	if prefix[0] == "(" && prefix[len(prefix)-1] == ")" {
+	if len(prefix) > 0 && prefix[0] == "(" && prefix[len(prefix)-1] == ")" {
 		prefix = prefix[1 : len(prefix)-1]
 	}
 
@@ -429,10 +873,11 @@ func (t PubMedTransformer) ConvertInfixToPrefix(infix []string) []string {
 
 // IsOperator tests to see if a string is a valid PubMed/Medline operator.
 func (t PubMedTransformer) IsOperator(s string) bool {
+	s = t.operator(s)
 	return s == "or" ||
 		s == "and" ||
 		s == "not" ||
-		adjMatchRegexp.MatchString(s)
+		defaultAdjacencyRegexp.MatchString(s)
 }
 
 // transformPrefixGroupToQueryGroup transforms a prefix syntax tree into a query group. The new QueryGroup is built by
@@ -444,7 +889,7 @@ func (t PubMedTransformer) TransformPrefixGroupToQueryGroup(prefix []string, que
 
 	token := prefix[0]
 	if t.IsOperator(token) {
-		queryGroup.Operator = token
+		queryGroup.Operator = t.operator(token)
 	} else if token == "(" {
 		var subGroup ir.BooleanQuery
 		prefix, subGroup = t.TransformPrefixGroupToQueryGroup(prefix[1:], ir.BooleanQuery{}, mapping)
@@ -465,12 +910,20 @@ func (t PubMedTransformer) TransformPrefixGroupToQueryGroup(prefix []string, que
 	} else {
 		if len(token) > 0 {
 			k := t.TransformSingle(token, mapping)
-			queryGroup.Keywords = append(queryGroup.Keywords, k)
+			if !(t.DropEmptyKeywords && isEmptyKeyword(k, t.StopWords)) {
+				queryGroup.Keywords = append(queryGroup.Keywords, k)
+			} else {
+				t.warn(&k, "dropped an empty keyword, or a keyword made up only of stop words")
+			}
 		}
 	}
 	return t.TransformPrefixGroupToQueryGroup(prefix[1:], queryGroup, mapping)
 }
 
 func NewPubMedParser() QueryParser {
-	return QueryParser{FieldMapping: PubMedFieldMapping, Parser: PubMedTransformer{}}
+	return QueryParser{
+		FieldMapping: PubMedFieldMapping,
+		Parser:       PubMedTransformer{},
+		LexOptions:   lexer.LexOptions{FormatParenthesis: true},
+	}
 }
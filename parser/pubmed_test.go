@@ -1,7 +1,13 @@
 package parser
 
 import (
+	"github.com/hscells/transmute/backend"
+	"github.com/hscells/transmute/fields"
+	"github.com/hscells/transmute/ir"
 	"github.com/hscells/transmute/lexer"
+	"reflect"
+	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -15,7 +21,7 @@ func TestPubMed_BooleanQuery_Terms(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	queryRep := NewPubMedParser().Parse(ast)
+	queryRep, err := NewPubMedParser().Parse(ast)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -32,7 +38,7 @@ func TestPubMed_BooleanQuery_Fields(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	queryRep := NewPubMedParser().Parse(ast)
+	queryRep, err := NewPubMedParser().Parse(ast)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -49,7 +55,7 @@ func TestPubMed_BooleanQuery_FieldCount(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	queryRep := NewPubMedParser().Parse(ast)
+	queryRep, err := NewPubMedParser().Parse(ast)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -60,3 +66,561 @@ func TestPubMed_BooleanQuery_FieldCount(t *testing.T) {
 		t.Fatalf("Expected %v fields, got %v", expected, got)
 	}
 }
+
+func TestPubMed_Proximity(t *testing.T) {
+	k := PubMedTransformer{}.TransformSingle(`"heart attack"[tiab:~3]`, PubMedFieldMapping)
+
+	if k.QueryString != `"heart attack"` {
+		t.Fatalf("Expected query string %v, got %v", `"heart attack"`, k.QueryString)
+	}
+	if len(k.Fields) != 1 || k.Fields[0] != fields.TitleAbstract {
+		t.Fatalf("Expected fields %v, got %v", []string{fields.TitleAbstract}, k.Fields)
+	}
+	if k.Options[ir.ProximityOption] != 3 {
+		t.Fatalf("Expected proximity of %v, got %v", 3, k.Options[ir.ProximityOption])
+	}
+}
+
+func TestPubMed_ProximityNested(t *testing.T) {
+	ast, err := lexer.Lex(`("heart attack"[tiab:~3] OR asthma[tiab])`, lexOptionsPubMed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queryRep, err := NewPubMedParser().Parse(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := 2
+	got := len(queryRep.Terms())
+	if expected != got {
+		t.Fatalf("Expected %v terms, got %v", expected, got)
+	}
+	k := queryRep.Children[0].Keywords[0]
+	if k.Options[ir.ProximityOption] != 3 {
+		t.Fatalf("Expected proximity of %v, got %v", 3, k.Options[ir.ProximityOption])
+	}
+}
+
+func TestPubMed_DropEmptyKeywords(t *testing.T) {
+	query := `(the[tiab] OR asthma[tiab] OR wheeze[tiab])`
+	ast, err := lexer.Lex(query, lexOptionsPubMed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queryRep, err := NewPubMedParser().Parse(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(queryRep.Terms()); got != 3 {
+		t.Fatalf("Expected %v terms, got %v", 3, got)
+	}
+
+	p := QueryParser{FieldMapping: PubMedFieldMapping, Parser: PubMedTransformer{DropEmptyKeywords: true}}
+	queryRep, err = p.Parse(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(queryRep.Terms()); got != 2 {
+		t.Fatalf("Expected %v terms, got %v", 2, got)
+	}
+
+	p = QueryParser{FieldMapping: PubMedFieldMapping, Parser: PubMedTransformer{DropEmptyKeywords: true, StopWords: map[string]bool{"wheeze": true}}}
+	queryRep, err = p.Parse(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(queryRep.Terms()); got != 2 {
+		t.Fatalf("Expected %v terms, got %v", 2, got)
+	}
+	for _, term := range queryRep.Terms() {
+		if term == "wheeze" {
+			t.Fatalf("Expected stop word %v to be dropped", term)
+		}
+	}
+
+	// A group left with a single operand is replaced by the operand, and a group left without operands is removed.
+	p = QueryParser{FieldMapping: PubMedFieldMapping, Parser: PubMedTransformer{DropEmptyKeywords: true}, LexOptions: lexOptionsPubMed}
+	for query, expected := range map[string]string{
+		`(the[tiab] OR asthma[tiab]) AND child[tiab]`:               "asthma[title_abstract] AND child[title_abstract]",
+		`((the[tiab] OR of[tiab]) OR asthma[tiab]) AND child[tiab]`: "asthma[title_abstract] AND child[title_abstract]",
+		`asthma[tiab] NOT (the[tiab] OR child[tiab])`:               "asthma[title_abstract] NOT child[title_abstract]",
+		`the[tiab] NOT asthma[tiab]`:                                "",
+	} {
+		queryRep, err = p.ParseString(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := queryRep.String(); s != expected {
+			t.Fatalf("Expected %v for %v, got %v", expected, query, s)
+		}
+	}
+}
+
+func TestPubMed_DanglingOperator(t *testing.T) {
+	for _, operator := range []string{"AND", "OR", "NOT"} {
+		query := "(asthma[tiab] " + operator + ")"
+		ast, err := lexer.Lex(query, lexOptionsPubMed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewPubMedParser().Parse(ast); err == nil {
+			t.Fatalf("Expected an error for dangling operator in %v", query)
+		}
+	}
+}
+
+// countOperator counts the groups in a query with an operator.
+func countOperator(q ir.BooleanQuery, operator string) (n int) {
+	ir.Walk(&q, ir.VisitorFuncs{Query: func(q *ir.BooleanQuery) bool {
+		if q.Operator == operator {
+			n++
+		}
+		return true
+	}})
+	return
+}
+
+func TestPubMed_MinusExclusion(t *testing.T) {
+	p := QueryParser{FieldMapping: PubMedFieldMapping, Parser: PubMedTransformer{MinusExclusion: true}}
+
+	queries := map[string][]string{
+		`asthma[tiab] -pediatric[tiab]`:                   {"asthma", "pediatric"},
+		`(asthma[tiab] -pediatric[tiab])`:                 {"asthma", "pediatric"},
+		`(asthma[tiab] OR wheeze[tiab] -pediatric[tiab])`: {"pediatric", "asthma", "wheeze"},
+	}
+	for query, expected := range queries {
+		ast, err := lexer.Lex(query, lexOptionsPubMed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q, err := p.Parse(ast)
+		if err != nil {
+			t.Fatal(err)
+		}
+		terms := q.Terms()
+		if strings.Join(terms, " ") != strings.Join(expected, " ") {
+			t.Fatalf("Expected terms %v, got %v", expected, terms)
+		}
+		if countOperator(q, "not") != 1 {
+			t.Fatalf("Expected a not group in %v", q)
+		}
+	}
+
+	// Hyphenated terms are not exclusions.
+	ast, err := lexer.Lex(`(beta-blocker[tiab] OR asthma[tiab])`, lexOptionsPubMed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := p.Parse(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	terms := q.Terms()
+	if len(terms) != 2 || terms[0] != "beta-blocker" {
+		t.Fatalf("Expected terms %v, got %v", []string{"beta-blocker", "asthma"}, terms)
+	}
+	if countOperator(q, "not") != 0 {
+		t.Fatalf("Expected no not group in %v", q)
+	}
+
+	// Without the option, a minus is part of the term.
+	ast, err = lexer.Lex(`(asthma[tiab] -pediatric[tiab])`, lexOptionsPubMed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err = NewPubMedParser().Parse(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if countOperator(q, "not") != 0 {
+		t.Fatalf("Expected no not group in %v", q)
+	}
+}
+
+func TestPubMed_FieldPrefix(t *testing.T) {
+	p := PubMedTransformer{FieldPrefix: true}
+
+	expected := PubMedTransformer{}.TransformSingle(`asthma[tiab]`, PubMedFieldMapping)
+	got := p.TransformSingle(`tiab:asthma`, PubMedFieldMapping)
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("Expected %v, got %v", expected, got)
+	}
+
+	expected = PubMedTransformer{}.TransformSingle(`"heart attack"[Mesh]`, PubMedFieldMapping)
+	got = p.TransformSingle(`Mesh:"heart attack"`, PubMedFieldMapping)
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("Expected %v, got %v", expected, got)
+	}
+
+	// Without the option, the prefix is part of the term.
+	got = PubMedTransformer{}.TransformSingle(`tiab:asthma`, PubMedFieldMapping)
+	if got.QueryString != "tiab:asthma" {
+		t.Fatalf("Expected query string %v, got %v", "tiab:asthma", got.QueryString)
+	}
+
+	// Unknown fields are not treated as prefixes.
+	got = p.TransformSingle(`covid:19`, PubMedFieldMapping)
+	if got.QueryString != "covid:19" {
+		t.Fatalf("Expected query string %v, got %v", "covid:19", got.QueryString)
+	}
+}
+
+func TestPubMed_EscapedCharacters(t *testing.T) {
+	queries := map[string][]string{
+		`(TNF-\[alpha\][tiab] OR asthma[tiab])`:       {"TNF-[alpha]", "asthma"},
+		`(IL\]6[tiab] OR asthma[tiab])`:               {"IL]6", "asthma"},
+		`("the \"best\" drug"[tiab] OR asthma[tiab])`: {`"the "best" drug"`, "asthma"},
+		`TNF-\[alpha\][tiab]`:                         {"TNF-[alpha]"},
+	}
+	for query, expected := range queries {
+		ast, err := lexer.Lex(query, lexer.LexOptions{FormatParenthesis: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		q, err := NewPubMedParser().Parse(ast)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(q.Terms(), expected) {
+			t.Fatalf("Expected terms %v, got %v", expected, q.Terms())
+		}
+		for _, keyword := range q.Keywords {
+			if len(keyword.Fields) != 1 || keyword.Fields[0] != fields.TitleAbstract {
+				t.Fatalf("Expected fields %v for %v, got %v", fields.TitleAbstract, keyword.QueryString, keyword.Fields)
+			}
+		}
+	}
+}
+
+func TestPubMed_ExplosionSuffix(t *testing.T) {
+	for _, c := range []struct {
+		query    string
+		exploded bool
+	}{
+		{`asthma[Mesh:exp]`, true},
+		{`asthma[Mesh:noexp]`, false},
+		{`asthma[MeSH Terms:exp]`, true},
+		{`asthma[MeSH Terms:noexp]`, false},
+	} {
+		k := PubMedTransformer{}.TransformSingle(c.query, PubMedFieldMapping)
+		if k.QueryString != "asthma" || k.Exploded != c.exploded {
+			t.Fatalf("Expected %v to be exploded=%v, got %v", c.query, c.exploded, k)
+		}
+		if !reflect.DeepEqual(k.Fields, []string{fields.MeshHeadings}) {
+			t.Fatalf("Expected %v to have the fields %v, got %v", c.query, []string{fields.MeshHeadings}, k.Fields)
+		}
+	}
+}
+
+func TestPubMed_WildcardPositions(t *testing.T) {
+	ast, err := lexer.Lex(`(*ectomy[tiab] OR gastr*itis[tiab] OR child*[tiab])`, lexOptionsPubMed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := NewPubMedParser().Parse(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]ir.WildcardPosition{
+		"*ectomy":    ir.LeadingWildcard,
+		"gastr*itis": ir.InternalWildcard,
+		"child*":     ir.TrailingWildcard,
+	}
+	n := 0
+	ir.Walk(&q, ir.VisitorFuncs{Keyword: func(k *ir.Keyword) bool {
+		w := k.Wildcards()
+		if len(w) != 1 || w[0].Position != expected[k.QueryString] {
+			t.Fatalf("Expected %v to have a %v wildcard, got %v", k.QueryString, expected[k.QueryString], w)
+		}
+		n++
+		return true
+	}})
+	if n != len(expected) {
+		t.Fatalf("Expected %v keywords, got %v", len(expected), n)
+	}
+}
+
+func TestPubMed_RelativeDate(t *testing.T) {
+	for query, expected := range map[string]ir.RelativeDate{
+		`"last 5 years"[dp]`:    {Amount: 5, Unit: "years"},
+		`"last 10 years"[pdat]`: {Amount: 10, Unit: "years"},
+		`"last 30 days"[edat]`:  {Amount: 30, Unit: "days"},
+		`"Last 1 Month"[dp]`:    {Amount: 1, Unit: "months"},
+	} {
+		k := PubMedTransformer{}.TransformSingle(query, PubMedFieldMapping)
+		if got := k.Options[ir.RelativeDateOption]; got != expected {
+			t.Fatalf("Expected %v to be relative to %v, got %v", query, expected, got)
+		}
+	}
+
+	k := PubMedTransformer{}.TransformSingle(`"last 5 years"[dp]`, PubMedFieldMapping)
+	if !reflect.DeepEqual(k.Fields, []string{fields.PublicationDate}) {
+		t.Fatalf("Expected the fields %v, got %v", []string{fields.PublicationDate}, k.Fields)
+	}
+
+	// A phrase that is not searched in a date field is not a relative date.
+	k = PubMedTransformer{}.TransformSingle(`"last 5 years"[tiab]`, PubMedFieldMapping)
+	if _, ok := k.Options[ir.RelativeDateOption]; ok {
+		t.Fatalf("Expected %v not to be a relative date", k)
+	}
+}
+
+func TestPubMed_Fuzzy(t *testing.T) {
+	k := PubMedTransformer{}.TransformSingle("tumour~2[tiab]", PubMedFieldMapping)
+	if k.QueryString != "tumour" || k.Truncated || k.Options[ir.FuzzinessOption] != 2 {
+		t.Fatalf("Expected %v to be fuzzy with an edit distance of %v, got %v", "tumour", 2, k)
+	}
+
+	// A `~` without an edit distance is still a truncation.
+	k = PubMedTransformer{}.TransformSingle("tumour~[tiab]", PubMedFieldMapping)
+	if k.QueryString != "tumour*" || !k.Truncated {
+		t.Fatalf("Expected %v, got %v", "tumour*", k)
+	}
+	if _, ok := k.Options[ir.FuzzinessOption]; ok {
+		t.Fatalf("Expected %v not to be fuzzy", k)
+	}
+}
+
+func TestPubMed_MajorTopic(t *testing.T) {
+	queries := []struct {
+		query      string
+		heading    string
+		exploded   bool
+		subheading interface{}
+	}{
+		{"asthma[majr]", "asthma", true, nil},
+		{"asthma[majr:noexp]", "asthma", false, nil},
+		{"asthma/drug therapy[majr]", "asthma", true, "drug therapy"},
+		{`"asthma/drug therapy"[MAJR:noexp]`, "asthma", false, "drug therapy"},
+	}
+	for _, q := range queries {
+		k := PubMedTransformer{}.TransformSingle(q.query, PubMedFieldMapping)
+		if k.QueryString != q.heading || k.Exploded != q.exploded || k.Options[ir.SubheadingOption] != q.subheading ||
+			!reflect.DeepEqual(k.Fields, []string{fields.MajorFocusMeshHeading}) {
+			t.Fatalf("Unexpected keyword %v for %v", k, q.query)
+		}
+
+		// The subheading and explosion are kept when the keyword is compiled back into PubMed.
+		c, err := backend.NewPubmedBackend().Compile(ir.BooleanQuery{Keywords: []ir.Keyword{k}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := c.String()
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := PubMedTransformer{}.TransformSingle(strings.Trim(s, "()"), PubMedFieldMapping)
+		if r.QueryString != k.QueryString || r.Exploded != k.Exploded || r.Options[ir.SubheadingOption] != q.subheading {
+			t.Fatalf("Expected %v after a round trip through %v, got %v", k, s, r)
+		}
+	}
+}
+
+func TestPubMed_AdjacencyOperator(t *testing.T) {
+	if !(PubMedTransformer{}).IsOperator("adj10") || (PubMedTransformer{}).IsOperator("near/12") {
+		t.Fatalf("Expected only adj to be an adjacency operator by default")
+	}
+
+	near := regexp.MustCompile(`(?i)^near/[0-9]+$`)
+	p := NewPubMedParser()
+	p.Parser = PubMedTransformer{AdjacencyOperator: near}
+	q, err := p.ParseString("(asthma[tiab] NEAR/12 wheeze[tiab])")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(q.Children) != 1 || q.Children[0].Operator != "adj12" || len(q.Children[0].Keywords) != 2 {
+		t.Fatalf("Expected asthma and wheeze to be combined with adj12, got %v", q)
+	}
+	b, err := backend.NewMedlineBackend().Compile(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := b.String(); s != "1. asthma.ti,ab.\n2. wheeze.ti,ab.\n3. 1 adj12 2\n" {
+		t.Fatalf("Expected the adjacency to be compiled to Medline, got %v", s)
+	}
+
+	// The proximity operators are also recognised in the combining lines of a Medline query.
+	m := QueryParser{FieldMapping: MedlineFieldMapping, Parser: MedlineTransformer{AdjacencyOperator: near}}
+	q, err = m.ParseString("1. asthma.ti.\n2. wheeze.ti.\n3. 1 NEAR/3 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "asthma[title] ADJ3 wheeze[title]"; q.String() != expected {
+		t.Fatalf("Expected %v, got %v", expected, q.String())
+	}
+	if _, err := m.ParseString("1. asthma NEAR/3"); err == nil {
+		t.Fatalf("Expected an error for a dangling proximity operator")
+	}
+}
+
+func TestPubMed_Boost(t *testing.T) {
+	for query, expected := range map[string]float64{
+		"asthma^2[tiab]":           2,
+		`"heart attack"^1.5[tiab]`: 1.5,
+		"tumour~2^3[tiab]":         3,
+	} {
+		k := PubMedTransformer{}.TransformSingle(query, PubMedFieldMapping)
+		if k.Options[ir.BoostOption] != expected || strings.Contains(k.QueryString, "^") {
+			t.Fatalf("Expected %v to be boosted by %v, got %v", query, expected, k)
+		}
+	}
+}
+
+func TestPubMed_HasAbstract(t *testing.T) {
+	q, err := NewPubMedParser().ParseString("asthma[tiab] AND hasabstract")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "asthma[title_abstract] AND exists[text]"
+	if q.String() != expected {
+		t.Fatalf("Expected %v, got %v", expected, q.String())
+	}
+
+	c, err := backend.NewPubmedBackend().Compile(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := c.String()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "(asthma[Title/Abstract] AND hasabstract)"; s != expected {
+		t.Fatalf("Expected %v, got %v", expected, s)
+	}
+}
+
+func TestPubMed_TrailingMetadata(t *testing.T) {
+	queries := map[string]struct {
+		query    string
+		metadata []string
+	}{
+		`asthma[tiab] AND ("humans"[MeSH Terms])`: {`asthma[title_abstract] AND exp "humans"[mesh_terms]`, nil},
+		`asthma[tiab] AND ("humans"[MeSH Terms]) Sort by: Most Recent Filters: Humans, English`: {
+			`asthma[title_abstract] AND exp "humans"[mesh_terms]`, []string{"Sort by: Most Recent", "Filters: Humans, English"},
+		},
+		// Text which is not a known setting is kept when it cannot be parsed as part of the query.
+		`asthma[tiab] AND ("humans"[MeSH Terms]) Search results`: {
+			`asthma[title_abstract] AND exp "humans"[mesh_terms]`, []string{"Search results"},
+		},
+	}
+	for query, expected := range queries {
+		q, err := NewPubMedParser().ParseString(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if q.String() != expected.query {
+			t.Fatalf("Expected %v for %v, got %v", expected.query, query, q.String())
+		}
+		metadata, _ := q.Options[ir.MetadataOption].([]string)
+		if !reflect.DeepEqual(metadata, expected.metadata) {
+			t.Fatalf("Expected the metadata %v for %v, got %v", expected.metadata, query, metadata)
+		}
+	}
+}
+
+func TestPubMed_QuotedOperators(t *testing.T) {
+	queries := map[string]string{
+		`"or"[tiab] OR asthma[tiab]`:   `"or"[title_abstract] OR asthma[title_abstract]`,
+		`asthma[tiab] AND "and"[tiab]`: `asthma[title_abstract] AND "and"[title_abstract]`,
+		`asthma[tiab] NOT "not"[tiab]`: `asthma[title_abstract] NOT "not"[title_abstract]`,
+		`("or"[tiab] OR "and"[tiab])`:  `"or"[title_abstract] OR "and"[title_abstract]`,
+	}
+	for query, expected := range queries {
+		q, err := NewPubMedParser().ParseString(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if q.String() != expected {
+			t.Fatalf("Expected %v for %v, got %v", expected, query, q.String())
+		}
+
+		// The quoted operators are keywords, so there is a single group of two keywords.
+		var groups, keywords int
+		ir.Walk(&q, ir.VisitorFuncs{
+			Query: func(q *ir.BooleanQuery) bool {
+				if len(q.Operator) > 0 {
+					groups++
+				}
+				return true
+			},
+			Keyword: func(k *ir.Keyword) bool {
+				keywords++
+				return true
+			},
+		})
+		if groups != 1 || keywords != 2 {
+			t.Fatalf("Expected a group of two keywords for %v, got %v groups and %v keywords", query, groups, keywords)
+		}
+	}
+}
+
+func TestPubMed_InlineNotes(t *testing.T) {
+	p := NewPubMedParser()
+	p.Parser = PubMedTransformer{InlineNotes: true}
+	queries := map[string]struct {
+		query string
+		notes []string
+	}{
+		`asthma /* chronic */[tiab] OR wheeze[tiab]`: {`asthma[title_abstract] OR wheeze[title_abstract]`, []string{"chronic", ""}},
+		// Operators in a note are part of the note.
+		`asthma /* chronic or mild */ [tiab] AND child* /* population */[tiab]`: {
+			`asthma[title_abstract] AND child*[title_abstract]`, []string{"chronic or mild", "population"},
+		},
+		`heart/* MI */attack[tiab]`: {`heart attack[title_abstract]`, []string{"MI"}},
+	}
+	for query, expected := range queries {
+		q, err := p.ParseString(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if q.String() != expected.query {
+			t.Fatalf("Expected %v for %v, got %v", expected.query, query, q.String())
+		}
+		var notes []string
+		ir.Walk(&q, ir.VisitorFuncs{Keyword: func(k *ir.Keyword) bool {
+			note, _ := k.Options[ir.NoteOption].(string)
+			notes = append(notes, note)
+			return true
+		}})
+		if !reflect.DeepEqual(notes, expected.notes) {
+			t.Fatalf("Expected the notes %v for %v, got %v", expected.notes, query, notes)
+		}
+	}
+
+	// Notes are only read when InlineNotes is set.
+	q, err := NewPubMedParser().ParseString(`asthma/*[tiab]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `asthma/*[title_abstract]`; q.String() != expected {
+		t.Fatalf("Expected %v, got %v", expected, q.String())
+	}
+}
+
+func TestPubMed_LeftToRight(t *testing.T) {
+	// PubMed reads its operators from left to right, and a leading `NOT` excludes its operand from every document.
+	for query, expected := range map[string]string{
+		`a[ti] OR b[ti] AND c[ti]`:   "((a[Title] OR b[Title]) AND c[Title])",
+		`a[ti] AND b[ti] OR c[ti]`:   "((a[Title] AND b[Title]) OR c[Title])",
+		`NOT child[ti]`:              "(all[sb] NOT child[Title])",
+		`NOT child[ti] OR adult[ti]`: "((all[sb] NOT child[Title]) OR adult[Title])",
+	} {
+		q, err := NewPubMedParser().ParseString(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := backend.NewPubmedBackend().Compile(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := c.String()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != expected {
+			t.Fatalf("Expected %v for %v, got %v", expected, query, s)
+		}
+	}
+}
@@ -0,0 +1,414 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/hscells/transmute/backend"
+	"github.com/hscells/transmute/fields"
+	"github.com/hscells/transmute/ir"
+	"github.com/hscells/transmute/lexer"
+)
+
+// explosions collects the explosion of every keyword in a query, keyed by the query string.
+func explosions(q ir.BooleanQuery, e map[string]bool) map[string]bool {
+	for _, keyword := range q.Keywords {
+		e[keyword.QueryString] = keyword.Exploded
+	}
+	for _, child := range q.Children {
+		explosions(child, e)
+	}
+	return e
+}
+
+func TestRoundTrip_Exploded(t *testing.T) {
+	queries := map[string]map[string]bool{
+		`asthma[Mesh]`:                          {"asthma": true},
+		`asthma[Mesh:noexp]`:                    {"asthma": false},
+		`(asthma[Mesh] OR wheeze[Mesh:noexp])`:  {"asthma": true, "wheeze": false},
+		`(asthma[Mesh:noexp] AND wheeze[tiab])`: {"asthma": false, "wheeze": false},
+	}
+
+	for query, expected := range queries {
+		ast, err := lexer.Lex(query, lexOptionsPubMed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q, err := NewPubMedParser().Parse(ast)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range expected {
+			if got := explosions(q, map[string]bool{})[k]; got != v {
+				t.Fatalf("Expected %v to have exploded %v after parsing %v, got %v", k, v, query, got)
+			}
+		}
+
+		// parse -> CQR -> parse
+		c, err := backend.NewCQRBackend().Compile(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := c.String()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cq, err := NewCQRParser().Parse(lexer.Node{Value: s, Reference: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range expected {
+			if got := explosions(cq, map[string]bool{})[k]; got != v {
+				t.Fatalf("Expected %v to have exploded %v after a CQR round trip of %v, got %v", k, v, query, got)
+			}
+		}
+
+		// parse -> Medline -> parse
+		m, err := backend.NewMedlineBackend().Compile(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err = m.String()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ast, err = lexer.Lex(s, lexer.LexOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		mq, err := NewMedlineParser().Parse(ast)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range expected {
+			if got := explosions(mq, map[string]bool{})[k]; got != v {
+				t.Fatalf("Expected %v to have exploded %v after a Medline round trip of %v, got %v", k, v, query, got)
+			}
+		}
+	}
+}
+
+func TestRoundTrip_FloatingSubheadings(t *testing.T) {
+	query := `1. pc.fs.
+2. exp Asthma/
+3. 1 and 2`
+
+	ast, err := lexer.Lex(query, lexer.LexOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := NewMedlineParser().Parse(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := q.FieldCount()[fields.FloatingMeshHeadings]; c != 1 {
+		t.Fatalf("Expected %v floating subheadings, got %v", 1, c)
+	}
+
+	m, err := backend.NewMedlineBackend().Compile(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := m.String()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(s, "pc.fs.") {
+		t.Fatalf("Expected the floating subheading `pc.fs.` in %v", s)
+	}
+
+	ast, err = lexer.Lex(s, lexer.LexOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err = NewMedlineParser().Parse(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := q.FieldCount()[fields.FloatingMeshHeadings]; c != 1 {
+		t.Fatalf("Expected %v floating subheadings after a Medline round trip, got %v", 1, c)
+	}
+}
+
+func TestRoundTrip_AllFields(t *testing.T) {
+	ast, err := lexer.Lex("1. drug.af.", lexer.LexOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := NewMedlineParser().Parse(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := q.FieldCount()[fields.AllFields]; c != 1 {
+		t.Fatalf("Expected %v all fields keywords, got %v", 1, c)
+	}
+
+	m, err := backend.NewMedlineBackend().Compile(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := m.String()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "1. drug.af.\n" {
+		t.Fatalf("Expected %v, got %v", "1. drug.af.\n", s)
+	}
+}
+
+func TestRoundTrip_Phrases(t *testing.T) {
+	// Quoted phrases keep their quotes, so they can be searched as phrases, and unquoted terms stay unquoted.
+	query := `("heart failure"[tiab] OR heart attack[tiab] OR "cardiac arrest*"[tiab])`
+	expected := []string{`"heart failure"`, "heart attack", `"cardiac arrest*"`}
+
+	ast, err := lexer.Lex(query, lexOptionsPubMed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := NewPubMedParser().Parse(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		terms := map[string]bool{}
+		for _, term := range q.Terms() {
+			terms[term] = true
+		}
+		for _, term := range expected {
+			if !terms[term] {
+				t.Fatalf("Expected the term %v in %v", term, q.Terms())
+			}
+		}
+
+		// parse -> PubMed -> parse
+		c, err := backend.NewPubmedBackend().Compile(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := c.String()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ast, err = lexer.Lex(s, lexOptionsPubMed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q, err = NewPubMedParser().Parse(ast)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRoundTrip_Limits(t *testing.T) {
+	query := `1. a.ti,ab.
+2. limit 1 to ("all adult" or "aged")
+3. b.ti,ab.
+4. 2 and 3
+5. limit 4 to english`
+	ast, err := lexer.Lex(query, lexer.LexOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := NewMedlineParser().Parse(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := backend.NewMedlineBackend().Compile(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := m.String()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The order of the keywords is not fixed, so the numbers of the lines are not either.
+	for _, limit := range []string{`limit [0-9]+ to \("all adult" or "aged"\)`, `5\. limit 4 to english`} {
+		if !regexp.MustCompile(limit).MatchString(s) {
+			t.Fatalf("Expected %v in %v", limit, s)
+		}
+	}
+}
+
+func TestRoundTrip_TextWord(t *testing.T) {
+	// `[tw]` searches more fields than `[tiab]`, so the two must not be confused when a query is compiled again.
+	queries := map[string]struct {
+		field   string
+		pubmed  string
+		medline string
+	}{
+		`asthma[tw]`:   {fields.TextWord, "asthma[Text Word]", "asthma.tw."},
+		`asthma[tiab]`: {fields.TitleAbstract, "asthma[Title/Abstract]", "asthma.ti,ab."},
+	}
+
+	for query, expected := range queries {
+		ast, err := lexer.Lex(query, lexOptionsPubMed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q, err := NewPubMedParser().Parse(ast)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f := q.Fields(); len(f) != 1 || f[0] != expected.field {
+			t.Fatalf("Expected [%v] after parsing %v, got %v", expected.field, query, f)
+		}
+
+		// parse -> CQR -> parse -> PubMed
+		c, err := backend.NewCQRBackend().Compile(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := c.String()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cq, err := NewCQRParser().Parse(lexer.Node{Value: s, Reference: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := backend.NewPubmedBackend().Compile(cq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err = p.String()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(s, expected.pubmed) {
+			t.Fatalf("Expected %v after a CQR round trip of %v, got %v", expected.pubmed, query, s)
+		}
+
+		// parse -> PubMed -> parse
+		ast, err = lexer.Lex(s, lexOptionsPubMed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pq, err := NewPubMedParser().Parse(ast)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f := pq.Fields(); len(f) != 1 || f[0] != expected.field {
+			t.Fatalf("Expected [%v] after a PubMed round trip of %v, got %v", expected.field, query, f)
+		}
+
+		// parse -> Medline
+		m, err := backend.NewMedlineBackend().Compile(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err = m.String()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(s, expected.medline) {
+			t.Fatalf("Expected %v after compiling %v to Medline, got %v", expected.medline, query, s)
+		}
+	}
+}
+
+func TestRoundTrip_NotOperands(t *testing.T) {
+	// The operand a `not` excludes from is the first one, so it must stay first when it is a group and the others are
+	// keywords.
+	query := "1. a.ti.\n2. b.ti.\n3. c.ti.\n4. (1 or 2) not 3"
+	expected := "((a[Title] OR b[Title]) NOT c[Title])"
+
+	q, err := NewMedlineParser().ParseString(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		// parse -> PubMed -> parse
+		c, err := backend.NewPubmedBackend().Compile(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := c.String()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != expected {
+			t.Fatalf("Expected %v, got %v", expected, s)
+		}
+		q, err = NewPubMedParser().ParseString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRoundTrip_OptionalWildcard(t *testing.T) {
+	// The optional wildcard of Ovid matches one character or none, so it is searched in Lucene without the character,
+	// or with the wildcard of Lucene for exactly one character. PubMed has no such wildcard, so only known spellings
+	// can be searched.
+	queries := map[string]struct {
+		lucene    string
+		spellings []string
+		pubmed    string
+	}{
+		"colo?r.ti.":    {"(title:color OR title:colo?r)", []string{"color", "colour"}, "(color[Title] OR colour[Title])"},
+		"behavio?r.ti.": {"(title:behavior OR title:behavio?r)", []string{"behavior", "behaviour"}, "(behavior[Title] OR behaviour[Title])"},
+	}
+	for query, expected := range queries {
+		q, err := NewMedlineParser().ParseString("1. " + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(q.Keywords) != 1 || !q.Keywords[0].Truncated || !strings.ContainsRune(q.Keywords[0].QueryString, ir.OptionalWildcard) {
+			t.Fatalf("Expected a keyword with an optional wildcard for %v, got %v", query, q)
+		}
+
+		// parse -> Lucene
+		s, err := backend.RenderKeyword(q.Keywords[0], backend.LuceneTarget)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != expected.lucene {
+			t.Fatalf("Expected %v, got %v", expected.lucene, s)
+		}
+
+		// parse -> PubMed, which warns about the optional wildcard until its spellings are expanded.
+		if warnings := backend.NewPubmedBackend().Validate(q); len(warnings) == 0 {
+			t.Fatalf("Expected a warning for %v", query)
+		}
+		q = q.ExpandTruncation(map[string][]string{q.Keywords[0].QueryString: expected.spellings})
+		if warnings := backend.NewPubmedBackend().Validate(q); len(warnings) != 0 {
+			t.Fatalf("Expected no warnings, got %v", warnings)
+		}
+		c, err := backend.NewPubmedBackend().Compile(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s, err = c.String(); err != nil {
+			t.Fatal(err)
+		} else if s != expected.pubmed {
+			t.Fatalf("Expected %v, got %v", expected.pubmed, s)
+		}
+	}
+}
+
+func TestRoundTrip_Frequency(t *testing.T) {
+	// The minimum frequency of a keyword follows its fields in Medline.
+	query := "1. asthma.ab./freq=3\n"
+	q, err := NewMedlineParser().ParseString(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(q.Keywords) != 1 || q.Keywords[0].QueryString != "asthma" || q.Keywords[0].Options[ir.FrequencyOption] != 3 {
+		t.Fatalf("Expected a keyword with a frequency of 3, got %v", q)
+	}
+
+	// parse -> Medline
+	c, err := backend.NewMedlineBackend().Compile(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := c.String()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != query {
+		t.Fatalf("Expected %v, got %v", query, s)
+	}
+}
@@ -0,0 +1,73 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hscells/transmute/ir"
+	"github.com/hscells/transmute/lexer"
+)
+
+// useRegexp matches the line of an Ovid search that starts the segment for a database, e.g. `use medline` or
+// `12. use embase`.
+var useRegexp, _ = regexp.Compile(`(?i)^(?:#?[0-9]+\.?\s+)?use\s+([a-z0-9_]+)\s*$`)
+
+// ParseSegments parses an Ovid search run across several databases, where each database has its own segment of the
+// search that starts with a `use` line, e.g.:
+//
+//	use medline
+//	1. exp Asthma/
+//	2. asthma.ti,ab.
+//	3. or/1-2
+//	use embase
+//	4. exp asthma/
+//	5. asthma.ti,ab.
+//	6. or/4-5
+//
+// Each segment is lexed and parsed on its own, and the query of each segment is returned keyed by the name of the
+// database in lower case. Lines may be numbered across the whole search, in which case the lines are referenced by
+// their numbers within their segment. An error is returned if there are lines before the first `use` line, if a
+// database has more than one segment, or if a segment is empty.
+func (q QueryParser) ParseSegments(query string, options lexer.LexOptions) (map[string]ir.BooleanQuery, error) {
+	segments := map[string][]string{}
+	var order []string
+	database := ""
+	for _, line := range strings.Split(query, "\n") {
+		if m := useRegexp.FindStringSubmatch(strings.TrimSpace(line)); len(m) == 2 {
+			database = strings.ToLower(m[1])
+			if _, ok := segments[database]; ok {
+				return nil, fmt.Errorf("the database %v has more than one segment", database)
+			}
+			segments[database] = []string{}
+			order = append(order, database)
+			continue
+		}
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+		if len(database) == 0 {
+			return nil, fmt.Errorf("line `%v` is not in the segment of a database", strings.TrimSpace(line))
+		}
+		segments[database] = append(segments[database], line)
+	}
+	if len(order) == 0 {
+		return nil, fmt.Errorf("the query does not have any `use` lines")
+	}
+
+	queries := make(map[string]ir.BooleanQuery, len(order))
+	for _, database := range order {
+		if len(segments[database]) == 0 {
+			return nil, fmt.Errorf("the segment of the database %v is empty", database)
+		}
+		ast, err := lexer.Lex(strings.Join(segments[database], "\n"), options)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", database, err)
+		}
+		queries[database], err = q.Parse(ast)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", database, err)
+		}
+	}
+	return queries, nil
+}
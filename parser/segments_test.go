@@ -0,0 +1,45 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/hscells/transmute/fields"
+	"github.com/hscells/transmute/lexer"
+)
+
+func TestQueryParser_ParseSegments(t *testing.T) {
+	query := `use medline
+1. exp Asthma/
+2. wheez*.ti,ab.
+3. or/1-2
+use Embase
+4. asthma.ti,ab.
+5. wheez*.ti,ab.
+6. child*.ti,ab.
+7. 4 or 5
+8. 6 and 7`
+	queries, err := NewMedlineParser().ParseSegments(query, lexer.LexOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queries) != 2 {
+		t.Fatalf("Expected %v segments, got %v", 2, queries)
+	}
+	if terms := queries["medline"].Terms(); len(terms) != 2 || queries["medline"].FieldCount()[fields.MeshHeadings] != 1 {
+		t.Fatalf("Expected the medline segment to have 2 terms, got %v", queries["medline"])
+	}
+	if terms := queries["embase"].Terms(); len(terms) != 3 {
+		t.Fatalf("Expected the embase segment to have 3 terms, got %v", queries["embase"])
+	}
+
+	for _, invalid := range []string{
+		"1. asthma.ti,ab.\nuse medline\n2. wheez*.ti,ab.",
+		"use medline\n1. asthma.ti,ab.\nuse medline\n2. wheez*.ti,ab.",
+		"use medline\nuse embase\n1. asthma.ti,ab.",
+		"1. asthma.ti,ab.",
+	} {
+		if _, err := NewMedlineParser().ParseSegments(invalid, lexer.LexOptions{}); err == nil {
+			t.Fatalf("Expected an error for %v", invalid)
+		}
+	}
+}
@@ -77,7 +77,10 @@ func (p TransmutePipeline) Execute(query string) (backend.BooleanQuery, error) {
 	}
 
 	// Parse.
-	boolQuery := p.Parser.Parse(ast)
+	boolQuery, err := p.Parser.Parse(ast)
+	if err != nil {
+		return nil, err
+	}
 
 	// Compile.
 	return p.Compiler.Compile(boolQuery)